@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook_manager"
+)
+
+// runConvertCommand implements the `webhook convert` subcommand, which
+// converts a hooks file between JSON and YAML.
+func runConvertCommand(args []string) int {
+	fs := flag.NewFlagSet("convert", flag.ContinueOnError)
+	to := fs.String("to", hook_manager.FormatYAML, "format to convert the hooks file to, json or yaml")
+	output := fs.String("o", "", "write the converted hooks file to the given file instead of stdout")
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(fs.Output(), "Usage: webhook convert [options] <hooks-file>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	var file []byte
+	var err error
+	if path := fs.Arg(0); path == "-" {
+		file, err = io.ReadAll(os.Stdin)
+	} else {
+		file, err = os.ReadFile(path)
+	}
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "error reading hooks file:", err)
+		return 1
+	}
+
+	converted, err := hook_manager.Convert(file, *to)
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "error converting hooks file:", err)
+		return 1
+	}
+	if *output == "" {
+		_, _ = os.Stdout.Write(converted)
+		return 0
+	}
+	if err := os.WriteFile(*output, converted, 0o644); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "error writing hooks file:", err)
+		return 1
+	}
+	return 0
+}
@@ -1,4 +1,4 @@
-// +build linux windows
+//go:build windows
 
 package main
 
@@ -7,6 +7,6 @@ import (
 	"runtime"
 )
 
-func dropPrivileges(uid, gid int) error {
+func dropPrivileges(uid, gid int, groups []int) error {
 	return errors.New("setuid and setgid not supported on " + runtime.GOOS)
 }
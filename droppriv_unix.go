@@ -1,4 +1,4 @@
-// +build !windows,!linux
+//go:build !windows
 
 package main
 
@@ -6,8 +6,14 @@ import (
 	"syscall"
 )
 
-func dropPrivileges(uid, gid int) error {
-	err := syscall.Setgid(gid)
+// dropPrivileges switches to the given user, group and supplementary groups.
+func dropPrivileges(uid, gid int, groups []int) error {
+	err := syscall.Setgroups(groups)
+	if err != nil {
+		return err
+	}
+
+	err = syscall.Setgid(gid)
 	if err != nil {
 		return err
 	}
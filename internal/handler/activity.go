@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+// Types of activity events.
+const (
+	ActivityTriggered = "triggered"
+	ActivityStarted   = "started"
+	ActivityFinished  = "finished"
+	ActivityFailed    = "failed"
+)
+
+const (
+	activityBufferSize     = 64
+	activityKeepAlivePause = 30 * time.Second
+)
+
+// ActivityEvent describes a step of a hook execution.
+type ActivityEvent struct {
+	Type      string    `json:"type"`
+	Time      time.Time `json:"time"`
+	HookID    string    `json:"hook_id"`
+	RequestID string    `json:"request_id,omitempty"`
+	Route     string    `json:"route,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	// Duration of the command in milliseconds, set for finished and failed events.
+	Duration int64 `json:"duration_ms,omitempty"`
+}
+
+// ActivityFeed broadcasts the activity of all hooks to its subscribers.
+// Subscribers which can't keep up lose events rather than delaying
+// executions. A nil feed discards all events.
+type ActivityFeed struct {
+	mu          sync.Mutex
+	subscribers map[chan ActivityEvent]struct{}
+}
+
+func NewActivityFeed() *ActivityFeed {
+	return &ActivityFeed{subscribers: make(map[chan ActivityEvent]struct{})}
+}
+
+// Publish sends the event to all current subscribers.
+func (f *ActivityFeed) Publish(event ActivityEvent) {
+	if f == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for ch := range f.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// triggered publishes that the request satisfied the trigger rules of the hook.
+func (f *ActivityFeed) triggered(h *hook.Hook, r *hook.Request) {
+	f.Publish(ActivityEvent{Type: ActivityTriggered, HookID: h.ID, RequestID: r.ID, Route: r.Route})
+}
+
+// Subscribe registers a new subscriber. The returned function cancels the
+// subscription.
+func (f *ActivityFeed) Subscribe() (<-chan ActivityEvent, func()) {
+	ch := make(chan ActivityEvent, activityBufferSize)
+	f.mu.Lock()
+	f.subscribers[ch] = struct{}{}
+	f.mu.Unlock()
+	return ch, func() {
+		f.mu.Lock()
+		delete(f.subscribers, ch)
+		f.mu.Unlock()
+	}
+}
+
+// ServeHTTP streams the events as server-sent events until the client
+// disconnects. The hook query parameter restricts the stream to a single hook.
+func (f *ActivityFeed) ServeHTTP(w http.ResponseWriter, request *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = fmt.Fprint(w, "Streaming is not supported.")
+		return
+	}
+	hookID := request.URL.Query().Get("hook")
+	events, cancel := f.Subscribe()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(activityKeepAlivePause)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-request.Context().Done():
+			return
+		case <-keepAlive.C:
+			// comments keep proxies from closing idle connections
+			_, _ = fmt.Fprint(w, ": keep-alive\n\n")
+		case event := <-events:
+			if hookID != "" && event.HookID != hookID {
+				continue
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			_, _ = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+		}
+		flusher.Flush()
+	}
+}
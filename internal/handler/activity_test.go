@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+func TestActivityFeedServeHTTP(t *testing.T) {
+	feed := NewActivityFeed()
+	server := httptest.NewServer(feed)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"?hook=deploy", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+
+	// the subscription is registered before the headers are sent
+	h := &hook.Hook{ID: "deploy", ExecuteCommand: "false"}
+	feed.Publish(ActivityEvent{Type: ActivityTriggered, HookID: "other"})
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	_ = NewExecutor(h, &hook.Request{ID: "req-1"}, logger).WithActivity(feed).Execute(ctx, io.Discard)
+
+	var events []ActivityEvent
+	scanner := bufio.NewScanner(resp.Body)
+	var eventType string
+	for len(events) < 2 && scanner.Scan() {
+		line := scanner.Text()
+		if v, ok := strings.CutPrefix(line, "event: "); ok {
+			eventType = v
+		}
+		if v, ok := strings.CutPrefix(line, "data: "); ok {
+			var event ActivityEvent
+			if err := json.Unmarshal([]byte(v), &event); err != nil {
+				t.Fatalf("error decoding event %q: %s", v, err)
+			}
+			if event.Type != eventType {
+				t.Errorf("event name %q does not match type %q", eventType, event.Type)
+			}
+			events = append(events, event)
+		}
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %+v", events)
+	}
+	if events[0].Type != ActivityStarted || events[0].HookID != "deploy" || events[0].RequestID != "req-1" {
+		t.Errorf("unexpected start event %+v", events[0])
+	}
+	if events[1].Type != ActivityFailed || events[1].Error == "" {
+		t.Errorf("unexpected outcome event %+v", events[1])
+	}
+}
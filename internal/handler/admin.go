@@ -0,0 +1,247 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook_manager"
+	"github.com/kaufland-ecommerce/ci-webhook/internal/middleware"
+)
+
+// TriggerRequest is the body accepted by the manual trigger endpoint.
+type TriggerRequest struct {
+	Payload map[string]interface{} `json:"payload,omitempty"`
+	Headers map[string]string      `json:"headers,omitempty"`
+	Query   map[string]string      `json:"query,omitempty"`
+	// Host and URLPrefix address hooks bound to a host or served under
+	// their own URL prefix, like requests to the hooks do.
+	Host      string `json:"host,omitempty"`
+	URLPrefix string `json:"url_prefix,omitempty"`
+}
+
+// AdminHandler serves the operator endpoints mounted under the admin prefix.
+type AdminHandler struct {
+	hookManager *hook_manager.Manager
+	scheduler   *Scheduler
+	activity    *ActivityFeed
+	lastRuns    *LastRuns
+	circuits    *CircuitBreakers
+	processes   *Processes
+	debug       *DebugHooks
+	logger      *slog.Logger
+}
+
+func NewAdminHandler(hookManager *hook_manager.Manager, scheduler *Scheduler, activity *ActivityFeed, lastRuns *LastRuns, circuits *CircuitBreakers, processes *Processes, debug *DebugHooks, logger *slog.Logger) *AdminHandler {
+	return &AdminHandler{
+		hookManager: hookManager,
+		scheduler:   scheduler,
+		activity:    activity,
+		lastRuns:    lastRuns,
+		circuits:    circuits,
+		processes:   processes,
+		debug:       debug,
+		logger:      logger,
+	}
+}
+
+// Routes returns the router serving all admin endpoints.
+func (a *AdminHandler) Routes() http.Handler {
+	r := chi.NewRouter()
+	r.Post("/hooks/*", a.ServeTrigger)
+	r.Put("/hooks/*", a.ServeDebug)
+	r.Delete("/hooks/*", a.ServeDebug)
+	r.Post("/reload", a.ServeReload)
+	r.Get("/config/version", a.ServeConfigVersion)
+	r.Get("/circuits", a.ServeCircuits)
+	return r
+}
+
+// ServeReload reloads the hooks, only of the hooks file given by the file
+// query parameter if present, and responds with the added, removed and
+// changed hooks.
+func (a *AdminHandler) ServeReload(w http.ResponseWriter, request *http.Request) {
+	file := request.URL.Query().Get("file")
+	requestLog := a.logger.With("http.request_id", middleware.GetReqID(request.Context()))
+	var (
+		diff hook_manager.Diff
+		err  error
+	)
+	if file == "" {
+		requestLog.Info("reloading all hooks files")
+		diff, err = a.hookManager.Reload()
+	} else {
+		requestLog.Info("reloading hooks file", "path", file)
+		diff, err = a.hookManager.ReloadFile(file)
+	}
+	if errors.Is(err, hook_manager.ErrFileNotLoaded) {
+		requestLog.Warn("error reloading hooks file", "error", err)
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = fmt.Fprint(w, "Hooks file not loaded.")
+		return
+	}
+	if err != nil {
+		requestLog.Warn("error reloading hooks, keeping the previous configuration", "error", err)
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_, _ = fmt.Fprintf(w, "Reload failed, keeping the previous configuration: %s", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(diff)
+}
+
+// ServeConfigVersion responds with the checksums and load times of the loaded
+// hooks files.
+func (a *AdminHandler) ServeConfigVersion(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(a.hookManager.Version())
+}
+
+// ServeCircuits responds with the circuits of the hooks with a circuit
+// breaker.
+func (a *AdminHandler) ServeCircuits(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(a.circuits.status(time.Now()))
+}
+
+// ServeDebug enables (PUT) or disables (DELETE) dumping the requests and
+// responses of the hook addressed by /hooks/{id}/debug.
+func (a *AdminHandler) ServeDebug(w http.ResponseWriter, request *http.Request) {
+	hookID, ok := strings.CutSuffix(chi.URLParam(request, "*"), "/debug")
+	if !ok {
+		http.NotFound(w, request)
+		return
+	}
+	if a.hookManager.Get(hookID) == nil {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = fmt.Fprint(w, "Hook not found.")
+		return
+	}
+	enabled := request.Method == http.MethodPut
+	a.debug.Set(hookID, enabled)
+	a.logger.Info("hook debugging toggled",
+		"http.request_id", middleware.GetReqID(request.Context()),
+		"hook_id", hookID,
+		"enabled", enabled,
+	)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ServeTrigger runs the hook addressed by /hooks/{id}/trigger with the
+// synthetic payload from the request body. The hook is resolved like for
+// requests to the host and URL prefix of the trigger request. Trigger rules
+// are not evaluated, the caller is already authenticated as an operator.
+func (a *AdminHandler) ServeTrigger(w http.ResponseWriter, request *http.Request) {
+	hookID, ok := strings.CutSuffix(chi.URLParam(request, "*"), "/trigger")
+	if !ok {
+		http.NotFound(w, request)
+		return
+	}
+	requestLog := a.logger.With(
+		"http.request_id", middleware.GetReqID(request.Context()),
+		"hook_id", hookID,
+	)
+
+	var tr TriggerRequest
+	if request.ContentLength != 0 {
+		decoder := json.NewDecoder(request.Body)
+		decoder.UseNumber()
+		if err := decoder.Decode(&tr); err != nil {
+			requestLog.Warn("error parsing manual trigger request", "error", err)
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprint(w, "Error parsing trigger request.")
+			return
+		}
+	}
+	base := (&hook.Hook{URLPrefix: tr.URLPrefix}).URLBase()
+	matchedHook := a.hookManager.GetForPath(tr.Host, base, hookID)
+	if matchedHook == nil {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = fmt.Fprint(w, "Hook not found.")
+		return
+	}
+
+	hookRequest, err := tr.hookRequest(middleware.GetReqID(request.Context()), request)
+	if err != nil {
+		requestLog.Warn("error preparing manual trigger request", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = fmt.Fprint(w, "Error parsing trigger request.")
+		return
+	}
+	// values captured by an ID pattern are available as arguments
+	_, hookRequest.IDMatch = matchedHook.MatchID(hookID)
+	if err := matchedHook.ParseJSONParameters(hookRequest); err != nil {
+		requestLog.Error("error parsing JSON parameters", "error", err)
+	}
+	transformPayload(matchedHook, hookRequest, requestLog)
+
+	requestLog.Info("hook triggered manually")
+	a.activity.triggered(matchedHook, hookRequest)
+	release, err := a.scheduler.Acquire(request.Context(), matchedHook)
+	if errors.Is(err, ErrHookRunning) {
+		w.WriteHeader(http.StatusConflict)
+		_, _ = fmt.Fprint(w, "Hook is already running.")
+		return
+	}
+	if err != nil {
+		requestLog.Error("error scheduling hook execution", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = fmt.Fprint(w, "Error occurred while scheduling the hook's command.")
+		return
+	}
+	defer release()
+	buf := &bytes.Buffer{}
+	executor := NewExecutor(matchedHook, hookRequest, requestLog).
+		WithChaining(a.hookManager).
+		WithActivity(a.activity).
+		WithLastRuns(a.lastRuns).
+		WithCircuits(a.circuits).
+		WithProcesses(a.processes)
+	if err := executor.Execute(request.Context(), buf); err != nil {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	_, _ = w.Write(buf.Bytes())
+}
+
+// hookRequest converts the trigger request into a hook request as if it had
+// been delivered with a JSON body.
+func (tr *TriggerRequest) hookRequest(id string, raw *http.Request) (*hook.Request, error) {
+	if tr.Payload == nil {
+		tr.Payload = make(map[string]interface{})
+	}
+	body, err := json.Marshal(tr.Payload)
+	if err != nil {
+		return nil, err
+	}
+	headers := make(http.Header, len(tr.Headers))
+	for k, v := range tr.Headers {
+		headers.Set(k, v)
+	}
+	query := make(url.Values, len(tr.Query))
+	for k, v := range tr.Query {
+		query.Set(k, v)
+	}
+
+	r := &hook.Request{
+		ID:          id,
+		ContentType: "application/json",
+		Body:        body,
+		Payload:     tr.Payload,
+		RawRequest:  raw,
+		ReceivedAt:  time.Now(),
+		Route:       chi.RouteContext(raw.Context()).RoutePattern(),
+	}
+	r.ParseHeaders(headers)
+	r.ParseQuery(query)
+	return r, nil
+}
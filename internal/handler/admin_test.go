@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook_manager"
+)
+
+func TestAdminServeTrigger(t *testing.T) {
+	hooksFile := filepath.Join(t.TempDir(), "hooks.json")
+	if err := os.WriteFile(hooksFile, []byte(`[
+		{"id": "deploy", "execute-command": "echo", "pass-arguments-to-command": [{"source": "string", "name": "global"}]},
+		{"id": "deploy", "host": "a.example.com", "execute-command": "echo", "pass-arguments-to-command": [{"source": "string", "name": "host"}]},
+		{"id": "deploy", "url-prefix": "team", "execute-command": "echo", "pass-arguments-to-command": [{"source": "string", "name": "prefix"}]},
+		{"id": "release-*", "execute-command": "echo", "pass-arguments-to-command": [{"source": "id-match", "name": "1"}]}
+	]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hooks := hook_manager.NewManager(ctx, hook_manager.HooksFiles{hooksFile}, false, false)
+	if err := hooks.Load(); err != nil {
+		t.Fatal(err)
+	}
+	routes := NewAdminHandler(hooks, NewScheduler(0), nil, nil, nil, nil, nil, slog.New(slog.DiscardHandler)).Routes()
+
+	for _, tt := range []struct {
+		name, id, body string
+		status         int
+		output         string
+	}{
+		{"global", "deploy", ``, 200, "global\n"},
+		{"host", "deploy", `{"host": "A.example.com:9000"}`, 200, "host\n"},
+		{"unbound host", "deploy", `{"host": "b.example.com"}`, 200, "global\n"},
+		{"url prefix", "deploy", `{"url_prefix": "/team/"}`, 200, "prefix\n"},
+		{"unknown url prefix", "deploy", `{"url_prefix": "other"}`, 404, "Hook not found."},
+		{"pattern", "release-v1.2", ``, 200, "v1.2\n"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			routes.ServeHTTP(rec, httptest.NewRequest("POST", "/hooks/"+tt.id+"/trigger", strings.NewReader(tt.body)))
+			if rec.Code != tt.status || rec.Body.String() != tt.output {
+				t.Errorf("expected %d %q, got %d %q", tt.status, tt.output, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// collectArtifacts returns the files in dir matching any of the glob
+// patterns which were modified since the given time, relative to dir.
+func collectArtifacts(dir string, patterns []string, since time.Time) ([]string, error) {
+	if dir == "" {
+		dir = "."
+	}
+	// file systems with a coarse modification time resolution
+	since = since.Truncate(time.Second)
+
+	var files []string
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, fmt.Errorf("invalid artifact pattern %q: %w", pattern, err)
+		}
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil || !info.Mode().IsRegular() || info.ModTime().Before(since) {
+				continue
+			}
+			rel, err := filepath.Rel(dir, match)
+			if err != nil {
+				return nil, err
+			}
+			if !slices.Contains(files, rel) {
+				files = append(files, rel)
+			}
+		}
+	}
+	return files, nil
+}
+
+// writeArtifactsZip writes a zip archive of the given files in dir to w.
+func writeArtifactsZip(w io.Writer, dir string, files []string) error {
+	zw := zip.NewWriter(w)
+	for _, name := range files {
+		if err := addZipFile(zw, filepath.Join(dir, name), filepath.ToSlash(name)); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func addZipFile(zw *zip.Writer, path, name string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+	fw, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fw, f)
+	return err
+}
+
+// writeArtifacts responds with a zip archive of the artifacts the command
+// produced since it was started.
+func (rec *requestExecutionContext) writeArtifacts(started time.Time) {
+	files, err := collectArtifacts(rec.hook.CommandWorkingDirectory, rec.hook.CollectArtifacts, started)
+	if err != nil {
+		rec.logger.Error("error collecting artifacts", "error", err)
+		rec.writeError(http.StatusInternalServerError, ErrorCodeArtifactsFailed, "Error occurred while collecting the hook's artifacts.")
+		return
+	}
+	rec.logger.Info("returning artifacts", "files", files)
+
+	header := rec.httpResponse.Header()
+	header.Set("Content-Type", "application/zip")
+	header.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-artifacts.zip"`, rec.hook.ID))
+	rec.writeHttpStatus(rec.hook.SuccessHttpResponseCode)
+	if err := writeArtifactsZip(rec.httpResponse, rec.hook.CommandWorkingDirectory, files); err != nil {
+		// the status is already sent, the client gets a truncated archive
+		rec.logger.Error("error writing artifacts", "error", err)
+	}
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCollectArtifacts(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string, modTime time.Time) {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	started := time.Now()
+	write("report.xml", "<report/>", started)
+	write("logs/build.log", "ok", started)
+	write("logs/old.log", "stale", started.Add(-time.Hour))
+	write("notes.txt", "unmatched", started)
+
+	files, err := collectArtifacts(dir, []string{"*.xml", "logs/*.log", "report.*"}, started)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []string{"report.xml", filepath.Join("logs", "build.log")}
+	if !reflect.DeepEqual(files, expected) {
+		t.Fatalf("expected %v, got %v", expected, files)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := writeArtifactsZip(buf, dir, files); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("invalid zip archive: %s", err)
+	}
+	contents := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(rc)
+		_ = rc.Close()
+		contents[f.Name] = string(data)
+	}
+	expectedContents := map[string]string{"report.xml": "<report/>", "logs/build.log": "ok"}
+	if !reflect.DeepEqual(contents, expectedContents) {
+		t.Errorf("expected archive %v, got %v", expectedContents, contents)
+	}
+
+	if _, err := collectArtifacts(dir, []string{"["}, started); err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+}
@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+// ErrNotABatch is returned for batch hooks whose payload holds no event array.
+var ErrNotABatch = errors.New("payload does not contain a batch of events")
+
+// batchResult summarizes the per-event executions of a batched payload.
+type batchResult struct {
+	Events    int                `json:"events"`
+	Succeeded int                `json:"succeeded"`
+	Failed    int                `json:"failed"`
+	Results   []batchEventResult `json:"results"`
+}
+
+type batchEventResult struct {
+	Index  int    `json:"index"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	Output string `json:"output,omitempty"`
+}
+
+// batchEvents returns the events found at the batch path of the payload.
+func batchEvents(h *hook.Hook, r *hook.Request) ([]interface{}, error) {
+	path := h.Batch.Path
+	if path == "" {
+		path = hook.DefaultBatchPath
+	}
+	v, err := hook.GetParameter(path, r.Payload)
+	if err != nil {
+		return nil, ErrNotABatch
+	}
+	events, ok := v.([]interface{})
+	if !ok {
+		return nil, ErrNotABatch
+	}
+	return events, nil
+}
+
+// executeBatch runs the command of the hook once for every event of the
+// batch. Each execution sees the event as its payload, while headers, query
+// and the raw request are shared. Events run one after another. They count
+// towards the circuit breaker of the hook, but are not tracked as its last
+// run, as they are parts of a single delivery.
+func executeBatch(ctx context.Context, h *hook.Hook, r *hook.Request, events []interface{}, lookup HookLookup, activity *ActivityFeed, circuits *CircuitBreakers, processes *Processes, logger *slog.Logger) *batchResult {
+	result := &batchResult{
+		Events:  len(events),
+		Results: make([]batchEventResult, 0, len(events)),
+	}
+	for i, event := range events {
+		eventRequest := *r
+		eventRequest.Payload = eventPayload(event)
+		eventLogger := logger.With("batch_index", i)
+		if err := h.ParseJSONParameters(&eventRequest); err != nil {
+			eventLogger.Error("error parsing JSON parameters", "error", err)
+		}
+
+		buf := &bytes.Buffer{}
+		err := NewExecutor(h, &eventRequest, eventLogger).WithChaining(lookup).WithActivity(activity).WithCircuits(circuits).WithProcesses(processes).Execute(ctx, buf)
+		res := batchEventResult{Index: i, Status: "success"}
+		if err != nil {
+			res.Status = "failure"
+			res.Error = err.Error()
+			result.Failed++
+		} else {
+			result.Succeeded++
+		}
+		if h.CaptureCommandOutput || (err != nil && h.CaptureCommandOutputOnError) {
+			res.Output = buf.String()
+		}
+		result.Results = append(result.Results, res)
+	}
+	logger.Info("batch executed", "events", result.Events, "failed", result.Failed)
+	return result
+}
+
+// eventPayload returns the payload of a single event. Events which are not
+// objects are exposed as "root", like top-level JSON arrays.
+func eventPayload(event interface{}) map[string]interface{} {
+	if m, ok := event.(map[string]interface{}); ok {
+		return m
+	}
+	return map[string]interface{}{"root": event}
+}
+
+// executeBatch runs the batch of the request and responds with its summary.
+func (rec *requestExecutionContext) executeBatch(ctx context.Context) {
+	events, err := batchEvents(rec.hook, rec.hookRequest)
+	if err != nil {
+		rec.logger.Warn("error reading batch events", "error", err)
+		rec.writeError(http.StatusBadRequest, ErrorCodeInvalidBatch, "Payload does not contain a batch of events.")
+		return
+	}
+	result := executeBatch(ctx, rec.hook, rec.hookRequest, events, rec.hookManager, rec.activity, rec.circuits, rec.processes, rec.logger)
+	body, err := json.Marshal(result)
+	if err != nil {
+		rec.writeError(http.StatusInternalServerError, ErrorCodeInternal, fmt.Sprintf("Error encoding batch result: %s", err))
+		return
+	}
+	rec.httpResponse.Header().Set("Content-Type", "application/json")
+	if result.Failed > 0 {
+		rec.httpResponse.WriteHeader(http.StatusInternalServerError)
+	} else {
+		rec.writeHttpStatus(rec.hook.SuccessHttpResponseCode)
+	}
+	rec.writeResponseBody(string(body))
+}
@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+// ErrCircuitOpen is returned for executions of hooks whose circuit breaker
+// stopped executing them.
+var ErrCircuitOpen = errors.New("circuit of the hook is open")
+
+// States of circuits.
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+// circuit tracks the consecutive failures of a hook.
+type circuit struct {
+	hookID   string
+	cooldown time.Duration
+	failures int
+	openedAt time.Time
+	// trialAt is the start of the trial execution of a half-open circuit
+	trialAt time.Time
+}
+
+// CircuitStatus is the state of the circuit of a hook, as shown by the admin
+// API.
+type CircuitStatus struct {
+	HookID   string     `json:"hook_id"`
+	Host     string     `json:"host,omitempty"`
+	URLBase  string     `json:"url_base,omitempty"`
+	State    string     `json:"state"`
+	Failures int        `json:"failures"`
+	OpenedAt *time.Time `json:"opened_at,omitempty"`
+	RetryAt  *time.Time `json:"retry_at,omitempty"`
+}
+
+// CircuitBreakers holds the circuits of the hooks with a circuit breaker by
+// their route, see hook.RouteKey. A nil CircuitBreakers never stops executions.
+type CircuitBreakers struct {
+	mu       sync.Mutex
+	circuits map[[3]string]*circuit
+}
+
+func NewCircuitBreakers() *CircuitBreakers {
+	return &CircuitBreakers{circuits: make(map[[3]string]*circuit)}
+}
+
+// allow returns whether the hook may be executed. Once the cooldown of an open
+// circuit elapsed, it is half-open and lets a single trial execution through;
+// if it doesn't finish within another cooldown, the next one is let through.
+// Otherwise, it returns the time to wait before retrying.
+func (b *CircuitBreakers) allow(h *hook.Hook, now time.Time) (time.Duration, bool) {
+	if b == nil || h.CircuitBreaker == nil {
+		return 0, true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c, ok := b.circuits[h.RouteKey()]
+	if !ok || c.openedAt.IsZero() {
+		return 0, true
+	}
+	cooldown := h.CircuitBreaker.CooldownOrDefault()
+	since := c.openedAt
+	if c.trialAt.After(since) {
+		since = c.trialAt
+	}
+	if wait := since.Add(cooldown).Sub(now); wait > 0 {
+		return wait, false
+	}
+	c.trialAt = now
+	return 0, true
+}
+
+// record counts the result of the execution of the hook and returns whether
+// it opened the circuit.
+func (b *CircuitBreakers) record(h *hook.Hook, err error, now time.Time) bool {
+	if b == nil || h.CircuitBreaker == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	key := h.RouteKey()
+	c, ok := b.circuits[key]
+	if !ok {
+		c = &circuit{hookID: h.ID}
+		b.circuits[key] = c
+	}
+	c.cooldown = h.CircuitBreaker.CooldownOrDefault()
+	if err == nil {
+		c.failures, c.openedAt, c.trialAt = 0, time.Time{}, time.Time{}
+		return false
+	}
+	c.failures++
+	// failed trials open the circuit again
+	if c.failures >= h.CircuitBreaker.Failures || !c.openedAt.IsZero() {
+		c.openedAt, c.trialAt = now, time.Time{}
+		return true
+	}
+	return false
+}
+
+// status returns the circuits of all hooks with a circuit breaker which were
+// executed since webhook started, ordered by hook ID.
+func (b *CircuitBreakers) status(now time.Time) []CircuitStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	result := make([]CircuitStatus, 0, len(b.circuits))
+	for key, c := range b.circuits {
+		s := CircuitStatus{HookID: c.hookID, Host: key[0], URLBase: key[1], State: CircuitClosed, Failures: c.failures}
+		if !c.openedAt.IsZero() {
+			openedAt := c.openedAt
+			s.OpenedAt = &openedAt
+			s.State = CircuitOpen
+			retryAt := openedAt.Add(c.cooldown)
+			if c.trialAt.After(openedAt) {
+				retryAt = c.trialAt.Add(c.cooldown)
+			}
+			s.RetryAt = &retryAt
+			if !now.Before(openedAt.Add(c.cooldown)) {
+				s.State = CircuitHalfOpen
+			}
+		}
+		result = append(result, s)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].HookID < result[j].HookID })
+	return result
+}
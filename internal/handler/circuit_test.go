@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	b := NewCircuitBreakers()
+	h := &hook.Hook{ID: "deploy", CircuitBreaker: &hook.CircuitBreaker{Failures: 2, Cooldown: hook.Duration(time.Minute)}}
+	failed := errors.New("exit status 1")
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	state := func() string {
+		t.Helper()
+		status := b.status(now)
+		if len(status) != 1 {
+			t.Fatalf("expected a single circuit, got %+v", status)
+		}
+		return status[0].State
+	}
+
+	if b.record(h, failed, now) {
+		t.Error("expected the first failure not to open the circuit")
+	}
+	if _, ok := b.allow(h, now); !ok || state() != CircuitClosed {
+		t.Error("expected the circuit to be closed")
+	}
+	if !b.record(h, failed, now) {
+		t.Error("expected the second failure to open the circuit")
+	}
+	if wait, ok := b.allow(h, now.Add(10*time.Second)); ok || wait != 50*time.Second {
+		t.Errorf("expected the open circuit to reject for 50s, got %s, %t", wait, ok)
+	}
+	if state() != CircuitOpen {
+		t.Errorf("expected the circuit to be open, got %s", state())
+	}
+
+	// after the cooldown, a single trial is let through
+	now = now.Add(time.Minute)
+	if state() != CircuitHalfOpen {
+		t.Errorf("expected the circuit to be half-open, got %s", state())
+	}
+	if _, ok := b.allow(h, now); !ok {
+		t.Error("expected the trial execution to be allowed")
+	}
+	if _, ok := b.allow(h, now.Add(time.Second)); ok {
+		t.Error("expected executions during the trial to be rejected")
+	}
+	if !b.record(h, failed, now.Add(time.Second)) {
+		t.Error("expected the failed trial to open the circuit again")
+	}
+	if _, ok := b.allow(h, now.Add(30*time.Second)); ok {
+		t.Error("expected the reopened circuit to reject")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, ok := b.allow(h, now); !ok {
+		t.Error("expected the trial execution to be allowed")
+	}
+	b.record(h, nil, now)
+	if _, ok := b.allow(h, now); !ok || state() != CircuitClosed {
+		t.Error("expected the successful trial to close the circuit")
+	}
+
+	// hooks without a circuit breaker are not tracked
+	other := &hook.Hook{ID: "other"}
+	b.record(other, failed, now)
+	if _, ok := b.allow(other, now); !ok || len(b.status(now)) != 1 {
+		t.Error("expected hooks without circuit breaker to be ignored")
+	}
+}
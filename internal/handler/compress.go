@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// acceptsGzip returns whether the Accept-Encoding header of the request lists
+// gzip, or any encoding, with a non-zero quality.
+func acceptsGzip(request *http.Request) bool {
+	for _, accept := range request.Header.Values("Accept-Encoding") {
+		for _, coding := range strings.Split(accept, ",") {
+			name, params, err := mime.ParseMediaType("x/" + strings.TrimSpace(coding))
+			if err != nil || (name != "x/gzip" && name != "x/*") {
+				continue
+			}
+			if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+				continue
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// gzipResponseWriter buffers a response and compresses it with gzip when it
+// is complete, if the body reaches the minimum size.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	minSize int
+	status  int
+	buf     bytes.Buffer
+}
+
+func (g *gzipResponseWriter) WriteHeader(status int) {
+	if g.status == 0 {
+		g.status = status
+	}
+}
+
+func (g *gzipResponseWriter) Write(p []byte) (int, error) {
+	g.WriteHeader(http.StatusOK)
+	return g.buf.Write(p)
+}
+
+// Close sends the buffered response, compressed if it is large enough and
+// not encoded already.
+func (g *gzipResponseWriter) Close() {
+	if g.status == 0 {
+		return
+	}
+	header := g.ResponseWriter.Header()
+	if g.buf.Len() < g.minSize || header.Get("Content-Encoding") != "" {
+		g.ResponseWriter.WriteHeader(g.status)
+		_, _ = g.ResponseWriter.Write(g.buf.Bytes())
+		return
+	}
+	header.Set("Content-Encoding", "gzip")
+	header.Del("Content-Length")
+	g.ResponseWriter.WriteHeader(g.status)
+	zw := gzip.NewWriter(g.ResponseWriter)
+	_, _ = zw.Write(g.buf.Bytes())
+	_ = zw.Close()
+}
+
+// compressResponse replaces the response writer with one compressing the
+// response with gzip, if compression is enabled and the client accepts it.
+// The returned function sends the response and has to be called once it is
+// written. Stored idempotent responses are never compressed, as they may be
+// replayed to other clients.
+func (rec *requestExecutionContext) compressResponse() func() {
+	if rec.opts.compressMinSize <= 0 {
+		return func() {}
+	}
+	rec.httpResponse.Header().Add("Vary", "Accept-Encoding")
+	if _, idempotent := rec.idempotencyKey(); idempotent || !acceptsGzip(rec.httpRequest) {
+		return func() {}
+	}
+	gw := &gzipResponseWriter{ResponseWriter: rec.httpResponse, minSize: rec.opts.compressMinSize}
+	rec.httpResponse = gw
+	return gw.Close
+}
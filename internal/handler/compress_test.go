@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+	for accept, expected := range map[string]bool{
+		"":                      false,
+		"identity":              false,
+		"gzip":                  true,
+		"deflate, gzip;q=0.5":   true,
+		"br, *":                 true,
+		"gzip;q=0":              false,
+		"gzip;q=0, deflate":     false,
+		"x-gzip-custom, brotli": false,
+	} {
+		request := httptest.NewRequest(http.MethodPost, "/hooks/test", nil)
+		request.Header.Set("Accept-Encoding", accept)
+		if acceptsGzip(request) != expected {
+			t.Errorf("expected %v for Accept-Encoding %q", expected, accept)
+		}
+	}
+}
+
+func TestCompressResponse(t *testing.T) {
+	output := strings.Repeat("build step done\n", 100)
+	for _, tt := range []struct {
+		desc       string
+		minSize    int
+		accept     string
+		body       string
+		compressed bool
+	}{
+		{"disabled", 0, "gzip", output, false},
+		{"not accepted", 10, "", output, false},
+		{"too small", 10, "gzip", "ok", false},
+		{"compressed", 10, "gzip", output, true},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/hooks/test", nil)
+			request.Header.Set("Accept-Encoding", tt.accept)
+			rr := httptest.NewRecorder()
+			rec := &requestExecutionContext{
+				hook:         &hook.Hook{ID: "test"},
+				hookRequest:  &hook.Request{},
+				httpRequest:  request,
+				httpResponse: rr,
+				opts:         options{compressMinSize: tt.minSize},
+			}
+			done := rec.compressResponse()
+			rec.httpResponse.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			rec.writeResponse(http.StatusAccepted, tt.body)
+			done()
+
+			if rr.Code != http.StatusAccepted {
+				t.Errorf("expected status %d, got %d", http.StatusAccepted, rr.Code)
+			}
+			body := rr.Body.String()
+			if encoding := rr.Header().Get("Content-Encoding"); (encoding == "gzip") != tt.compressed {
+				t.Fatalf("unexpected Content-Encoding %q", encoding)
+			}
+			if tt.compressed {
+				zr, err := gzip.NewReader(rr.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				b, _ := io.ReadAll(zr)
+				body = string(b)
+			}
+			if body != tt.body {
+				t.Errorf("unexpected body %q", body)
+			}
+			if vary := rr.Header().Get("Vary"); (vary == "Accept-Encoding") != (tt.minSize > 0) {
+				t.Errorf("unexpected Vary header %q", vary)
+			}
+		})
+	}
+}
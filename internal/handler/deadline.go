@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// errBodyReadTimeout is returned by ParseRequest when the client didn't send
+// the request body within the body read timeout.
+var errBodyReadTimeout = errors.New("timed out reading the request body")
+
+// bodyReadTimeout returns the time the client has to send the request body,
+// either configured by the hook or by default. Zero doesn't limit it.
+func (rec *requestExecutionContext) bodyReadTimeout() time.Duration {
+	if rec.hook.BodyReadTimeout > 0 {
+		return time.Duration(rec.hook.BodyReadTimeout)
+	}
+	return rec.opts.bodyReadTimeout
+}
+
+// setBodyReadDeadline limits the time reading the request body and returns a
+// function lifting the limit again. Bodies streamed to the command are read
+// during the execution and are not limited.
+func (rec *requestExecutionContext) setBodyReadDeadline() func() {
+	timeout := rec.bodyReadTimeout()
+	if timeout <= 0 || rec.streamsBody() {
+		return func() {}
+	}
+	rc := http.NewResponseController(rec.httpResponse)
+	if err := rc.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		rec.logger.Warn("unable to limit the time reading the request body", "error", err)
+		return func() {}
+	}
+	return func() {
+		_ = rc.SetReadDeadline(time.Time{})
+	}
+}
@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+func TestBodyReadTimeout(t *testing.T) {
+	h := &hook.Hook{ID: "test", BodyReadTimeout: hook.Duration(100 * time.Millisecond)}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &requestExecutionContext{
+			hook:         h,
+			hookRequest:  &hook.Request{RawRequest: r},
+			logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+			httpRequest:  r,
+			httpResponse: w,
+		}
+		rec.Handle(w, r)
+	}))
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	// announce a body but only send a part of it
+	_, _ = fmt.Fprint(conn, "POST /hooks/test HTTP/1.1\r\nHost: example.com\r\nContent-Type: application/json\r\nContent-Length: 100\r\n\r\n{\"a\":")
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusRequestTimeout {
+		t.Errorf("expected status %d, got %d", http.StatusRequestTimeout, resp.StatusCode)
+	}
+}
@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+// DebugHooks decides which hooks have their requests and responses dumped.
+// Hooks are dumped if their definition enables debug or an operator toggled
+// it through the admin API. Toggles are kept by hook ID, so they survive
+// reloads of the hooks files. A nil DebugHooks dumps nothing.
+type DebugHooks struct {
+	dump func(http.Handler) http.Handler
+
+	mu      sync.RWMutex
+	toggled map[string]bool
+}
+
+// NewDebugHooks returns the per-hook debug state dumping with the given
+// middleware, see middleware.Dumper. Nothing is dumped if dump is nil, e.g.
+// because all requests are dumped already.
+func NewDebugHooks(dump func(http.Handler) http.Handler) *DebugHooks {
+	return &DebugHooks{dump: dump, toggled: make(map[string]bool)}
+}
+
+// Set enables or disables dumping of the hook with the given ID at runtime.
+func (d *DebugHooks) Set(id string, enabled bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if enabled {
+		d.toggled[id] = true
+	} else {
+		delete(d.toggled, id)
+	}
+}
+
+// Enabled reports whether requests of the hook are dumped.
+func (d *DebugHooks) Enabled(h *hook.Hook) bool {
+	if d == nil {
+		return false
+	}
+	if h.Debug {
+		return true
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.toggled[h.ID]
+}
+
+// wrap returns next wrapped with the dumper if the hook is being debugged.
+func (d *DebugHooks) wrap(h *hook.Hook, next http.Handler) http.Handler {
+	if d == nil || d.dump == nil || !d.Enabled(h) {
+		return next
+	}
+	return d.dump(next)
+}
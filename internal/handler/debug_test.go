@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+func TestDebugHooks(t *testing.T) {
+	var dumped int
+	dump := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			dumped++
+			next.ServeHTTP(w, r)
+		})
+	}
+	noop := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	serve := func(d *DebugHooks, h *hook.Hook) {
+		d.wrap(h, noop).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/hooks/"+h.ID, nil))
+	}
+
+	d := NewDebugHooks(dump)
+	quiet, configured := &hook.Hook{ID: "quiet"}, &hook.Hook{ID: "configured", Debug: true}
+
+	serve(d, quiet)
+	serve(d, configured)
+	if dumped != 1 {
+		t.Fatalf("expected only the configured hook to be dumped, got %d dumps", dumped)
+	}
+
+	d.Set("quiet", true)
+	serve(d, quiet)
+	if dumped != 2 || !d.Enabled(quiet) {
+		t.Fatalf("expected toggled hook to be dumped, got %d dumps", dumped)
+	}
+
+	d.Set("quiet", false)
+	serve(d, quiet)
+	if dumped != 2 || d.Enabled(quiet) {
+		t.Fatalf("expected hook not to be dumped after disabling, got %d dumps", dumped)
+	}
+
+	// nothing is dumped without a dumper, e.g. when -debug dumps everything
+	serve(NewDebugHooks(nil), configured)
+	serve(nil, configured)
+	if dumped != 2 {
+		t.Errorf("expected no dumps without dumper, got %d dumps", dumped-2)
+	}
+}
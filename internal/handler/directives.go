@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"bytes"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// Prefix of the directives a command prints to shape the response.
+const directivePrefix = "::"
+
+// responseDirectives holds the response settings requested by the command.
+type responseDirectives struct {
+	headers http.Header
+	// status is the response status code, 0 if not set
+	status int
+}
+
+// headers which are managed by the server and can't be set by commands
+var reservedDirectiveHeaders = []string{"Content-Length", "Transfer-Encoding", "Connection"}
+
+// parseResponseDirectives reads the directive lines at the start of the
+// output, ie. "::header Location=/builds/42" or "::status 202", and returns
+// them along with the remaining output. Parsing stops at the first line which
+// is no directive.
+func parseResponseDirectives(output []byte) (responseDirectives, []byte) {
+	d := responseDirectives{headers: make(http.Header)}
+	rest := output
+	for len(rest) > 0 {
+		line, remainder, _ := bytes.Cut(rest, []byte("\n"))
+		if !d.parseLine(strings.TrimSuffix(string(line), "\r")) {
+			break
+		}
+		rest = remainder
+	}
+	return d, rest
+}
+
+// parseLine applies a single directive line and reports whether it was one.
+func (d *responseDirectives) parseLine(line string) bool {
+	directive, ok := strings.CutPrefix(line, directivePrefix)
+	if !ok {
+		return false
+	}
+	name, arg, _ := strings.Cut(directive, " ")
+	switch name {
+	case "header":
+		key, value, ok := strings.Cut(arg, "=")
+		key = textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(key))
+		if !ok || key == "" || !validHeaderName(key) {
+			return false
+		}
+		for _, reserved := range reservedDirectiveHeaders {
+			if key == reserved {
+				return true
+			}
+		}
+		d.headers.Add(key, strings.TrimSpace(value))
+		return true
+	case "status":
+		code, err := strconv.Atoi(strings.TrimSpace(arg))
+		if err != nil || code < 200 || code > 599 {
+			return false
+		}
+		d.status = code
+		return true
+	}
+	return false
+}
+
+// validHeaderName reports whether name is a valid header field name token.
+func validHeaderName(name string) bool {
+	for _, r := range name {
+		if r <= ' ' || r >= 0x7f || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// applyResponseDirectives sets the response headers requested by the command
+// and returns the output without the directive lines along with the
+// requested status code, which is 0 if the command did not set one.
+func (rec *requestExecutionContext) applyResponseDirectives(output []byte) ([]byte, int) {
+	d, rest := parseResponseDirectives(output)
+	for key, values := range d.headers {
+		rec.logger.Debug("command set response header", "header", key)
+		for _, v := range values {
+			rec.httpResponse.Header().Add(key, v)
+		}
+	}
+	return rest, d.status
+}
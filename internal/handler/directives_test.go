@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestParseResponseDirectives(t *testing.T) {
+	for _, tt := range []struct {
+		desc    string
+		output  string
+		headers http.Header
+		status  int
+		rest    string
+	}{
+		{
+			"headers",
+			"::header Location=/builds/42\r\n::header x-build-id = 42\nbuild queued\n::header Ignored=1\n",
+			http.Header{"Location": {"/builds/42"}, "X-Build-Id": {"42"}},
+			0,
+			"build queued\n::header Ignored=1\n",
+		},
+		{
+			"no directives",
+			"build queued\n",
+			http.Header{},
+			0,
+			"build queued\n",
+		},
+		{
+			"reserved header",
+			"::header Content-Length=1\ndone",
+			http.Header{},
+			0,
+			"done",
+		},
+		{
+			"invalid directive ends parsing",
+			"::header invalid\n::header Location=/\n",
+			http.Header{},
+			0,
+			"::header invalid\n::header Location=/\n",
+		},
+		{
+			"unknown directive ends parsing",
+			"::warning something\n",
+			http.Header{},
+			0,
+			"::warning something\n",
+		},
+		{
+			"status",
+			"::status 202\n::header Location=/builds/42\nqueued",
+			http.Header{"Location": {"/builds/42"}},
+			http.StatusAccepted,
+			"queued",
+		},
+		{
+			"invalid status",
+			"::status 99\nqueued",
+			http.Header{},
+			0,
+			"::status 99\nqueued",
+		},
+	} {
+		d, rest := parseResponseDirectives([]byte(tt.output))
+		if !reflect.DeepEqual(d.headers, tt.headers) {
+			t.Errorf("%s: expected headers %v, got %v", tt.desc, tt.headers, d.headers)
+		}
+		if d.status != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.desc, tt.status, d.status)
+		}
+		if string(rest) != tt.rest {
+			t.Errorf("%s: expected output %q, got %q", tt.desc, tt.rest, rest)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook_manager"
+)
+
+// ErrRulesNotSatisfied is returned by Dispatch when the message did not
+// satisfy the hook's trigger rules.
+var ErrRulesNotSatisfied = errors.New("hook rules were not satisfied")
+
+// Dispatcher runs hooks for messages which were not received over HTTP, such
+// as messages consumed from a broker. Messages go through the same payload
+// parsing, rule evaluation and execution as HTTP requests.
+type Dispatcher struct {
+	hookManager *hook_manager.Manager
+	scheduler   *Scheduler
+	activity    *ActivityFeed
+	lastRuns    *LastRuns
+	circuits    *CircuitBreakers
+	processes   *Processes
+	logger      *slog.Logger
+}
+
+func NewDispatcher(hookManager *hook_manager.Manager, scheduler *Scheduler, activity *ActivityFeed, lastRuns *LastRuns, circuits *CircuitBreakers, processes *Processes, logger *slog.Logger) *Dispatcher {
+	return &Dispatcher{
+		hookManager: hookManager,
+		scheduler:   scheduler,
+		activity:    activity,
+		lastRuns:    lastRuns,
+		circuits:    circuits,
+		processes:   processes,
+		logger:      logger,
+	}
+}
+
+// Dispatch parses the body of the request, evaluates the trigger rules of the
+// hook and executes its command, waiting for it to finish.
+func (d *Dispatcher) Dispatch(ctx context.Context, h *hook.Hook, r *hook.Request) error {
+	logger := withHook(d.logger.With("request_id", r.ID), h)
+
+	r.SingleValueParameters = h.SingleValueParameters
+	parsePayload(h, r, logger)
+	if err := h.ParseJSONParameters(r); err != nil {
+		logger.Error("error parsing JSON parameters", "error", err)
+	}
+	transformPayload(h, r, logger)
+
+	ok, err := evaluateRules(h, r, logger)
+	traceRules(ctx, r, ok)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		logger.Info("hook rules were not satisfied, skipping message")
+		return ErrRulesNotSatisfied
+	}
+
+	if retryAfter, ok := d.circuits.allow(h, time.Now()); !ok {
+		logger.Warn("circuit of the hook is open, skipping message", "retry_after", retryAfter)
+		return ErrCircuitOpen
+	}
+	logger.Info("hook triggered successfully")
+	d.activity.triggered(h, r)
+	release, err := d.scheduler.Acquire(ctx, h)
+	if err != nil {
+		return err
+	}
+	defer release()
+	if h.Batch != nil {
+		events, err := batchEvents(h, r)
+		if err != nil {
+			return err
+		}
+		if result := executeBatch(ctx, h, r, events, d.hookManager, d.activity, d.circuits, d.processes, logger); result.Failed > 0 {
+			return fmt.Errorf("%d of %d events failed", result.Failed, result.Events)
+		}
+		return nil
+	}
+	return NewExecutor(h, r, logger).
+		WithChaining(d.hookManager).
+		WithActivity(d.activity).
+		WithLastRuns(d.lastRuns).
+		WithCircuits(d.circuits).
+		WithProcesses(d.processes).
+		Execute(ctx, io.Discard)
+}
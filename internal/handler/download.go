@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+// responseFilePath resolves the path of the file to send back. Without a
+// configured path template, the last non-empty line of the command output is
+// the path. Templated paths may depend on request values, so they have to
+// stay within the working directory.
+func responseFilePath(h *hook.Hook, r *hook.Request, output []byte) (string, error) {
+	dir := h.CommandWorkingDirectory
+	if h.ResponseFile.Path == "" {
+		lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+		path := strings.TrimSpace(lines[len(lines)-1])
+		if path == "" {
+			return "", errors.New("command did not print a file path")
+		}
+		if !filepath.IsAbs(path) && dir != "" {
+			path = filepath.Join(dir, path)
+		}
+		return path, nil
+	}
+
+	tmpl, err := template.New("response-file").Parse(h.ResponseFile.Path)
+	if err != nil {
+		return "", fmt.Errorf("invalid response file path template: %w", err)
+	}
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, r); err != nil {
+		return "", fmt.Errorf("error executing response file path template: %w", err)
+	}
+	if dir == "" {
+		dir = "."
+	}
+	path := buf.String()
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("response file %q is outside of the working directory", path)
+	}
+	return path, nil
+}
+
+// writeResponseFile sends the file produced by the command as download.
+func (rec *requestExecutionContext) writeResponseFile(output []byte) {
+	path, err := responseFilePath(rec.hook, rec.hookRequest, output)
+	if err != nil {
+		rec.logger.Error("error resolving response file", "error", err)
+		rec.writeError(http.StatusInternalServerError, ErrorCodeResponseFileFailed, "Error occurred while sending the hook's file.")
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		rec.logger.Error("error opening response file", "error", err)
+		rec.writeError(http.StatusInternalServerError, ErrorCodeResponseFileFailed, "Error occurred while sending the hook's file.")
+		return
+	}
+	defer func() { _ = f.Close() }()
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		rec.logger.Error("response file is not a regular file", "path", path, "error", err)
+		rec.writeError(http.StatusInternalServerError, ErrorCodeResponseFileFailed, "Error occurred while sending the hook's file.")
+		return
+	}
+
+	name := rec.hook.ResponseFile.FileName
+	if name == "" {
+		name = filepath.Base(path)
+	}
+	header := rec.httpResponse.Header()
+	if rec.hook.ResponseFile.ContentType != "" {
+		header.Set("Content-Type", rec.hook.ResponseFile.ContentType)
+	}
+	header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	rec.logger.Info("sending response file", "path", path)
+	// detects the content type from the name or content unless set above
+	http.ServeContent(rec.httpResponse, rec.httpRequest, name, info.ModTime(), f)
+}
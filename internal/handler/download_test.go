@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+func TestResponseFilePath(t *testing.T) {
+	r := &hook.Request{ID: "abc", Query: map[string]interface{}{"name": "../../etc/passwd"}}
+	for _, tt := range []struct {
+		desc     string
+		hook     *hook.Hook
+		output   string
+		expected string
+		ok       bool
+	}{
+		{"printed path", &hook.Hook{CommandWorkingDirectory: "/srv", ResponseFile: &hook.ResponseFile{}}, "dumping\nbackup.tar\n", "/srv/backup.tar", true},
+		{"printed absolute path", &hook.Hook{CommandWorkingDirectory: "/srv", ResponseFile: &hook.ResponseFile{}}, "/tmp/export.csv", "/tmp/export.csv", true},
+		{"no printed path", &hook.Hook{ResponseFile: &hook.ResponseFile{}}, "\n", "", false},
+		{"template", &hook.Hook{CommandWorkingDirectory: "/srv", ResponseFile: &hook.ResponseFile{Path: "exports/{{ .ID }}.csv"}}, "", "/srv/exports/abc.csv", true},
+		{"template outside of working directory", &hook.Hook{CommandWorkingDirectory: "/srv", ResponseFile: &hook.ResponseFile{Path: "{{ .Query.name }}"}}, "", "", false},
+	} {
+		path, err := responseFilePath(tt.hook, r, []byte(tt.output))
+		if (err == nil) != tt.ok || path != tt.expected {
+			t.Errorf("%s: expected %q (ok: %t), got %q (err: %v)", tt.desc, tt.expected, tt.ok, path, err)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// Response headers describing the outcome of the command.
+const (
+	ExitCodeHeader = "X-Webhook-Exit-Code"
+	DurationHeader = "X-Webhook-Duration"
+)
+
+// Statuses of the JSON response envelope.
+const (
+	envelopeSuccess = "success"
+	envelopeError   = "error"
+)
+
+const executionErrorMessage = "Error occurred while executing the hook's command. " +
+	"Please check logs for more details."
+
+// responseEnvelope is the response of hooks using the JSON response format.
+type responseEnvelope struct {
+	Hook      string `json:"hook"`
+	RequestID string `json:"request_id"`
+	Status    string `json:"status"`
+	// ExitCode is only known to hooks waiting for the command to finish.
+	ExitCode *int   `json:"exit_code,omitempty"`
+	Output   string `json:"output"`
+	Message  string `json:"message,omitempty"`
+}
+
+// exitCode returns the exit code of the command which ran with the given
+// result, or -1 if the command could not be run or was killed.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// setExitCodeHeaders sets the exit code of the command and its duration in
+// milliseconds as response headers.
+func (rec *requestExecutionContext) setExitCodeHeaders(err error, started time.Time) {
+	rec.httpResponse.Header().Set(ExitCodeHeader, strconv.Itoa(exitCode(err)))
+	rec.httpResponse.Header().Set(DurationHeader, strconv.FormatInt(time.Since(started).Milliseconds(), 10))
+}
+
+// envelope returns the response envelope for an execution. executed tells
+// whether err is the result of the command.
+func (rec *requestExecutionContext) envelope(executed bool, err error) responseEnvelope {
+	env := responseEnvelope{
+		Hook:      rec.hook.ID,
+		RequestID: rec.hookRequest.ID,
+		Status:    envelopeSuccess,
+	}
+	if err != nil {
+		env.Status = envelopeError
+	}
+	if executed {
+		code := exitCode(err)
+		env.ExitCode = &code
+	}
+	return env
+}
+
+// writeEnvelope responds with the JSON encoded envelope.
+func (rec *requestExecutionContext) writeEnvelope(status int, env responseEnvelope) {
+	body, err := json.Marshal(env)
+	if err != nil {
+		rec.writeResponse(http.StatusInternalServerError, "Error encoding response.")
+		return
+	}
+	rec.httpResponse.Header().Set("Content-Type", "application/json")
+	rec.writeResponse(status, string(body))
+}
@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"errors"
+	"net/http/httptest"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+func TestExitCode(t *testing.T) {
+	exitErr := exec.Command("sh", "-c", "exit 3").Run()
+	for _, tt := range []struct {
+		err  error
+		code int
+	}{
+		{nil, 0},
+		{exitErr, 3},
+		{errors.New("executable file not found"), -1},
+	} {
+		if code := exitCode(tt.err); code != tt.code {
+			t.Errorf("expected exit code %d for %v, got %d", tt.code, tt.err, code)
+		}
+	}
+}
+
+func TestSetExitCodeHeaders(t *testing.T) {
+	rr := httptest.NewRecorder()
+	rec := &requestExecutionContext{hook: &hook.Hook{ID: "test"}, httpResponse: rr}
+	rec.setExitCodeHeaders(exec.Command("sh", "-c", "exit 2").Run(), time.Now().Add(-1500*time.Millisecond))
+	if code := rr.Header().Get(ExitCodeHeader); code != "2" {
+		t.Errorf("expected exit code header 2, got %q", code)
+	}
+	if d := rr.Header().Get(DurationHeader); len(d) != 4 || d[0] != '1' {
+		t.Errorf("expected duration header of about 1500, got %q", d)
+	}
+}
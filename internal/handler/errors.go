@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+	"github.com/kaufland-ecommerce/ci-webhook/internal/middleware"
+)
+
+// Codes of JSON error responses. They are part of the API, so existing codes
+// must not change.
+const (
+	ErrorCodeHookNotFound       = "hook_not_found"
+	ErrorCodeMethodNotAllowed   = "method_not_allowed"
+	ErrorCodeInvalidRequest     = "invalid_request"
+	ErrorCodeRequestTimeout     = "request_timeout"
+	ErrorCodeSignatureMismatch  = "signature_mismatch"
+	ErrorCodeIPNotAllowed       = "ip_not_allowed"
+	ErrorCodeMissingParameter   = "missing_parameter"
+	ErrorCodeRulesNotSatisfied  = "rules_not_satisfied"
+	ErrorCodeRuleEvaluation     = "rule_evaluation_failed"
+	ErrorCodeTooManyStreams     = "too_many_streams"
+	ErrorCodeHookRunning        = "hook_running"
+	ErrorCodeCircuitOpen        = "circuit_open"
+	ErrorCodeSchedulingFailed   = "scheduling_failed"
+	ErrorCodeExecutionFailed    = "execution_failed"
+	ErrorCodeStreamingFailed    = "streaming_failed"
+	ErrorCodeResponseFileFailed = "response_file_failed"
+	ErrorCodeArtifactsFailed    = "artifacts_failed"
+	ErrorCodeInvalidBatch       = "invalid_batch"
+	ErrorCodeInternal           = "internal_error"
+)
+
+// mismatchErrorCodes are the error codes of the mismatch classes.
+var mismatchErrorCodes = map[string]string{
+	hook.MismatchSignature:        ErrorCodeSignatureMismatch,
+	hook.MismatchIPWhitelist:      ErrorCodeIPNotAllowed,
+	hook.MismatchMissingParameter: ErrorCodeMissingParameter,
+	hook.MismatchRules:            ErrorCodeRulesNotSatisfied,
+}
+
+// errorResponse is the body of failed requests of clients accepting JSON.
+type errorResponse struct {
+	Error errorDetails `json:"error"`
+}
+
+type errorDetails struct {
+	Code      string `json:"code"`
+	Message   string `json:"message,omitempty"`
+	RequestID string `json:"request_id"`
+}
+
+// acceptsJSON returns whether the Accept header of the request explicitly
+// lists application/json. Wildcards don't count, so clients which don't care
+// keep receiving plain text.
+func acceptsJSON(request *http.Request) bool {
+	for _, accept := range request.Header.Values("Accept") {
+		for _, mediaRange := range strings.Split(accept, ",") {
+			mediaType, params, err := mime.ParseMediaType(mediaRange)
+			if err != nil || mediaType != "application/json" {
+				continue
+			}
+			if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+				continue
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// writeJSONError responds with the JSON error response.
+func writeJSONError(w http.ResponseWriter, request *http.Request, status int, code, message string) {
+	body, _ := json.Marshal(errorResponse{Error: errorDetails{
+		Code:      code,
+		Message:   message,
+		RequestID: middleware.GetReqID(request.Context()),
+	}})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = fmt.Fprint(w, string(body))
+}
+
+// writeError responds to a failed request with the message, or with a JSON
+// error response of the code if the client accepts JSON.
+func (rec *requestExecutionContext) writeError(status int, code, message string) {
+	if rec.httpRequest == nil || !acceptsJSON(rec.httpRequest) {
+		rec.writeResponse(status, message)
+		return
+	}
+	if status == 0 {
+		status = http.StatusOK
+	} else if len(http.StatusText(status)) == 0 {
+		rec.logger.Warn("configured error code is unknown, using default",
+			"configured_code", status,
+			"actual_code", http.StatusOK,
+		)
+		status = http.StatusOK
+	}
+	writeJSONError(rec.httpResponse, rec.httpRequest, status, code, message)
+}
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+	"github.com/kaufland-ecommerce/ci-webhook/internal/middleware"
+)
+
+func TestAcceptsJSON(t *testing.T) {
+	for accept, expected := range map[string]bool{
+		"":                                  false,
+		"*/*":                               false,
+		"text/plain":                        false,
+		"application/json":                  true,
+		"text/html, application/json;q=0.9": true,
+		"application/json;q=0":              false,
+		"application/jsonl":                 false,
+	} {
+		request := httptest.NewRequest(http.MethodPost, "/hooks/test", nil)
+		request.Header.Set("Accept", accept)
+		if acceptsJSON(request) != expected {
+			t.Errorf("expected %v for Accept %q", expected, accept)
+		}
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	request := httptest.NewRequest(http.MethodPost, "/hooks/test", nil)
+	request = request.WithContext(context.WithValue(request.Context(), middleware.RequestIDKey, "abc123"))
+	rec := &requestExecutionContext{
+		hook:        &hook.Hook{ID: "test", AuthFailureStatusCodes: true},
+		hookRequest: &hook.Request{MismatchClass: hook.MismatchSignature},
+		logger:      slog.Default(),
+		httpRequest: request,
+	}
+
+	rr := httptest.NewRecorder()
+	rec.httpResponse = rr
+	rec.writeMismatch()
+	if rr.Code != http.StatusUnauthorized || rr.Body.String() != defaultMismatchMessage {
+		t.Errorf("expected plain text response, got %d: %q", rr.Code, rr.Body.String())
+	}
+
+	request.Header.Set("Accept", "application/json")
+	rr = httptest.NewRecorder()
+	rec.httpResponse = rr
+	rec.writeMismatch()
+	expected := `{"error":{"code":"signature_mismatch","message":"Hook rules were not satisfied.","request_id":"abc123"}}`
+	if rr.Code != http.StatusUnauthorized || rr.Body.String() != expected || rr.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("expected JSON error response, got %d %q: %q", rr.Code, rr.Header().Get("Content-Type"), rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	NotFoundResponse{}.ServeHTTP(rr, request)
+	expected = `{"error":{"code":"hook_not_found","message":"Hook not found.","request_id":"abc123"}}`
+	if rr.Code != http.StatusNotFound || rr.Body.String() != expected {
+		t.Errorf("expected JSON not found response, got %d: %q", rr.Code, rr.Body.String())
+	}
+}
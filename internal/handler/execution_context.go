@@ -2,50 +2,94 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"math"
+	"mime/multipart"
 	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook_manager"
 )
 
 type requestExecutionContext struct {
 	hookRequest  *hook.Request
 	hook         *hook.Hook
+	hookManager  *hook_manager.Manager
 	logger       *slog.Logger
 	httpRequest  *http.Request
 	httpResponse http.ResponseWriter
 	opts         options
+	executions   *sharedExecutions
+	responses    *responseCache
+	scheduler    *Scheduler
+	jobs         *JobRegistry
+	activity     *ActivityFeed
+	lastRuns     *LastRuns
+	circuits     *CircuitBreakers
+	processes    *Processes
+	// sample is the request selected by the request sampling of the hook
+	sample *sampledRequest
+	// shared is the execution shared with identical deliveries, which the
+	// request leads or attached to, see joinExecution
+	shared *sharedExecution
+	leads  bool
 }
 
 func (rec *requestExecutionContext) evaluateHookRules() (bool, error) {
-	if rec.hook.TriggerRule == nil {
+	return evaluateRules(rec.hook, rec.hookRequest, rec.logger)
+}
+
+// evaluateRules evaluates the trigger rule of the hook against the request.
+// Missing parameters are not treated as errors, the rules are merely not satisfied.
+func evaluateRules(h *hook.Hook, r *hook.Request, logger *slog.Logger) (bool, error) {
+	if h.TriggerRule == nil {
 		return true, nil
 	}
+	r.MismatchedRules, r.MismatchClass, r.MismatchReason = nil, "", ""
 	// Save signature soft failures option in request for evaluators
-	rec.hookRequest.AllowSignatureErrors = rec.hook.TriggerSignatureSoftFailures
+	r.AllowSignatureErrors = h.TriggerSignatureSoftFailures
 
-	ok, err := rec.hook.TriggerRule.Evaluate(rec.hookRequest)
+	ok, err := h.TriggerRule.Evaluate(r)
+	if !ok {
+		r.MismatchClass = hook.ClassifyMismatch(r.MismatchedRules, err)
+		if r.MismatchReason != "" {
+			logger.Warn("request rejected by hook rules", "reason", r.MismatchReason)
+		}
+	}
 	if err != nil && !hook.IsParameterNodeError(err) {
-		rec.logger.Error("error evaluating hook rules", "error", err)
+		logger.Error("error evaluating hook rules", "error", err)
 		return false, err
 	}
 	if err != nil {
-		rec.logger.Warn("hook rules were not satisfied", "error", err)
+		logger.Warn("hook rules were not satisfied", "error", err)
 	}
 	return ok, nil
 }
 
 func (rec *requestExecutionContext) Handle(w http.ResponseWriter, request *http.Request) {
 	ctx := request.Context()
+	// OPTIONS and HEAD requests never run the command, unless the methods are
+	// explicitly allowed for the hook
+	if request.Method == http.MethodOptions && !rec.methodListed(http.MethodOptions) {
+		rec.writeOptions()
+		return
+	}
+	dryRun := request.Method == http.MethodHead && !rec.methodListed(http.MethodHead)
 	// Check for allowed methods
-	if !rec.IsHTTPMethodAllowed(request.Method) {
-		w.WriteHeader(http.StatusMethodNotAllowed)
+	if !dryRun && !rec.IsHTTPMethodAllowed(request.Method) {
 		rec.logger.Warn("HTTP method not allowed for this hook", "method", request.Method)
+		rec.writeMethodNotAllowed()
 		return
 	}
 	// write default response headers
@@ -53,95 +97,571 @@ func (rec *requestExecutionContext) Handle(w http.ResponseWriter, request *http.
 		w.Header().Set(responseHeader.Name, responseHeader.Value)
 	}
 
-	if err := rec.ParseRequest(); err != nil {
-		rec.writeResponse(http.StatusInternalServerError, err.Error())
+	// reading the body is limited independently of the execution, so slow
+	// clients can't hold on to the handler
+	clearDeadline := rec.setBodyReadDeadline()
+	// sampled requests record the body while it is parsed
+	rec.sample = rec.sampleRequest()
+	sample := rec.sample
+	err := rec.ParseRequest()
+	if errors.Is(err, errBodyReadTimeout) {
+		// the deadline is kept, so the rest of the body isn't waited for
+		rec.logger.Warn("timed out reading the request body")
+		rec.removeUploadedFiles()
+		rec.writeError(http.StatusRequestTimeout, ErrorCodeRequestTimeout, "Timed out reading the request body.")
+		return
+	}
+	clearDeadline()
+	if err != nil {
+		// files saved before the error are not handed to any command
+		rec.removeUploadedFiles()
+		rec.writeError(http.StatusInternalServerError, ErrorCodeInvalidRequest, err.Error())
+		return
 	}
+	// uploaded files are removed once the request is done, unless the
+	// execution continues in the background and takes them over
+	handedOff := false
+	defer func() {
+		if !handedOff {
+			rec.removeUploadedFiles()
+		}
+	}()
 
 	ok, err := rec.evaluateHookRules()
+	traceRules(ctx, rec.hookRequest, ok)
+	if sample != nil {
+		if path, err := sample.persist(rec.hook, rec.hookRequest, ok, err); err != nil {
+			rec.logger.Error("error persisting sampled request", "error", err)
+		} else {
+			rec.logger.Debug("persisted sampled request", "file_name", path)
+		}
+	}
+	_, configured := rec.hook.TriggerRuleMismatchResponses[hook.MismatchSignature]
+	if (configured || rec.hook.AuthFailureStatusCodes) && hook.IsSignatureError(err) {
+		// invalid signatures are answered as configured instead of as errors
+		rec.writeMismatch()
+		return
+	}
 	if err != nil {
 		rec.logger.Error("error evaluating hook", "error", err)
-		rec.writeResponse(
+		rec.writeError(
 			http.StatusInternalServerError,
+			ErrorCodeRuleEvaluation,
 			"Error occurred while evaluating hook rules.",
 		)
 		return // bail out early
 	}
 	if !ok { // hook is not triggered
-		// Check if a return code is configured for the hook
-		rec.writeResponse(
-			rec.hook.TriggerRuleMismatchHttpResponseCode,
-			"Hook rules were not satisfied.",
-		)
+		rec.writeMismatch()
 		return // bail out early
 	}
 
+	if dryRun {
+		rec.logger.Info("hook rules satisfied by HEAD request, skipping execution")
+		for _, responseHeader := range rec.hook.ResponseHeaders {
+			w.Header().Set(responseHeader.Name, responseHeader.Value)
+		}
+		rec.writeHttpStatus(rec.hook.SuccessHttpResponseCode)
+		return
+	}
+
 	rec.logger.Info("hook triggered successfully")
+	rec.activity.triggered(rec.hook, rec.hookRequest)
+	if key, ok := rec.idempotencyKey(); ok {
+		// retries arriving while the request is handled wait for its response
+		cached, store, err := rec.responses.begin(ctx, key)
+		if err != nil {
+			rec.logger.Warn("request cancelled while waiting for the response to its idempotency key", "error", err)
+			return
+		}
+		if store == nil {
+			rec.logger.Info("replaying stored response for idempotency key")
+			rec.replay(cached)
+			return
+		}
+		recorder := &recordingWriter{ResponseWriter: w}
+		w, rec.httpResponse = recorder, recorder
+		defer func() {
+			// failed executions are not stored, so they can be retried
+			if resp, ok := recorder.response(); ok && resp.status < http.StatusInternalServerError {
+				store(&resp, time.Duration(rec.hook.IdempotencyTTL))
+			} else {
+				store(nil, 0)
+			}
+		}()
+	}
 	for _, responseHeader := range rec.hook.ResponseHeaders {
 		w.Header().Set(responseHeader.Name, responseHeader.Value)
 	}
 
-	executor := NewExecutor(rec.hook, rec.hookRequest, rec.logger)
+	if len(rec.hook.ForwardTo) > 0 {
+		forwardRequest(rec.hook, rec.hookRequest, rec.logger)
+		// hooks may act as a pure router without a command
+		if rec.hook.ExecuteCommand == "" {
+			rec.writeSuccess()
+			return
+		}
+	}
+
+	if retryAfter, ok := rec.circuits.allow(rec.hook, time.Now()); !ok {
+		rec.logger.Warn("circuit of the hook is open, skipping execution", "retry_after", retryAfter)
+		rec.httpResponse.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		rec.writeError(http.StatusServiceUnavailable, ErrorCodeCircuitOpen, "Hook is disabled after repeated failures.")
+		return
+	}
+
+	if rec.hook.Debounce > 0 {
+		handedOff = true
+		rec.debounce(ctx, rec.startJob())
+		rec.writeSuccess()
+		return
+	}
+
+	// streamed outputs keep their connection open for the whole execution
+	if rec.hook.StreamCommandOutput {
+		releaseStream, ok := rec.opts.streams.TryAcquire()
+		if !ok {
+			rec.logger.Warn("too many streaming connections, rejecting request")
+			rec.httpResponse.Header().Set("Retry-After", "1")
+			rec.writeError(http.StatusServiceUnavailable, ErrorCodeTooManyStreams, "Too many streaming connections.")
+			return
+		}
+		defer releaseStream()
+	}
+
+	// reserve the execution according to the concurrency policy of the hook,
+	// asynchronous hooks wait for their turn in the background
+	// the request body can't be read anymore once the response is sent, so
+	// hooks streaming it to the command run synchronously as well
+	async := rec.hook.Batch == nil && !rec.hook.StreamBodyToStdin &&
+		!rec.hook.StreamCommandOutput && !rec.hook.CaptureCommandOutput
+	// identical deliveries attach to the running execution instead of
+	// reserving one of their own
+	attached := rec.hook.Batch == nil && !rec.hook.StreamCommandOutput && rec.joinExecution()
+	var release func()
+	if !attached && (!async || rec.hook.ConcurrencyPolicy == hook.ConcurrencyDrop) {
+		release, err = rec.scheduler.Acquire(rec.executionContext(ctx), rec.hook)
+		if err != nil {
+			rec.abandonExecution(err)
+			rec.writeAcquireError(err)
+			return
+		}
+		if !async {
+			defer release()
+		}
+	}
+
+	// batches report the result of every event, so they always run synchronously
+	if rec.hook.Batch != nil {
+		rec.executeBatch(ctx)
+		return
+	}
+
+	executor := NewExecutor(rec.hook, rec.hookRequest, rec.logger).
+		WithChaining(rec.hookManager).
+		WithActivity(rec.activity).
+		WithLastRuns(rec.lastRuns).
+		WithCircuits(rec.circuits).
+		WithProcesses(rec.processes)
 
 	switch {
 	case rec.hook.StreamCommandOutput:
 		if flusher, ok := w.(FlushableWriter); ok {
+			fw, err := newFlushWriter(flusher, rec.hook)
+			if err != nil {
+				rec.logger.Error("error setting up output streaming", "error", err)
+				rec.writeError(http.StatusInternalServerError, ErrorCodeStreamingFailed, "Error occurred while streaming the hook's command output.")
+				return
+			}
 			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			if rec.hook.ExitCodeHeaders {
+				// the outcome is only known after the body, so it is sent as trailers
+				w.Header().Set("Trailer", ExitCodeHeader+", "+DurationHeader)
+			}
 			// when streaming, we need to write the header before executing the command,
 			// and we can't bind the status code to command exit code
 			w.WriteHeader(http.StatusOK)
-			// create an io.Writer that flushes after every write operation
-			fw := &flushWriter{w: flusher, muteErrors: true}
+			var out io.Writer = fw
+			// keep the connection alive while the command is silent
+			var heartbeat *heartbeatWriter
+			if interval := time.Duration(rec.hook.StreamHeartbeatInterval); interval > 0 {
+				heartbeat = startHeartbeat(fw, interval, rec.hook.StreamHeartbeatMessage)
+				out = heartbeat
+			}
+			// keep a copy of the output, which also lets the command
+			// finish if the client disconnects
+			execCtx := ctx
+			if rec.hook.StreamOutputFile != "" {
+				if file, err := rec.createOutputFile(); err != nil {
+					rec.logger.Error("error creating output file", "error", err)
+				} else {
+					defer closeOutputFile(file)
+					rec.logger.Info("writing command output to file", "file_name", file.Name())
+					out = io.MultiWriter(out, file)
+					execCtx = context.WithoutCancel(ctx)
+				}
+			}
 			// run command
 			waiter := make(chan error)
 			var exitCode int
+			started := time.Now()
 			go func() {
 				defer close(waiter)
-				waiter <- executor.Execute(ctx, fw)
+				waiter <- executor.Execute(execCtx, out)
 			}()
-			if err := <-waiter; err != nil {
+			err = <-waiter
+			if heartbeat != nil {
+				heartbeat.Stop()
+			}
+			fw.Close()
+			if err != nil {
 				exitCode = 1
 			}
+			if rec.hook.ExitCodeHeaders {
+				rec.setExitCodeHeaders(err, started)
+			}
 			// print exit code
 			_, _ = fmt.Fprintf(w, "\n---\n%d\n", exitCode)
 			flusher.Flush()
 			return // done handling the streaming request
 		}
-		rec.logger.Error("cant obtain flusher. are you running with `-debug`?" +
-			" streaming is not available in debug mode, will fallback to non-streaming mode")
+		rec.logger.Error("cant obtain flusher, will fallback to non-streaming mode")
 		fallthrough
 	case rec.hook.CaptureCommandOutput:
-		// create a buffer with io.Writer interface
-		buf := &bytes.Buffer{}
-		err = executor.Execute(ctx, buf)
+		started := time.Now()
+		var output []byte
+		output, err = rec.execute(ctx, executor)
+		if rec.hook.ExitCodeHeaders {
+			rec.setExitCodeHeaders(err, started)
+		}
+		var status int
+		if rec.hook.ResponseDirectives {
+			output, status = rec.applyResponseDirectives(output)
+		}
+		if err == nil && rec.hook.ResponseFile != nil {
+			rec.writeResponseFile(output)
+			break
+		}
+		if err == nil && len(rec.hook.CollectArtifacts) > 0 {
+			rec.writeArtifacts(started)
+			break
+		}
+		// the command output may be large, ie. build logs
+		defer rec.compressResponse()()
+		w = rec.httpResponse
+		if rec.hook.ResponseFormat == hook.ResponseFormatJSON {
+			env := rec.envelope(true, err)
+			if err == nil || rec.hook.CaptureCommandOutputOnError {
+				env.Output = string(output)
+			} else {
+				env.Message = executionErrorMessage
+			}
+			if status == 0 {
+				status = rec.hook.SuccessHttpResponseCode
+				if err != nil {
+					status = http.StatusInternalServerError
+				}
+			}
+			rec.writeEnvelope(status, env)
+			break
+		}
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+			if status == 0 {
+				status = http.StatusInternalServerError
+			}
 			if !rec.hook.CaptureCommandOutputOnError {
+				if acceptsJSON(rec.httpRequest) {
+					rec.writeError(status, ErrorCodeExecutionFailed, executionErrorMessage)
+					break
+				}
 				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-				rec.writeResponseBody("Error occurred while executing the hook's command. " +
-					"Please check logs for more details.")
+				w.WriteHeader(status)
+				rec.writeResponseBody(executionErrorMessage)
 				break
 			}
+			w.WriteHeader(status)
 		} else {
-			rec.writeHttpStatus(rec.hook.SuccessHttpResponseCode)
+			if status == 0 {
+				status = rec.hook.SuccessHttpResponseCode
+			}
+			rec.writeHttpStatus(status)
 		}
-		rec.writeResponseBody(buf.String())
+		rec.writeResponseBody(string(output))
+	case rec.hook.StreamBodyToStdin:
+		started := time.Now()
+		_, err = rec.execute(ctx, executor)
+		if rec.hook.ExitCodeHeaders {
+			rec.setExitCodeHeaders(err, started)
+		}
+		if rec.hook.ResponseFormat == hook.ResponseFormatJSON && err != nil {
+			env := rec.envelope(true, err)
+			env.Message = executionErrorMessage
+			rec.writeEnvelope(http.StatusInternalServerError, env)
+			break
+		}
+		if err != nil {
+			rec.writeError(http.StatusInternalServerError, ErrorCodeExecutionFailed, executionErrorMessage)
+			break
+		}
+		rec.writeSuccess()
 	default:
+		handedOff = true
+		job := rec.startJob()
 		go func() {
-			buf := &bytes.Buffer{}
-			err = executor.Execute(ctx, buf)
+			defer rec.removeUploadedFiles()
+			if release == nil && !attached {
+				var err error
+				if release, err = rec.scheduler.Acquire(context.Background(), rec.hook); err != nil {
+					rec.logger.Error("error scheduling hook execution", "error", err)
+					rec.abandonExecution(err)
+					job.finish(err)
+					return
+				}
+			}
+			if release != nil {
+				defer release()
+			}
+			job.running()
+			// the execution outlives the request
+			_, err := rec.execute(context.WithoutCancel(ctx), executor.WithDetachedTrace())
+			job.finish(err)
 		}()
-		rec.writeResponse(rec.hook.SuccessHttpResponseCode, rec.hook.ResponseMessage)
+		rec.writeSuccess()
+	}
+}
+
+// execute runs the executor and returns the command output. Requests which
+// attached to the execution of an identical delivery wait for its result
+// instead, see joinExecution, until their own context is done.
+func (rec *requestExecutionContext) execute(ctx context.Context, executor *Executor) ([]byte, error) {
+	if rec.shared != nil && !rec.leads {
+		rec.logger.Info("identical delivery shares a running execution")
+		return rec.shared.wait(ctx)
+	}
+	buf := &bytes.Buffer{}
+	err := executor.Execute(rec.executionContext(ctx), buf)
+	if rec.shared != nil {
+		rec.executions.finish(rec.shared, buf.Bytes(), err)
+	}
+	return buf.Bytes(), err
+}
+
+// joinExecution attaches the request to the running execution of an
+// identical delivery, as determined by the deduplication key of the hook,
+// and returns true. Otherwise the request leads a new execution, which
+// identical deliveries attach to until it finishes. Requests attach before
+// reserving an execution with the scheduler, so they neither wait for the
+// execution they share nor get dropped because of it.
+func (rec *requestExecutionContext) joinExecution() bool {
+	key, ok := rec.deduplicationKey()
+	if !ok {
+		return false
+	}
+	rec.shared, rec.leads = rec.executions.join(key)
+	return !rec.leads
+}
+
+// executionContext returns the context the execution is scheduled and run
+// with. Shared executions outlive the request leading them, so a client
+// disconnecting doesn't terminate the command of the deliveries sharing it.
+func (rec *requestExecutionContext) executionContext(ctx context.Context) context.Context {
+	if rec.shared != nil && rec.leads {
+		return context.WithoutCancel(ctx)
+	}
+	return ctx
+}
+
+// abandonExecution finishes the execution led by the request with the error,
+// if it can't be run.
+func (rec *requestExecutionContext) abandonExecution(err error) {
+	if rec.shared != nil && rec.leads {
+		rec.executions.finish(rec.shared, nil, err)
+	}
+}
+
+// deduplicationKey builds the key identifying identical deliveries from the
+// deduplication-key arguments of the hook. Deliveries are not deduplicated if
+// the hook has no key or any of its values is missing.
+func (rec *requestExecutionContext) deduplicationKey() (string, bool) {
+	if len(rec.hook.DeduplicationKey) == 0 {
+		return "", false
+	}
+	route := rec.hook.RouteKey()
+	parts := route[:]
+	for i := range rec.hook.DeduplicationKey {
+		v, err := rec.hook.DeduplicationKey[i].Get(rec.hookRequest)
+		if err != nil {
+			rec.logger.Warn("error extracting deduplication key, not deduplicating", "error", err)
+			return "", false
+		}
+		parts = append(parts, v)
 	}
+	return strings.Join(parts, "\x00"), true
+}
+
+// idempotencyKey returns the key under which the response to the request is
+// stored, if the hook enables idempotency and the request carries a key.
+// Streamed responses are never stored.
+func (rec *requestExecutionContext) idempotencyKey() (string, bool) {
+	if rec.hook.IdempotencyTTL <= 0 || rec.hook.StreamCommandOutput {
+		return "", false
+	}
+	arg := hook.DefaultIdempotencyKey()
+	if rec.hook.IdempotencyKey != nil {
+		arg = *rec.hook.IdempotencyKey
+	}
+	key, err := arg.Get(rec.hookRequest)
+	if err != nil || key == "" {
+		return "", false
+	}
+	route := rec.hook.RouteKey()
+	return strings.Join(append(route[:], key), "\x00"), true
+}
+
+// replay writes a stored response.
+func (rec *requestExecutionContext) replay(resp cachedResponse) {
+	for k, v := range resp.header {
+		rec.httpResponse.Header()[k] = v
+	}
+	rec.httpResponse.Header().Set("Idempotent-Replayed", "true")
+	rec.httpResponse.WriteHeader(resp.status)
+	_, _ = rec.httpResponse.Write(resp.body)
 }
 
 func (rec *requestExecutionContext) IsHTTPMethodAllowed(method string) bool {
-	switch {
-	case len(rec.hook.HTTPMethods) > 0:
-		return methodInList(method, rec.hook.HTTPMethods)
-	case len(rec.opts.defaultAllowedMethods) > 0:
-		return methodInList(method, rec.opts.defaultAllowedMethods)
+	allowed := rec.allowedMethods()
+	return allowed == nil || slices.Contains(allowed, method)
+}
+
+// allowedMethods returns the methods allowed for the hook, either configured
+// by the hook or by default, or nil if all methods are allowed. The methods
+// are normalized when the hooks are loaded, see hook.NormalizeMethods.
+func (rec *requestExecutionContext) allowedMethods() []string {
+	if len(rec.hook.HTTPMethods) > 0 {
+		return rec.hook.HTTPMethods
+	}
+	return rec.opts.defaultAllowedMethods
+}
+
+// writeMethodNotAllowed responds to a request using a method not allowed for
+// the hook, listing the allowed methods in the Allow header.
+func (rec *requestExecutionContext) writeMethodNotAllowed() {
+	status, message := http.StatusMethodNotAllowed, "HTTP method not allowed."
+	if o := rec.hook.MethodNotAllowedResponse; o != nil {
+		if o.HttpResponseCode != 0 {
+			status = o.HttpResponseCode
+		}
+		if o.Message != "" {
+			message = o.Message
+		}
+	}
+	rec.httpResponse.Header().Set("Allow", rec.allowHeader())
+	rec.writeError(status, ErrorCodeMethodNotAllowed, message)
+}
+
+// methodListed returns whether the method is explicitly allowed for the hook.
+func (rec *requestExecutionContext) methodListed(method string) bool {
+	return slices.Contains(rec.allowedMethods(), method)
+}
+
+// allowHeader returns the value of the Allow header for the hook. HEAD and
+// OPTIONS are always accepted.
+func (rec *requestExecutionContext) allowHeader() string {
+	allowed := rec.allowedMethods()
+	if allowed == nil {
+		allowed = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
 	}
-	return true
+	for _, m := range []string{http.MethodHead, http.MethodOptions} {
+		if !slices.Contains(allowed, m) {
+			allowed = append(allowed, m)
+		}
+	}
+	return strings.Join(allowed, ", ")
+}
+
+// writeOptions answers OPTIONS requests, including CORS preflight requests,
+// with the methods allowed for the hook.
+func (rec *requestExecutionContext) writeOptions() {
+	header := rec.httpResponse.Header()
+	for _, responseHeader := range rec.opts.responseHeaders {
+		header.Set(responseHeader.Name, responseHeader.Value)
+	}
+	for _, responseHeader := range rec.hook.ResponseHeaders {
+		header.Set(responseHeader.Name, responseHeader.Value)
+	}
+	allow := rec.allowHeader()
+	header.Set("Allow", allow)
+	if rec.httpRequest.Header.Get("Access-Control-Request-Method") != "" {
+		header.Set("Access-Control-Allow-Methods", allow)
+	}
+	rec.httpResponse.WriteHeader(http.StatusNoContent)
+}
+
+// debounce schedules the execution of the hook after its debounce period,
+// superseding executions scheduled by earlier requests.
+func (rec *requestExecutionContext) debounce(ctx context.Context, job *job) {
+	ctx = context.WithoutCancel(ctx)
+	executor := NewExecutor(rec.hook, rec.hookRequest, rec.logger).
+		WithChaining(rec.hookManager).
+		WithActivity(rec.activity).
+		WithLastRuns(rec.lastRuns).
+		WithCircuits(rec.circuits).
+		WithProcesses(rec.processes).
+		WithDetachedTrace()
+	rec.logger.Info("execution debounced", "debounce", time.Duration(rec.hook.Debounce))
+	rec.scheduler.Debounce(rec.hook, func() {
+		defer rec.removeUploadedFiles()
+		if rec.hook.Batch != nil || !rec.joinExecution() {
+			release, err := rec.scheduler.Acquire(ctx, rec.hook)
+			if err != nil {
+				rec.logger.Error("error scheduling hook execution", "error", err)
+				rec.abandonExecution(err)
+				job.finish(err)
+				return
+			}
+			defer release()
+		}
+		job.running()
+		if rec.hook.Batch != nil {
+			events, err := batchEvents(rec.hook, rec.hookRequest)
+			if err != nil {
+				rec.logger.Warn("error reading batch events", "error", err)
+				job.finish(err)
+				return
+			}
+			result := executeBatch(ctx, rec.hook, rec.hookRequest, events, rec.hookManager, rec.activity, rec.circuits, rec.processes, rec.logger)
+			if result.Failed > 0 {
+				err = fmt.Errorf("%d of %d events failed", result.Failed, result.Events)
+			}
+			job.finish(err)
+			return
+		}
+		_, err := rec.execute(ctx, executor)
+		job.finish(err)
+	}, func() {
+		rec.removeUploadedFiles()
+		job.finish(errJobSuperseded)
+	})
+}
+
+// startJob registers the asynchronous execution of the request and announces
+// its ID in the response.
+func (rec *requestExecutionContext) startJob() *job {
+	job := rec.jobs.add(rec.hook.ID)
+	rec.httpResponse.Header().Set(JobIDHeader, job.id)
+	return job
+}
+
+// writeAcquireError responds to a request whose execution could not be
+// scheduled.
+func (rec *requestExecutionContext) writeAcquireError(err error) {
+	if errors.Is(err, ErrHookRunning) {
+		rec.logger.Warn("hook is already running, dropping request")
+		rec.writeError(http.StatusConflict, ErrorCodeHookRunning, "Hook is already running.")
+		return
+	}
+	rec.logger.Error("error scheduling hook execution", "error", err)
+	rec.writeError(http.StatusInternalServerError, ErrorCodeSchedulingFailed, "Error occurred while scheduling the hook's command.")
 }
 
 func (rec *requestExecutionContext) writeResponse(status int, message string) {
@@ -171,45 +691,53 @@ func (rec *requestExecutionContext) writeHttpStatus(responseCode int) {
 
 func (rec *requestExecutionContext) parseMultipartForm() error {
 	if err := rec.httpRequest.ParseMultipartForm(rec.opts.multipartMaxMemory); err != nil {
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return errBodyReadTimeout
+		}
 		return errors.New("error occurred while parsing multipart form")
 	}
+	if rec.hookRequest.Payload == nil {
+		rec.hookRequest.Payload = make(map[string]interface{})
+	}
 
 	for k, v := range rec.httpRequest.MultipartForm.Value {
 		rec.logger.Debug("found multipart form value", "key", k)
-		if rec.hookRequest.Payload == nil {
-			rec.hookRequest.Payload = make(map[string]interface{})
+		values := make([]interface{}, len(v))
+		for i := range v {
+			values[i] = v[i]
 		}
-		// TODO: support duplicate, named values
-		rec.hookRequest.Payload[k] = v[0]
+		rec.hookRequest.Payload[k] = multipartValue(values)
 	}
 
 	for k, v := range rec.httpRequest.MultipartForm.File {
 		// Force parsing as JSON regardless of Content-Type.
-		var parseAsJSON bool
+		var forceJSON bool
 		for _, j := range rec.hook.JSONStringParameters {
 			if j.Source == "payload" && j.Name == k {
-				parseAsJSON = true
+				forceJSON = true
 				break
 			}
 		}
-		// TODO: we need to support multiple parts
-		// with the same name instead of just processing the first
-		// one. Will need #215 resolved first.
 
-		// MIME encoding can contain duplicate headers, so check them
-		// all.
-		if !parseAsJSON && len(v[0].Header["Content-Type"]) > 0 {
-			for _, j := range v[0].Header["Content-Type"] {
-				if j == "application/json" {
-					parseAsJSON = true
-					break
+		var parts []interface{}
+		for _, fh := range v {
+			parseAsJSON := forceJSON
+			// MIME encoding can contain duplicate headers, so check them
+			// all.
+			if !parseAsJSON && len(fh.Header["Content-Type"]) > 0 {
+				for _, j := range fh.Header["Content-Type"] {
+					if j == "application/json" {
+						parseAsJSON = true
+						break
+					}
 				}
 			}
-		}
+			if !parseAsJSON {
+				continue
+			}
 
-		if parseAsJSON {
-			rec.logger.Debug("parsing multipart form file as JSON", "key", k)
-			f, err := v[0].Open()
+			rec.logger.Debug("parsing multipart form file as JSON", "key", k, "file_name", fh.Filename)
+			f, err := fh.Open()
 			if err != nil {
 				rec.logger.Error("error parsing multipart form file", "error", err)
 				return errors.New("error occurred while parsing multipart form file")
@@ -220,19 +748,93 @@ func (rec *requestExecutionContext) parseMultipartForm() error {
 
 			var part map[string]interface{}
 			err = decoder.Decode(&part)
+			_ = f.Close()
 			if err != nil {
 				rec.logger.Error("error parsing JSON payload file", "error", err)
 			}
+			parts = append(parts, part)
+		}
+		if len(parts) > 0 {
+			rec.hookRequest.Payload[k] = multipartValue(parts)
+		}
+	}
+	return rec.saveUploadedFiles()
+}
 
-			if rec.hookRequest.Payload == nil {
-				rec.hookRequest.Payload = make(map[string]interface{})
+// saveUploadedFiles copies the file parts requested by the
+// pass-uploaded-files-to-command option to temporary files, as the multipart
+// form is removed once the request is done.
+func (rec *requestExecutionContext) saveUploadedFiles() error {
+	for _, arg := range rec.hook.PassUploadedFilesToCommand {
+		envName := arg.EnvName
+		if envName == "" {
+			envName = hook.EnvNamespace + strings.ToUpper(arg.Name)
+		}
+		for _, fh := range rec.httpRequest.MultipartForm.File[arg.Name] {
+			path, err := saveUploadedFile(fh, rec.hook.CommandWorkingDirectory)
+			if err != nil {
+				rec.logger.Error("error saving uploaded file", "key", arg.Name, "file_name", fh.Filename, "error", err)
+				return errors.New("error occurred while saving uploaded file")
 			}
-			rec.hookRequest.Payload[k] = part
+			rec.logger.Debug("saved uploaded file", "key", arg.Name, "file_name", fh.Filename, "path", path)
+			rec.hookRequest.UploadedFiles = append(rec.hookRequest.UploadedFiles, hook.UploadedFile{
+				EnvName:     envName,
+				Path:        path,
+				FileName:    fh.Filename,
+				ContentType: fh.Header.Get("Content-Type"),
+			})
 		}
 	}
 	return nil
 }
 
+// saveUploadedFile copies the file part to a temporary file in dir and
+// returns its path. The extension of the original file name is kept.
+func saveUploadedFile(fh *multipart.FileHeader, dir string) (string, error) {
+	src, err := fh.Open()
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = src.Close() }()
+
+	dst, err := os.CreateTemp(dir, "webhook-upload-*"+filepath.Ext(fh.Filename))
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(dst, src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(dst.Name())
+		return "", err
+	}
+	return dst.Name(), nil
+}
+
+// removeUploadedFiles deletes the temporary files of the uploaded files.
+func (rec *requestExecutionContext) removeUploadedFiles() {
+	if err := rec.hookRequest.RemoveUploadedFiles(); err != nil {
+		rec.logger.Error("error removing uploaded files", "error", err)
+	}
+}
+
+// multipartValue returns the single value of a multipart field as is and
+// repeated values as an array, addressable with index paths like "field.1".
+func multipartValue(values []interface{}) interface{} {
+	if len(values) == 1 {
+		return values[0]
+	}
+	return values
+}
+
+// streamsBody returns whether the body is streamed to the command instead of
+// being read before the execution. Forwarded requests need the raw body, so it
+// is buffered even when streamed.
+func (rec *requestExecutionContext) streamsBody() bool {
+	return rec.hook.StreamBodyToStdin && len(rec.hook.ForwardTo) == 0
+}
+
 // ParseRequest parses the request body and populates the request object.
 // returning error will cause the request to be rejected with 500 status code.
 func (rec *requestExecutionContext) ParseRequest() error {
@@ -242,52 +844,101 @@ func (rec *requestExecutionContext) ParseRequest() error {
 		rec.hookRequest.ContentType = rec.hook.IncomingPayloadContentType
 	}
 
+	rec.hookRequest.SingleValueParameters = rec.hook.SingleValueParameters
 	isMultipart := strings.HasPrefix(rec.hookRequest.ContentType, "multipart/form-data;")
-	if !isMultipart {
+	streamBody := rec.streamsBody()
+	// hooks which don't use the body are triggered without reading it, unless
+	// the request is sampled
+	skipBody := rec.hook.SkipsBody() && rec.sample == nil
+	switch {
+	case skipBody:
+	case streamBody:
+		body := rec.hookRequest.RawRequest.Body
+		if rec.hook.StreamBodyMaxSize > 0 {
+			body = http.MaxBytesReader(rec.httpResponse, body, rec.hook.StreamBodyMaxSize)
+		}
+		rec.hookRequest.BodyStream = body
+	case !isMultipart || len(rec.hook.ForwardTo) > 0:
 		var err error
 		rec.hookRequest.Body, err = io.ReadAll(rec.hookRequest.RawRequest.Body)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return errBodyReadTimeout
+		}
 		if err != nil {
 			rec.logger.Error("error reading the request body", "error", err)
 		}
+		rec.hookRequest.RawRequest.Body = io.NopCloser(bytes.NewReader(rec.hookRequest.Body))
+		rec.sample.setBody(rec.hookRequest.Body)
+		if rec.hook.StreamBodyToStdin {
+			rec.hookRequest.BodyStream = bytes.NewReader(rec.hookRequest.Body)
+		}
 	}
 
 	rec.hookRequest.ParseHeaders(rec.hookRequest.RawRequest.Header)
 	rec.hookRequest.ParseQuery(rec.hookRequest.RawRequest.URL.Query())
 
 	switch {
-	case strings.Contains(rec.hookRequest.ContentType, "json"):
-		if err := rec.hookRequest.ParseJSONPayload(); err != nil {
-			rec.logger.Error("error parsing JSON payload", "error", err)
-		}
-	case strings.Contains(rec.hookRequest.ContentType, "x-www-form-urlencoded"):
-		if err := rec.hookRequest.ParseFormPayload(); err != nil {
-			rec.logger.Error("error parsing form-urlencoded payload", "error", err)
-		}
-	case strings.Contains(rec.hookRequest.ContentType, "xml"):
-		if err := rec.hookRequest.ParseXMLPayload(); err != nil {
-			rec.logger.Error("error parsing XML payload", "error", err)
-		}
+	case skipBody:
+		// the body is left unread and unparsed
+	case streamBody:
+		// the body is left unread for the command
 	case isMultipart:
+		rec.httpRequest.Body = rec.sample.teeBody(rec.httpRequest.Body, rec.opts.multipartMaxMemory)
 		if err := rec.parseMultipartForm(); err != nil {
 			rec.logger.Error("error parsing multipart form", "error", err)
 			return err
 		}
 	default:
-		rec.logger.Warn("unsupported content type, skip parsing body payload",
-			"content_type", rec.hookRequest.ContentType)
+		parsePayload(rec.hook, rec.hookRequest, rec.logger)
 	}
 	if err := rec.hook.ParseJSONParameters(rec.hookRequest); err != nil {
 		rec.logger.Error("error parsing JSON parameters", "error", err)
 	}
+	transformPayload(rec.hook, rec.hookRequest, rec.logger)
 	return nil
 }
 
-func methodInList(method string, methods []string) bool {
-	for _, m := range methods {
-		// TODO: refactor config loading and reloading to sanitize these methods once at load time.
-		if strings.ToUpper(strings.TrimSpace(m)) == method {
-			return true
+// transformPayload applies the payload transform of the hook, if any.
+// Errors are logged and leave the payload as parsed.
+func transformPayload(h *hook.Hook, r *hook.Request, logger *slog.Logger) {
+	if h.PayloadTransform == nil {
+		return
+	}
+	if err := r.TransformPayload(h.PayloadTransform); err != nil {
+		logger.Error("error transforming payload", "error", err)
+	}
+}
+
+// parsePayload decodes the request body according to its content type.
+// Parsing errors are logged and leave the payload empty.
+func parsePayload(h *hook.Hook, r *hook.Request, logger *slog.Logger) {
+	switch {
+	case h.Protobuf != nil && strings.Contains(r.ContentType, "protobuf"):
+		if err := r.ParseProtobufPayload(h.Protobuf); err != nil {
+			logger.Error("error parsing protobuf payload", "error", err)
+		}
+	case strings.Contains(r.ContentType, "ndjson") || strings.Contains(r.ContentType, "jsonl"):
+		if err := r.ParseNDJSONPayload(); err != nil {
+			logger.Error("error parsing NDJSON payload", "error", err)
 		}
+	case strings.Contains(r.ContentType, "json"):
+		if err := r.ParseJSONPayload(); err != nil {
+			logger.Error("error parsing JSON payload", "error", err)
+		}
+	case strings.Contains(r.ContentType, "x-www-form-urlencoded"):
+		if err := r.ParseFormPayload(); err != nil {
+			logger.Error("error parsing form-urlencoded payload", "error", err)
+		}
+	case strings.Contains(r.ContentType, "xml") && h.XMLPayload != nil:
+		if err := r.ParseXMLPayloadWithOptions(h.XMLPayload); err != nil {
+			logger.Error("error parsing XML payload", "error", err)
+		}
+	case strings.Contains(r.ContentType, "xml"):
+		if err := r.ParseXMLPayload(); err != nil {
+			logger.Error("error parsing XML payload", "error", err)
+		}
+	default:
+		logger.Warn("unsupported content type, skip parsing body payload",
+			"content_type", r.ContentType)
 	}
-	return false
 }
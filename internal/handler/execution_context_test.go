@@ -0,0 +1,312 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+func TestWriteMethodNotAllowed(t *testing.T) {
+	for _, tt := range []struct {
+		desc     string
+		hook     hook.Hook
+		defaults []string
+		status   int
+		body     string
+		allow    string
+	}{
+		{"hook methods", hook.Hook{HTTPMethods: []string{"Post ", "put", "POST"}}, []string{"GET"}, 405, "HTTP method not allowed.", "POST, PUT, HEAD, OPTIONS"},
+		{"default methods", hook.Hook{}, []string{"GET"}, 405, "HTTP method not allowed.", "GET, HEAD, OPTIONS"},
+		{"override", hook.Hook{
+			HTTPMethods:              []string{"POST"},
+			MethodNotAllowedResponse: &hook.ResponseOverride{HttpResponseCode: 404, Message: "Not found."},
+		}, nil, 404, "Not found.", "POST, HEAD, OPTIONS"},
+	} {
+		if err := tt.hook.Prepare(); err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		rec := &requestExecutionContext{
+			hook:         &tt.hook,
+			logger:       slog.Default(),
+			httpResponse: rr,
+			opts:         options{defaultAllowedMethods: tt.defaults},
+		}
+		if rec.IsHTTPMethodAllowed(http.MethodDelete) {
+			t.Errorf("%s: DELETE must not be allowed", tt.desc)
+		}
+		rec.writeMethodNotAllowed()
+		if rr.Code != tt.status || rr.Body.String() != tt.body || rr.Header().Get("Allow") != tt.allow {
+			t.Errorf("%s: expected {%d, %q, %q}, got {%d, %q, %q}", tt.desc, tt.status, tt.body, tt.allow,
+				rr.Code, rr.Body.String(), rr.Header().Get("Allow"))
+		}
+	}
+}
+
+func TestWriteOptions(t *testing.T) {
+	request := httptest.NewRequest(http.MethodOptions, "/hooks/test", nil)
+	request.Header.Set("Access-Control-Request-Method", "POST")
+	rr := httptest.NewRecorder()
+	rec := &requestExecutionContext{
+		hook: &hook.Hook{
+			HTTPMethods:     []string{"POST"},
+			ResponseHeaders: hook.ResponseHeaders{{Name: "Access-Control-Allow-Origin", Value: "*"}},
+		},
+		logger:       slog.Default(),
+		httpRequest:  request,
+		httpResponse: rr,
+	}
+	rec.writeOptions()
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d", rr.Code)
+	}
+	for name, value := range map[string]string{
+		"Allow":                        "POST, HEAD, OPTIONS",
+		"Access-Control-Allow-Methods": "POST, HEAD, OPTIONS",
+		"Access-Control-Allow-Origin":  "*",
+	} {
+		if got := rr.Header().Get(name); got != value {
+			t.Errorf("expected header %s %q, got %q", name, value, got)
+		}
+	}
+}
+
+// readRecorder records whether its reader was read.
+type readRecorder struct {
+	io.Reader
+	read bool
+}
+
+func (r *readRecorder) Read(p []byte) (int, error) {
+	r.read = true
+	return r.Reader.Read(p)
+}
+
+func TestParseRequestSkipsBody(t *testing.T) {
+	for _, tt := range []struct {
+		desc string
+		hook hook.Hook
+		read bool
+	}{
+		{"header argument", hook.Hook{PassArgumentsToCommand: []hook.Argument{{Source: hook.SourceHeader, Name: "X-Event"}}}, false},
+		{"payload argument", hook.Hook{PassArgumentsToCommand: []hook.Argument{{Source: hook.SourcePayload, Name: "ref"}}}, true},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			tt.hook.AnalyzeBodyUsage()
+			body := &readRecorder{Reader: strings.NewReader(`{"ref": "main"}`)}
+			r := httptest.NewRequest(http.MethodPost, "/hooks/test?a=b", body)
+			r.Header.Set("Content-Type", "application/json")
+			r.Header.Set("X-Event", "push")
+			rec := &requestExecutionContext{
+				hook:         &tt.hook,
+				hookRequest:  &hook.Request{RawRequest: r},
+				logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+				httpRequest:  r,
+				httpResponse: httptest.NewRecorder(),
+			}
+			if err := rec.ParseRequest(); err != nil {
+				t.Fatal(err)
+			}
+			if body.read != tt.read {
+				t.Errorf("expected body read %t, got %t", tt.read, body.read)
+			}
+			if (rec.hookRequest.Payload != nil) != tt.read {
+				t.Errorf("expected payload parsed %t, got %v", tt.read, rec.hookRequest.Payload)
+			}
+			if rec.hookRequest.Headers["X-Event"] != "push" || rec.hookRequest.Query["a"] != "b" {
+				t.Errorf("expected headers and query to be parsed, got %v and %v", rec.hookRequest.Headers, rec.hookRequest.Query)
+			}
+		})
+	}
+}
+
+func TestKeysSeparateRoutes(t *testing.T) {
+	keys := func(h *hook.Hook) (string, string) {
+		rec := &requestExecutionContext{
+			hook: h,
+			hookRequest: &hook.Request{Headers: map[string]interface{}{
+				"Idempotency-Key": "retry-1",
+				"X-Delivery":      "delivery-1",
+			}},
+			logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		}
+		dedup, ok := rec.deduplicationKey()
+		if !ok {
+			t.Fatalf("expected a deduplication key for host %q", h.Host)
+		}
+		idem, ok := rec.idempotencyKey()
+		if !ok {
+			t.Fatalf("expected an idempotency key for host %q", h.Host)
+		}
+		return dedup, idem
+	}
+	newHook := func(host string) *hook.Hook {
+		return &hook.Hook{
+			ID:               "deploy",
+			Host:             host,
+			IdempotencyTTL:   hook.Duration(time.Minute),
+			DeduplicationKey: []hook.Argument{{Source: hook.SourceHeader, Name: "X-Delivery"}},
+		}
+	}
+
+	dedupA, idemA := keys(newHook("a.example.com"))
+	dedupB, idemB := keys(newHook("b.example.com"))
+	if dedupA == dedupB {
+		t.Errorf("expected deduplication keys of hooks on different hosts to differ, got %q", dedupA)
+	}
+	if idemA == idemB {
+		t.Errorf("expected idempotency keys of hooks on different hosts to differ, got %q", idemA)
+	}
+	if dedup, idem := keys(newHook("A.example.com:443")); dedup != dedupA || idem != idemA {
+		t.Errorf("expected keys of the same route to match, got %q and %q", dedup, idem)
+	}
+}
+
+func TestHandleUploadSaveError(t *testing.T) {
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	fw, err := mw.CreateFormFile("artifact", "build.tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = fw.Write([]byte("artifact"))
+	_ = mw.Close()
+
+	h := &hook.Hook{
+		ID:                         "upload",
+		ExecuteCommand:             "true",
+		CommandWorkingDirectory:    filepath.Join(t.TempDir(), "missing"),
+		PassUploadedFilesToCommand: []hook.Argument{{Source: hook.SourcePayload, Name: "artifact"}},
+	}
+	if err := h.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/hooks/upload", body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	rr := httptest.NewRecorder()
+	rec := &requestExecutionContext{
+		hook:         h,
+		hookRequest:  &hook.Request{RawRequest: r},
+		logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+		httpRequest:  r,
+		httpResponse: rr,
+		opts:         options{multipartMaxMemory: 1 << 20},
+	}
+	// the handler must stop before the rules are evaluated and the hook is
+	// executed, which would need the scheduler, activity feed and so on
+	rec.Handle(rr, r)
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected status 500, got %d", rr.Code)
+	}
+	if got := rr.Body.String(); got != "error occurred while saving uploaded file" {
+		t.Errorf("expected only the error to be written, got %q", got)
+	}
+	if len(rec.hookRequest.UploadedFiles) != 0 {
+		t.Errorf("expected no uploaded files to be kept, got %v", rec.hookRequest.UploadedFiles)
+	}
+}
+
+// deduplicatedHook returns a hook capturing the output of a command, which
+// records its runs in the returned file, and a function handling identical
+// deliveries of it with the context.
+func deduplicatedHook(t *testing.T) (*hook.Hook, string, func(context.Context) *httptest.ResponseRecorder) {
+	t.Helper()
+	runs := filepath.Join(t.TempDir(), "runs")
+	h := shellHook(`echo run >> ` + runs + `; sleep 0.3; echo done`)
+	h.ID = "deploy"
+	h.CaptureCommandOutput = true
+	h.DeduplicationKey = []hook.Argument{{Source: hook.SourceHeader, Name: "X-Delivery"}}
+	scheduler, executions := NewScheduler(0), newSharedExecutions()
+	return h, runs, func(ctx context.Context) *httptest.ResponseRecorder {
+		r := httptest.NewRequestWithContext(ctx, http.MethodPost, "/hooks/deploy", nil)
+		r.Header.Set("X-Delivery", "delivery-1")
+		rr := httptest.NewRecorder()
+		rec := &requestExecutionContext{
+			hook:         h,
+			hookRequest:  &hook.Request{RawRequest: r},
+			logger:       slog.New(slog.DiscardHandler),
+			httpRequest:  r,
+			httpResponse: rr,
+			scheduler:    scheduler,
+			executions:   executions,
+		}
+		rec.Handle(rr, r)
+		return rr
+	}
+}
+
+// waitForFile waits until the file exists.
+func waitForFile(t *testing.T, path string) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(path); err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s was not created", path)
+		}
+	}
+}
+
+func TestHandleDeduplicationSerialize(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a shell")
+	}
+	h, runs, handle := deduplicatedHook(t)
+	h.ConcurrencyPolicy = hook.ConcurrencySerialize
+
+	first := make(chan *httptest.ResponseRecorder)
+	go func() { first <- handle(context.Background()) }()
+	waitForFile(t, runs)
+	// the identical delivery attaches to the running execution instead of
+	// waiting for it to run the command again
+	second := handle(context.Background())
+	for i, rr := range []*httptest.ResponseRecorder{<-first, second} {
+		if rr.Code != http.StatusOK || rr.Body.String() != "done\n" {
+			t.Errorf("delivery %d: expected the shared output, got %d %q", i+1, rr.Code, rr.Body.String())
+		}
+	}
+	if content, _ := os.ReadFile(runs); string(content) != "run\n" {
+		t.Errorf("expected the command to run once, got %q", content)
+	}
+}
+
+func TestHandleDeduplicationDisconnect(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a shell")
+	}
+	_, runs, handle := deduplicatedHook(t)
+
+	ctx, disconnect := context.WithCancel(context.Background())
+	first := make(chan *httptest.ResponseRecorder)
+	go func() { first <- handle(ctx) }()
+	waitForFile(t, runs)
+	second := make(chan *httptest.ResponseRecorder)
+	go func() { second <- handle(context.Background()) }()
+	// the client of a delivery waiting for the shared execution leaves
+	// without waiting for it
+	waiting, leave := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer leave()
+	if rr := handle(waiting); rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected the delivery to fail once its client left, got %d", rr.Code)
+	}
+	// the client of the delivery leading the execution disconnects, which
+	// doesn't terminate the command shared with the second delivery
+	disconnect()
+	<-first
+	if rr := <-second; rr.Code != http.StatusOK || rr.Body.String() != "done\n" {
+		t.Errorf("expected the shared output after the first client disconnected, got %d %q", rr.Code, rr.Body.String())
+	}
+}
@@ -1,34 +1,65 @@
 package handler
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
-	"syscall"
 	"time"
 
 	"github.com/hashicorp/go-multierror"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/trace"
 
 	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+	"github.com/kaufland-ecommerce/ci-webhook/internal/sandbox"
 )
 
+// HookLookup resolves the hooks chained to or shadowing a hook within its
+// tenant and lists the tenants, see hook_manager.Manager.
+type HookLookup interface {
+	GetForTenant(tenant, id string) *hook.Hook
+	Tenants() []string
+}
+
 type Executor struct {
 	hook   *hook.Hook
 	req    *hook.Request
 	logger *slog.Logger
 
 	files []hook.FileParameter
+
+	// lookup resolves chained hooks; chaining is disabled when nil
+	lookup HookLookup
+	// chain holds the IDs of the hooks which led to this execution
+	chain []string
+	// activity receives the start and outcome of the execution
+	activity *ActivityFeed
+	// lastRuns passes the previous execution to the command and records
+	// this one
+	lastRuns *LastRuns
+	// circuits counts the failures of hooks with a circuit breaker
+	circuits *CircuitBreakers
+	// processes tracks the running command, so it is terminated on shutdown
+	processes *Processes
+	// detached executions outlive the request and are traced in their own
+	// trace, linked to the span of the request
+	detached bool
+	// shadow executions are not counted as running executions and their
+	// timeouts are recorded with the shadow attribute
+	shadow bool
+	// timeoutReason is set if the last command was terminated by a timeout
+	timeoutReason string
 }
 
 func NewExecutor(h *hook.Hook, req *hook.Request, logger *slog.Logger) *Executor {
@@ -39,6 +70,50 @@ func NewExecutor(h *hook.Hook, req *hook.Request, logger *slog.Logger) *Executor
 	}
 }
 
+// WithChaining enables running the on-success and on-failure hooks after the
+// command finished, resolving them within the tenant of the hook. The
+// commands of hooks of a tenant don't receive the environment variables of
+// the other tenants of the lookup.
+func (e *Executor) WithChaining(lookup HookLookup) *Executor {
+	e.lookup = lookup
+	return e
+}
+
+// WithActivity publishes the start and the outcome of the execution, and of
+// chained executions, to the feed.
+func (e *Executor) WithActivity(feed *ActivityFeed) *Executor {
+	e.activity = feed
+	return e
+}
+
+// WithLastRuns passes the previous execution of the hook to the command and
+// records the execution, and chained executions, for the next one.
+func (e *Executor) WithLastRuns(lastRuns *LastRuns) *Executor {
+	e.lastRuns = lastRuns
+	return e
+}
+
+// WithCircuits counts the result of the execution, and of chained executions,
+// towards the circuit breaker of the hook.
+func (e *Executor) WithCircuits(circuits *CircuitBreakers) *Executor {
+	e.circuits = circuits
+	return e
+}
+
+// WithProcesses tracks the running command, and the commands of chained
+// executions, so they are terminated on shutdown.
+func (e *Executor) WithProcesses(processes *Processes) *Executor {
+	e.processes = processes
+	return e
+}
+
+// WithDetachedTrace traces the execution in its own trace instead of as a
+// child of the span of the request, for executions outliving the request.
+func (e *Executor) WithDetachedTrace() *Executor {
+	e.detached = true
+	return e
+}
+
 func (e *Executor) checkCommandExistsAndValid() (string, error) {
 	var path string
 	command := e.hook.ExecuteCommand
@@ -107,7 +182,7 @@ func (e *Executor) cleanupFileArguments() {
 	}
 }
 
-func (e *Executor) execHookCommand(w io.Writer) error {
+func (e *Executor) execHookCommand(ctx context.Context, w io.Writer) error {
 	// check the command exists
 	cmdPath, err := e.checkCommandExistsAndValid()
 	if err != nil {
@@ -118,6 +193,9 @@ func (e *Executor) execHookCommand(w io.Writer) error {
 	// construct command
 	cmd := exec.Command(cmdPath)
 	cmd.Dir = e.hook.CommandWorkingDirectory
+	if e.hook.StreamBodyToStdin && e.req.BodyStream != nil {
+		cmd.Stdin = e.req.BodyStream
+	}
 	// arguments
 	cmd.Args, err = e.hook.ExtractCommandArguments(e.req)
 	if err != nil {
@@ -136,8 +214,14 @@ func (e *Executor) execHookCommand(w io.Writer) error {
 		e.logger.Warn("error preparing file arguments", "error", err)
 	}
 	envs = append(envs, envFileArgs...)
+	envs = append(envs, e.req.UploadedFilesEnv()...)
+	envs = append(envs, e.metadataEnv(ctx)...)
+	envs = append(envs, e.lastRuns.env(e.hook)...)
+	if e.hook.PassPayloadDigest {
+		envs = append(envs, e.req.PayloadDigestEnv()...)
+	}
 	// set all on command
-	cmd.Env = append(os.Environ(), envs...)
+	cmd.Env = append(e.environ(), envs...)
 	e.logger.WithGroup("exec").Info("executing command",
 		"command", cmd.Path,
 		"arguments", cmd.Args,
@@ -145,61 +229,177 @@ func (e *Executor) execHookCommand(w io.Writer) error {
 		"environment", envs,
 		"working_directory", cmd.Dir,
 		"timeout", timeout,
+		"no_output_timeout", time.Duration(e.hook.NoOutputTimeout),
 	)
+	signal, err := parseKillSignal(e.hook.KillSignal)
+	if err != nil {
+		e.logger.Error("error parsing kill signal", "error", err)
+		return err
+	}
+	p := newProcess(cmd, signal, time.Duration(e.hook.TerminationGracePeriod), e.logger)
+	p.shadow = e.shadow
+	noOutputTimeout := time.Duration(e.hook.NoOutputTimeout)
+	// track the output for detecting stalled commands
+	if noOutputTimeout > 0 {
+		w = p.trackOutput(w)
+	}
 	cmd.Stderr = w
 	cmd.Stdout = w
-	// handling the timeout
-	if timeout > 0 {
-		// sets the same PGID for the child processes
-		setPGID(cmd)
-		terminationTimer := e.stopProcessWithTimeout(cmd, timeout)
-		// stop the timer if a process had terminated before the timeout reached
-		defer terminationTimer.Stop()
-	}
-	return cmd.Run()
+	// sets the same PGID for the child processes, so they are terminated
+	// together
+	setPGID(cmd)
+	// start through the sandbox launcher, which confines the command and
+	// sets its priorities
+	scheduling := sandbox.Scheduling{Nice: e.hook.Nice, IONice: e.hook.IONice, Umask: e.hook.Umask}
+	if err := sandbox.Wrap(cmd, e.hook.Sandbox, scheduling); err != nil {
+		e.logger.Error("error setting up command sandbox", "error", err)
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	e.processes.add(p)
+	defer e.processes.remove(p)
+	go p.watch(ctx, timeout, noOutputTimeout)
+	err = cmd.Wait()
+	close(p.exited)
+	e.timeoutReason = p.timeoutReason()
+	if reason := e.timeoutReason; reason != "" {
+		if m, err := executorMetrics(); err == nil {
+			attrs := []attribute.KeyValue{metricReasonKey.String(reason)}
+			if e.shadow {
+				attrs = append(attrs, metricShadowKey.Bool(true))
+			}
+			m.timeouts.Add(ctx, 1, metric.WithAttributes(hookAttributes(e.hook, attrs...)...))
+		}
+	}
+	return err
 }
 
-// stopProcessWithTimeout handles termination of the process with a configurable timeout
-func (e *Executor) stopProcessWithTimeout(cmd *exec.Cmd, timeout time.Duration) *time.Timer {
-	e.logger.Info("setting up timeout for current operation", "timeout", timeout)
-
-	return time.AfterFunc(timeout, func() {
-
-		e.logger.Info("sending SIGTERM because timeout has reached", "timeout", timeout)
-		// attempting to terminate the process with pre-configured timeout
-		if err := sendKillSignal(e, cmd.Process.Pid, syscall.SIGTERM); err != nil {
-			e.logger.Warn("failed to send SIGTERM, trying SIGKILL instead", "error", err)
-		}
-		// attempting to kill the process with additional timeout on top
-		killingTimer := time.AfterFunc(time.Second*time.Duration(10), func() {
-			if err := sendKillSignal(e, cmd.Process.Pid, syscall.SIGKILL); err != nil {
-				e.logger.Error("failed to send SIGKILL", "error", err)
+// environ returns the environment of webhook passed to the command. Hooks of
+// a tenant don't receive the variables of other tenants, see
+// hook.TenantEnvPrefix. A variable belongs to the tenant with the longest
+// matching prefix, so tenant team keeps TEAM_SECRET, but not TEAM_A_SECRET
+// of tenant team-a.
+func (e *Executor) environ() []string {
+	environ := os.Environ()
+	if e.hook.Tenant == "" || e.lookup == nil {
+		return environ
+	}
+	var prefixes []string
+	for _, tenant := range e.lookup.Tenants() {
+		prefixes = append(prefixes, hook.TenantEnvPrefix(tenant))
+	}
+	own := hook.TenantEnvPrefix(e.hook.Tenant)
+	return slices.DeleteFunc(environ, func(kv string) bool {
+		owner := ""
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(kv, prefix) && len(prefix) > len(owner) {
+				owner = prefix
 			}
-		})
-		// stop the timer if process had terminated before timer reached
-		defer killingTimer.Stop()
-		// waiting for the process being exited
-		if processState, err := cmd.Process.Wait(); err != nil && processState != nil {
-			e.logger.Error("error during process exiting", "error", err)
 		}
-		e.logger.Info("command has been stopped", "command", cmd.Path)
+		return owner != "" && owner != own
 	})
 }
 
+// metadataEnv returns the standard environment variables describing the
+// request and the execution, which are passed to every command.
+func (e *Executor) metadataEnv(ctx context.Context) []string {
+	var method, clientIP, receivedAt, traceID string
+	if raw := e.req.RawRequest; raw != nil {
+		method = raw.Method
+		clientIP = raw.RemoteAddr
+		if host, _, err := net.SplitHostPort(raw.RemoteAddr); err == nil {
+			clientIP = host
+		}
+	}
+	if !e.req.ReceivedAt.IsZero() {
+		receivedAt = e.req.ReceivedAt.UTC().Format(time.RFC3339Nano)
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		traceID = sc.TraceID().String()
+	}
+	return []string{
+		"WEBHOOK_REQUEST_ID=" + e.req.ID,
+		"WEBHOOK_HOOK_ID=" + e.hook.ID,
+		"WEBHOOK_CLIENT_IP=" + clientIP,
+		"WEBHOOK_METHOD=" + method,
+		"WEBHOOK_ROUTE=" + e.req.Route,
+		"WEBHOOK_RECEIVED_AT=" + receivedAt,
+		"WEBHOOK_TRACE_ID=" + traceID,
+	}
+}
+
+// Execute runs the command of the hook followed by its chained hooks. The
+// output of all commands is written to w, the returned error reflects the
+// command of this hook only.
 func (e *Executor) Execute(ctx context.Context, w io.Writer) error {
+	started := time.Now()
+	e.publish(ActivityEvent{Type: ActivityStarted, Time: started})
+	shadow := e.startShadow(ctx)
 	// run exec with tracing
-	err := e.trace(ctx, func() error { return e.execute(w) })
+	err := e.trace(ctx, func(ctx context.Context) error { return e.execute(ctx, w) })
 	if errors.Is(err, instrumentationErr) {
 		// run exec without tracing
 		e.logger.Warn("tracing failed, fallback to non-instrumented execution", "error", err)
-		return e.execute(w)
+		err = e.execute(ctx, w)
+	}
+	outcome := ActivityEvent{Type: ActivityFinished, Duration: time.Since(started).Milliseconds()}
+	if err != nil {
+		outcome.Type, outcome.Error = ActivityFailed, err.Error()
 	}
+	e.publish(outcome)
+	if shadow != nil {
+		go e.logShadow(shadow, err)
+	}
+	e.runChain(ctx, w, err)
 	return err
 }
 
+// publish sends an event about this execution to the activity feed.
+func (e *Executor) publish(event ActivityEvent) {
+	event.HookID, event.RequestID, event.Route = e.hook.ID, e.req.ID, e.req.Route
+	e.activity.Publish(event)
+}
+
+// runChain executes the hooks chained to the outcome of the command with the
+// same request.
+func (e *Executor) runChain(ctx context.Context, w io.Writer, execErr error) {
+	if e.lookup == nil {
+		return
+	}
+	next := e.hook.OnSuccess
+	if execErr != nil {
+		next = e.hook.OnFailure
+	}
+	chain := append(slices.Clone(e.chain), e.hook.ID)
+	for _, id := range next {
+		if slices.Contains(chain, id) {
+			e.logger.Warn("skipping chained hook, it is already part of the chain", "chained_hook_id", id, "chain", chain)
+			continue
+		}
+		h := e.lookup.GetForTenant(e.hook.Tenant, id)
+		if h == nil {
+			e.logger.Error("chained hook not found", "chained_hook_id", id)
+			continue
+		}
+		e.logger.Info("running chained hook", "chained_hook_id", id)
+		chained := NewExecutor(h, e.req, e.logger.With("chained_hook_id", id))
+		chained.lookup = e.lookup
+		chained.activity = e.activity
+		chained.lastRuns = e.lastRuns
+		chained.circuits = e.circuits
+		chained.processes = e.processes
+		chained.chain = chain
+		if err := chained.Execute(ctx, w); err != nil {
+			e.logger.Warn("chained hook failed", "chained_hook_id", id, "error", err)
+		}
+	}
+}
+
 var instrumentationErr = errors.New("instrumentation error")
 
-func (e *Executor) trace(ctx context.Context, fn func() error) error {
+func (e *Executor) trace(ctx context.Context, fn func(ctx context.Context) error) error {
 	// setup tracing span
 	const (
 		mainOpName     = "hook.executor"
@@ -208,8 +408,7 @@ func (e *Executor) trace(ctx context.Context, fn func() error) error {
 		metricError    = mainOpName + ".run.errors"
 	)
 	tracer := otel.Tracer(mainOpName)
-	attrHookID := traceHookIDKey.String(e.hook.ID)
-	metricAttrs := metric.WithAttributes(attrHookID)
+	metricAttrs := metric.WithAttributes(hookAttributes(e.hook)...)
 	// setup metrics
 	meter := otel.Meter(mainOpName)
 	cInflight, err := meter.Int64UpDownCounter(metricInflight)
@@ -224,19 +423,47 @@ func (e *Executor) trace(ctx context.Context, fn func() error) error {
 	if err != nil {
 		return errors.Join(instrumentationErr, fmt.Errorf("meter failed [%s]: %w", metricError, err))
 	}
+	m, err := executorMetrics()
+	if err != nil {
+		return err
+	}
 	// start tracing and metering
-	ctx, span := tracer.Start(ctx, "RUN "+e.hook.ID, trace.WithAttributes(
-		attrHookID,
+	opts := []trace.SpanStartOption{trace.WithAttributes(hookAttributes(e.hook,
 		traceReqIDKey.String(e.req.ID),
 		traceOperation.String("hook.execute"),
-	))
+	)...)}
+	trigger := trace.SpanFromContext(ctx)
+	if sc := trigger.SpanContext(); sc.IsValid() {
+		opts = append(opts, trace.WithLinks(trace.Link{
+			SpanContext: sc,
+			Attributes:  []attribute.KeyValue{traceLinkKey.String("trigger")},
+		}))
+		if e.detached {
+			opts = append(opts, trace.WithNewRoot())
+		}
+	}
+	ctx, span := tracer.Start(ctx, "RUN "+e.hook.ID, opts...)
 	defer span.End()
+	// the span of the request links to the execution as well, unless it
+	// already ended
+	trigger.AddLink(trace.Link{
+		SpanContext: span.SpanContext(),
+		Attributes:  []attribute.KeyValue{traceLinkKey.String("execution")},
+	})
 
 	cInflight.Add(ctx, 1, metricAttrs)
 	defer cInflight.Add(ctx, -1, metricAttrs)
 
 	cTotal.Add(ctx, 1, metricAttrs)
-	if err := fn(); err != nil {
+	started := time.Now()
+	err = fn(ctx)
+	m.duration.Record(ctx, time.Since(started).Seconds(), metricAttrs)
+	m.exitCodes.Add(ctx, 1, metric.WithAttributes(hookAttributes(e.hook, metricExitCodeKey.Int(exitCode(err)))...))
+	span.SetAttributes(traceExitCodeKey.Int(exitCode(err)), traceTimeoutKey.Bool(e.timeoutReason != ""))
+	if e.timeoutReason != "" {
+		span.SetAttributes(traceTimeoutReasonKey.String(e.timeoutReason))
+	}
+	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "exec failed")
 		cError.Add(ctx, 1, metricAttrs)
@@ -245,14 +472,31 @@ func (e *Executor) trace(ctx context.Context, fn func() error) error {
 	return nil
 }
 
-func (e *Executor) execute(w io.Writer) error {
-	commandOutputBuf := &bytes.Buffer{}
-	mw := io.MultiWriter(w, commandOutputBuf)
+func (e *Executor) execute(ctx context.Context, w io.Writer) error {
+	// only the tail of the output is kept for logging, the output itself is
+	// buffered by w as far as the response needs it
+	tail := &tailBuffer{max: logOutputLimit}
+	mw := io.MultiWriter(w, tail)
 	defer func() {
 		// log after execution finished, capturing out even on error
-		e.logger.Info("execution finished", "exec.output", commandOutputBuf.String())
+		attrs := []any{"exec.output", tail.String()}
+		if tail.Truncated() {
+			attrs = append(attrs, "exec.output_truncated", true, "exec.output_bytes", tail.size)
+		}
+		e.logger.Info("execution finished", attrs...)
+		traceOutput(ctx, tail.String(), tail.size)
+		if m, err := executorMetrics(); err == nil {
+			m.outputBytes.Add(ctx, tail.size, metric.WithAttributes(hookAttributes(e.hook)...))
+		}
 	}()
-	if err := e.execHookCommand(mw); err != nil {
+	started := time.Now()
+	err := e.execHookCommand(ctx, mw)
+	e.lastRuns.record(e.hook, e.req, started, err)
+	if e.circuits.record(e.hook, err, time.Now()) {
+		e.logger.Warn("circuit of the hook opened, skipping executions during cooldown",
+			"cooldown", e.hook.CircuitBreaker.CooldownOrDefault())
+	}
+	if err != nil {
 		e.logger.Error("error executing hook's command", "error", err)
 		return err
 	}
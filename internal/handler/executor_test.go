@@ -0,0 +1,320 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http/httptest"
+	"runtime"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+func TestExecutorMetadataEnv(t *testing.T) {
+	raw := httptest.NewRequest("POST", "/hooks/deploy", nil)
+	raw.RemoteAddr = "192.0.2.1:4321"
+	req := &hook.Request{
+		ID:         "abc123",
+		RawRequest: raw,
+		ReceivedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		Route:      "/hooks/*",
+	}
+	traceID := trace.TraceID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID,
+		SpanID:  trace.SpanID{1},
+	}))
+
+	env := NewExecutor(&hook.Hook{ID: "deploy"}, req, slog.Default()).metadataEnv(ctx)
+	for _, expected := range []string{
+		"WEBHOOK_REQUEST_ID=abc123",
+		"WEBHOOK_HOOK_ID=deploy",
+		"WEBHOOK_CLIENT_IP=192.0.2.1",
+		"WEBHOOK_METHOD=POST",
+		"WEBHOOK_ROUTE=/hooks/*",
+		"WEBHOOK_RECEIVED_AT=2024-05-01T12:00:00Z",
+		"WEBHOOK_TRACE_ID=0102030405060708090a0b0c0d0e0f10",
+	} {
+		if !slices.Contains(env, expected) {
+			t.Errorf("expected %q in %v", expected, env)
+		}
+	}
+}
+
+// shellHook returns a hook running the shell script.
+func shellHook(script string) *hook.Hook {
+	return &hook.Hook{
+		ID:             "shell",
+		ExecuteCommand: "/bin/sh",
+		PassArgumentsToCommand: []hook.Argument{
+			{Source: hook.SourceString, Name: "-c"},
+			{Source: hook.SourceString, Name: script},
+		},
+	}
+}
+
+// hookList is a HookLookup of the hooks.
+type hookList []*hook.Hook
+
+func (l hookList) GetForTenant(tenant, id string) *hook.Hook {
+	for _, h := range l {
+		if h.Tenant == tenant && h.ID == id {
+			return h
+		}
+	}
+	return nil
+}
+
+func (l hookList) Tenants() []string {
+	var tenants []string
+	for _, h := range l {
+		if h.Tenant != "" && !slices.Contains(tenants, h.Tenant) {
+			tenants = append(tenants, h.Tenant)
+		}
+	}
+	return tenants
+}
+
+func TestExecutorTenantIsolation(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a shell")
+	}
+	t.Setenv("TEAM_SECRET", "team")
+	t.Setenv("TEAM_A_SECRET", "team-a")
+	t.Setenv("TEAM_B_SECRET", "team-b")
+	t.Setenv("GLOBAL", "global")
+
+	script := `echo "${TEAM_SECRET:-} ${TEAM_A_SECRET:-} ${TEAM_B_SECRET:-} ${GLOBAL:-}"`
+	deploy := shellHook(script)
+	deploy.ID, deploy.Tenant, deploy.OnSuccess = "deploy", "team-a", []string{"notify"}
+	// the chained hook of team-b shares the ID, but is never run for team-a
+	foreign := shellHook(`echo foreign`)
+	foreign.ID, foreign.Tenant = "notify", "team-b"
+	notify := shellHook(`echo notify`)
+	notify.ID, notify.Tenant = "notify", "team-a"
+	team := shellHook(script)
+	team.ID, team.Tenant = "team", "team"
+	global := shellHook(script)
+	global.ID = "global"
+	hooks := hookList{deploy, foreign, notify, team, global}
+
+	for _, tt := range []struct {
+		hook     *hook.Hook
+		expected string
+	}{
+		{deploy, " team-a  global\nnotify\n"},
+		{team, "team   global\n"},
+		{global, "team team-a team-b global\n"},
+	} {
+		out := &bytes.Buffer{}
+		err := NewExecutor(tt.hook, &hook.Request{ID: tt.hook.ID}, slog.New(slog.DiscardHandler)).
+			WithChaining(hooks).
+			Execute(context.Background(), out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.hook.ID, tt.expected, out.String())
+		}
+	}
+}
+
+func TestExecutorTermination(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires signals")
+	}
+	tests := []struct {
+		desc    string
+		script  string
+		signal  string
+		cancel  bool
+		cleanup bool
+		minimum time.Duration
+	}{
+		{"cleanup after timeout", `trap 'echo cleanup; exit 3' TERM; while :; do sleep 0.05; done`, "", false, true, 0},
+		{"cleanup after cancellation", `trap 'echo cleanup; exit 3' TERM; while :; do sleep 0.05; done`, "", true, true, 0},
+		{"cleanup after kill signal", `trap 'echo cleanup; exit 3' INT; while :; do sleep 0.05; done`, "SIGINT", false, true, 0},
+		{"kill after grace period", `trap '' TERM; while :; do sleep 0.05; done`, "", false, false, 500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			h := shellHook(tt.script)
+			h.Timeout = hook.Duration(300 * time.Millisecond)
+			h.TerminationGracePeriod = hook.Duration(500 * time.Millisecond)
+			h.KillSignal = tt.signal
+			ctx := context.Background()
+			if tt.cancel {
+				h.Timeout = 0
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, 300*time.Millisecond)
+				defer cancel()
+			}
+
+			out := &bytes.Buffer{}
+			started := time.Now()
+			err := NewExecutor(h, &hook.Request{}, slog.Default()).execHookCommand(ctx, out)
+			elapsed := time.Since(started)
+			if err == nil {
+				t.Fatal("expected terminated command to fail")
+			}
+			if strings.Contains(out.String(), "cleanup") != tt.cleanup {
+				t.Errorf("expected cleanup %t, got output %q", tt.cleanup, out.String())
+			}
+			if elapsed < 300*time.Millisecond+tt.minimum {
+				t.Errorf("expected command to run for at least %s, ran %s", 300*time.Millisecond+tt.minimum, elapsed)
+			}
+			if elapsed > 5*time.Second {
+				t.Errorf("expected command to be stopped, ran %s", elapsed)
+			}
+		})
+	}
+}
+
+func TestProcessesTerminate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires signals")
+	}
+	processes := NewProcesses()
+	done := make(chan error)
+	out := &bytes.Buffer{}
+	go func() {
+		done <- NewExecutor(shellHook(`trap 'echo cleanup; exit 3' TERM; echo started; while :; do sleep 0.05; done`), &hook.Request{}, slog.Default()).
+			WithProcesses(processes).
+			execHookCommand(context.Background(), out)
+	}()
+	// wait for the command to be running
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		processes.mu.Lock()
+		n := len(processes.running)
+		processes.mu.Unlock()
+		if n > 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	processes.Terminate()
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(out.String(), "cleanup") {
+			t.Errorf("expected command to be terminated gracefully, got %v: %q", err, out.String())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("command was not terminated")
+	}
+}
+
+func TestParseKillSignal(t *testing.T) {
+	for name, expected := range map[string]syscall.Signal{"": syscall.SIGTERM, "SIGINT": syscall.SIGINT, "quit": syscall.SIGQUIT} {
+		if signal, err := parseKillSignal(name); err != nil || signal != expected {
+			t.Errorf("expected %q to be %s, got %s (%v)", name, expected, signal, err)
+		}
+	}
+	if _, err := parseKillSignal("SIGKILL"); err == nil {
+		t.Error("expected error for unsupported signal")
+	}
+}
+
+func TestExecutorNoOutputTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires signals")
+	}
+	h := shellHook(`for i in 1 2 3 4 5; do echo tick; sleep 0.1; done; [ "$1" = stall ] && sleep 10; echo done`)
+	h.NoOutputTimeout = hook.Duration(300 * time.Millisecond)
+
+	// regular output keeps the command running beyond the no-output timeout
+	out := &bytes.Buffer{}
+	if err := NewExecutor(h, &hook.Request{}, slog.Default()).execHookCommand(context.Background(), out); err != nil {
+		t.Fatalf("expected command to succeed, got %v: %q", err, out.String())
+	}
+
+	h.PassArgumentsToCommand = append(h.PassArgumentsToCommand,
+		hook.Argument{Source: hook.SourceString, Name: "sh"},
+		hook.Argument{Source: hook.SourceString, Name: "stall"},
+	)
+	out.Reset()
+	started := time.Now()
+	err := NewExecutor(h, &hook.Request{}, slog.Default()).execHookCommand(context.Background(), out)
+	if err == nil || strings.Contains(out.String(), "done") {
+		t.Errorf("expected stalled command to be terminated, got %v: %q", err, out.String())
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("expected stalled command to be terminated early, ran %s", elapsed)
+	}
+}
+
+func TestExecutorLastRunEnv(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a shell")
+	}
+	h := shellHook(`echo "last=${HOOK_LAST_EXIT_CODE:-none} request=${HOOK_LAST_REQUEST_ID:-none} at=${HOOK_LAST_RUN_AT:-none}"; exit 3`)
+	h.ID = "last-run"
+	lastRuns := NewLastRuns()
+	run := func(id string) string {
+		t.Helper()
+		out := &bytes.Buffer{}
+		_ = NewExecutor(h, &hook.Request{ID: id}, slog.Default()).WithLastRuns(lastRuns).execute(context.Background(), out)
+		return out.String()
+	}
+
+	if out := run("first"); !strings.Contains(out, "last=none request=none at=none") {
+		t.Errorf("expected no previous run, got %q", out)
+	}
+	out := run("second")
+	if !strings.Contains(out, "last=3 request=first at=") || strings.Contains(out, "at=none") {
+		t.Errorf("expected the previous run, got %q", out)
+	}
+	at := strings.TrimSpace(out[strings.Index(out, "at=")+3:])
+	if _, err := time.Parse(time.RFC3339Nano, at); err != nil {
+		t.Errorf("expected the time of the previous run, got %q: %v", at, err)
+	}
+}
+
+func TestExecutorShadow(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a shell")
+	}
+	primary := shellHook(`echo primary; exit 0`)
+	primary.ID = "primary"
+	primary.Shadow = &hook.Shadow{Hook: "rewrite"}
+	rewrite := shellHook(`echo rewrite; exit 2`)
+	rewrite.ID = "rewrite"
+
+	logs := &lockedBuffer{}
+	logger := slog.New(slog.NewTextHandler(logs, nil))
+	out := &bytes.Buffer{}
+	err := NewExecutor(primary, &hook.Request{ID: "shadowed"}, logger).
+		WithChaining(hookList{primary, rewrite}).
+		Execute(context.Background(), out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "primary\n" {
+		t.Errorf("expected only the primary output, got %q", out.String())
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(logs.String(), "shadow execution finished") && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, expected := range []string{
+		`msg="shadow execution finished"`,
+		"shadow.exit_code=2",
+		`shadow.output="rewrite\n"`,
+		"primary.exit_code=0",
+		"exit_codes_match=false",
+	} {
+		if !strings.Contains(logs.String(), expected) {
+			t.Errorf("expected %s in logs:\n%s", expected, logs.String())
+		}
+	}
+}
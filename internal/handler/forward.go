@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+const (
+	// defaultForwardTimeout limits a single delivery to a forward target.
+	defaultForwardTimeout = 30 * time.Second
+	// defaultForwardSignatureHeader carries the signature of re-signed forwards.
+	defaultForwardSignatureHeader = "X-Webhook-Signature"
+)
+
+// hopHeaders are connection specific and must not be forwarded.
+var hopHeaders = []string{
+	"Connection",
+	"Content-Length",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// forwardRequest re-delivers the original request to all forward targets of
+// the hook in parallel, without waiting for the deliveries to finish.
+func forwardRequest(h *hook.Hook, r *hook.Request, logger *slog.Logger) {
+	for _, target := range h.ForwardTo {
+		flog := logger.With("forward.url", target.URL)
+		req, cancel, err := newForwardRequest(target, r)
+		if err != nil {
+			flog.Error("error preparing forwarded request", "error", err)
+			continue
+		}
+		go func() {
+			defer cancel()
+			if err := deliver(req); err != nil {
+				flog.Error("error forwarding request", "error", err)
+				return
+			}
+			flog.Info("request forwarded")
+		}()
+	}
+}
+
+// newForwardRequest builds the request delivered to the target. The query of
+// the original request is merged into the target URL.
+func newForwardRequest(target hook.ForwardTarget, r *hook.Request) (*http.Request, context.CancelFunc, error) {
+	u, err := url.Parse(target.URL)
+	if err != nil {
+		return nil, nil, err
+	}
+	method := http.MethodPost
+	header := http.Header{}
+	if r.RawRequest != nil {
+		method = r.RawRequest.Method
+		header = r.RawRequest.Header.Clone()
+		if r.RawRequest.URL.RawQuery != "" {
+			query := u.Query()
+			for k, v := range r.RawRequest.URL.Query() {
+				for _, vv := range v {
+					query.Add(k, vv)
+				}
+			}
+			u.RawQuery = query.Encode()
+		}
+	}
+	for _, h := range hopHeaders {
+		header.Del(h)
+	}
+	if target.Secret != "" {
+		signature, err := target.Sign(r.Body, time.Now())
+		if err != nil {
+			return nil, nil, err
+		}
+		name := target.SignatureHeader
+		if name == "" {
+			name = defaultForwardSignatureHeader
+		}
+		header.Set(name, signature)
+	}
+
+	timeout := time.Duration(target.Timeout)
+	if timeout <= 0 {
+		timeout = defaultForwardTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(r.Body))
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	req.Header = header
+	return req, cancel, nil
+}
+
+// deliver sends the request and fails on non-2xx responses.
+func deliver(req *http.Request) error {
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = res.Body.Close() }()
+	_, _ = io.Copy(io.Discard, res.Body)
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("target responded with %s", res.Status)
+	}
+	return nil
+}
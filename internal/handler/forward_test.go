@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+func TestForwardRequest(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	bodies := make(chan string, 1)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- string(body)
+	}))
+	defer target.Close()
+
+	raw := httptest.NewRequest(http.MethodPut, "/hooks/forward?ref=main", strings.NewReader(`{"a": "z"}`))
+	raw.Header.Set("X-Event", "push")
+	raw.Header.Set("Connection", "close")
+	r := &hook.Request{ID: "test", Body: []byte(`{"a": "z"}`), RawRequest: raw}
+
+	req, cancel, err := newForwardRequest(hook.ForwardTarget{URL: target.URL + "/?extra=1", Secret: "secret"}, r)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer cancel()
+	if err := deliver(req); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	got := <-received
+	if got.Method != http.MethodPut {
+		t.Errorf("expected method PUT, got %s", got.Method)
+	}
+	if got.URL.Query().Get("ref") != "main" || got.URL.Query().Get("extra") != "1" {
+		t.Errorf("expected merged query, got %s", got.URL.RawQuery)
+	}
+	if got.Header.Get("X-Event") != "push" {
+		t.Errorf("expected original headers to be forwarded, got %v", got.Header)
+	}
+	if got.Header.Get(defaultForwardSignatureHeader) != "sha256=f417af3a21bd70379b5796d5f013915e7029f62c580fb0f500f59a35a6f04c89" {
+		t.Errorf("unexpected signature %q", got.Header.Get(defaultForwardSignatureHeader))
+	}
+	if body := <-bodies; body != `{"a": "z"}` {
+		t.Errorf("unexpected body %q", body)
+	}
+}
@@ -1,10 +1,13 @@
 package handler
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"go.opentelemetry.io/otel/attribute"
@@ -19,43 +22,93 @@ type options struct {
 	defaultAllowedMethods []string
 	responseHeaders       hook.ResponseHeaders
 	multipartMaxMemory    int64
+	notFound              NotFoundResponse
+	streams               *middleware.InFlightLimiter
+	bodyReadTimeout       time.Duration
+	compressMinSize       int
 }
 
 type RequestHandler struct {
 	hookManager *hook_manager.Manager
+	scheduler   *Scheduler
+	jobs        *JobRegistry
+	activity    *ActivityFeed
+	lastRuns    *LastRuns
+	circuits    *CircuitBreakers
+	processes   *Processes
+	debug       *DebugHooks
 	logger      *slog.Logger
 	opts        options
+	executions  *sharedExecutions
+	responses   *responseCache
 }
 
 func NewRequestHandler(
 	hookManager *hook_manager.Manager,
+	scheduler *Scheduler,
+	jobs *JobRegistry,
+	activity *ActivityFeed,
+	lastRuns *LastRuns,
+	circuits *CircuitBreakers,
+	processes *Processes,
+	debug *DebugHooks,
 	logger *slog.Logger,
 	responseHeaders hook.ResponseHeaders,
 	defaultAllowedMethods []string,
 	multipartMaxMemory int64,
+	maxStreams int,
+	notFound NotFoundResponse,
+	bodyReadTimeout time.Duration,
+	compressMinSize int,
 ) *RequestHandler {
 	return &RequestHandler{
 		hookManager: hookManager,
+		scheduler:   scheduler,
+		jobs:        jobs,
+		activity:    activity,
+		lastRuns:    lastRuns,
+		circuits:    circuits,
+		processes:   processes,
+		debug:       debug,
 		logger:      logger,
+		executions:  newSharedExecutions(),
+		responses:   newResponseCache(maxCachedResponses),
 		opts: options{
 			responseHeaders:       responseHeaders,
-			defaultAllowedMethods: defaultAllowedMethods,
+			defaultAllowedMethods: hook.NormalizeMethods(defaultAllowedMethods),
 			multipartMaxMemory:    multipartMaxMemory,
+			notFound:              notFound,
+			streams:               middleware.NewInFlightLimiter(maxStreams),
+			bodyReadTimeout:       bodyReadTimeout,
+			compressMinSize:       compressMinSize,
 		},
 	}
 }
 
 const (
 	traceHookIDKey = attribute.Key("webhook.hook_id")
+	traceTenantKey = attribute.Key("webhook.tenant")
 	traceReqIDKey  = attribute.Key("webhook.request_id")
 	traceOperation = attribute.Key("operation.name")
 )
 
+// withHook adds the hook, and its tenant if it has one, to the log records.
+func withHook(logger *slog.Logger, h *hook.Hook) *slog.Logger {
+	logger = logger.With("hook_id", h.ID)
+	if h.Tenant != "" {
+		logger = logger.With("tenant", h.Tenant)
+	}
+	return logger
+}
+
 func (r *RequestHandler) ServeHTTP(w http.ResponseWriter, request *http.Request) {
 
 	hookRequest := &hook.Request{
 		ID:         middleware.GetReqID(request.Context()),
 		RawRequest: request,
+		ReceivedAt: time.Now(),
+		Route:      chi.RouteContext(request.Context()).RoutePattern(),
+		Claims:     middleware.GetClaims(request.Context()),
 	}
 	requestLog := r.logger.With("http.request_id", hookRequest.ID)
 	requestLog.Info(
@@ -66,30 +119,50 @@ func (r *RequestHandler) ServeHTTP(w http.ResponseWriter, request *http.Request)
 	)
 	hookId := chi.URLParam(request, "*")
 	// try loading the hook
-	matchedHook := r.hookManager.Get(hookId)
+	matchedHook := r.hookManager.GetForHost(request.Host, hookId)
 	if matchedHook == nil {
-		w.WriteHeader(http.StatusNotFound)
-		_, _ = fmt.Fprint(w, "Hook not found.")
+		// hooks with their own URL prefix are served outside of the global
+		// prefix, requests for them are routed here as unmatched requests
+		if h, id := r.hookManager.GetByPath(request.Host, request.URL.Path); h != nil {
+			matchedHook, hookId = h, id
+			hookRequest.Route = h.URLBase() + "*"
+		}
+	}
+	if matchedHook == nil {
+		requestLog.Info("no hook matched", "hook_id", hookId)
+		r.opts.notFound.ServeHTTP(w, request)
 		return
 	}
-	requestLog = requestLog.With("hook_id", matchedHook.ID)
-	requestLog.Info("hook matched")
+	// values captured by an ID pattern are available as arguments
+	_, hookRequest.IDMatch = matchedHook.MatchID(hookId)
+	requestLog = withHook(requestLog, matchedHook)
+	requestLog.Info("hook matched", "requested_id", hookId)
 	// enrich span
 	span := trace.SpanFromContext(request.Context())
-	span.SetAttributes(
-		traceHookIDKey.String(matchedHook.ID),
-		traceReqIDKey.String(hookRequest.ID),
-	)
+	span.SetAttributes(hookAttributes(matchedHook, traceReqIDKey.String(hookRequest.ID))...)
 	// create execution context
 	executionContext := requestExecutionContext{
 		hookRequest:  hookRequest,
 		hook:         matchedHook,
+		hookManager:  r.hookManager,
 		logger:       requestLog,
 		httpRequest:  request,
 		httpResponse: w,
 		opts:         r.opts,
+		executions:   r.executions,
+		responses:    r.responses,
+		scheduler:    r.scheduler,
+		jobs:         r.jobs,
+		activity:     r.activity,
+		lastRuns:     r.lastRuns,
+		circuits:     r.circuits,
+		processes:    r.processes,
 	}
-	executionContext.Handle(w, request)
+	// the dumper replaces the response writer of hooks being debugged
+	r.debug.wrap(matchedHook, http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		executionContext.httpResponse = w
+		executionContext.Handle(w, request)
+	})).ServeHTTP(w, request)
 }
 
 type FlushableWriter interface {
@@ -97,24 +170,111 @@ type FlushableWriter interface {
 	http.Flusher
 }
 
+// defaultStreamFlushSize is the number of bytes buffered by the size flush
+// strategy, unless configured otherwise.
+const defaultStreamFlushSize = 4096
+
+// flushWriter flushes the written output according to the flush strategy of
+// the hook, after every write by default.
 type flushWriter struct {
 	w          FlushableWriter
 	muteErrors bool
 	hasError   bool
+
+	// strategy is one of the hook.StreamFlush* constants
+	strategy string
+	size     int
+
+	mu sync.Mutex
+	// pending is the number of bytes written since the last flush
+	pending int
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func newFlushWriter(w FlushableWriter, h *hook.Hook) (*flushWriter, error) {
+	fw := &flushWriter{w: w, muteErrors: true, strategy: h.StreamFlush, size: h.StreamFlushSize}
+	switch h.StreamFlush {
+	case "", hook.StreamFlushPerWrite, hook.StreamFlushPerLine:
+	case hook.StreamFlushBySize:
+		if fw.size <= 0 {
+			fw.size = defaultStreamFlushSize
+		}
+	case hook.StreamFlushByInterval:
+		interval := time.Duration(h.StreamFlushInterval)
+		if interval <= 0 {
+			interval = time.Second
+		}
+		fw.stop, fw.done = make(chan struct{}), make(chan struct{})
+		go fw.flushEvery(interval)
+	default:
+		return nil, fmt.Errorf("unknown stream flush strategy %q", h.StreamFlush)
+	}
+	return fw, nil
 }
 
 func (fw *flushWriter) Write(p []byte) (n int, err error) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
 	n, err = fw.w.Write(p)
 	if err != nil && fw.muteErrors {
 		fw.hasError = true
 		return len(p), nil
 	}
-	if n > 0 {
-		fw.w.Flush()
+	fw.pending += n
+	switch fw.strategy {
+	case hook.StreamFlushPerLine:
+		if bytes.IndexByte(p[:n], '\n') < 0 {
+			return
+		}
+	case hook.StreamFlushBySize:
+		if fw.pending < fw.size {
+			return
+		}
+	case hook.StreamFlushByInterval:
+		return
 	}
+	fw.flush()
 	return
 }
 
+// Flush sends the pending output to the client.
+func (fw *flushWriter) Flush() {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	fw.flush()
+}
+
+func (fw *flushWriter) flush() {
+	if fw.pending > 0 {
+		fw.w.Flush()
+		fw.pending = 0
+	}
+}
+
+func (fw *flushWriter) flushEvery(interval time.Duration) {
+	defer close(fw.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-fw.stop:
+			return
+		case <-ticker.C:
+			fw.Flush()
+		}
+	}
+}
+
+// Close stops flushing in intervals and flushes the pending output.
+func (fw *flushWriter) Close() {
+	if fw.stop != nil {
+		close(fw.stop)
+		<-fw.done
+	}
+	fw.Flush()
+}
+
 // MakeRoutePattern builds a pattern matching URL for the mux.
 func MakeRoutePattern(prefix *string) string {
 	return makeBaseURL(prefix) + "/*"
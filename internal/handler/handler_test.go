@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+// flushRecorder records the output and the number of flushes.
+type flushRecorder struct {
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	flushes int
+}
+
+func (r *flushRecorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.buf.Write(p)
+}
+
+func (r *flushRecorder) Flush() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.flushes++
+}
+
+func (r *flushRecorder) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.flushes
+}
+
+func TestFlushWriterStrategies(t *testing.T) {
+	writes := []string{"build ", "started\n", "step 1", "/2 ", "done\n", "x"}
+	tests := []struct {
+		desc     string
+		hook     hook.Hook
+		expected int
+		// pending tells whether output is left to be flushed on close
+		pending bool
+	}{
+		{"per write", hook.Hook{}, 6, false},
+		{"per line", hook.Hook{StreamFlush: hook.StreamFlushPerLine}, 2, true},
+		{"by size", hook.Hook{StreamFlush: hook.StreamFlushBySize, StreamFlushSize: 10}, 2, true},
+		{"by interval", hook.Hook{StreamFlush: hook.StreamFlushByInterval, StreamFlushInterval: hook.Duration(time.Hour)}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			rec := &flushRecorder{}
+			fw, err := newFlushWriter(rec, &tt.hook)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, w := range writes {
+				_, _ = fw.Write([]byte(w))
+			}
+			if n := rec.count(); n != tt.expected {
+				t.Errorf("expected %d flushes, got %d", tt.expected, n)
+			}
+			// closing flushes the remaining output
+			fw.Close()
+			expected := tt.expected
+			if tt.pending {
+				expected++
+			}
+			if n := rec.count(); n != expected {
+				t.Errorf("expected %d flushes after close, got %d", expected, n)
+			}
+		})
+	}
+}
+
+func TestFlushWriterInterval(t *testing.T) {
+	rec := &flushRecorder{}
+	fw, err := newFlushWriter(rec, &hook.Hook{StreamFlush: hook.StreamFlushByInterval, StreamFlushInterval: hook.Duration(20 * time.Millisecond)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fw.Close()
+	_, _ = fw.Write([]byte("output"))
+	time.Sleep(100 * time.Millisecond)
+	// idle intervals don't flush
+	if n := rec.count(); n != 1 {
+		t.Errorf("expected a single flush, got %d", n)
+	}
+}
+
+func TestFlushWriterUnknownStrategy(t *testing.T) {
+	if _, err := newFlushWriter(&flushRecorder{}, &hook.Hook{StreamFlush: "never"}); err == nil {
+		t.Error("expected error for unknown flush strategy")
+	}
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// defaultHeartbeatMessage is a comment line for server-sent events, which
+// clients of plain text streams can skip as well.
+const defaultHeartbeatMessage = ": ping"
+
+// heartbeatWriter writes a heartbeat line whenever nothing was written for
+// the heartbeat interval, so proxies and load balancers with idle timeouts
+// keep streamed responses of silent commands open.
+type heartbeatWriter struct {
+	mu       sync.Mutex
+	w        io.Writer
+	message  []byte
+	interval time.Duration
+	last     time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// startHeartbeat starts writing heartbeats to w until Stop is called.
+func startHeartbeat(w io.Writer, interval time.Duration, message string) *heartbeatWriter {
+	if message == "" {
+		message = defaultHeartbeatMessage
+	}
+	hw := &heartbeatWriter{
+		w:        w,
+		message:  []byte(message + "\n"),
+		interval: interval,
+		last:     time.Now(),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go hw.run()
+	return hw
+}
+
+func (hw *heartbeatWriter) run() {
+	defer close(hw.done)
+	timer := time.NewTimer(hw.interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-hw.stop:
+			return
+		case <-timer.C:
+		}
+		hw.mu.Lock()
+		idle := time.Since(hw.last)
+		if idle >= hw.interval {
+			_, _ = hw.w.Write(hw.message)
+			// heartbeats are useless unless they reach the client
+			if f, ok := hw.w.(http.Flusher); ok {
+				f.Flush()
+			}
+			hw.last = time.Now()
+			idle = 0
+		}
+		hw.mu.Unlock()
+		timer.Reset(hw.interval - idle)
+	}
+}
+
+func (hw *heartbeatWriter) Write(p []byte) (int, error) {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+	hw.last = time.Now()
+	return hw.w.Write(p)
+}
+
+// Stop ends the heartbeats and returns once no more heartbeat is written.
+func (hw *heartbeatWriter) Stop() {
+	close(hw.stop)
+	<-hw.done
+}
@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lockedBuffer is a bytes.Buffer safe for concurrent use.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestHeartbeatWriter(t *testing.T) {
+	out := &lockedBuffer{}
+	hw := startHeartbeat(out, 50*time.Millisecond, "")
+
+	// regular output suppresses heartbeats
+	for i := 0; i < 5; i++ {
+		_, _ = hw.Write([]byte("output\n"))
+		time.Sleep(20 * time.Millisecond)
+	}
+	if strings.Contains(out.String(), defaultHeartbeatMessage) {
+		t.Errorf("expected no heartbeat while writing output:\n%s", out.String())
+	}
+
+	// silence is filled with heartbeats
+	time.Sleep(180 * time.Millisecond)
+	hw.Stop()
+	beats := strings.Count(out.String(), defaultHeartbeatMessage+"\n")
+	if beats < 2 || beats > 4 {
+		t.Errorf("expected about 3 heartbeats, got %d:\n%s", beats, out.String())
+	}
+
+	// no heartbeats after stopping
+	stopped := out.String()
+	time.Sleep(100 * time.Millisecond)
+	if out.String() != stopped {
+		t.Errorf("expected no heartbeat after stop:\n%s", out.String())
+	}
+}
@@ -0,0 +1,222 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid/v5"
+)
+
+// JobIDHeader is the response header carrying the ID of an asynchronous
+// execution.
+const JobIDHeader = "X-Webhook-Job-Id"
+
+// Statuses of an asynchronous execution.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCanceled  = "canceled"
+)
+
+const (
+	defaultJobRetention   = time.Hour
+	defaultJobWaitTimeout = 60 * time.Second
+	// maxJobWaitTimeout caps the timeout of a wait request, so clients can't
+	// hold connections open for hours.
+	maxJobWaitTimeout = 5 * time.Minute
+)
+
+// errJobSuperseded finishes debounced executions replaced by a later trigger.
+var errJobSuperseded = errors.New("superseded by a later trigger")
+
+// job tracks an asynchronous execution.
+type job struct {
+	mu         sync.Mutex
+	id         string
+	hookID     string
+	status     string
+	err        string
+	createdAt  time.Time
+	finishedAt time.Time
+	done       chan struct{}
+	registry   *JobRegistry
+}
+
+// JobState is the state of a job as returned by the wait endpoint.
+type JobState struct {
+	ID         string     `json:"id"`
+	HookID     string     `json:"hook_id"`
+	Status     string     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+func (j *job) running() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.status == JobQueued {
+		j.status = JobRunning
+	}
+}
+
+// finish records the outcome of the execution and releases waiters.
+func (j *job) finish(err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if !j.finishedAt.IsZero() {
+		return
+	}
+	switch {
+	case errors.Is(err, errJobSuperseded):
+		j.status = JobCanceled
+	case err != nil:
+		j.status = JobFailed
+	default:
+		j.status = JobSucceeded
+	}
+	if err != nil {
+		j.err = err.Error()
+	}
+	j.finishedAt = time.Now()
+	close(j.done)
+	j.registry.expire(j.id, j.finishedAt)
+}
+
+func (j *job) state() JobState {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	s := JobState{
+		ID:        j.id,
+		HookID:    j.hookID,
+		Status:    j.status,
+		Error:     j.err,
+		CreatedAt: j.createdAt,
+	}
+	if !j.finishedAt.IsZero() {
+		finishedAt := j.finishedAt
+		s.FinishedAt = &finishedAt
+	}
+	return s
+}
+
+// JobRegistry keeps track of asynchronous executions, so clients can wait for
+// their outcome. Finished jobs are kept for the retention period.
+type JobRegistry struct {
+	mu        sync.Mutex
+	jobs      map[string]*job
+	expiry    []expiringJob
+	retention time.Duration
+}
+
+// expiringJob is a finished job in the expiry queue of the registry. The
+// retention is the same for all jobs, so they expire in the order they
+// finished.
+type expiringJob struct {
+	id      string
+	expires time.Time
+}
+
+// NewJobRegistry creates a registry keeping finished jobs for an hour.
+func NewJobRegistry() *JobRegistry {
+	return &JobRegistry{
+		jobs:      make(map[string]*job),
+		retention: defaultJobRetention,
+	}
+}
+
+// add registers a new queued job for the hook.
+func (r *JobRegistry) add(hookID string) *job {
+	j := &job{
+		id:        uuid.Must(uuid.NewV4()).String(),
+		hookID:    hookID,
+		status:    JobQueued,
+		createdAt: time.Now(),
+		done:      make(chan struct{}),
+		registry:  r,
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// drop expired jobs, so the registry does not grow unbounded
+	now := time.Now()
+	for len(r.expiry) > 0 && now.After(r.expiry[0].expires) {
+		delete(r.jobs, r.expiry[0].id)
+		r.expiry[0] = expiringJob{}
+		r.expiry = r.expiry[1:]
+	}
+	r.jobs[j.id] = j
+	return j
+}
+
+// expire queues the job finished at the given time for removal once the
+// retention period elapsed.
+func (r *JobRegistry) expire(id string, finishedAt time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.expiry = append(r.expiry, expiringJob{id: id, expires: finishedAt.Add(r.retention)})
+}
+
+func (r *JobRegistry) get(id string) *job {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.jobs[id]
+}
+
+// Wait blocks until the job finished, the timeout elapsed or ctx is done, and
+// returns the state of the job. ok is false for unknown jobs.
+func (r *JobRegistry) Wait(ctx context.Context, id string, timeout time.Duration) (JobState, bool) {
+	j := r.get(id)
+	if j == nil {
+		return JobState{}, false
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-j.done:
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	return j.state(), true
+}
+
+// Routes returns the router serving the job endpoints.
+func (r *JobRegistry) Routes() http.Handler {
+	router := chi.NewRouter()
+	router.Get("/{id}/wait", r.ServeWait)
+	return router
+}
+
+// ServeWait long-polls until the job addressed by the URL finished or the
+// timeout query parameter elapsed, at most maxJobWaitTimeout. Finished jobs
+// are reported with 200, jobs still pending with 202.
+func (r *JobRegistry) ServeWait(w http.ResponseWriter, request *http.Request) {
+	timeout := defaultJobWaitTimeout
+	if t := request.URL.Query().Get("timeout"); t != "" {
+		var err error
+		if timeout, err = time.ParseDuration(t); err != nil || timeout < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprint(w, "Invalid timeout.")
+			return
+		}
+	}
+	timeout = min(timeout, maxJobWaitTimeout)
+	state, ok := r.Wait(request.Context(), chi.URLParam(request, "id"), timeout)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = fmt.Fprint(w, "Job not found.")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if state.FinishedAt == nil {
+		w.WriteHeader(http.StatusAccepted)
+	}
+	_ = json.NewEncoder(w).Encode(state)
+}
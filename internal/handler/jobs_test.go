@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestJobRegistryWait(t *testing.T) {
+	jobs := NewJobRegistry()
+	routes := jobs.Routes()
+
+	wait := func(path string) (int, JobState) {
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		var state JobState
+		if rr.Code == http.StatusOK || rr.Code == http.StatusAccepted {
+			if err := json.Unmarshal(rr.Body.Bytes(), &state); err != nil {
+				t.Fatalf("error decoding %q: %s", rr.Body.String(), err)
+			}
+		}
+		return rr.Code, state
+	}
+
+	if code, _ := wait("/unknown/wait"); code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown job, got %d", code)
+	}
+
+	j := jobs.add("test")
+	if code, _ := wait("/" + j.id + "/wait?timeout=bogus"); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid timeout, got %d", code)
+	}
+	code, state := wait("/" + j.id + "/wait?timeout=10ms")
+	if code != http.StatusAccepted || state.Status != JobQueued || state.FinishedAt != nil {
+		t.Errorf("expected pending job, got %d %+v", code, state)
+	}
+
+	j.running()
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		j.finish(errors.New("exit status 1"))
+	}()
+	code, state = wait("/" + j.id + "/wait?timeout=5s")
+	if code != http.StatusOK || state.Status != JobFailed || state.Error != "exit status 1" || state.FinishedAt == nil {
+		t.Errorf("expected failed job, got %d %+v", code, state)
+	}
+
+	superseded := jobs.add("test")
+	superseded.finish(errJobSuperseded)
+	if _, state := wait("/" + superseded.id + "/wait"); state.Status != JobCanceled {
+		t.Errorf("expected canceled job, got %+v", state)
+	}
+
+	done := jobs.add("test")
+	done.finish(nil)
+	if _, state := wait("/" + done.id + "/wait"); state.Status != JobSucceeded || state.HookID != "test" {
+		t.Errorf("expected succeeded job, got %+v", state)
+	}
+}
+
+func TestJobRegistryExpiry(t *testing.T) {
+	jobs := NewJobRegistry()
+	jobs.retention = 0
+	pending := jobs.add("test")
+	finished := jobs.add("test")
+	finished.finish(nil)
+	time.Sleep(time.Millisecond)
+
+	latest := jobs.add("test")
+	if jobs.get(finished.id) != nil {
+		t.Error("expected the expired job to be removed")
+	}
+	if jobs.get(pending.id) == nil || jobs.get(latest.id) == nil {
+		t.Error("expected pending jobs to be kept")
+	}
+}
@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+// lastRun is the result of the previous execution of a hook.
+type lastRun struct {
+	exitCode  int
+	startedAt time.Time
+	requestID string
+}
+
+// LastRuns holds the previous execution of each hook by its route, see
+// hook.RouteKey. They are kept across reloads, but not across restarts. A nil
+// LastRuns tracks nothing.
+type LastRuns struct {
+	runs sync.Map
+}
+
+func NewLastRuns() *LastRuns {
+	return &LastRuns{}
+}
+
+// record stores the result of the execution of the hook.
+func (l *LastRuns) record(h *hook.Hook, r *hook.Request, startedAt time.Time, err error) {
+	if l == nil {
+		return
+	}
+	l.runs.Store(h.RouteKey(), lastRun{exitCode: exitCode(err), startedAt: startedAt, requestID: r.ID})
+}
+
+// env returns the environment variables describing the previous execution of
+// the hook, or none if it didn't run since webhook started.
+func (l *LastRuns) env(h *hook.Hook) []string {
+	if l == nil {
+		return nil
+	}
+	v, ok := l.runs.Load(h.RouteKey())
+	if !ok {
+		return nil
+	}
+	last := v.(lastRun)
+	return []string{
+		"HOOK_LAST_EXIT_CODE=" + strconv.Itoa(last.exitCode),
+		"HOOK_LAST_RUN_AT=" + last.startedAt.UTC().Format(time.RFC3339Nano),
+		"HOOK_LAST_REQUEST_ID=" + last.requestID,
+	}
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"text/template"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+// messageData returns the values available to response message templates,
+// ie. the environment variables passed to the command, like HOOK_repo, and
+// the request metadata, like WEBHOOK_REQUEST_ID.
+func (rec *requestExecutionContext) messageData(ctx context.Context) map[string]string {
+	env, err := rec.hook.ExtractCommandArgumentsForEnv(rec.hookRequest)
+	if err != nil {
+		rec.logger.Debug("error extracting command arguments for response message", "error", err)
+	}
+	env = append(env, NewExecutor(rec.hook, rec.hookRequest, rec.logger).metadataEnv(ctx)...)
+	data := make(map[string]string, len(env))
+	for _, e := range env {
+		if k, v, ok := strings.Cut(e, "="); ok {
+			data[k] = v
+		}
+	}
+	return data
+}
+
+// renderMessage executes the message template of the named hook property.
+// Messages without actions are returned as they are; on errors, the fallback
+// is returned.
+func (rec *requestExecutionContext) renderMessage(ctx context.Context, name, text, fallback string) string {
+	if !strings.Contains(text, "{{") {
+		return text
+	}
+	tmpl, err := template.New(name).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		rec.logger.Error("invalid message template", "property", name, "error", err)
+		return fallback
+	}
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, rec.messageData(ctx)); err != nil {
+		rec.logger.Error("error executing message template", "property", name, "error", err)
+		return fallback
+	}
+	return buf.String()
+}
+
+// writeSuccess responds with the success status code and response message
+// of the hook.
+func (rec *requestExecutionContext) writeSuccess() {
+	message := rec.renderMessage(rec.httpRequest.Context(), "response-message", rec.hook.ResponseMessage, rec.hook.ResponseMessage)
+	if rec.hook.ResponseFormat == hook.ResponseFormatJSON {
+		env := rec.envelope(false, nil)
+		env.Message = message
+		rec.writeEnvelope(rec.hook.SuccessHttpResponseCode, env)
+		return
+	}
+	rec.writeResponse(rec.hook.SuccessHttpResponseCode, message)
+}
@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+const (
+	metricDuration    = "hook.executor.run.duration"
+	metricExitCodes   = "hook.executor.run.exit_codes"
+	metricTimeouts    = "hook.executor.run.timeouts"
+	metricQueueWait   = "hook.executor.queue.wait"
+	metricOutputBytes = "hook.executor.output.bytes"
+
+	metricExitCodeKey = attribute.Key("exit_code")
+	metricReasonKey   = attribute.Key("reason")
+	metricShadowKey   = attribute.Key("shadow")
+)
+
+// executorInstruments record the executions of hook commands.
+type executorInstruments struct {
+	duration    metric.Float64Histogram
+	exitCodes   metric.Int64Counter
+	timeouts    metric.Int64Counter
+	queueWait   metric.Float64Histogram
+	outputBytes metric.Int64Counter
+}
+
+// executorMetrics creates the instruments once. They are created from the
+// global meter provider, which forwards them to the OTLP pipeline once it is
+// initialized.
+var executorMetrics = sync.OnceValues(func() (*executorInstruments, error) {
+	meter := otel.Meter("hook.executor")
+	var (
+		m    executorInstruments
+		err  error
+		errs []error
+	)
+	m.duration, err = meter.Float64Histogram(metricDuration,
+		metric.WithUnit("s"),
+		metric.WithDescription("Duration of the hook commands"))
+	errs = append(errs, instrumentErr(metricDuration, err))
+	m.exitCodes, err = meter.Int64Counter(metricExitCodes,
+		metric.WithDescription("Finished hook commands by exit code, -1 if the command could not be run"))
+	errs = append(errs, instrumentErr(metricExitCodes, err))
+	m.timeouts, err = meter.Int64Counter(metricTimeouts,
+		metric.WithDescription("Hook commands terminated by the timeout or the no-output timeout"))
+	errs = append(errs, instrumentErr(metricTimeouts, err))
+	m.queueWait, err = meter.Float64Histogram(metricQueueWait,
+		metric.WithUnit("s"),
+		metric.WithDescription("Time executions waited for the concurrency policy and a free worker"))
+	errs = append(errs, instrumentErr(metricQueueWait, err))
+	m.outputBytes, err = meter.Int64Counter(metricOutputBytes,
+		metric.WithUnit("By"),
+		metric.WithDescription("Output written by the hook commands"))
+	errs = append(errs, instrumentErr(metricOutputBytes, err))
+	if err := errors.Join(errs...); err != nil {
+		return nil, errors.Join(instrumentationErr, err)
+	}
+	return &m, nil
+})
+
+func instrumentErr(name string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("meter failed [%s]: %w", name, err)
+}
+
+// hookAttributes identify the hook in spans and metrics, followed by attrs.
+// Hooks of a tenant carry its name, so the series of tenants stay apart.
+func hookAttributes(h *hook.Hook, attrs ...attribute.KeyValue) []attribute.KeyValue {
+	result := []attribute.KeyValue{traceHookIDKey.String(h.ID)}
+	if h.Tenant != "" {
+		result = append(result, traceTenantKey.String(h.Tenant))
+	}
+	return append(result, attrs...)
+}
+
+// recordQueueWait records the time an execution of the hook waited before it
+// could start.
+func recordQueueWait(ctx context.Context, h *hook.Hook, seconds float64) {
+	m, err := executorMetrics()
+	if err != nil {
+		return
+	}
+	m.queueWait.Record(ctx, seconds, metric.WithAttributes(hookAttributes(h)...))
+}
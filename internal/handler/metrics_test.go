@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"runtime"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+func TestExecutorMetrics(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a shell")
+	}
+	reader := sdkmetric.NewManualReader()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+
+	h := shellHook(`printf hello; exit 3`)
+	h.ID = "metrics"
+	if release, err := NewScheduler(0).Acquire(context.Background(), h); err != nil {
+		t.Fatal(err)
+	} else {
+		release()
+	}
+	if err := NewExecutor(h, &hook.Request{}, slog.Default()).Execute(context.Background(), &bytes.Buffer{}); err == nil {
+		t.Fatal("expected command to fail")
+	}
+	stalled := shellHook(`sleep 10`)
+	stalled.ID = "metrics"
+	stalled.Timeout = hook.Duration(100 * time.Millisecond)
+	_ = NewExecutor(stalled, &hook.Request{}, slog.Default()).Execute(context.Background(), &bytes.Buffer{})
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	metrics := make(map[string]metricdata.Aggregation)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			metrics[m.Name] = m.Data
+		}
+	}
+	hookID := traceHookIDKey.String("metrics")
+
+	sum := func(name string, attrs ...attribute.KeyValue) int64 {
+		t.Helper()
+		data, ok := metrics[name].(metricdata.Sum[int64])
+		if !ok {
+			t.Fatalf("expected sum %s, got %T", name, metrics[name])
+		}
+		var total int64
+		for _, dp := range data.DataPoints {
+			match := true
+			for _, attr := range append(attrs, hookID) {
+				if v, ok := dp.Attributes.Value(attr.Key); !ok || v != attr.Value {
+					match = false
+				}
+			}
+			if match {
+				total += dp.Value
+			}
+		}
+		return total
+	}
+	count := func(name string) uint64 {
+		t.Helper()
+		data, ok := metrics[name].(metricdata.Histogram[float64])
+		if !ok {
+			t.Fatalf("expected histogram %s, got %T", name, metrics[name])
+		}
+		var total uint64
+		for _, dp := range data.DataPoints {
+			if v, ok := dp.Attributes.Value(hookID.Key); ok && v == hookID.Value {
+				total += dp.Count
+			}
+		}
+		return total
+	}
+
+	if n := sum(metricExitCodes, metricExitCodeKey.Int(3)); n != 1 {
+		t.Errorf("expected one exit code 3, got %d", n)
+	}
+	if n := sum(metricTimeouts, metricReasonKey.String(reasonTimeout)); n != 1 {
+		t.Errorf("expected one timeout, got %d", n)
+	}
+	if n := sum(metricOutputBytes); n != int64(len("hello")) {
+		t.Errorf("expected %d bytes of output, got %d", len("hello"), n)
+	}
+	if n := count(metricDuration); n != 2 {
+		t.Errorf("expected two recorded durations, got %d", n)
+	}
+	if n := count(metricQueueWait); n != 1 {
+		t.Errorf("expected one recorded queue wait, got %d", n)
+	}
+}
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+const defaultMismatchMessage = "Hook rules were not satisfied."
+
+// mismatchDetails is the JSON body describing an unsatisfied trigger rule.
+type mismatchDetails struct {
+	Message         string   `json:"message"`
+	Class           string   `json:"class"`
+	MismatchedRules []string `json:"mismatched_rules"`
+}
+
+// writeMismatch responds to a request which did not satisfy the trigger rule,
+// optionally describing the types of the rules which did not match.
+// The response configured for the class of the failure takes precedence over
+// the generic one.
+func (rec *requestExecutionContext) writeMismatch() {
+	status, text := rec.hook.TriggerRuleMismatchHttpResponseCode, rec.hook.TriggerRuleMismatchResponseMessage
+	if rec.hook.AuthFailureStatusCodes {
+		switch rec.hookRequest.MismatchClass {
+		case hook.MismatchSignature:
+			status = http.StatusUnauthorized
+			rec.httpResponse.Header().Set("WWW-Authenticate", fmt.Sprintf("Signature realm=%q", rec.hook.ID))
+		case hook.MismatchIPWhitelist:
+			status = http.StatusForbidden
+		}
+	}
+	if resp, ok := rec.hook.TriggerRuleMismatchResponses[rec.hookRequest.MismatchClass]; ok {
+		if resp.HttpResponseCode != 0 {
+			status = resp.HttpResponseCode
+		}
+		if resp.Message != "" {
+			text = resp.Message
+		}
+	}
+	message := defaultMismatchMessage
+	if text != "" {
+		message = rec.renderMessage(rec.httpRequest.Context(), "trigger-rule-mismatch-response-message",
+			text, defaultMismatchMessage)
+	}
+	if !rec.hook.TriggerRuleMismatchResponseDetails {
+		code, ok := mismatchErrorCodes[rec.hookRequest.MismatchClass]
+		if !ok {
+			code = ErrorCodeRulesNotSatisfied
+		}
+		rec.writeError(status, code, message)
+		return
+	}
+	mismatched := rec.hookRequest.MismatchedRules
+	if mismatched == nil {
+		mismatched = []string{}
+	}
+	body, _ := json.Marshal(mismatchDetails{
+		Message:         message,
+		Class:           rec.hookRequest.MismatchClass,
+		MismatchedRules: mismatched,
+	})
+	rec.httpResponse.Header().Set("Content-Type", "application/json")
+	rec.writeResponse(status, string(body))
+}
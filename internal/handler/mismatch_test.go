@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+func TestWriteMismatch(t *testing.T) {
+	for _, tt := range []struct {
+		desc         string
+		hook         hook.Hook
+		class        string
+		status       int
+		body         string
+		authenticate string
+	}{
+		{"generic", hook.Hook{TriggerRuleMismatchHttpResponseCode: 400}, hook.MismatchSignature, 400, defaultMismatchMessage, ""},
+		{"auth signature", hook.Hook{AuthFailureStatusCodes: true}, hook.MismatchSignature, 401, defaultMismatchMessage, `Signature realm="test"`},
+		{"auth ip whitelist", hook.Hook{AuthFailureStatusCodes: true}, hook.MismatchIPWhitelist, 403, defaultMismatchMessage, ""},
+		{"auth other", hook.Hook{AuthFailureStatusCodes: true, TriggerRuleMismatchHttpResponseCode: 422}, hook.MismatchRules, 422, defaultMismatchMessage, ""},
+		{"class override", hook.Hook{
+			AuthFailureStatusCodes: true,
+			TriggerRuleMismatchResponses: map[string]hook.ResponseOverride{
+				hook.MismatchIPWhitelist: {HttpResponseCode: 404, Message: "Not found."},
+			},
+		}, hook.MismatchIPWhitelist, 404, "Not found.", ""},
+	} {
+		tt.hook.ID = "test"
+		rr := httptest.NewRecorder()
+		rec := &requestExecutionContext{
+			hook:         &tt.hook,
+			hookRequest:  &hook.Request{MismatchClass: tt.class},
+			logger:       slog.Default(),
+			httpRequest:  httptest.NewRequest(http.MethodPost, "/hooks/test", nil),
+			httpResponse: rr,
+		}
+		rec.writeMismatch()
+		if rr.Code != tt.status || rr.Body.String() != tt.body || rr.Header().Get("WWW-Authenticate") != tt.authenticate {
+			t.Errorf("%s: expected {%d, %q, %q}, got {%d, %q, %q}", tt.desc, tt.status, tt.body, tt.authenticate,
+				rr.Code, rr.Body.String(), rr.Header().Get("WWW-Authenticate"))
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+const defaultNotFoundMessage = "Hook not found."
+
+// NotFoundResponse describes the response to requests which don't match any
+// hook. The zero value responds with 404 and "Hook not found.".
+type NotFoundResponse struct {
+	// StatusCode defaults to 404, or 302 when redirecting.
+	StatusCode int
+	Message    string
+	Headers    hook.ResponseHeaders
+	// RedirectURL, if set, is sent as the Location header.
+	RedirectURL string
+}
+
+func (n NotFoundResponse) ServeHTTP(w http.ResponseWriter, request *http.Request) {
+	for _, responseHeader := range n.Headers {
+		w.Header().Set(responseHeader.Name, responseHeader.Value)
+	}
+	status := n.StatusCode
+	if n.RedirectURL != "" {
+		if status == 0 {
+			status = http.StatusFound
+		}
+		w.Header().Set("Location", n.RedirectURL)
+	}
+	if status == 0 {
+		status = http.StatusNotFound
+	}
+	message := n.Message
+	if message == "" && n.RedirectURL == "" {
+		message = defaultNotFoundMessage
+	}
+	if acceptsJSON(request) && n.RedirectURL == "" {
+		writeJSONError(w, request, status, ErrorCodeHookNotFound, message)
+		return
+	}
+	w.WriteHeader(status)
+	_, _ = fmt.Fprint(w, message)
+}
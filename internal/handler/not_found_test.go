@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+func TestNotFoundResponse(t *testing.T) {
+	for _, tt := range []struct {
+		desc     string
+		response NotFoundResponse
+		status   int
+		body     string
+		location string
+	}{
+		{"default", NotFoundResponse{}, http.StatusNotFound, "Hook not found.", ""},
+		{"custom", NotFoundResponse{StatusCode: http.StatusForbidden, Message: "Forbidden."}, http.StatusForbidden, "Forbidden.", ""},
+		{"redirect", NotFoundResponse{RedirectURL: "https://example.com/docs"}, http.StatusFound, "", "https://example.com/docs"},
+		{"permanent redirect", NotFoundResponse{StatusCode: http.StatusMovedPermanently, RedirectURL: "/"}, http.StatusMovedPermanently, "", "/"},
+	} {
+		tt.response.Headers = hook.ResponseHeaders{{Name: "X-Served-By", Value: "webhook"}}
+		rr := httptest.NewRecorder()
+		tt.response.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/hooks/unknown", nil))
+		if rr.Code != tt.status || rr.Body.String() != tt.body || rr.Header().Get("Location") != tt.location {
+			t.Errorf("%s: expected {%d, %q, %q}, got {%d, %q, %q}", tt.desc,
+				tt.status, tt.body, tt.location, rr.Code, rr.Body.String(), rr.Header().Get("Location"))
+		}
+		if rr.Header().Get("X-Served-By") != "webhook" {
+			t.Errorf("%s: expected configured headers, got %v", tt.desc, rr.Header())
+		}
+	}
+}
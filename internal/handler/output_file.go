@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"text/template"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+// unsafeFileNameChars matches the characters replaced in values of output
+// file paths, as request IDs may be chosen by the client.
+var unsafeFileNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// openOutputFiles holds the paths of the output files still being written.
+var openOutputFiles sync.Map
+
+// outputFileData are the values available to output file path templates.
+type outputFileData struct {
+	HookID    string
+	RequestID string
+}
+
+// outputFilePath renders the path of the file receiving the streamed output
+// of the hook. Relative paths are resolved against the working directory of
+// the command.
+func outputFilePath(h *hook.Hook, r *hook.Request) (string, error) {
+	return renderOutputFilePath(h, unsafeFileNameChars.ReplaceAllString(r.ID, "_"))
+}
+
+// outputFileGlob returns a pattern matching the output files of all
+// executions of the hook.
+func outputFileGlob(h *hook.Hook) (string, error) {
+	return renderOutputFilePath(h, "*")
+}
+
+func renderOutputFilePath(h *hook.Hook, requestID string) (string, error) {
+	tmpl, err := template.New("stream-output-file").Parse(h.StreamOutputFile)
+	if err != nil {
+		return "", fmt.Errorf("invalid output file path template: %w", err)
+	}
+	data := outputFileData{
+		HookID:    unsafeFileNameChars.ReplaceAllString(h.ID, "_"),
+		RequestID: requestID,
+	}
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, data); err != nil {
+		return "", fmt.Errorf("error executing output file path template: %w", err)
+	}
+	path := buf.String()
+	if !filepath.IsAbs(path) && h.CommandWorkingDirectory != "" {
+		path = filepath.Join(h.CommandWorkingDirectory, path)
+	}
+	return path, nil
+}
+
+// createOutputFile creates the file receiving the streamed output of the
+// execution, including missing directories. The file is protected from
+// retention until it is closed with closeOutputFile.
+func (rec *requestExecutionContext) createOutputFile() (*os.File, error) {
+	path, err := outputFilePath(rec.hook, rec.hookRequest)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o640)
+	if err != nil {
+		return nil, err
+	}
+	openOutputFiles.Store(file.Name(), struct{}{})
+	return file, nil
+}
+
+func closeOutputFile(file *os.File) {
+	_ = file.Close()
+	openOutputFiles.Delete(file.Name())
+}
@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+func TestOutputFilePath(t *testing.T) {
+	tests := []struct {
+		desc     string
+		hook     hook.Hook
+		id       string
+		expected string
+	}{
+		{"absolute", hook.Hook{ID: "deploy", StreamOutputFile: "/var/log/webhook/{{ .HookID }}/{{ .RequestID }}.log"}, "abc123", "/var/log/webhook/deploy/abc123.log"},
+		{"relative to working directory", hook.Hook{ID: "deploy", CommandWorkingDirectory: "/srv/app", StreamOutputFile: "logs/{{ .RequestID }}.log"}, "abc123", "/srv/app/logs/abc123.log"},
+		{"client chosen request ID", hook.Hook{ID: "deploy", StreamOutputFile: "/var/log/webhook/{{ .RequestID }}.log"}, "../../etc/passwd", "/var/log/webhook/.._.._etc_passwd.log"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			path, err := outputFilePath(&tt.hook, &hook.Request{ID: tt.id})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if path != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, path)
+			}
+		})
+	}
+
+	if _, err := outputFilePath(&hook.Hook{StreamOutputFile: "{{ .Missing"}, &hook.Request{}); err == nil {
+		t.Error("expected error for invalid template")
+	}
+}
@@ -0,0 +1,214 @@
+package handler
+
+import (
+	"bytes"
+	"container/heap"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxCachedResponses is the number of responses kept for replaying, so keys
+// which are never retried can't exhaust the memory. The responses expiring
+// first are evicted once it is reached.
+const maxCachedResponses = 10000
+
+// maxCachedResponseSize is the size of the largest response body stored for
+// replaying. Larger responses, ie. downloaded files and artifacts, are not
+// kept in memory, retries of their requests execute the hook again.
+const maxCachedResponseSize = 1 << 20
+
+// cachedResponse is a response stored for replaying to retried deliveries.
+type cachedResponse struct {
+	status  int
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+// cacheEntry is a stored response in the expiry queue of the cache.
+type cacheEntry struct {
+	key   string
+	resp  cachedResponse
+	index int
+}
+
+// responseCache stores responses by key until they expire. Keys of requests
+// in progress are marked as pending, so retries arriving meanwhile wait for
+// the response instead of executing the hook again.
+type responseCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]*cacheEntry
+	expiry     expiryQueue
+	pending    map[string]chan struct{}
+}
+
+func newResponseCache(maxEntries int) *responseCache {
+	return &responseCache{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*cacheEntry),
+		pending:    make(map[string]chan struct{}),
+	}
+}
+
+// begin returns the stored response for the key. Otherwise it marks the key
+// as pending and returns the function to call with the response to store, or
+// nil if none is stored, once the request is done. Requests with a pending key
+// wait until it is done or the context is cancelled.
+func (c *responseCache) begin(ctx context.Context, key string) (cachedResponse, func(*cachedResponse, time.Duration), error) {
+	for {
+		c.mu.Lock()
+		if resp, ok := c.getLocked(key); ok {
+			c.mu.Unlock()
+			return resp, nil, nil
+		}
+		done, pending := c.pending[key]
+		if !pending {
+			done = make(chan struct{})
+			c.pending[key] = done
+			c.mu.Unlock()
+			return cachedResponse{}, func(resp *cachedResponse, ttl time.Duration) {
+				c.mu.Lock()
+				defer c.mu.Unlock()
+				if resp != nil {
+					c.setLocked(key, *resp, ttl)
+				}
+				delete(c.pending, key)
+				close(done)
+			}, nil
+		}
+		c.mu.Unlock()
+		// the request in progress may fail without storing a response, in
+		// which case the next waiter takes over
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return cachedResponse{}, nil, ctx.Err()
+		}
+	}
+}
+
+func (c *responseCache) getLocked(key string) (cachedResponse, bool) {
+	e, ok := c.entries[key]
+	if !ok {
+		return cachedResponse{}, false
+	}
+	if time.Now().After(e.resp.expires) {
+		c.removeLocked(e)
+		return cachedResponse{}, false
+	}
+	return e.resp, true
+}
+
+func (c *responseCache) setLocked(key string, resp cachedResponse, ttl time.Duration) {
+	now := time.Now()
+	resp.expires = now.Add(ttl)
+	if e, ok := c.entries[key]; ok {
+		e.resp = resp
+		heap.Fix(&c.expiry, e.index)
+		return
+	}
+	// drop expired entries, so keys which are never retried do not pile up,
+	// and make room for the new entry by evicting the one expiring first
+	for len(c.expiry) > 0 && (now.After(c.expiry[0].resp.expires) || len(c.expiry) >= c.maxEntries) {
+		c.removeLocked(c.expiry[0])
+	}
+	e := &cacheEntry{key: key, resp: resp}
+	c.entries[key] = e
+	heap.Push(&c.expiry, e)
+}
+
+func (c *responseCache) removeLocked(e *cacheEntry) {
+	heap.Remove(&c.expiry, e.index)
+	delete(c.entries, e.key)
+}
+
+// expiryQueue implements heap.Interface ordered by ascending expiry.
+type expiryQueue []*cacheEntry
+
+func (q expiryQueue) Len() int { return len(q) }
+
+func (q expiryQueue) Less(i, j int) bool {
+	return q[i].resp.expires.Before(q[j].resp.expires)
+}
+
+func (q expiryQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *expiryQueue) Push(x any) {
+	e := x.(*cacheEntry)
+	e.index = len(*q)
+	*q = append(*q, e)
+}
+
+func (q *expiryQueue) Pop() any {
+	old := *q
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+	return e
+}
+
+// recordingWriter captures the status and body written to the underlying
+// response writer, up to maxCachedResponseSize bytes of the body.
+type recordingWriter struct {
+	http.ResponseWriter
+	status   int
+	body     bytes.Buffer
+	oversize bool
+}
+
+func (rw *recordingWriter) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *recordingWriter) Write(p []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	if !rw.oversize {
+		if rw.body.Len()+len(p) > maxCachedResponseSize {
+			rw.oversize = true
+			rw.body = bytes.Buffer{}
+		} else {
+			rw.body.Write(p)
+		}
+	}
+	return rw.ResponseWriter.Write(p)
+}
+
+// Flush sends the buffered response to the client, if the underlying writer
+// supports it.
+func (rw *recordingWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer for http.ResponseController.
+func (rw *recordingWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// response returns the recorded response, or false if its body exceeded
+// maxCachedResponseSize.
+func (rw *recordingWriter) response() (cachedResponse, bool) {
+	status := rw.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	return cachedResponse{
+		status: status,
+		header: rw.Header().Clone(),
+		body:   bytes.Clone(rw.body.Bytes()),
+	}, !rw.oversize
+}
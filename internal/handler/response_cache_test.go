@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestResponseCache(t *testing.T) {
+	c := newResponseCache(maxCachedResponses)
+	ctx := context.Background()
+
+	rec := httptest.NewRecorder()
+	rw := &recordingWriter{ResponseWriter: rec}
+	rw.Header().Set("X-Test", "1")
+	rw.WriteHeader(http.StatusAccepted)
+	_, _ = rw.Write([]byte("done"))
+	stored, ok := rw.response()
+	if !ok {
+		t.Fatal("expected the response to be recorded")
+	}
+
+	for key, ttl := range map[string]time.Duration{"a": time.Minute, "expired": -time.Minute} {
+		_, store, err := c.begin(ctx, key)
+		if err != nil || store == nil {
+			t.Fatalf("expected %s to be pending, got %v", key, err)
+		}
+		store(&stored, ttl)
+	}
+
+	resp, store, err := c.begin(ctx, "a")
+	if err != nil || store != nil {
+		t.Fatalf("expected stored response, got %v", err)
+	}
+	if resp.status != http.StatusAccepted || string(resp.body) != "done" || resp.header.Get("X-Test") != "1" {
+		t.Errorf("unexpected stored response %+v", resp)
+	}
+	if _, store, _ := c.begin(ctx, "expired"); store == nil {
+		t.Error("expected expired response to be evicted")
+	} else {
+		store(nil, 0)
+	}
+	if _, store, _ := c.begin(ctx, "missing"); store == nil {
+		t.Error("expected no response for unknown key")
+	} else {
+		store(nil, 0)
+	}
+}
+
+func TestResponseCachePending(t *testing.T) {
+	c := newResponseCache(maxCachedResponses)
+	ctx := context.Background()
+
+	_, store, err := c.begin(ctx, "key")
+	if err != nil || store == nil {
+		t.Fatalf("expected the first request to be pending, got %v", err)
+	}
+
+	type result struct {
+		resp  cachedResponse
+		store func(*cachedResponse, time.Duration)
+	}
+	results := make(chan result)
+	begin := func() {
+		go func() {
+			resp, store, err := c.begin(ctx, "key")
+			if err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+			results <- result{resp, store}
+		}()
+	}
+
+	// a failed request stores no response, so a waiting retry takes over
+	begin()
+	select {
+	case <-results:
+		t.Fatal("expected the retry to wait for the pending request")
+	case <-time.After(20 * time.Millisecond):
+	}
+	store(nil, 0)
+	retry := <-results
+	if retry.store == nil {
+		t.Fatal("expected the retry to take over after the failed request")
+	}
+
+	// a successful request is replayed to the waiting retries
+	begin()
+	begin()
+	retry.store(&cachedResponse{status: http.StatusOK, body: []byte("ok")}, time.Minute)
+	for range 2 {
+		if r := <-results; r.store != nil || string(r.resp.body) != "ok" {
+			t.Errorf("expected the stored response to be replayed, got %+v", r.resp)
+		}
+	}
+
+	_, store, _ = c.begin(ctx, "cancelled")
+	defer store(nil, 0)
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, _, err := c.begin(timeout, "cancelled"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected waiting to end with the context, got %v", err)
+	}
+}
+
+func TestResponseCacheEviction(t *testing.T) {
+	c := newResponseCache(2)
+	ctx := context.Background()
+	for key, ttl := range map[string]time.Duration{"short": time.Minute, "long": time.Hour} {
+		_, store, _ := c.begin(ctx, key)
+		store(&cachedResponse{status: http.StatusOK}, ttl)
+	}
+	_, store, _ := c.begin(ctx, "new")
+	store(&cachedResponse{status: http.StatusOK}, time.Hour)
+
+	if len(c.entries) != 2 || len(c.expiry) != 2 {
+		t.Fatalf("expected 2 entries, got %d and %d", len(c.entries), len(c.expiry))
+	}
+	for key, want := range map[string]bool{"short": false, "long": true, "new": true} {
+		if _, ok := c.entries[key]; ok != want {
+			t.Errorf("expected %s stored %t, got %t", key, want, ok)
+		}
+	}
+}
+
+func TestRecordingWriterLimit(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rw := &recordingWriter{ResponseWriter: rec}
+	chunk := bytes.Repeat([]byte("x"), maxCachedResponseSize/2+1)
+	for range 2 {
+		if n, err := rw.Write(chunk); n != len(chunk) || err != nil {
+			t.Fatalf("unexpected write result %d, %v", n, err)
+		}
+	}
+	if _, ok := rw.response(); ok {
+		t.Error("expected an oversized response not to be recorded")
+	}
+	if rw.body.Len() != 0 {
+		t.Errorf("expected the recorded body to be released, got %d bytes", rw.body.Len())
+	}
+	if rec.Body.Len() != 2*len(chunk) {
+		t.Errorf("expected the whole body to be written, got %d bytes", rec.Body.Len())
+	}
+	rw.Flush()
+	if !rec.Flushed {
+		t.Error("expected the flush to be passed on")
+	}
+	if http.NewResponseController(rw).Flush() != nil {
+		t.Error("expected the response controller to reach the underlying writer")
+	}
+}
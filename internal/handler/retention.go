@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook_manager"
+)
+
+// retentionInterval is the pause between two sweeps of the janitor.
+const retentionInterval = time.Minute
+
+// RetentionJanitor removes the stored output files of hooks exceeding their
+// retention policy, so long-running instances don't fill the disk.
+type RetentionJanitor struct {
+	hookManager *hook_manager.Manager
+	logger      *slog.Logger
+}
+
+func NewRetentionJanitor(hookManager *hook_manager.Manager, logger *slog.Logger) *RetentionJanitor {
+	return &RetentionJanitor{hookManager: hookManager, logger: logger}
+}
+
+// Run sweeps the output files periodically until the context is canceled.
+func (j *RetentionJanitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(retentionInterval)
+	defer ticker.Stop()
+	for {
+		j.Sweep()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep applies the retention policies of all hooks once.
+func (j *RetentionJanitor) Sweep() {
+	for _, h := range j.hookManager.Hooks() {
+		if h.RequestSampling != nil {
+			removed, err := sweepSampledRequests(h, time.Now())
+			if err != nil {
+				j.logger.Error("error applying sampled request retention", "hook_id", h.ID, "error", err)
+			}
+			if removed > 0 {
+				j.logger.Info("removed sampled requests exceeding retention", "hook_id", h.ID, "count", removed)
+			}
+		}
+		if h.StreamOutputFile == "" || h.StreamOutputRetention == nil {
+			continue
+		}
+		removed, err := sweepOutputFiles(h, time.Now())
+		if err != nil {
+			j.logger.Error("error applying output retention", "hook_id", h.ID, "error", err)
+		}
+		if removed > 0 {
+			j.logger.Info("removed output files exceeding retention", "hook_id", h.ID, "count", removed)
+		}
+	}
+}
+
+// sweepOutputFiles removes the output files of the hook exceeding its
+// retention policy and returns their number. Files are kept newest first as
+// long as none of the limits is exceeded; files still being written are
+// never removed.
+func sweepOutputFiles(h *hook.Hook, now time.Time) (int, error) {
+	pattern, err := outputFileGlob(h)
+	if err != nil {
+		return 0, err
+	}
+	return sweepFiles(pattern, h.StreamOutputRetention, now)
+}
+
+// sweepFiles removes the files matching the pattern which exceed the
+// retention policy and returns their number.
+func sweepFiles(pattern string, policy *hook.Retention, now time.Time) (int, error) {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return 0, err
+	}
+
+	type outputFile struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	files := make([]outputFile, 0, len(matches))
+	for _, path := range matches {
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		files = append(files, outputFile{path: path, size: info.Size(), modTime: info.ModTime()})
+	}
+	sort.Slice(files, func(a, b int) bool { return files[a].modTime.After(files[b].modTime) })
+
+	var kept, removed int
+	var size int64
+	// once a limit is exceeded, all older files are removed as well
+	exceeded := false
+	for _, f := range files {
+		if _, open := openOutputFiles.Load(f.path); open {
+			kept++
+			size += f.size
+			continue
+		}
+		exceeded = exceeded ||
+			(policy.MaxAge > 0 && now.Sub(f.modTime) > time.Duration(policy.MaxAge)) ||
+			(policy.MaxCount > 0 && kept+1 > policy.MaxCount) ||
+			(policy.MaxSize > 0 && size+f.size > policy.MaxSize)
+		if !exceeded {
+			kept++
+			size += f.size
+			continue
+		}
+		if err := os.Remove(f.path); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+func TestSweepOutputFiles(t *testing.T) {
+	now := time.Now()
+	// files from newest to oldest, with their age and size
+	files := []struct {
+		name string
+		age  time.Duration
+		size int
+	}{
+		{"e.log", 1 * time.Hour, 10},
+		{"d.log", 2 * time.Hour, 10},
+		{"c.log", 3 * time.Hour, 10},
+		{"b.log", 30 * time.Hour, 1},
+		{"a.log", 50 * time.Hour, 1},
+	}
+	tests := []struct {
+		desc      string
+		retention hook.Retention
+		kept      []string
+	}{
+		{"max age", hook.Retention{MaxAge: hook.Duration(24 * time.Hour)}, []string{"c.log", "d.log", "e.log"}},
+		{"max count", hook.Retention{MaxCount: 2}, []string{"d.log", "e.log"}},
+		{"max size", hook.Retention{MaxSize: 25}, []string{"d.log", "e.log"}},
+		{"combined", hook.Retention{MaxAge: hook.Duration(40 * time.Hour), MaxCount: 10, MaxSize: 100}, []string{"b.log", "c.log", "d.log", "e.log"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, f := range files {
+				path := filepath.Join(dir, "deploy", f.name)
+				if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, make([]byte, f.size), 0o600); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Chtimes(path, now.Add(-f.age), now.Add(-f.age)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// output files of other hooks are left alone
+			other := filepath.Join(dir, "other", "a.log")
+			if err := os.MkdirAll(filepath.Dir(other), 0o750); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(other, nil, 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			h := &hook.Hook{
+				ID:                      "deploy",
+				CommandWorkingDirectory: dir,
+				StreamOutputFile:        "{{ .HookID }}/{{ .RequestID }}.log",
+				StreamOutputRetention:   &tt.retention,
+			}
+			if _, err := sweepOutputFiles(h, now); err != nil {
+				t.Fatal(err)
+			}
+			matches, _ := filepath.Glob(filepath.Join(dir, "deploy", "*"))
+			var kept []string
+			for _, m := range matches {
+				kept = append(kept, filepath.Base(m))
+			}
+			if !slices.Equal(kept, tt.kept) {
+				t.Errorf("expected %v to be kept, got %v", tt.kept, kept)
+			}
+			if _, err := os.Stat(other); err != nil {
+				t.Errorf("expected output file of other hook to be kept: %v", err)
+			}
+		})
+	}
+}
+
+func TestSweepOutputFilesKeepsOpenFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "running.log")
+	if err := os.WriteFile(path, make([]byte, 100), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	openOutputFiles.Store(path, struct{}{})
+	defer openOutputFiles.Delete(path)
+
+	h := &hook.Hook{
+		ID:                    "deploy",
+		StreamOutputFile:      filepath.Join(dir, "{{ .RequestID }}.log"),
+		StreamOutputRetention: &hook.Retention{MaxSize: 10},
+	}
+	if removed, err := sweepOutputFiles(h, time.Now()); err != nil || removed != 0 {
+		t.Errorf("expected open file to be kept, removed %d (%v)", removed, err)
+	}
+}
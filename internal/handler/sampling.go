@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+// sampleFileExt is the extension of persisted sampled requests. The files
+// hold the raw HTTP request preceded by comments, as understood by common
+// HTTP client tools.
+const sampleFileExt = ".http"
+
+// sampledRequest is a raw request selected for persisting by the request
+// sampling of a hook.
+type sampledRequest struct {
+	header []byte
+	body   headBuffer
+}
+
+// headBuffer keeps the first max bytes written to it and counts the rest.
+type headBuffer struct {
+	max  int64
+	buf  []byte
+	size int64
+}
+
+func (b *headBuffer) Write(p []byte) (int, error) {
+	b.size += int64(len(p))
+	if room := b.max - int64(len(b.buf)); room > 0 {
+		b.buf = append(b.buf, p[:min(int64(len(p)), room)]...)
+	}
+	return len(p), nil
+}
+
+// sampleRequest selects the request for persisting according to the request
+// sampling of the hook and dumps its request line and headers. The body is
+// recorded by ParseRequest while reading it, so it is read only once and
+// within the limits of the request; see setBody and teeBody. It returns nil
+// if the request is not sampled. Bodies streamed to the command are never
+// read before the execution, so their requests are never sampled.
+func (rec *requestExecutionContext) sampleRequest() *sampledRequest {
+	s := rec.hook.RequestSampling
+	if s == nil || s.Rate <= 0 || rec.streamsBody() || (s.Rate < 1 && rand.Float64() >= s.Rate) {
+		return nil
+	}
+	header, err := httputil.DumpRequest(rec.httpRequest, false)
+	if err != nil {
+		rec.logger.Error("error dumping sampled request", "error", err)
+		return nil
+	}
+	return &sampledRequest{header: header}
+}
+
+// setBody records the body read by ParseRequest.
+func (s *sampledRequest) setBody(body []byte) {
+	if s == nil {
+		return
+	}
+	size := int64(len(body))
+	s.body = headBuffer{max: size, buf: body, size: size}
+}
+
+// teeBody records the body while it is parsed as a multipart form, keeping
+// at most max bytes of it, as its files may exceed the memory.
+func (s *sampledRequest) teeBody(body io.ReadCloser, max int64) io.ReadCloser {
+	if s == nil {
+		return body
+	}
+	s.body = headBuffer{max: max}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.TeeReader(body, &s.body), body}
+}
+
+// persist writes the sampled request together with the outcome of the
+// trigger rules to the sampling directory of the hook.
+func (s *sampledRequest) persist(h *hook.Hook, r *hook.Request, satisfied bool, ruleErr error) (string, error) {
+	dir := sampleDir(h)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return "", err
+	}
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "# hook: %s\n", h.ID)
+	fmt.Fprintf(buf, "# request-id: %s\n", r.ID)
+	fmt.Fprintf(buf, "# received-at: %s\n", r.ReceivedAt.UTC().Format(time.RFC3339Nano))
+	fmt.Fprintf(buf, "# rules-satisfied: %t\n", satisfied)
+	if !satisfied && r.MismatchClass != "" {
+		fmt.Fprintf(buf, "# mismatch-class: %s\n", r.MismatchClass)
+	}
+	if len(r.MismatchedRules) > 0 {
+		fmt.Fprintf(buf, "# mismatched-rules: %s\n", strings.Join(r.MismatchedRules, ", "))
+	}
+	if ruleErr != nil {
+		fmt.Fprintf(buf, "# rule-error: %s\n", ruleErr)
+	}
+	if kept := int64(len(s.body.buf)); kept < s.body.size {
+		fmt.Fprintf(buf, "# body-truncated: %d of %d bytes\n", kept, s.body.size)
+	}
+	buf.Write(s.header)
+	buf.Write(s.body.buf)
+
+	name := r.ReceivedAt.UTC().Format("20060102T150405.000000000")
+	if r.ID != "" {
+		name += "-" + unsafeFileNameChars.ReplaceAllString(r.ID, "_")
+	}
+	path := filepath.Join(dir, name+sampleFileExt)
+	return path, os.WriteFile(path, buf.Bytes(), 0o600)
+}
+
+// sampleDir returns the directory holding the sampled requests of the hook.
+// Relative directories are resolved against the working directory of the
+// command.
+func sampleDir(h *hook.Hook) string {
+	dir := h.RequestSampling.Directory
+	if !filepath.IsAbs(dir) && h.CommandWorkingDirectory != "" {
+		dir = filepath.Join(h.CommandWorkingDirectory, dir)
+	}
+	return filepath.Join(dir, unsafeFileNameChars.ReplaceAllString(h.ID, "_"))
+}
+
+// sweepSampledRequests removes the sampled requests of the hook exceeding
+// the retention of its request sampling and returns their number.
+func sweepSampledRequests(h *hook.Hook, now time.Time) (int, error) {
+	pattern := filepath.Join(sampleDir(h), "*"+sampleFileExt)
+	return sweepFiles(pattern, h.RequestSampling.RetentionOrDefault(), now)
+}
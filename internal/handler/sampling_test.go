@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+func TestSampleRequest(t *testing.T) {
+	dir := t.TempDir()
+	h := &hook.Hook{ID: "deploy", RequestSampling: &hook.RequestSampling{Rate: 1, Directory: dir}}
+	req := httptest.NewRequest("POST", "/hooks/deploy", strings.NewReader(`{"ref":"main"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := &requestExecutionContext{
+		hook:         h,
+		hookRequest:  &hook.Request{RawRequest: req},
+		httpRequest:  req,
+		httpResponse: httptest.NewRecorder(),
+		logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	rec.sample = rec.sampleRequest()
+	sample := rec.sample
+	if sample == nil {
+		t.Fatal("expected the request to be sampled")
+	}
+	// the body is recorded while it is parsed
+	if err := rec.ParseRequest(); err != nil {
+		t.Fatal(err)
+	}
+	if rec.hookRequest.Payload["ref"] != "main" {
+		t.Errorf("payload = %v after sampling", rec.hookRequest.Payload)
+	}
+
+	r := &hook.Request{
+		ID:              "req/1",
+		ReceivedAt:      time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		MismatchedRules: []string{hook.MatchHMACSHA256},
+		MismatchClass:   hook.MismatchSignature,
+	}
+	path, err := sample.persist(h, r, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "deploy", "20240501T120000.000000000-req_1.http"); path != want {
+		t.Errorf("path = %q, want %q", path, want)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"# rules-satisfied: false\n",
+		"# mismatch-class: signature\n",
+		"# mismatched-rules: payload-hmac-sha256\n",
+		"POST /hooks/deploy HTTP/1.1\r\n",
+		`{"ref":"main"}`,
+	} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("sampled request lacks %q:\n%s", want, content)
+		}
+	}
+
+	h.RequestSampling.Rate = 0
+	if rec.sampleRequest() != nil {
+		t.Error("expected no sample with a zero rate")
+	}
+	h.RequestSampling.Rate = 1
+	h.StreamBodyToStdin = true
+	if rec.sampleRequest() != nil {
+		t.Error("expected no sample of a body streamed to the command")
+	}
+}
+
+func TestSampleMultipartRequest(t *testing.T) {
+	dir := t.TempDir()
+	h := &hook.Hook{ID: "upload", RequestSampling: &hook.RequestSampling{Rate: 1, Directory: dir}}
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	_ = mw.WriteField("ref", "main")
+	fw, err := mw.CreateFormFile("artifact", "build.tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = fw.Write(bytes.Repeat([]byte("x"), 1024))
+	_ = mw.Close()
+	size := body.Len()
+
+	req := httptest.NewRequest("POST", "/hooks/upload", body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rec := &requestExecutionContext{
+		hook:         h,
+		hookRequest:  &hook.Request{RawRequest: req},
+		httpRequest:  req,
+		httpResponse: httptest.NewRecorder(),
+		logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+		opts:         options{multipartMaxMemory: 256},
+	}
+	rec.sample = rec.sampleRequest()
+	if err := rec.ParseRequest(); err != nil {
+		t.Fatal(err)
+	}
+	if rec.hookRequest.Payload["ref"] != "main" {
+		t.Errorf("payload = %v after sampling", rec.hookRequest.Payload)
+	}
+	path, err := rec.sample.persist(h, &hook.Request{ID: "upload"}, true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("# body-truncated: 256 of %d bytes\n", size); !strings.Contains(string(content), want) {
+		t.Errorf("sampled request lacks %q:\n%s", want, content)
+	}
+	if !strings.Contains(string(content), `name="ref"`) || strings.Contains(string(content), "xxxxxxxxxx\r\n") {
+		t.Errorf("expected only the start of the body to be kept:\n%s", content)
+	}
+}
+
+func TestSweepSampledRequests(t *testing.T) {
+	dir := t.TempDir()
+	h := &hook.Hook{ID: "deploy", RequestSampling: &hook.RequestSampling{
+		Rate:      1,
+		Directory: dir,
+		Retention: &hook.Retention{MaxCount: 2},
+	}}
+	now := time.Now()
+	for i, name := range []string{"a", "b", "c"} {
+		path := filepath.Join(sampleDir(h), name+sampleFileExt)
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		age := time.Duration(3-i) * time.Hour
+		if err := os.Chtimes(path, now.Add(-age), now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	removed, err := sweepSampledRequests(h, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Errorf("removed %d sampled requests, want 1", removed)
+	}
+	if _, err := os.Stat(filepath.Join(sampleDir(h), "a"+sampleFileExt)); !os.IsNotExist(err) {
+		t.Error("expected the oldest sampled request to be removed")
+	}
+}
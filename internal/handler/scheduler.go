@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+// ErrHookRunning is returned by Scheduler.Acquire for hooks with the drop
+// concurrency policy while an execution is in progress.
+var ErrHookRunning = errors.New("hook is already running")
+
+// Scheduler coordinates executions of the same hook across all requests and
+// trigger sources according to the concurrency policy of the hook. Optionally,
+// it limits the number of commands running at the same time across all hooks.
+type Scheduler struct {
+	mu        sync.Mutex
+	slots     map[[3]string]chan struct{}
+	debounced map[[3]string]*debouncedRun
+	pool      *workerPool
+	// queued is the number of executions waiting in Acquire
+	queued atomic.Int64
+}
+
+// debouncedRun is the pending execution of a debounced hook.
+type debouncedRun struct {
+	timer   *time.Timer
+	run     func()
+	discard func()
+}
+
+// NewScheduler creates a scheduler running at most maxConcurrent commands at
+// the same time; zero means no limit.
+func NewScheduler(maxConcurrent int) *Scheduler {
+	s := &Scheduler{
+		slots:     make(map[[3]string]chan struct{}),
+		debounced: make(map[[3]string]*debouncedRun),
+	}
+	if maxConcurrent > 0 {
+		s.pool = newWorkerPool(maxConcurrent)
+	}
+	return s
+}
+
+// Acquire reserves an execution of the hook. Hooks with the serialize policy
+// wait until the running execution finished or the context is done, hooks with
+// the drop policy fail with ErrHookRunning instead. When the number of
+// concurrent commands is limited, executions additionally wait for a free
+// worker, hooks with a higher priority first. The returned function must be
+// called once the execution finished.
+func (s *Scheduler) Acquire(ctx context.Context, h *hook.Hook) (func(), error) {
+	started := time.Now()
+	s.queued.Add(1)
+	release, err := s.acquire(ctx, h)
+	s.queued.Add(-1)
+	if err == nil {
+		recordQueueWait(ctx, h, time.Since(started).Seconds())
+	}
+	return release, err
+}
+
+// Queued returns the number of executions waiting for their concurrency
+// policy or a free worker.
+func (s *Scheduler) Queued() int {
+	return int(s.queued.Load())
+}
+
+func (s *Scheduler) acquire(ctx context.Context, h *hook.Hook) (func(), error) {
+	release, err := s.acquireHook(ctx, h)
+	if err != nil || s.pool == nil {
+		return release, err
+	}
+	if err := s.pool.acquire(ctx, h.Priority); err != nil {
+		release()
+		return nil, err
+	}
+	return func() {
+		s.pool.release()
+		release()
+	}, nil
+}
+
+// acquireHook reserves an execution according to the concurrency policy.
+func (s *Scheduler) acquireHook(ctx context.Context, h *hook.Hook) (func(), error) {
+	switch h.ConcurrencyPolicy {
+	case "", hook.ConcurrencyParallel:
+		return func() {}, nil
+	case hook.ConcurrencyDrop:
+		slot := s.slot(h.RouteKey())
+		select {
+		case slot <- struct{}{}:
+			return func() { <-slot }, nil
+		default:
+			return nil, ErrHookRunning
+		}
+	case hook.ConcurrencySerialize:
+		slot := s.slot(h.RouteKey())
+		select {
+		case slot <- struct{}{}:
+			return func() { <-slot }, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	default:
+		return nil, fmt.Errorf("unknown concurrency policy %q", h.ConcurrencyPolicy)
+	}
+}
+
+// slot returns the execution slot of the hook with the route, see hook.RouteKey.
+func (s *Scheduler) slot(route [3]string) chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	slot, ok := s.slots[route]
+	if !ok {
+		slot = make(chan struct{}, 1)
+		s.slots[route] = slot
+	}
+	return slot
+}
+
+// Debounce delays run until the hook has not been triggered for its debounce
+// period. Calls during the period replace the pending run and restart the
+// period, so a burst of triggers results in a single run of the latest one.
+// The discard function, if any, is called for a run which gets replaced.
+func (s *Scheduler) Debounce(h *hook.Hook, run, discard func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.debounceLocked(h.RouteKey(), time.Duration(h.Debounce), run, discard)
+}
+
+func (s *Scheduler) debounceLocked(route [3]string, period time.Duration, run, discard func()) {
+	if d, ok := s.debounced[route]; ok {
+		// the pending run is replaced by a new entry with its own timer, so
+		// a timer which expired concurrently finds its entry gone
+		d.timer.Stop()
+		if d.discard != nil {
+			d.discard()
+		}
+	}
+	d := &debouncedRun{run: run, discard: discard}
+	d.timer = time.AfterFunc(period, func() {
+		s.mu.Lock()
+		if s.debounced[route] != d {
+			s.mu.Unlock()
+			return
+		}
+		delete(s.debounced, route)
+		s.mu.Unlock()
+		run()
+	})
+	s.debounced[route] = d
+}
@@ -0,0 +1,205 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+func TestSchedulerAcquire(t *testing.T) {
+	s := NewScheduler(0)
+	ctx := context.Background()
+
+	parallel := &hook.Hook{ID: "parallel"}
+	r1, err := s.Acquire(ctx, parallel)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	r2, err := s.Acquire(ctx, parallel)
+	if err != nil {
+		t.Fatalf("parallel executions must not block: %s", err)
+	}
+	r1()
+	r2()
+
+	drop := &hook.Hook{ID: "drop", ConcurrencyPolicy: hook.ConcurrencyDrop}
+	release, err := s.Acquire(ctx, drop)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := s.Acquire(ctx, drop); !errors.Is(err, ErrHookRunning) {
+		t.Errorf("expected ErrHookRunning, got %v", err)
+	}
+	release()
+	release, err = s.Acquire(ctx, drop)
+	if err != nil {
+		t.Fatalf("expected slot to be free after release: %s", err)
+	}
+	release()
+
+	serialize := &hook.Hook{ID: "serialize", ConcurrencyPolicy: hook.ConcurrencySerialize}
+	release, err = s.Acquire(ctx, serialize)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := s.Acquire(timeout, serialize); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected serialized execution to wait, got %v", err)
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		release()
+	}()
+	release, err = s.Acquire(ctx, serialize)
+	if err != nil {
+		t.Fatalf("expected serialized execution to run after release: %s", err)
+	}
+	release()
+
+	if _, err := s.Acquire(ctx, &hook.Hook{ID: "x", ConcurrencyPolicy: "bogus"}); err == nil {
+		t.Error("expected error for unknown policy")
+	}
+}
+
+func TestSchedulerDebounce(t *testing.T) {
+	s := NewScheduler(0)
+	h := &hook.Hook{ID: "debounce", Debounce: hook.Duration(50 * time.Millisecond)}
+
+	runs := make(chan int, 3)
+	discarded := make(chan int, 3)
+	for i := 1; i <= 3; i++ {
+		s.Debounce(h, func() { runs <- i }, func() { discarded <- i })
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	select {
+	case got := <-runs:
+		if got != 3 {
+			t.Errorf("expected the latest trigger to run, got %d", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("debounced run did not happen")
+	}
+	select {
+	case got := <-runs:
+		t.Errorf("expected a single run, got another one: %d", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if len(discarded) != 2 {
+		t.Errorf("expected 2 superseded runs to be discarded, got %d", len(discarded))
+	}
+}
+
+func TestSchedulerPriority(t *testing.T) {
+	s := NewScheduler(1)
+	ctx := context.Background()
+
+	release, err := s.Acquire(ctx, &hook.Hook{ID: "running"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	order := make(chan string, 3)
+	start := func(id string, priority int) {
+		go func() {
+			release, err := s.Acquire(ctx, &hook.Hook{ID: id, Priority: priority})
+			if err != nil {
+				t.Errorf("unexpected error: %s", err)
+				return
+			}
+			order <- id
+			release()
+		}()
+		// make sure the waiters queue up in order
+		time.Sleep(20 * time.Millisecond)
+	}
+	start("housekeeping", 0)
+	start("cleanup", 0)
+	start("deploy", 10)
+
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := s.Acquire(timeout, &hook.Hook{ID: "impatient"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected execution to wait for a worker, got %v", err)
+	}
+
+	release()
+	for _, want := range []string{"deploy", "housekeeping", "cleanup"} {
+		if got := <-order; got != want {
+			t.Errorf("expected %s to run next, got %s", want, got)
+		}
+	}
+}
+
+func TestSchedulerSeparatesRoutes(t *testing.T) {
+	s := NewScheduler(0)
+	ctx := context.Background()
+
+	a := &hook.Hook{ID: "deploy", Host: "a.example.com", ConcurrencyPolicy: hook.ConcurrencyDrop, Debounce: hook.Duration(20 * time.Millisecond)}
+	b := &hook.Hook{ID: "deploy", Host: "b.example.com", ConcurrencyPolicy: hook.ConcurrencyDrop, Debounce: hook.Duration(20 * time.Millisecond)}
+
+	release, err := s.Acquire(ctx, a)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer release()
+	if release, err := s.Acquire(ctx, b); err != nil {
+		t.Errorf("expected the hook of another host to run, got %v", err)
+	} else {
+		release()
+	}
+
+	runs := make(chan string, 2)
+	s.Debounce(a, func() { runs <- a.Host }, nil)
+	s.Debounce(b, func() { runs <- b.Host }, nil)
+	got := map[string]bool{}
+	for range 2 {
+		select {
+		case host := <-runs:
+			got[host] = true
+		case <-time.After(time.Second):
+			t.Fatalf("expected both debounced runs, got %v", got)
+		}
+	}
+}
+
+func TestSchedulerDebounceAtExpiry(t *testing.T) {
+	s := NewScheduler(0)
+	route := (&hook.Hook{ID: "debounce"}).RouteKey()
+
+	runs := make(chan int, 2)
+	discarded := make(chan int, 2)
+	// hold the lock until the timer of the first trigger expired, so its
+	// callback waits while the second trigger arrives
+	s.mu.Lock()
+	s.debounceLocked(route, time.Millisecond, func() { runs <- 1 }, func() { discarded <- 1 })
+	time.Sleep(20 * time.Millisecond)
+	s.debounceLocked(route, 100*time.Millisecond, func() { runs <- 2 }, func() { discarded <- 2 })
+	s.mu.Unlock()
+
+	select {
+	case got := <-runs:
+		t.Fatalf("expected the second trigger to wait for its period, got run %d", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+	select {
+	case got := <-runs:
+		if got != 2 {
+			t.Errorf("expected the latest trigger to run, got %d", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("debounced run did not happen")
+	}
+	select {
+	case got := <-runs:
+		t.Errorf("expected a single run, got another one: %d", got)
+	case <-time.After(150 * time.Millisecond):
+	}
+	if len(discarded) != 1 || <-discarded != 1 {
+		t.Error("expected the first trigger to be discarded")
+	}
+}
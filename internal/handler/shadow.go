@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+// shadowResult is the outcome of a shadow execution.
+type shadowResult struct {
+	err      error
+	output   string
+	duration time.Duration
+}
+
+// startShadow starts the shadow command of the hook in the background and
+// returns the channel receiving its result, or nil if the hook has none.
+// Shadows never read the request body stream and never affect the response,
+// the activity feed, the circuit breaker or the previous execution state of
+// the hook, and are not counted as running executions.
+func (e *Executor) startShadow(ctx context.Context) <-chan shadowResult {
+	s := e.hook.Shadow
+	if s == nil {
+		return nil
+	}
+	var shadow hook.Hook
+	switch {
+	case s.Hook != "":
+		if e.lookup == nil {
+			return nil
+		}
+		h := e.lookup.GetForTenant(e.hook.Tenant, s.Hook)
+		if h == nil {
+			e.logger.Error("shadow hook not found", "shadow_hook_id", s.Hook)
+			return nil
+		}
+		shadow = *h
+	case s.ExecuteCommand != "":
+		shadow = *e.hook
+		shadow.ExecuteCommand = s.ExecuteCommand
+	default:
+		e.logger.Error("shadow sets neither execute-command nor hook")
+		return nil
+	}
+	shadow.StreamBodyToStdin = false
+
+	logger := e.logger.With("shadow", true)
+	executor := NewExecutor(&shadow, e.req, logger).WithLastRuns(e.lastRuns)
+	executor.lookup = e.lookup
+	executor.processes = e.processes
+	executor.shadow = true
+	result := make(chan shadowResult, 1)
+	go func() {
+		started := time.Now()
+		tail := &tailBuffer{max: logOutputLimit}
+		err := executor.execHookCommand(context.WithoutCancel(ctx), tail)
+		result <- shadowResult{err: err, output: tail.String(), duration: time.Since(started)}
+	}()
+	return result
+}
+
+// logShadow waits for the shadow execution and logs its result along with the
+// result of the command of the hook, so both can be compared.
+func (e *Executor) logShadow(result <-chan shadowResult, primaryErr error) {
+	r := <-result
+	e.logger.Info("shadow execution finished",
+		"shadow.exit_code", exitCode(r.err),
+		"shadow.output", r.output,
+		"shadow.duration", r.duration,
+		"primary.exit_code", exitCode(primaryErr),
+		"exit_codes_match", exitCode(r.err) == exitCode(primaryErr),
+	)
+}
@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"context"
+	"sync"
+)
+
+// sharedExecutions tracks the running executions of deliveries with a
+// deduplication key, so identical deliveries share them instead of running
+// the command again, see requestExecutionContext.deduplicationKey.
+type sharedExecutions struct {
+	mu      sync.Mutex
+	running map[string]*sharedExecution
+}
+
+func newSharedExecutions() *sharedExecutions {
+	return &sharedExecutions{running: make(map[string]*sharedExecution)}
+}
+
+// sharedExecution is the execution of a delivery, shared by the identical
+// deliveries received until it finishes.
+type sharedExecution struct {
+	key    string
+	done   chan struct{}
+	output []byte
+	err    error
+}
+
+// join returns the running execution with the key and false. Otherwise it
+// registers a new execution and returns it with true, the caller then leads
+// the execution and has to finish it.
+func (s *sharedExecutions) join(key string) (*sharedExecution, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.running[key]; ok {
+		return e, false
+	}
+	e := &sharedExecution{key: key, done: make(chan struct{})}
+	s.running[key] = e
+	return e, true
+}
+
+// finish stores the result of the execution and hands it to the deliveries
+// sharing it. Deliveries arriving afterwards start a new execution.
+func (s *sharedExecutions) finish(e *sharedExecution, output []byte, err error) {
+	s.mu.Lock()
+	delete(s.running, e.key)
+	s.mu.Unlock()
+	e.output, e.err = output, err
+	close(e.done)
+}
+
+// wait returns the result of the execution once it finished, or the error of
+// the context if it is done first. The execution continues either way.
+func (e *sharedExecution) wait(ctx context.Context) ([]byte, error) {
+	select {
+	case <-e.done:
+		return e.output, e.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook_manager"
+)
+
+// Stats is a snapshot of the runtime state of webhook.
+type Stats struct {
+	Goroutines int    `json:"goroutines"`
+	HeapAlloc  uint64 `json:"heap_alloc_bytes"`
+	HeapInuse  uint64 `json:"heap_inuse_bytes"`
+	HeapSys    uint64 `json:"heap_sys_bytes"`
+	Hooks      int    `json:"hooks"`
+	Running    int    `json:"running_executions"`
+	Queued     int    `json:"queued_executions"`
+}
+
+// StatsHandler serves the runtime stats for quick operational inspection,
+// without a metrics stack.
+type StatsHandler struct {
+	hookManager *hook_manager.Manager
+	scheduler   *Scheduler
+	processes   *Processes
+}
+
+func NewStatsHandler(hookManager *hook_manager.Manager, scheduler *Scheduler, processes *Processes) *StatsHandler {
+	return &StatsHandler{hookManager: hookManager, scheduler: scheduler, processes: processes}
+}
+
+// Stats returns the current stats.
+func (s *StatsHandler) Stats() Stats {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	return Stats{
+		Goroutines: runtime.NumGoroutine(),
+		HeapAlloc:  mem.HeapAlloc,
+		HeapInuse:  mem.HeapInuse,
+		HeapSys:    mem.HeapSys,
+		Hooks:      s.hookManager.Len(),
+		Running:    s.processes.len(),
+		Queued:     s.scheduler.Queued(),
+	}
+}
+
+func (s *StatsHandler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(s.Stats())
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook_manager"
+)
+
+func TestStatsHandler(t *testing.T) {
+	hooksFile := filepath.Join(t.TempDir(), "hooks.json")
+	if err := os.WriteFile(hooksFile, []byte(`[{"id":"a","execute-command":"true"},{"id":"b","execute-command":"true"}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hooks := hook_manager.NewManager(ctx, hook_manager.HooksFiles{hooksFile}, false, false)
+	if err := hooks.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	scheduler := NewScheduler(1)
+	h := &hook.Hook{ID: "a"}
+	release, err := scheduler.Acquire(ctx, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitCtx, stopWaiting := context.WithCancel(ctx)
+	waiting := make(chan struct{})
+	go func() {
+		defer close(waiting)
+		_, _ = scheduler.Acquire(waitCtx, h)
+	}()
+	for deadline := time.Now().Add(5 * time.Second); scheduler.Queued() == 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	rec := httptest.NewRecorder()
+	NewStatsHandler(hooks, scheduler, NewProcesses()).ServeHTTP(rec, httptest.NewRequest("GET", "/debug/stats", nil))
+	stopWaiting()
+	<-waiting
+	release()
+
+	var stats Stats
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("invalid response %q: %s", rec.Body.String(), err)
+	}
+	if stats.Hooks != 2 || stats.Queued != 1 || stats.Goroutines == 0 || stats.HeapAlloc == 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if scheduler.Queued() != 0 {
+		t.Errorf("expected no queued executions after canceling, got %d", scheduler.Queued())
+	}
+}
+
+func TestProcessGroupLen(t *testing.T) {
+	g := NewProcesses()
+	g.add(&process{})
+	g.add(&process{shadow: true})
+	if n := g.len(); n != 1 {
+		t.Errorf("expected shadows not to be counted, got %d running", n)
+	}
+}
@@ -0,0 +1,50 @@
+package handler
+
+import "unicode/utf8"
+
+// logOutputLimit is the number of bytes at the end of the command output
+// which are kept for logging, so the memory used doesn't grow with the
+// output of long running or chatty commands.
+const logOutputLimit = 64 << 10
+
+// tailBuffer keeps the last max bytes written to it and counts all of them.
+type tailBuffer struct {
+	max  int
+	buf  []byte
+	size int64
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.size += int64(len(p))
+	if len(p) >= b.max {
+		b.buf = append(b.buf[:0], p[len(p)-b.max:]...)
+		return len(p), nil
+	}
+	b.buf = append(b.buf, p...)
+	// the buffer is compacted once it holds twice the tail, so writes don't
+	// move the tail every time
+	if len(b.buf) >= 2*b.max {
+		b.buf = b.buf[:copy(b.buf, b.buf[len(b.buf)-b.max:])]
+	}
+	return len(p), nil
+}
+
+// Truncated returns whether bytes were dropped from the start of the output.
+func (b *tailBuffer) Truncated() bool {
+	return b.size > int64(b.max)
+}
+
+// String returns the tail of the output without a cut multibyte character
+// at its start.
+func (b *tailBuffer) String() string {
+	tail := b.buf
+	if len(tail) > b.max {
+		tail = tail[len(tail)-b.max:]
+	}
+	if b.Truncated() {
+		for len(tail) > 0 && !utf8.RuneStart(tail[0]) {
+			tail = tail[1:]
+		}
+	}
+	return string(tail)
+}
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTailBuffer(t *testing.T) {
+	tests := []struct {
+		desc      string
+		writes    []string
+		want      string
+		truncated bool
+	}{
+		{"empty", nil, "", false},
+		{"short", []string{"ab", "cd"}, "abcd", false},
+		{"exact", []string{"abcdefgh"}, "abcdefgh", false},
+		{"large write", []string{"0123456789"}, "23456789", true},
+		{"many writes", []string{"abc", "def", "ghi", "jkl", "mno", "pqr"}, "klmnopqr", true},
+		{"multibyte", []string{"a", "äöüéx"}, "öüéx", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			b := &tailBuffer{max: 8}
+			var size int
+			for _, w := range tt.writes {
+				if n, err := b.Write([]byte(w)); n != len(w) || err != nil {
+					t.Fatalf("unexpected write result %d, %v", n, err)
+				}
+				size += len(w)
+				if len(b.buf) > 2*b.max {
+					t.Fatalf("buffer grew to %d bytes", len(b.buf))
+				}
+			}
+			if got := b.String(); got != tt.want {
+				t.Errorf("expected tail %q, got %q", tt.want, got)
+			}
+			if b.Truncated() != tt.truncated {
+				t.Errorf("expected truncated %t, got %t", tt.truncated, b.Truncated())
+			}
+			if b.size != int64(size) {
+				t.Errorf("expected size %d, got %d", size, b.size)
+			}
+		})
+	}
+
+	b := &tailBuffer{max: logOutputLimit}
+	chunk := strings.Repeat("x", 1000)
+	for range 1000 {
+		_, _ = b.Write([]byte(chunk))
+	}
+	if cap(b.buf) > 4*logOutputLimit {
+		t.Errorf("expected memory bounded by the limit, got capacity %d", cap(b.buf))
+	}
+}
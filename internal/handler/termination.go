@@ -0,0 +1,252 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Reasons for terminating commands.
+const (
+	reasonCanceled = "request canceled"
+	reasonTimeout  = "timeout reached"
+	reasonNoOutput = "no output"
+	reasonShutdown = "shutdown"
+)
+
+// defaultTerminationGracePeriod is the time commands have to exit after the
+// termination signal, before they are killed.
+const defaultTerminationGracePeriod = 10 * time.Second
+
+// killSignals are the signals hooks may terminate their commands with.
+var killSignals = map[string]syscall.Signal{
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGINT":  syscall.SIGINT,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGTERM": syscall.SIGTERM,
+}
+
+// parseKillSignal returns the named signal, SIGTERM if the name is empty.
+// The SIG prefix is optional.
+func parseKillSignal(name string) (syscall.Signal, error) {
+	if name == "" {
+		return syscall.SIGTERM, nil
+	}
+	name = strings.ToUpper(name)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	signal, ok := killSignals[name]
+	if !ok {
+		return 0, fmt.Errorf("unsupported kill signal %q, use SIGHUP, SIGINT, SIGQUIT or SIGTERM", name)
+	}
+	return signal, nil
+}
+
+// process is a running command, which is terminated gracefully: its process
+// group receives the kill signal, and SIGKILL once the grace period elapsed.
+type process struct {
+	cmd    *exec.Cmd
+	signal syscall.Signal
+	grace  time.Duration
+	logger *slog.Logger
+	// shadow commands are terminated on shutdown, but not counted as
+	// running executions
+	shadow bool
+
+	once sync.Once
+	// exited is closed once the command exited
+	exited chan struct{}
+	// terminated is closed once the command exited or was killed after
+	// the termination
+	terminated chan struct{}
+	// lastOutput is the time of the latest output in Unix nanoseconds
+	lastOutput atomic.Int64
+	// reason is why the command was terminated, if it was
+	reason atomic.Pointer[string]
+}
+
+func newProcess(cmd *exec.Cmd, signal syscall.Signal, grace time.Duration, logger *slog.Logger) *process {
+	if grace <= 0 {
+		grace = defaultTerminationGracePeriod
+	}
+	return &process{
+		cmd:        cmd,
+		signal:     signal,
+		grace:      grace,
+		logger:     logger,
+		exited:     make(chan struct{}),
+		terminated: make(chan struct{}),
+	}
+}
+
+// trackOutput returns a writer recording the time of the output written to
+// w, for detecting stalled commands.
+func (p *process) trackOutput(w io.Writer) io.Writer {
+	p.lastOutput.Store(time.Now().UnixNano())
+	return &outputTracker{w: w, p: p}
+}
+
+// watch terminates the command once the context is canceled, ie. when the
+// client disconnected, the timeout is reached or the command did not produce
+// output for the no-output timeout. It returns once the command exited.
+func (p *process) watch(ctx context.Context, timeout, noOutputTimeout time.Duration) {
+	var timedOut, stalled <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timedOut = timer.C
+	}
+	var stallTimer *time.Timer
+	if noOutputTimeout > 0 {
+		stallTimer = time.NewTimer(noOutputTimeout)
+		defer stallTimer.Stop()
+		stalled = stallTimer.C
+	}
+	for {
+		select {
+		case <-p.exited:
+			return
+		case <-ctx.Done():
+			p.terminate(reasonCanceled)
+			return
+		case <-timedOut:
+			p.terminate(reasonTimeout)
+			return
+		case <-stalled:
+			idle := time.Since(time.Unix(0, p.lastOutput.Load()))
+			if idle >= noOutputTimeout {
+				p.terminate(reasonNoOutput)
+				return
+			}
+			stallTimer.Reset(noOutputTimeout - idle)
+		}
+	}
+}
+
+// terminate sends the kill signal to the process group of the command, so
+// scripts can clean up, and kills the group if the command did not exit
+// within the grace period. It does not wait for the command to exit.
+func (p *process) terminate(reason string) {
+	p.once.Do(func() {
+		select {
+		case <-p.exited:
+			close(p.terminated)
+			return
+		default:
+		}
+		p.reason.Store(&reason)
+		p.logger.Info("terminating command", "reason", reason, "signal", p.signal.String(), "grace_period", p.grace)
+		if err := sendKillSignal(p.logger, p.cmd.Process.Pid, p.signal); err != nil {
+			p.logger.Warn("failed to send kill signal, trying SIGKILL instead", "signal", p.signal.String(), "error", err)
+		}
+		go func() {
+			defer close(p.terminated)
+			timer := time.NewTimer(p.grace)
+			defer timer.Stop()
+			select {
+			case <-p.exited:
+				p.logger.Info("command has been stopped", "command", p.cmd.Path)
+			case <-timer.C:
+				p.logger.Warn("command did not exit within the grace period, sending SIGKILL", "grace_period", p.grace)
+				if err := sendKillSignal(p.logger, p.cmd.Process.Pid, syscall.SIGKILL); err != nil {
+					p.logger.Error("failed to send SIGKILL", "error", err)
+				}
+			}
+		}()
+	})
+}
+
+// timeoutReason returns the reason of the termination if the command was
+// terminated by the timeout or the no-output timeout.
+func (p *process) timeoutReason() string {
+	reason := p.reason.Load()
+	if reason == nil || (*reason != reasonTimeout && *reason != reasonNoOutput) {
+		return ""
+	}
+	return *reason
+}
+
+// outputTracker records the time of the latest write of a command.
+type outputTracker struct {
+	w io.Writer
+	p *process
+}
+
+func (t *outputTracker) Write(b []byte) (int, error) {
+	t.p.lastOutput.Store(time.Now().UnixNano())
+	return t.w.Write(b)
+}
+
+// Processes holds the running commands, so they can be terminated on
+// shutdown. A nil Processes tracks nothing.
+type Processes struct {
+	mu      sync.Mutex
+	running map[*process]struct{}
+}
+
+func NewProcesses() *Processes {
+	return &Processes{running: make(map[*process]struct{})}
+}
+
+func (g *Processes) add(p *process) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.running[p] = struct{}{}
+}
+
+func (g *Processes) remove(p *process) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.running, p)
+}
+
+// len returns the number of running commands, without shadows.
+func (g *Processes) len() int {
+	if g == nil {
+		return 0
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	n := 0
+	for p := range g.running {
+		if !p.shadow {
+			n++
+		}
+	}
+	return n
+}
+
+// Terminate gracefully terminates all running commands and waits until they
+// exited or were killed after their grace period.
+func (g *Processes) Terminate() {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	running := make([]*process, 0, len(g.running))
+	for p := range g.running {
+		running = append(running, p)
+	}
+	g.mu.Unlock()
+
+	for _, p := range running {
+		p.terminate(reasonShutdown)
+	}
+	for _, p := range running {
+		<-p.terminated
+	}
+}
@@ -3,14 +3,15 @@
 package handler
 
 import (
+	"log/slog"
 	"os/exec"
 	"syscall"
 )
 
 // sendKillSignal sends terminate/kill signal to the process
-func sendKillSignal(executor *Executor, pid int, signal syscall.Signal) error {
+func sendKillSignal(logger *slog.Logger, pid int, signal syscall.Signal) error {
 	if err := syscall.Kill(-pid, signal); err != nil {
-		executor.logger.Error("error during handling terminate/kill signal", "signal", signal.String(), "error", err)
+		logger.Error("error during handling terminate/kill signal", "signal", signal.String(), "error", err)
 		return err
 	}
 	return nil
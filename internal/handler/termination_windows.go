@@ -3,18 +3,19 @@
 package handler
 
 import (
+	"log/slog"
 	"os/exec"
 	"strconv"
 	"syscall"
 )
 
 // sendKillSignal sends terminate/kill signal to the process
-func sendKillSignal(executor *Executor, pid int, signal syscall.Signal) error {
+func sendKillSignal(logger *slog.Logger, pid int, signal syscall.Signal) error {
 
 	err := exec.Command("TASKKILL", "/T", "/F", "/PID", strconv.Itoa(pid)).Run()
 
 	if err != nil {
-		executor.logger.Error("error during handling terminate/kill signal", "error", err)
+		logger.Error("error during handling terminate/kill signal", "error", err)
 	}
 
 	return err
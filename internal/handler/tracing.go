@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"context"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+const (
+	traceRulesMatchedKey  = attribute.Key("webhook.rules.matched")
+	traceMismatchKey      = attribute.Key("webhook.rules.mismatch")
+	traceExitCodeKey      = attribute.Key("process.exit.code")
+	traceTimeoutKey       = attribute.Key("webhook.timeout")
+	traceTimeoutReasonKey = attribute.Key("webhook.timeout.reason")
+	traceOutputKey        = attribute.Key("webhook.output")
+	traceOutputSizeKey    = attribute.Key("webhook.output.bytes")
+	traceOutputCutKey     = attribute.Key("webhook.output.truncated")
+	traceLinkKey          = attribute.Key("webhook.link")
+
+	// traceOutputLimit is the number of bytes of the command output recorded
+	// in the output event of the execution span.
+	traceOutputLimit = 4096
+)
+
+// traceRules records the outcome of the trigger rules on the span of the
+// request.
+func traceRules(ctx context.Context, r *hook.Request, matched bool) {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(traceRulesMatchedKey.Bool(matched))
+	if r.MismatchClass != "" {
+		span.SetAttributes(traceMismatchKey.String(r.MismatchClass))
+	}
+}
+
+// traceOutput records the end of the command output, truncated to
+// traceOutputLimit bytes, as an event of the execution span. The size is the
+// number of bytes of the whole output.
+func traceOutput(ctx context.Context, output string, size int64) {
+	truncated := size > int64(len(output))
+	if len(output) > traceOutputLimit {
+		truncated = true
+		// don't cut multibyte characters
+		cut := len(output) - traceOutputLimit
+		for cut < len(output) && !utf8.RuneStart(output[cut]) {
+			cut++
+		}
+		output = output[cut:]
+	}
+	trace.SpanFromContext(ctx).AddEvent("command output", trace.WithAttributes(
+		traceOutputKey.String(output),
+		traceOutputSizeKey.Int64(size),
+		traceOutputCutKey.Bool(truncated),
+	))
+}
@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+func spanAttribute(attrs []attribute.KeyValue, key attribute.Key) (attribute.Value, bool) {
+	for _, attr := range attrs {
+		if attr.Key == key {
+			return attr.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestExecutorTracing(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a shell")
+	}
+	previous := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	tests := []struct {
+		desc     string
+		script   string
+		timeout  time.Duration
+		detached bool
+		exitCode int64
+		output   string
+	}{
+		{"success", `echo done`, 0, false, 0, "done\n"},
+		{"failure", `echo failed; exit 3`, 0, false, 3, "failed\n"},
+		{"timeout", `sleep 5`, 100 * time.Millisecond, false, -1, ""},
+		{"detached", `echo done`, 0, true, 0, "done\n"},
+		{"truncated output", `head -c 5000 /dev/zero | tr '\0' x`, 0, false, 0, strings.Repeat("x", traceOutputLimit)},
+		{"output tail", `head -c 5000 /dev/zero | tr '\0' x; echo end`, 0, false, 0, strings.Repeat("x", traceOutputLimit-4) + "end\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			recorder := tracetest.NewSpanRecorder()
+			provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+			otel.SetTracerProvider(provider)
+
+			h := shellHook(tt.script)
+			h.Timeout = hook.Duration(tt.timeout)
+			ctx, trigger := provider.Tracer("test").Start(context.Background(), "POST /hooks/shell")
+			e := NewExecutor(h, &hook.Request{ID: "abc123"}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if tt.detached {
+				e.WithDetachedTrace()
+			}
+			_ = e.Execute(ctx, io.Discard)
+			trigger.End()
+
+			spans := recorder.Ended()
+			if len(spans) != 2 {
+				t.Fatalf("expected execution and request span, got %d spans", len(spans))
+			}
+			execution, request := spans[0], spans[1]
+
+			if value, _ := spanAttribute(execution.Attributes(), traceHookIDKey); value.AsString() != "shell" {
+				t.Errorf("expected hook id shell, got %q", value.AsString())
+			}
+			if value, _ := spanAttribute(execution.Attributes(), traceExitCodeKey); value.AsInt64() != tt.exitCode {
+				t.Errorf("expected exit code %d, got %d", tt.exitCode, value.AsInt64())
+			}
+			if value, _ := spanAttribute(execution.Attributes(), traceTimeoutKey); value.AsBool() != (tt.timeout > 0) {
+				t.Errorf("expected timeout %t, got %t", tt.timeout > 0, value.AsBool())
+			}
+			if tt.detached == execution.Parent().IsValid() {
+				t.Errorf("expected detached %t, got parent %s", tt.detached, execution.Parent().SpanID())
+			}
+			if links := execution.Links(); len(links) != 1 || links[0].SpanContext.SpanID() != trigger.SpanContext().SpanID() {
+				t.Errorf("expected execution span to link to the request span, got %v", links)
+			}
+			if links := request.Links(); len(links) != 1 || links[0].SpanContext.SpanID() != execution.SpanContext().SpanID() {
+				t.Errorf("expected request span to link to the execution span, got %v", links)
+			}
+
+			var output []attribute.KeyValue
+			for _, event := range execution.Events() {
+				if event.Name == "command output" {
+					output = event.Attributes
+				}
+			}
+			if output == nil {
+				t.Fatalf("expected command output event, got %v", execution.Events())
+			}
+			if value, _ := spanAttribute(output, traceOutputKey); value.AsString() != tt.output {
+				t.Errorf("expected output %q, got %q", tt.output, value.AsString())
+			}
+			truncated := len(tt.output) == traceOutputLimit
+			if value, _ := spanAttribute(output, traceOutputCutKey); value.AsBool() != truncated {
+				t.Errorf("expected truncated %t, got %t", truncated, value.AsBool())
+			}
+		})
+	}
+}
+
+func TestTraceRules(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	ctx, span := provider.Tracer("test").Start(context.Background(), "POST /hooks/shell")
+	traceRules(ctx, &hook.Request{MismatchClass: hook.MismatchSignature}, false)
+	span.End()
+
+	attrs := recorder.Ended()[0].Attributes()
+	if value, ok := spanAttribute(attrs, traceRulesMatchedKey); !ok || value.AsBool() {
+		t.Errorf("expected rules not to be matched, got %v", value.Emit())
+	}
+	if value, _ := spanAttribute(attrs, traceMismatchKey); value.AsString() != hook.MismatchSignature {
+		t.Errorf("expected mismatch %q, got %q", hook.MismatchSignature, value.AsString())
+	}
+}
@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+)
+
+// workerPool limits the number of concurrently running commands. Waiting
+// executions are granted a slot by priority first and arrival second.
+type workerPool struct {
+	mu      sync.Mutex
+	free    int
+	seq     uint64
+	waiters waiterQueue
+}
+
+type waiter struct {
+	priority int
+	seq      uint64
+	ready    chan struct{}
+	index    int
+}
+
+func newWorkerPool(size int) *workerPool {
+	return &workerPool{free: size}
+}
+
+// acquire waits for a free slot or until the context is done.
+func (p *workerPool) acquire(ctx context.Context, priority int) error {
+	p.mu.Lock()
+	if p.free > 0 && len(p.waiters) == 0 {
+		p.free--
+		p.mu.Unlock()
+		return nil
+	}
+	p.seq++
+	w := &waiter{priority: priority, seq: p.seq, ready: make(chan struct{})}
+	heap.Push(&p.waiters, w)
+	p.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		select {
+		case <-w.ready:
+			// the slot was granted concurrently, hand it on
+			p.releaseLocked()
+		default:
+			heap.Remove(&p.waiters, w.index)
+		}
+		return ctx.Err()
+	}
+}
+
+func (p *workerPool) release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.releaseLocked()
+}
+
+func (p *workerPool) releaseLocked() {
+	if len(p.waiters) > 0 {
+		w := heap.Pop(&p.waiters).(*waiter)
+		close(w.ready)
+		return
+	}
+	p.free++
+}
+
+// waiterQueue implements heap.Interface ordered by descending priority and
+// ascending arrival.
+type waiterQueue []*waiter
+
+func (q waiterQueue) Len() int { return len(q) }
+
+func (q waiterQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q waiterQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *waiterQueue) Push(x any) {
+	w := x.(*waiter)
+	w.index = len(*q)
+	*q = append(*q, w)
+}
+
+func (q *waiterQueue) Pop() any {
+	old := *q
+	n := len(old)
+	w := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+	return w
+}
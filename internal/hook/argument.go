@@ -33,6 +33,12 @@ type Argument struct {
 	Name         string `json:"name,omitempty"`
 	EnvName      string `json:"envname,omitempty"`
 	Base64Decode bool   `json:"base64decode,omitempty"`
+	// Include and Exclude project the value of entire-* sources.
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+	// Ref names an argument set of the hooks file. References are replaced
+	// by the arguments of the set when the hooks file is loaded.
+	Ref string `json:"ref,omitempty"`
 }
 
 // Get Argument method returns the value for the Argument's key name
@@ -49,6 +55,10 @@ func (ha *Argument) Get(r *Request) (string, error) {
 // Get Argument method returns the value for the Argument's key name
 // based on the Argument's source
 func (ha *Argument) get(r *Request) (string, error) {
+	if ha.Ref != "" {
+		return "", fmt.Errorf("unresolved reference to argument set %q", ha.Ref)
+	}
+
 	var source *map[string]interface{}
 	key := ha.Name
 
@@ -63,6 +73,15 @@ func (ha *Argument) get(r *Request) (string, error) {
 	case SourcePayload:
 		source = &r.Payload
 
+	case SourceIdentity:
+		source = &r.Identity
+
+	case SourceClaims:
+		source = &r.Claims
+
+	case SourceIDMatch:
+		source = &r.IDMatch
+
 	case SourceString:
 		return ha.Name, nil
 
@@ -84,7 +103,7 @@ func (ha *Argument) get(r *Request) (string, error) {
 		}
 
 	case SourceEntirePayload:
-		res, err := json.Marshal(&r.Payload)
+		res, err := json.Marshal(ha.project(r.Payload))
 		if err != nil {
 			return "", fmt.Errorf("JSON encode failed: %w", err)
 		}
@@ -92,7 +111,7 @@ func (ha *Argument) get(r *Request) (string, error) {
 		return string(res), nil
 
 	case SourceEntireHeaders:
-		res, err := json.Marshal(&r.Headers)
+		res, err := json.Marshal(ha.project(r.Headers))
 		if err != nil {
 			return "", fmt.Errorf("JSON encode failed: %w", err)
 		}
@@ -100,7 +119,7 @@ func (ha *Argument) get(r *Request) (string, error) {
 		return string(res), nil
 
 	case SourceEntireQuery:
-		res, err := json.Marshal(&r.Query)
+		res, err := json.Marshal(ha.project(r.Query))
 		if err != nil {
 			return "", err
 		}
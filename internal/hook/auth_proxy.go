@@ -0,0 +1,108 @@
+package hook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/jwt"
+)
+
+// RuleAuthProxy is the name of the auth-proxy rule in mismatched rules.
+const RuleAuthProxy = "auth-proxy"
+
+// Authenticating proxies whose identity headers can be verified.
+const (
+	AuthProxyOAuth2Proxy      = "oauth2-proxy"
+	AuthProxyCloudflareAccess = "cloudflare-access"
+	AuthProxyPomerium         = "pomerium"
+)
+
+// AuthProxy describes the signed identity assertion an authenticating proxy
+// in front of webhook adds to requests.
+type AuthProxy struct {
+	// Provider is one of the AuthProxy* constants and determines the
+	// default header.
+	Provider string `json:"provider,omitempty"`
+	// Header carrying the JWT assertion, overrides the provider default.
+	Header string `json:"header,omitempty"`
+	// JWKSURL is where the proxy publishes its signing keys.
+	JWKSURL  string `json:"jwks-url,omitempty"`
+	Issuer   string `json:"issuer,omitempty"`
+	Audience string `json:"audience,omitempty"`
+}
+
+// header returns the name of the header carrying the assertion.
+func (p *AuthProxy) header() (string, error) {
+	if p.Header != "" {
+		return p.Header, nil
+	}
+	switch p.Provider {
+	case AuthProxyOAuth2Proxy:
+		// the ID token passed with --pass-authorization-header
+		return "Authorization", nil
+	case AuthProxyCloudflareAccess:
+		return "Cf-Access-Jwt-Assertion", nil
+	case AuthProxyPomerium:
+		return "X-Pomerium-Jwt-Assertion", nil
+	}
+	return "", fmt.Errorf("unknown auth-proxy provider %q", p.Provider)
+}
+
+// validate checks the rule is complete. The audience is required, as the
+// keys of a proxy sign the assertions of all of its applications.
+func (p *AuthProxy) validate() error {
+	if p.JWKSURL == "" {
+		return errors.New("auth-proxy rule requires jwks-url")
+	}
+	if p.Audience == "" {
+		return errors.New("auth-proxy rule requires audience")
+	}
+	_, err := p.header()
+	return err
+}
+
+// Verify checks the identity assertion of the request and stores its claims
+// in the request identity. Requests without a valid assertion don't match,
+// the reason is kept as the mismatch reason of the request.
+func (p *AuthProxy) Verify(req *Request) (bool, error) {
+	if req.RawRequest == nil {
+		return false, errors.New("auth-proxy rule requires an HTTP request")
+	}
+	if err := p.validate(); err != nil {
+		return false, err
+	}
+	name, _ := p.header()
+
+	token := req.RawRequest.Header.Get(name)
+	if name == "Authorization" {
+		token, _ = strings.CutPrefix(token, "Bearer ")
+	}
+	if token == "" {
+		req.MismatchReason = "missing auth-proxy assertion in header " + name
+		return false, nil
+	}
+
+	ctx := req.RawRequest.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	claims, err := jwt.Verify(ctx, token, jwt.Remote(p.JWKSURL), jwt.Validation{
+		Issuer:   p.Issuer,
+		Audience: p.Audience,
+	})
+	if errors.Is(err, jwt.ErrInvalidToken) {
+		req.MismatchReason = fmt.Sprintf("invalid auth-proxy assertion in header %s: %s", name, err)
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if _, ok := claims["user"]; !ok {
+		claims["user"] = claims.Subject()
+	}
+	req.Identity = claims
+	return true, nil
+}
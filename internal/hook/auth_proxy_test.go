@@ -0,0 +1,105 @@
+package hook
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := crypto.SHA256.New()
+	digest.Write([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest.Sum(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestAuthProxyRule(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "test", "n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()), "e": "AQAB"},
+		}})
+	}))
+	defer srv.Close()
+
+	rules := Rules{AuthProxy: &AuthProxy{Provider: AuthProxyCloudflareAccess, JWKSURL: srv.URL, Audience: "aud-tag"}}
+	valid := signRS256(t, key, map[string]interface{}{
+		"aud":   []string{"aud-tag"},
+		"email": "jane@example.com",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	})
+	wrongAudience := signRS256(t, key, map[string]interface{}{
+		"aud":   "other",
+		"email": "jane@example.com",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	})
+
+	for _, tt := range []struct {
+		desc      string
+		assertion string
+		ok        bool
+		reason    string
+	}{
+		{"valid assertion", valid, true, ""},
+		{"missing assertion", "", false, "missing auth-proxy assertion in header Cf-Access-Jwt-Assertion"},
+		{"wrong audience", wrongAudience, false, "unexpected audience"},
+		{"garbage", "garbage", false, "invalid auth-proxy assertion in header Cf-Access-Jwt-Assertion"},
+	} {
+		raw := httptest.NewRequest(http.MethodPost, "/hooks/deploy", nil)
+		if tt.assertion != "" {
+			raw.Header.Set("Cf-Access-Jwt-Assertion", tt.assertion)
+		}
+		req := &Request{RawRequest: raw}
+		ok, err := rules.Evaluate(req)
+		if err != nil || ok != tt.ok {
+			t.Errorf("%s: expected (%t, nil), got (%t, %v)", tt.desc, tt.ok, ok, err)
+			continue
+		}
+		if !strings.Contains(req.MismatchReason, tt.reason) || (tt.reason == "") != (req.MismatchReason == "") {
+			t.Errorf("%s: expected mismatch reason %q, got %q", tt.desc, tt.reason, req.MismatchReason)
+		}
+		if !ok {
+			if ClassifyMismatch(req.MismatchedRules, nil) != MismatchSignature {
+				t.Errorf("%s: expected signature mismatch class, got %v", tt.desc, req.MismatchedRules)
+			}
+			continue
+		}
+		for name, want := range map[string]string{"user": "jane@example.com", "email": "jane@example.com"} {
+			arg := Argument{Source: SourceIdentity, Name: name}
+			if got, err := arg.Get(req); err != nil || got != want {
+				t.Errorf("%s: expected identity %s %q, got %q (%v)", tt.desc, name, want, got, err)
+			}
+		}
+	}
+
+	for expected, proxy := range map[string]*AuthProxy{
+		"unknown auth-proxy provider":       {Provider: "bouncer", JWKSURL: srv.URL, Audience: "aud-tag"},
+		"auth-proxy rule requires audience": {Provider: AuthProxyCloudflareAccess, JWKSURL: srv.URL},
+		"auth-proxy rule requires jwks-url": {Provider: AuthProxyCloudflareAccess, Audience: "aud-tag"},
+	} {
+		h := &Hook{ID: "deploy", TriggerRule: &Rules{And: &AndRule{{AuthProxy: proxy}}}}
+		if err := h.Prepare(); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected error %q when preparing the hook, got %v", expected, err)
+		}
+		if _, err := h.TriggerRule.Evaluate(&Request{RawRequest: httptest.NewRequest(http.MethodPost, "/", nil)}); err == nil {
+			t.Errorf("expected error %q when evaluating the rule", expected)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package hook
+
+// UsesBody returns whether handling requests for the hook may need the
+// request body: its rules or arguments reference the payload or the raw body,
+// or its options pass the request on to other hooks and targets. Unknown rule
+// types are assumed to use the body.
+func (h *Hook) UsesBody() bool {
+	switch {
+	case h.StreamBodyToStdin, h.PassPayloadDigest, h.PayloadTransform != nil, h.Batch != nil,
+		len(h.ForwardTo) > 0, len(h.PassUploadedFilesToCommand) > 0,
+		// chained and shadow hooks are executed with the same request
+		len(h.OnSuccess) > 0, len(h.OnFailure) > 0, h.Shadow != nil && h.Shadow.Hook != "",
+		// the path template is rendered with the whole request
+		h.ResponseFile != nil && h.ResponseFile.Path != "":
+		return true
+	}
+	if h.TriggerRule.usesBody() {
+		return true
+	}
+	if h.IdempotencyKey != nil && h.IdempotencyKey.usesBody() {
+		return true
+	}
+	for _, args := range [][]Argument{
+		h.PassArgumentsToCommand,
+		h.PassEnvironmentToCommand,
+		h.PassFileToCommand,
+		h.JSONStringParameters,
+		h.DeduplicationKey,
+	} {
+		for i := range args {
+			if args[i].usesBody() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AnalyzeBodyUsage records whether the hook uses the request body, see
+// UsesBody. It is called when hooks are loaded; hooks which were not analyzed
+// are assumed to use the body.
+func (h *Hook) AnalyzeBodyUsage() {
+	h.skipBody = !h.UsesBody()
+}
+
+// SkipsBody returns whether requests of the hook can be handled without
+// reading and parsing their body.
+func (h *Hook) SkipsBody() bool {
+	return h.skipBody
+}
+
+// usesBody returns whether the value of the argument is taken from the body.
+func (ha *Argument) usesBody() bool {
+	switch ha.Source {
+	case SourcePayload, SourceEntirePayload, SourceRawRequestBody:
+		return true
+	}
+	return ha.Ref != ""
+}
+
+// usesBody returns whether evaluating the rules needs the body.
+func (r *Rules) usesBody() bool {
+	switch {
+	case r == nil:
+		return false
+	case r.And != nil:
+		for i := range *r.And {
+			if (*r.And)[i].usesBody() {
+				return true
+			}
+		}
+		return false
+	case r.Or != nil:
+		for i := range *r.Or {
+			if (*r.Or)[i].usesBody() {
+				return true
+			}
+		}
+		return false
+	case r.Not != nil:
+		return (*Rules)(r.Not).usesBody()
+	case r.Match != nil:
+		return r.Match.usesBody()
+	case r.AuthProxy != nil:
+		return false
+	}
+	return r.Ref != ""
+}
+
+// usesBody returns whether evaluating the rule needs the body.
+func (r *MatchRule) usesBody() bool {
+	switch r.Type {
+	case IPWhitelist, MatchGitLabToken:
+		return false
+	case MatchValue, MatchRegex:
+		return r.Parameter.usesBody()
+	}
+	return true
+}
@@ -0,0 +1,108 @@
+package hook
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// canonicalFuncs returns the functions available to canonical string
+// templates, reading the values of the request req points to when called.
+func canonicalFuncs(req **Request) template.FuncMap {
+	get := func(source string) func(string) (string, error) {
+		return func(name string) (string, error) {
+			return (&Argument{Source: source, Name: name}).Get(*req)
+		}
+	}
+	return template.FuncMap{
+		"header":  get(SourceHeader),
+		"query":   get(SourceQuery),
+		"payload": get(SourcePayload),
+		"body":    func() string { return string((*req).Body) },
+	}
+}
+
+// canonicalTemplate is a parsed canonical string template. The functions of
+// a template are bound to the request when it is parsed, so concurrent
+// renderings each need their own copy, which are reused across requests.
+type canonicalTemplate struct {
+	text   string
+	copies sync.Pool
+}
+
+// boundTemplate is a copy of a canonical string template whose functions read
+// the request it is rendered for.
+type boundTemplate struct {
+	tmpl *template.Template
+	req  *Request
+}
+
+// parseCanonicalTemplate parses the canonical string template.
+func parseCanonicalTemplate(text string) (*canonicalTemplate, error) {
+	b, err := bindCanonicalTemplate(text)
+	if err != nil {
+		return nil, err
+	}
+	t := &canonicalTemplate{text: text}
+	t.copies.Put(b)
+	return t, nil
+}
+
+func bindCanonicalTemplate(text string) (*boundTemplate, error) {
+	b := &boundTemplate{}
+	tmpl, err := template.New("canonical-string").Funcs(canonicalFuncs(&b.req)).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid canonical string template: %w", err)
+	}
+	b.tmpl = tmpl
+	return b, nil
+}
+
+// render executes the template for the request.
+func (t *canonicalTemplate) render(req *Request) ([]byte, error) {
+	b, ok := t.copies.Get().(*boundTemplate)
+	if !ok {
+		var err error
+		if b, err = bindCanonicalTemplate(t.text); err != nil {
+			return nil, err
+		}
+	}
+	b.req = req
+	defer func() {
+		b.req = nil
+		t.copies.Put(b)
+	}()
+	buf := &bytes.Buffer{}
+	if err := b.tmpl.Execute(buf, req); err != nil {
+		return nil, fmt.Errorf("error executing canonical string template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// canonicalString renders the canonical string template of the rule, which
+// is signed instead of the raw body by providers signing additional values
+// like a timestamp.
+func (r MatchRule) canonicalString(req *Request) ([]byte, error) {
+	tmpl, err := r.canonicalTemplate()
+	if err != nil {
+		return nil, err
+	}
+	return tmpl.render(req)
+}
+
+// checkSignatureTimestamp verifies that the signing time of the request, in
+// seconds since the epoch, is within the clock skew of the rule.
+func (r MatchRule) checkSignatureTimestamp(req *Request) error {
+	value, err := r.SignatureTimestamp.Get(req)
+	if err != nil {
+		return err
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return &SignatureError{Signature: "invalid timestamp"}
+	}
+	return checkTimestamp(time.Unix(seconds, 0), time.Now(), r.clockSkew())
+}
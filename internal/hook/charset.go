@@ -0,0 +1,76 @@
+package hook
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+
+	"github.com/clbanning/mxj"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+func init() {
+	// decode XML payloads declaring a non UTF-8 encoding
+	mxj.XmlCharsetReader = charsetReader
+}
+
+// toUTF8 transcodes the body from the charset given in the content type to
+// UTF-8. Bodies without a charset or already in UTF-8 are returned as is.
+func toUTF8(contentType string, body []byte) ([]byte, error) {
+	label := contentTypeCharset(contentType)
+	if isUTF8Charset(label) {
+		return body, nil
+	}
+	enc, err := htmlindex.Get(label)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported charset %q", label)
+	}
+	decoded, err := enc.NewDecoder().Bytes(body)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding %s body: %w", label, err)
+	}
+	return decoded, nil
+}
+
+// charsetReader returns a reader transcoding input from the named charset to
+// UTF-8.
+func charsetReader(label string, input io.Reader) (io.Reader, error) {
+	if isUTF8Charset(label) {
+		return input, nil
+	}
+	enc, err := htmlindex.Get(label)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported charset %q", label)
+	}
+	return enc.NewDecoder().Reader(input), nil
+}
+
+func contentTypeCharset(contentType string) string {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return params["charset"]
+}
+
+func isUTF8Charset(label string) bool {
+	switch strings.ToLower(label) {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		return true
+	}
+	return false
+}
+
+// declaresXMLEncoding reports whether the XML document starts with a
+// declaration naming its encoding, which takes precedence over the charset
+// of the content type.
+func declaresXMLEncoding(body []byte) bool {
+	body = bytes.TrimLeft(body, " \t\r\n\ufeff")
+	if !bytes.HasPrefix(body, []byte("<?xml")) {
+		return false
+	}
+	end := bytes.Index(body, []byte("?>"))
+	return end > 0 && bytes.Contains(body[:end], []byte("encoding"))
+}
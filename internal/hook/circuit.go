@@ -0,0 +1,26 @@
+package hook
+
+import "time"
+
+// DefaultCircuitCooldown is the time a circuit stays open if the circuit
+// breaker doesn't set a cooldown.
+const DefaultCircuitCooldown = time.Minute
+
+// CircuitBreaker stops executing a hook after consecutive failed executions,
+// so a broken deploy target isn't hammered by every request.
+type CircuitBreaker struct {
+	// Failures is the number of consecutive failed executions opening the
+	// circuit.
+	Failures int `json:"failures"`
+	// Cooldown is the time the circuit stays open before a single trial
+	// execution is let through.
+	Cooldown Duration `json:"cooldown,omitempty"`
+}
+
+// CooldownOrDefault returns the cooldown of the circuit breaker.
+func (c *CircuitBreaker) CooldownOrDefault() time.Duration {
+	if c.Cooldown <= 0 {
+		return DefaultCircuitCooldown
+	}
+	return time.Duration(c.Cooldown)
+}
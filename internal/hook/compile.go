@@ -0,0 +1,126 @@
+package hook
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Prepare normalizes the hook and compiles its ID pattern and the patterns of
+// its trigger rules when it is loaded, so invalid patterns fail loading
+// instead of every request. The compiled patterns are kept on the hook and
+// its rules; hooks which were not prepared compile them on every use.
+func (h *Hook) Prepare() error {
+	h.HTTPMethods = NormalizeMethods(h.HTTPMethods)
+	h.AnalyzeBodyUsage()
+	if h.IsPattern() {
+		re, err := h.compileIDPattern()
+		if err != nil {
+			return err
+		}
+		h.idRegexp = re
+	}
+	return h.TriggerRule.compile()
+}
+
+// NormalizeMethods returns the HTTP methods in upper case, without blanks and
+// duplicates.
+func NormalizeMethods(methods []string) []string {
+	var normalized []string
+	for _, m := range methods {
+		m = strings.ToUpper(strings.TrimSpace(m))
+		if m != "" && !slices.Contains(normalized, m) {
+			normalized = append(normalized, m)
+		}
+	}
+	return normalized
+}
+
+// compile compiles the patterns of the rules and checks auth-proxy rules are
+// complete.
+func (r *Rules) compile() error {
+	switch {
+	case r == nil:
+		return nil
+	case r.And != nil:
+		for i := range *r.And {
+			if err := (*r.And)[i].compile(); err != nil {
+				return err
+			}
+		}
+	case r.Or != nil:
+		for i := range *r.Or {
+			if err := (*r.Or)[i].compile(); err != nil {
+				return err
+			}
+		}
+	case r.Not != nil:
+		return (*Rules)(r.Not).compile()
+	case r.Match != nil:
+		return r.Match.compile()
+	case r.AuthProxy != nil:
+		return r.AuthProxy.validate()
+	}
+	return nil
+}
+
+// compile compiles the patterns of the rule and keeps them on the rule.
+func (r *MatchRule) compile() error {
+	var err error
+	switch r.Type {
+	case MatchRegex:
+		r.regex, err = regexp.Compile(r.Regex)
+	case IPWhitelist:
+		r.ipRanges, err = parseIPRanges(r.IPRange)
+	}
+	if err == nil && r.CanonicalString != "" {
+		r.canonical, err = parseCanonicalTemplate(r.CanonicalString)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s rule: %w", r.Type, err)
+	}
+	return nil
+}
+
+// compiledRegex returns the compiled regex of the rule.
+func (r MatchRule) compiledRegex() (*regexp.Regexp, error) {
+	if r.regex != nil {
+		return r.regex, nil
+	}
+	return regexp.Compile(r.Regex)
+}
+
+// compiledIPRanges returns the parsed IP ranges of the rule.
+func (r MatchRule) compiledIPRanges() ([]*net.IPNet, error) {
+	if r.ipRanges != nil {
+		return r.ipRanges, nil
+	}
+	return parseIPRanges(r.IPRange)
+}
+
+// canonicalTemplate returns the parsed canonical string template of the rule.
+func (r MatchRule) canonicalTemplate() (*canonicalTemplate, error) {
+	if r.canonical != nil {
+		return r.canonical, nil
+	}
+	return parseCanonicalTemplate(r.CanonicalString)
+}
+
+// parseIPRanges parses the whitespace separated IP ranges in CIDR form.
+// Single IP addresses are turned into ranges of one address.
+func parseIPRanges(ipRange string) ([]*net.IPNet, error) {
+	var ranges []*net.IPNet
+	for _, r := range strings.Fields(ipRange) {
+		if !strings.Contains(r, "/") {
+			r = r + "/32"
+		}
+		_, cidr, err := net.ParseCIDR(r)
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, cidr)
+	}
+	return ranges, nil
+}
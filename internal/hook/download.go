@@ -0,0 +1,11 @@
+package hook
+
+// ResponseFile makes a hook respond with a file produced by its command.
+type ResponseFile struct {
+	// Path is a text/template rendered with the request, ie.
+	// "exports/{{ .ID }}.csv". If empty, the command prints the path as the
+	// last line of its output.
+	Path        string `json:"path,omitempty"`
+	ContentType string `json:"content-type,omitempty"`
+	FileName    string `json:"filename,omitempty"`
+}
@@ -0,0 +1,62 @@
+package hook
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Signature formats of forwarded requests.
+const (
+	// SignaturePrefixed is the algorithm=hex notation, ie. sha256=<hex>.
+	SignaturePrefixed = "prefixed"
+	// SignatureHex is the bare hex encoded HMAC.
+	SignatureHex = "hex"
+	// SignatureBase64 is the bare base64 encoded HMAC.
+	SignatureBase64 = "base64"
+	// SignatureTimestamped signs "<unix time>.<body>" and is written as
+	// t=<unix time>,v1=<hex>, so receivers can reject replayed deliveries.
+	SignatureTimestamped = "timestamped"
+)
+
+// ForwardTarget describes a URL the original request is re-delivered to once
+// the trigger rules of the hook are satisfied.
+type ForwardTarget struct {
+	URL     string   `json:"url,omitempty"`
+	Timeout Duration `json:"timeout,omitempty"`
+	// Secret re-signs the forwarded body with a new secret; the signature is
+	// written to SignatureHeader using SignatureAlgorithm and SignatureFormat.
+	Secret             string `json:"secret,omitempty"`
+	SignatureHeader    string `json:"signature-header,omitempty"`
+	SignatureAlgorithm string `json:"signature-algorithm,omitempty"`
+	SignatureFormat    string `json:"signature-format,omitempty"`
+}
+
+// Sign returns the signature of the body in the format of the target. now is
+// the signing time used by the timestamped format.
+func (t ForwardTarget) Sign(body []byte, now time.Time) (string, error) {
+	switch t.SignatureFormat {
+	case SignaturePrefixed, "":
+		return SignPayload(t.SignatureAlgorithm, t.Secret, body)
+	case SignatureHex, SignatureBase64:
+		_, mac, err := payloadMAC(t.SignatureAlgorithm, t.Secret, body)
+		if err != nil {
+			return "", err
+		}
+		if t.SignatureFormat == SignatureBase64 {
+			return base64.StdEncoding.EncodeToString(mac), nil
+		}
+		return hex.EncodeToString(mac), nil
+	case SignatureTimestamped:
+		ts := strconv.FormatInt(now.Unix(), 10)
+		_, mac, err := payloadMAC(t.SignatureAlgorithm, t.Secret, append([]byte(ts+"."), body...))
+		if err != nil {
+			return "", err
+		}
+		return "t=" + ts + ",v1=" + hex.EncodeToString(mac), nil
+	default:
+		return "", fmt.Errorf("unsupported signature format: %s", t.SignatureFormat)
+	}
+}
@@ -0,0 +1,27 @@
+package hook
+
+import "slices"
+
+// GitHubEventHeader is the request header naming the event of a GitHub
+// webhook delivery.
+const GitHubEventHeader = "X-GitHub-Event"
+
+// matchGitHubEvent matches the event of a GitHub delivery against the events
+// of the rule and, if the rule lists actions, the action of its payload.
+func (r MatchRule) matchGitHubEvent(req *Request) (bool, error) {
+	event, err := (&Argument{Source: SourceHeader, Name: GitHubEventHeader}).Get(req)
+	if err != nil {
+		return false, err
+	}
+	if len(r.Events) > 0 && !slices.Contains(r.Events, event) {
+		return false, nil
+	}
+	if len(r.Actions) == 0 {
+		return true, nil
+	}
+	action, err := (&Argument{Source: SourcePayload, Name: "action"}).Get(req)
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(r.Actions, action), nil
+}
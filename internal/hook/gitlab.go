@@ -0,0 +1,47 @@
+package hook
+
+import "slices"
+
+// Request headers of GitLab webhook deliveries.
+const (
+	GitLabTokenHeader = "X-Gitlab-Token"
+	GitLabEventHeader = "X-Gitlab-Event"
+)
+
+// matchGitLabToken compares the secret token of a GitLab delivery with the
+// secrets of the rule in constant time.
+func (r MatchRule) matchGitLabToken(req *Request) (bool, error) {
+	token, err := (&Argument{Source: SourceHeader, Name: GitLabTokenHeader}).Get(req)
+	if err != nil {
+		return false, err
+	}
+	return r.withSecrets(func(secret string) (bool, error) {
+		return secret != "" && compare(token, secret), nil
+	})
+}
+
+// matchGitLabEvent matches the event of a GitLab delivery against the events
+// of the rule and, if the rule lists actions, the action of the object the
+// event is about. Events are given either as the X-Gitlab-Event header, ie.
+// "Merge Request Hook", or as the object_kind of the payload, ie.
+// "merge_request".
+func (r MatchRule) matchGitLabEvent(req *Request) (bool, error) {
+	event, err := (&Argument{Source: SourceHeader, Name: GitLabEventHeader}).Get(req)
+	if err != nil {
+		return false, err
+	}
+	if len(r.Events) > 0 && !slices.Contains(r.Events, event) {
+		kind, err := (&Argument{Source: SourcePayload, Name: "object_kind"}).Get(req)
+		if err != nil || !slices.Contains(r.Events, kind) {
+			return false, nil
+		}
+	}
+	if len(r.Actions) == 0 {
+		return true, nil
+	}
+	action, err := (&Argument{Source: SourcePayload, Name: "object_attributes.action"}).Get(req)
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(r.Actions, action), nil
+}
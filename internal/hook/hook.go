@@ -10,11 +10,14 @@ import (
 	"net/textproto"
 	"os"
 	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/hashicorp/go-multierror"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/sandbox"
 )
 
 // Constants used to specify the parameter source
@@ -29,6 +32,9 @@ const (
 	SourceEntirePayload  string = "entire-payload"
 	SourceEntireQuery    string = "entire-query"
 	SourceEntireHeaders  string = "entire-headers"
+	SourceIdentity       string = "identity"
+	SourceClaims         string = "claims"
+	SourceIDMatch        string = "id-match"
 )
 
 const (
@@ -113,6 +119,16 @@ func ExtractSignatures(source, prefix string) []string {
 // CheckIPWhitelist makes sure the provided remote address (of the form IP:port) falls within the provided IP range
 // (in CIDR form or a single IP address).
 func CheckIPWhitelist(remoteAddr, ipRange string) (bool, error) {
+	ranges, err := parseIPRanges(ipRange)
+	if err != nil {
+		return false, err
+	}
+	return checkIPRanges(remoteAddr, ranges)
+}
+
+// checkIPRanges makes sure the provided remote address falls within one of
+// the IP ranges.
+func checkIPRanges(remoteAddr string, ranges []*net.IPNet) (bool, error) {
 	// Extract IP address from remote address.
 
 	// IPv6 addresses will likely be surrounded by [].
@@ -128,18 +144,7 @@ func CheckIPWhitelist(remoteAddr, ipRange string) (bool, error) {
 		return false, fmt.Errorf("invalid IP address found in remote address '%s'", remoteAddr)
 	}
 
-	for _, r := range strings.Fields(ipRange) {
-		// Extract IP range in CIDR form.  If a single IP address is provided, turn it into CIDR form.
-
-		if !strings.Contains(r, "/") {
-			r = r + "/32"
-		}
-
-		_, cidr, err := net.ParseCIDR(r)
-		if err != nil {
-			return false, err
-		}
-
+	for _, cidr := range ranges {
 		if cidr.Contains(parsedIP) {
 			return true, nil
 		}
@@ -299,6 +304,13 @@ func (h *ResponseHeaders) Set(value string) error {
 	return nil
 }
 
+// ResponseOverride replaces the status code and message of a response
+// generated by webhook. Zero values keep the defaults.
+type ResponseOverride struct {
+	HttpResponseCode int    `json:"http-response-code,omitempty"`
+	Message          string `json:"message,omitempty"`
+}
+
 // Duration type supports unmarshalling to time.Duration
 type Duration time.Duration
 
@@ -315,27 +327,120 @@ func (d *Duration) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Constants for the concurrency policy of a hook
+const (
+	ConcurrencyParallel  string = "parallel"
+	ConcurrencySerialize string = "serialize"
+	ConcurrencyDrop      string = "drop"
+)
+
+// Constants for the flush strategy of streamed command output
+const (
+	StreamFlushPerWrite   string = "write"
+	StreamFlushPerLine    string = "line"
+	StreamFlushBySize     string = "size"
+	StreamFlushByInterval string = "interval"
+)
+
+// ResponseFormatJSON wraps responses in a JSON envelope.
+const ResponseFormatJSON = "json"
+
+// DefaultBatchPath is the payload path of the events of a batch, which is
+// where JSON array and NDJSON payloads are exposed.
+const DefaultBatchPath = "root"
+
+// BatchConfig makes a hook execute its command once per event of a batched
+// payload.
+type BatchConfig struct {
+	// Path is the payload path of the event array, defaults to DefaultBatchPath.
+	Path string `json:"path,omitempty"`
+}
+
 // Hook type is a structure containing details for a single hook
 type Hook struct {
-	ID                                  string          `json:"id,omitempty"`
-	ExecuteCommand                      string          `json:"execute-command,omitempty"`
-	CommandWorkingDirectory             string          `json:"command-working-directory,omitempty"`
-	ResponseMessage                     string          `json:"response-message,omitempty"`
-	ResponseHeaders                     ResponseHeaders `json:"response-headers,omitempty"`
-	CaptureCommandOutput                bool            `json:"include-command-output-in-response,omitempty"`
-	StreamCommandOutput                 bool            `json:"stream-command-output,omitempty"`
-	CaptureCommandOutputOnError         bool            `json:"include-command-output-in-response-on-error,omitempty"`
-	PassEnvironmentToCommand            []Argument      `json:"pass-environment-to-command,omitempty"`
-	PassArgumentsToCommand              []Argument      `json:"pass-arguments-to-command,omitempty"`
-	PassFileToCommand                   []Argument      `json:"pass-file-to-command,omitempty"`
-	JSONStringParameters                []Argument      `json:"parse-parameters-as-json,omitempty"`
-	TriggerRule                         *Rules          `json:"trigger-rule,omitempty"`
-	TriggerRuleMismatchHttpResponseCode int             `json:"trigger-rule-mismatch-http-response-code,omitempty"`
-	TriggerSignatureSoftFailures        bool            `json:"trigger-signature-soft-failures,omitempty"`
-	IncomingPayloadContentType          string          `json:"incoming-payload-content-type,omitempty"`
-	SuccessHttpResponseCode             int             `json:"success-http-response-code,omitempty"`
-	HTTPMethods                         []string        `json:"http-methods"`
-	Timeout                             Duration        `json:"timeout,omitempty"`
+	ID                                  string                      `json:"id,omitempty"`
+	IDRegex                             string                      `json:"id-regex,omitempty"`
+	Host                                string                      `json:"host,omitempty"`
+	URLPrefix                           string                      `json:"url-prefix,omitempty"`
+	Tenant                              string                      `json:"tenant,omitempty"`
+	ExecuteCommand                      string                      `json:"execute-command,omitempty"`
+	CommandWorkingDirectory             string                      `json:"command-working-directory,omitempty"`
+	ResponseMessage                     string                      `json:"response-message,omitempty"`
+	ResponseHeaders                     ResponseHeaders             `json:"response-headers,omitempty"`
+	CaptureCommandOutput                bool                        `json:"include-command-output-in-response,omitempty"`
+	StreamCommandOutput                 bool                        `json:"stream-command-output,omitempty"`
+	StreamHeartbeatInterval             Duration                    `json:"stream-heartbeat-interval,omitempty"`
+	StreamHeartbeatMessage              string                      `json:"stream-heartbeat-message,omitempty"`
+	StreamFlush                         string                      `json:"stream-flush,omitempty"`
+	StreamFlushSize                     int                         `json:"stream-flush-size,omitempty"`
+	StreamFlushInterval                 Duration                    `json:"stream-flush-interval,omitempty"`
+	StreamOutputFile                    string                      `json:"stream-output-file,omitempty"`
+	StreamOutputRetention               *Retention                  `json:"stream-output-retention,omitempty"`
+	CaptureCommandOutputOnError         bool                        `json:"include-command-output-in-response-on-error,omitempty"`
+	PassEnvironmentToCommand            []Argument                  `json:"pass-environment-to-command,omitempty"`
+	PassArgumentsToCommand              []Argument                  `json:"pass-arguments-to-command,omitempty"`
+	PassFileToCommand                   []Argument                  `json:"pass-file-to-command,omitempty"`
+	PassUploadedFilesToCommand          []Argument                  `json:"pass-uploaded-files-to-command,omitempty"`
+	PassPayloadDigest                   bool                        `json:"pass-payload-digest,omitempty"`
+	CollectArtifacts                    []string                    `json:"collect-artifacts,omitempty"`
+	ResponseFile                        *ResponseFile               `json:"response-file,omitempty"`
+	ResponseDirectives                  bool                        `json:"response-directives,omitempty"`
+	JSONStringParameters                []Argument                  `json:"parse-parameters-as-json,omitempty"`
+	TriggerRule                         *Rules                      `json:"trigger-rule,omitempty"`
+	TriggerRuleMismatchHttpResponseCode int                         `json:"trigger-rule-mismatch-http-response-code,omitempty"`
+	TriggerRuleMismatchResponseMessage  string                      `json:"trigger-rule-mismatch-response-message,omitempty"`
+	TriggerRuleMismatchResponseDetails  bool                        `json:"trigger-rule-mismatch-response-details,omitempty"`
+	AuthFailureStatusCodes              bool                        `json:"auth-failure-status-codes,omitempty"`
+	TriggerRuleMismatchResponses        map[string]ResponseOverride `json:"trigger-rule-mismatch-responses,omitempty"`
+	TriggerSignatureSoftFailures        bool                        `json:"trigger-signature-soft-failures,omitempty"`
+	IncomingPayloadContentType          string                      `json:"incoming-payload-content-type,omitempty"`
+	SingleValueParameters               bool                        `json:"single-value-parameters,omitempty"`
+	StreamBodyToStdin                   bool                        `json:"stream-body-to-stdin,omitempty"`
+	StreamBodyMaxSize                   int64                       `json:"stream-body-max-size,omitempty"`
+	BodyReadTimeout                     Duration                    `json:"body-read-timeout,omitempty"`
+	Protobuf                            *ProtobufPayload            `json:"protobuf,omitempty"`
+	XMLPayload                          *XMLPayload                 `json:"xml-payload,omitempty"`
+	PayloadTransform                    *PayloadTransform           `json:"payload-transform,omitempty"`
+	SuccessHttpResponseCode             int                         `json:"success-http-response-code,omitempty"`
+	HTTPMethods                         []string                    `json:"http-methods,omitempty"`
+	MethodNotAllowedResponse            *ResponseOverride           `json:"method-not-allowed-response,omitempty"`
+	Timeout                             Duration                    `json:"timeout,omitempty"`
+	TerminationGracePeriod              Duration                    `json:"termination-grace-period,omitempty"`
+	KillSignal                          string                      `json:"kill-signal,omitempty"`
+	NoOutputTimeout                     Duration                    `json:"no-output-timeout,omitempty"`
+	KafkaSource                         *KafkaSource                `json:"kafka,omitempty"`
+	MQTTSource                          *MQTTSource                 `json:"mqtt,omitempty"`
+	PubSubSource                        *PubSubSource               `json:"pubsub,omitempty"`
+	ForwardTo                           []ForwardTarget             `json:"forward-to,omitempty"`
+	OnSuccess                           []string                    `json:"on-success,omitempty"`
+	OnFailure                           []string                    `json:"on-failure,omitempty"`
+	Shadow                              *Shadow                     `json:"shadow,omitempty"`
+	DeduplicationKey                    []Argument                  `json:"deduplication-key,omitempty"`
+	IdempotencyTTL                      Duration                    `json:"idempotency-ttl,omitempty"`
+	IdempotencyKey                      *Argument                   `json:"idempotency-key,omitempty"`
+	ConcurrencyPolicy                   string                      `json:"concurrency-policy,omitempty"`
+	CircuitBreaker                      *CircuitBreaker             `json:"circuit-breaker,omitempty"`
+	Debounce                            Duration                    `json:"debounce,omitempty"`
+	Priority                            int                         `json:"priority,omitempty"`
+	Batch                               *BatchConfig                `json:"batch,omitempty"`
+	ResponseFormat                      string                      `json:"response-format,omitempty"`
+	ExitCodeHeaders                     bool                        `json:"exit-code-headers,omitempty"`
+	Debug                               bool                        `json:"debug,omitempty"`
+	RequestSampling                     *RequestSampling            `json:"request-sampling,omitempty"`
+	Sandbox                             *sandbox.Config             `json:"sandbox,omitempty"`
+	Nice                                *int                        `json:"nice,omitempty"`
+	IONice                              string                      `json:"ionice,omitempty"`
+	Umask                               string                      `json:"umask,omitempty"`
+
+	// skipBody is set for hooks which were found not to use the request
+	// body when they were loaded
+	skipBody bool
+	// idRegexp is the ID pattern of the hook compiled when it was loaded
+	idRegexp *regexp.Regexp
 }
 
 // ParseJSONParameters decodes specified arguments to JSON objects and replaces the
@@ -477,3 +582,13 @@ func (h *Hook) ExtractCommandArgumentsForFile(r *Request) ([]FileParameter, erro
 
 	return args, result.ErrorOrNil()
 }
+
+// IdempotencyKeyHeader is the request header holding the idempotency key
+// unless the hook configures a different source.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// DefaultIdempotencyKey returns the argument the idempotency key of a request
+// is extracted from when the hook does not configure one.
+func DefaultIdempotencyKey() Argument {
+	return Argument{Source: SourceHeader, Name: IdempotencyKeyHeader}
+}
@@ -1,10 +1,26 @@
 package hook
 
 import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"net/http"
+	"os"
+	"path/filepath"
 	"reflect"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
 )
 
 func TestGetParameter(t *testing.T) {
@@ -133,6 +149,48 @@ func TestCheckPayloadSignature512(t *testing.T) {
 	}
 }
 
+func TestSignPayload(t *testing.T) {
+	for _, tt := range []struct {
+		algorithm string
+		secret    string
+		signature string
+		ok        bool
+	}{
+		{"sha1", "secret", "sha1=b17e04cbb22afa8ffbff8796fc1894ed27badd9e", true},
+		{"", "secret", "sha256=f417af3a21bd70379b5796d5f013915e7029f62c580fb0f500f59a35a6f04c89", true},
+		// failures
+		{"md5", "secret", "", false},
+		{"sha1", "", "", false},
+	} {
+		signature, err := SignPayload(tt.algorithm, tt.secret, []byte(`{"a": "z"}`))
+		if (err == nil) != tt.ok || signature != tt.signature {
+			t.Errorf("failed to sign payload {%q, %q}:\nexpected {%q, ok:%v},\ngot {%q, ok:%v}", tt.algorithm, tt.secret, tt.signature, tt.ok, signature, err == nil)
+		}
+	}
+}
+
+func TestForwardTargetSign(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	for _, tt := range []struct {
+		format    string
+		signature string
+		ok        bool
+	}{
+		{"", "sha256=f417af3a21bd70379b5796d5f013915e7029f62c580fb0f500f59a35a6f04c89", true},
+		{SignatureHex, "f417af3a21bd70379b5796d5f013915e7029f62c580fb0f500f59a35a6f04c89", true},
+		{SignatureBase64, "9BevOiG9cDebV5bV8BORXnAp9ixYD7D1APWaNabwTIk=", true},
+		{SignatureTimestamped, "t=1700000000,v1=ac50b2782ea230322a2e9321027d3ea0badb05347588e7f242a44ef89c25fe68", true},
+		// failures
+		{"jwt", "", false},
+	} {
+		target := ForwardTarget{Secret: "secret", SignatureFormat: tt.format}
+		signature, err := target.Sign([]byte(`{"a": "z"}`), now)
+		if (err == nil) != tt.ok || signature != tt.signature {
+			t.Errorf("failed to sign payload in format %q:\nexpected {%q, ok:%v},\ngot {%q, ok:%v}", tt.format, tt.signature, tt.ok, signature, err == nil)
+		}
+	}
+}
+
 var checkScalrSignatureTests = []struct {
 	description       string
 	headers           map[string]interface{}
@@ -191,6 +249,156 @@ func TestCheckScalrSignature(t *testing.T) {
 	}
 }
 
+func TestScalrSignatureClockSkew(t *testing.T) {
+	const key = "signing-key"
+	body := []byte(`{"a": "b"}`)
+	signed := func(age time.Duration) *Request {
+		date := time.Now().Add(-age).UTC().Format("Mon 02 Jan 2006 15:04:05 MST")
+		mac := hmac.New(sha1.New, []byte(key))
+		mac.Write(body)
+		mac.Write([]byte(date))
+		return &Request{
+			Headers: map[string]interface{}{"Date": date, "X-Signature": hex.EncodeToString(mac.Sum(nil))},
+			Body:    body,
+		}
+	}
+	for _, tt := range []struct {
+		desc string
+		age  time.Duration
+		skew Duration
+		ok   bool
+	}{
+		{"recent, default skew", time.Minute, 0, true},
+		{"outdated, default skew", 10 * time.Minute, 0, false},
+		{"outdated, wider skew", 10 * time.Minute, Duration(15 * time.Minute), true},
+		{"recent, narrower skew", time.Minute, Duration(30 * time.Second), false},
+	} {
+		rule := MatchRule{Type: ScalrSignature, Secret: key, ClockSkew: tt.skew}
+		ok, err := rule.Evaluate(signed(tt.age))
+		if ok != tt.ok {
+			t.Errorf("%s: expected ok: %v, got ok: %v, err: %v", tt.desc, tt.ok, ok, err)
+		}
+		if !ok && !IsSignatureError(err) {
+			t.Errorf("%s: expected a signature error, got %v", tt.desc, err)
+		}
+	}
+}
+
+func TestHMACSignatureOptions(t *testing.T) {
+	body := []byte(`{"a": "z"}`)
+	// HMAC-SHA256 of the body with the key "secret"
+	const hexMAC = "f417af3a21bd70379b5796d5f013915e7029f62c580fb0f500f59a35a6f04c89"
+	sum, _ := hex.DecodeString(hexMAC)
+	base64MAC := base64.StdEncoding.EncodeToString(sum)
+	none, v1 := "", "v1="
+	for _, tt := range []struct {
+		desc      string
+		prefix    *string
+		encoding  string
+		signature string
+		ok        bool
+		err       bool
+	}{
+		{"default prefix", nil, "", "sha256=" + hexMAC, true, false},
+		{"no prefix", &none, "", hexMAC, true, false},
+		{"custom prefix", &v1, "", "v1=" + hexMAC, true, false},
+		{"custom prefix, multiple signatures", &v1, "", "v0=abc,v1=" + hexMAC, true, false},
+		{"base64", &none, SignatureEncodingBase64, base64MAC, true, false},
+		{"base64 expected, hex given", &none, SignatureEncodingBase64, hexMAC, false, true},
+		{"unknown encoding", &none, "base32", hexMAC, false, true},
+	} {
+		rule := MatchRule{
+			Type:              MatchHMACSHA256,
+			Secret:            "secret",
+			Parameter:         Argument{Source: "header", Name: "a"},
+			SignaturePrefix:   tt.prefix,
+			SignatureEncoding: tt.encoding,
+		}
+		req := &Request{Headers: map[string]interface{}{"A": tt.signature}, Body: body}
+		ok, err := rule.Evaluate(req)
+		if ok != tt.ok || (err != nil) != tt.err {
+			t.Errorf("%s: expected ok: %v, err: %v, got ok: %v, err: %v", tt.desc, tt.ok, tt.err, ok, err)
+		}
+		if ok && req.ValidatedSignature != "sha256="+hexMAC {
+			t.Errorf("%s: validated signature = %q", tt.desc, req.ValidatedSignature)
+		}
+	}
+}
+
+func TestHMACCanonicalString(t *testing.T) {
+	body := []byte(`{"a": "z"}`)
+	sign := func(timestamp string) string {
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte("v0:" + timestamp + ":" + string(body)))
+		return "v0=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	prefix := "v0="
+	for _, tt := range []struct {
+		desc      string
+		timestamp string
+		signature string
+		ok        bool
+		err       bool
+		missing   bool
+	}{
+		{"valid", now, sign(now), true, false, false},
+		{"signed other timestamp", now, sign(old), false, true, false},
+		{"outdated", old, sign(old), false, true, false},
+		{"invalid timestamp", "yesterday", sign("yesterday"), false, true, false},
+		{"missing timestamp", "", sign(""), false, true, true},
+	} {
+		rule := MatchRule{
+			Type:               MatchHMACSHA256,
+			Secret:             "secret",
+			Parameter:          Argument{Source: "header", Name: "X-Slack-Signature"},
+			SignaturePrefix:    &prefix,
+			CanonicalString:    `v0:{{ header "X-Slack-Request-Timestamp" }}:{{ body }}`,
+			SignatureTimestamp: &Argument{Source: "header", Name: "X-Slack-Request-Timestamp"},
+		}
+		headers := map[string]interface{}{"X-Slack-Signature": tt.signature}
+		if tt.timestamp != "" {
+			headers["X-Slack-Request-Timestamp"] = tt.timestamp
+		}
+		ok, err := rule.Evaluate(&Request{Headers: headers, Body: body})
+		if ok != tt.ok || (err != nil) != tt.err {
+			t.Errorf("%s: expected ok: %v, err: %v, got ok: %v, err: %v", tt.desc, tt.ok, tt.err, ok, err)
+		}
+		if tt.missing != IsParameterNodeError(err) {
+			t.Errorf("%s: expected missing parameter: %v, got %v", tt.desc, tt.missing, err)
+		}
+	}
+}
+
+func TestSignatureRuleSecrets(t *testing.T) {
+	body := []byte(`{"a": "z"}`)
+	// HMAC-SHA256 of the body with the key "secret"
+	const signature = "sha256=f417af3a21bd70379b5796d5f013915e7029f62c580fb0f500f59a35a6f04c89"
+	for _, tt := range []struct {
+		desc    string
+		rule    MatchRule
+		headers map[string]interface{}
+		ok      bool
+	}{
+		{"hmac, new secret", MatchRule{Type: MatchHMACSHA256, Secret: "rotated", Secrets: []string{"secret"}}, map[string]interface{}{"A": signature}, true},
+		{"hmac, secrets only", MatchRule{Type: MatchHMACSHA256, Secrets: []string{"rotated", "secret"}}, map[string]interface{}{"A": signature}, true},
+		{"hmac, no matching secret", MatchRule{Type: MatchHMACSHA256, Secrets: []string{"rotated", "other"}}, map[string]interface{}{"A": signature}, false},
+		{"gitlab token, old secret", MatchRule{Type: MatchGitLabToken, Secrets: []string{"old", "new"}}, map[string]interface{}{"X-Gitlab-Token": "old"}, true},
+		{"gitlab token, unknown secret", MatchRule{Type: MatchGitLabToken, Secrets: []string{"old", "new"}}, map[string]interface{}{"X-Gitlab-Token": "other"}, false},
+	} {
+		tt.rule.Parameter = Argument{Source: "header", Name: "a"}
+		req := &Request{Headers: tt.headers, Body: body}
+		ok, err := tt.rule.Evaluate(req)
+		if ok != tt.ok {
+			t.Errorf("%s: expected ok: %v, got ok: %v, err: %v", tt.desc, tt.ok, ok, err)
+		}
+		if tt.rule.Type == MatchHMACSHA256 && !ok && !IsSignatureError(err) {
+			t.Errorf("%s: expected a signature error, got %v", tt.desc, err)
+		}
+	}
+}
+
 var checkIPWhitelistTests = []struct {
 	addr    string
 	ipRange string
@@ -273,7 +481,7 @@ var argumentGetTests = []struct {
 
 func TestArgumentGet(t *testing.T) {
 	for _, tt := range argumentGetTests {
-		a := Argument{tt.source, tt.name, "", false}
+		a := Argument{Source: tt.source, Name: tt.name}
 		r := &Request{
 			Headers:    tt.headers,
 			Query:      tt.query,
@@ -294,42 +502,42 @@ var hookParseJSONParametersTests = []struct {
 	ok                         bool
 }{
 	{
-		params:   []Argument{{"header", "a", "", false}},
+		params:   []Argument{{Source: "header", Name: "a"}},
 		headers:  map[string]interface{}{"A": `{"b": "y"}`},
 		rheaders: map[string]interface{}{"A": map[string]interface{}{"b": "y"}},
 		ok:       true,
 	},
 	{
-		params: []Argument{{"url", "a", "", false}},
+		params: []Argument{{Source: "url", Name: "a"}},
 		query:  map[string]interface{}{"a": `{"b": "y"}`},
 		rquery: map[string]interface{}{"a": map[string]interface{}{"b": "y"}},
 		ok:     true,
 	},
 	{
-		params:   []Argument{{"payload", "a", "", false}},
+		params:   []Argument{{Source: "payload", Name: "a"}},
 		payload:  map[string]interface{}{"a": `{"b": "y"}`},
 		rpayload: map[string]interface{}{"a": map[string]interface{}{"b": "y"}},
 		ok:       true,
 	},
 	{
-		params:   []Argument{{"header", "z", "", false}},
+		params:   []Argument{{Source: "header", Name: "z"}},
 		headers:  map[string]interface{}{"Z": `{}`},
 		rheaders: map[string]interface{}{"Z": map[string]interface{}{}},
 		ok:       true,
 	},
 	// failures
 	{
-		params:   []Argument{{"header", "z", "", false}},
+		params:   []Argument{{Source: "header", Name: "z"}},
 		headers:  map[string]interface{}{"Z": ``},
 		rheaders: map[string]interface{}{"Z": ``},
 	}, // empty string
 	{
-		params:   []Argument{{"header", "y", "", false}},
+		params:   []Argument{{Source: "header", Name: "y"}},
 		headers:  map[string]interface{}{"X": `{}`},
 		rheaders: map[string]interface{}{"X": `{}`},
 	}, // missing parameter
 	{
-		params:   []Argument{{"string", "z", "", false}},
+		params:   []Argument{{Source: "string", Name: "z"}},
 		headers:  map[string]interface{}{"Z": ``},
 		rheaders: map[string]interface{}{"Z": ``},
 	}, // invalid argument source
@@ -359,7 +567,7 @@ var hookExtractCommandArgumentsTests = []struct {
 }{
 	{
 		exec:    "test",
-		args:    []Argument{{"header", "a", "", false}},
+		args:    []Argument{{Source: "header", Name: "a"}},
 		headers: map[string]interface{}{"A": "z"},
 		value:   []string{"test", "z"},
 		ok:      true,
@@ -367,7 +575,7 @@ var hookExtractCommandArgumentsTests = []struct {
 	// failures
 	{
 		exec:    "fail",
-		args:    []Argument{{"payload", "a", "", false}},
+		args:    []Argument{{Source: "payload", Name: "a"}},
 		headers: map[string]interface{}{"A": "z"},
 		value:   []string{"fail", ""},
 	},
@@ -418,14 +626,14 @@ var hookExtractCommandArgumentsForEnvTests = []struct {
 	// successes
 	{
 		exec:    "test",
-		args:    []Argument{{"header", "a", "", false}},
+		args:    []Argument{{Source: "header", Name: "a"}},
 		headers: map[string]interface{}{"A": "z"},
 		value:   []string{"HOOK_a=z"},
 		ok:      true,
 	},
 	{
 		exec:    "test",
-		args:    []Argument{{"header", "a", "MYKEY", false}},
+		args:    []Argument{{Source: "header", Name: "a", EnvName: "MYKEY"}},
 		headers: map[string]interface{}{"A": "z"},
 		value:   []string{"MYKEY=z"},
 		ok:      true,
@@ -433,7 +641,7 @@ var hookExtractCommandArgumentsForEnvTests = []struct {
 	// failures
 	{
 		exec:    "fail",
-		args:    []Argument{{"payload", "a", "", false}},
+		args:    []Argument{{Source: "payload", Name: "a"}},
 		headers: map[string]interface{}{"A": "z"},
 		value:   []string{},
 	},
@@ -463,24 +671,24 @@ var matchRuleTests = []struct {
 	ok                                 bool
 	err                                bool
 }{
-	{"value", "", "", "z", "", Argument{"header", "a", "", false}, map[string]interface{}{"A": "z"}, nil, nil, []byte{}, "", true, false},
-	{"regex", "^z", "", "z", "", Argument{"header", "a", "", false}, map[string]interface{}{"A": "z"}, nil, nil, []byte{}, "", true, false},
-	{"payload-hmac-sha1", "", "secret", "", "", Argument{"header", "a", "", false}, map[string]interface{}{"A": "b17e04cbb22afa8ffbff8796fc1894ed27badd9e"}, nil, nil, []byte(`{"a": "z"}`), "", true, false},
-	{"payload-hash-sha1", "", "secret", "", "", Argument{"header", "a", "", false}, map[string]interface{}{"A": "b17e04cbb22afa8ffbff8796fc1894ed27badd9e"}, nil, nil, []byte(`{"a": "z"}`), "", true, false},
-	{"payload-hmac-sha256", "", "secret", "", "", Argument{"header", "a", "", false}, map[string]interface{}{"A": "f417af3a21bd70379b5796d5f013915e7029f62c580fb0f500f59a35a6f04c89"}, nil, nil, []byte(`{"a": "z"}`), "", true, false},
-	{"payload-hash-sha256", "", "secret", "", "", Argument{"header", "a", "", false}, map[string]interface{}{"A": "f417af3a21bd70379b5796d5f013915e7029f62c580fb0f500f59a35a6f04c89"}, nil, nil, []byte(`{"a": "z"}`), "", true, false},
+	{"value", "", "", "z", "", Argument{Source: "header", Name: "a"}, map[string]interface{}{"A": "z"}, nil, nil, []byte{}, "", true, false},
+	{"regex", "^z", "", "z", "", Argument{Source: "header", Name: "a"}, map[string]interface{}{"A": "z"}, nil, nil, []byte{}, "", true, false},
+	{"payload-hmac-sha1", "", "secret", "", "", Argument{Source: "header", Name: "a"}, map[string]interface{}{"A": "b17e04cbb22afa8ffbff8796fc1894ed27badd9e"}, nil, nil, []byte(`{"a": "z"}`), "", true, false},
+	{"payload-hash-sha1", "", "secret", "", "", Argument{Source: "header", Name: "a"}, map[string]interface{}{"A": "b17e04cbb22afa8ffbff8796fc1894ed27badd9e"}, nil, nil, []byte(`{"a": "z"}`), "", true, false},
+	{"payload-hmac-sha256", "", "secret", "", "", Argument{Source: "header", Name: "a"}, map[string]interface{}{"A": "f417af3a21bd70379b5796d5f013915e7029f62c580fb0f500f59a35a6f04c89"}, nil, nil, []byte(`{"a": "z"}`), "", true, false},
+	{"payload-hash-sha256", "", "secret", "", "", Argument{Source: "header", Name: "a"}, map[string]interface{}{"A": "f417af3a21bd70379b5796d5f013915e7029f62c580fb0f500f59a35a6f04c89"}, nil, nil, []byte(`{"a": "z"}`), "", true, false},
 	// failures
-	{"value", "", "", "X", "", Argument{"header", "a", "", false}, map[string]interface{}{"A": "z"}, nil, nil, []byte{}, "", false, false},
-	{"regex", "^X", "", "", "", Argument{"header", "a", "", false}, map[string]interface{}{"A": "z"}, nil, nil, []byte{}, "", false, false},
-	{"value", "", "2", "X", "", Argument{"header", "a", "", false}, map[string]interface{}{"Y": "z"}, nil, nil, []byte{}, "", false, true}, // reference invalid header
+	{"value", "", "", "X", "", Argument{Source: "header", Name: "a"}, map[string]interface{}{"A": "z"}, nil, nil, []byte{}, "", false, false},
+	{"regex", "^X", "", "", "", Argument{Source: "header", Name: "a"}, map[string]interface{}{"A": "z"}, nil, nil, []byte{}, "", false, false},
+	{"value", "", "2", "X", "", Argument{Source: "header", Name: "a"}, map[string]interface{}{"Y": "z"}, nil, nil, []byte{}, "", false, true}, // reference invalid header
 	// errors
-	{"regex", "*", "", "", "", Argument{"header", "a", "", false}, map[string]interface{}{"A": "z"}, nil, nil, []byte{}, "", false, true},                   // invalid regex
-	{"payload-hmac-sha1", "", "secret", "", "", Argument{"header", "a", "", false}, map[string]interface{}{"A": ""}, nil, nil, []byte{}, "", false, true},   // invalid hmac
-	{"payload-hash-sha1", "", "secret", "", "", Argument{"header", "a", "", false}, map[string]interface{}{"A": ""}, nil, nil, []byte{}, "", false, true},   // invalid hmac
-	{"payload-hmac-sha256", "", "secret", "", "", Argument{"header", "a", "", false}, map[string]interface{}{"A": ""}, nil, nil, []byte{}, "", false, true}, // invalid hmac
-	{"payload-hash-sha256", "", "secret", "", "", Argument{"header", "a", "", false}, map[string]interface{}{"A": ""}, nil, nil, []byte{}, "", false, true}, // invalid hmac
-	{"payload-hmac-sha512", "", "secret", "", "", Argument{"header", "a", "", false}, map[string]interface{}{"A": ""}, nil, nil, []byte{}, "", false, true}, // invalid hmac
-	{"payload-hash-sha512", "", "secret", "", "", Argument{"header", "a", "", false}, map[string]interface{}{"A": ""}, nil, nil, []byte{}, "", false, true}, // invalid hmac
+	{"regex", "*", "", "", "", Argument{Source: "header", Name: "a"}, map[string]interface{}{"A": "z"}, nil, nil, []byte{}, "", false, true},                   // invalid regex
+	{"payload-hmac-sha1", "", "secret", "", "", Argument{Source: "header", Name: "a"}, map[string]interface{}{"A": ""}, nil, nil, []byte{}, "", false, true},   // invalid hmac
+	{"payload-hash-sha1", "", "secret", "", "", Argument{Source: "header", Name: "a"}, map[string]interface{}{"A": ""}, nil, nil, []byte{}, "", false, true},   // invalid hmac
+	{"payload-hmac-sha256", "", "secret", "", "", Argument{Source: "header", Name: "a"}, map[string]interface{}{"A": ""}, nil, nil, []byte{}, "", false, true}, // invalid hmac
+	{"payload-hash-sha256", "", "secret", "", "", Argument{Source: "header", Name: "a"}, map[string]interface{}{"A": ""}, nil, nil, []byte{}, "", false, true}, // invalid hmac
+	{"payload-hmac-sha512", "", "secret", "", "", Argument{Source: "header", Name: "a"}, map[string]interface{}{"A": ""}, nil, nil, []byte{}, "", false, true}, // invalid hmac
+	{"payload-hash-sha512", "", "secret", "", "", Argument{Source: "header", Name: "a"}, map[string]interface{}{"A": ""}, nil, nil, []byte{}, "", false, true}, // invalid hmac
 	// IP whitelisting, valid cases
 	{"ip-whitelist", "", "", "", "192.168.0.1/24", Argument{}, nil, nil, nil, []byte{}, "192.168.0.2:9000", true, false}, // valid IPv4, with range
 	{"ip-whitelist", "", "", "", "192.168.0.1/24", Argument{}, nil, nil, nil, []byte{}, "192.168.0.2:9000", true, false}, // valid IPv4, with range
@@ -498,7 +706,7 @@ var matchRuleTests = []struct {
 
 func TestMatchRule(t *testing.T) {
 	for i, tt := range matchRuleTests {
-		r := MatchRule{tt.typ, tt.regex, tt.secret, tt.value, tt.param, tt.ipRange}
+		r := MatchRule{Type: tt.typ, Regex: tt.regex, Secret: tt.secret, Value: tt.value, Parameter: tt.param, IPRange: tt.ipRange}
 		req := &Request{
 			Headers: tt.headers,
 			Query:   tt.query,
@@ -515,6 +723,72 @@ func TestMatchRule(t *testing.T) {
 	}
 }
 
+func TestGitHubEventRule(t *testing.T) {
+	rule := MatchRule{Type: MatchGitHubEvent, Events: []string{"push", "pull_request"}}
+	withActions := MatchRule{Type: MatchGitHubEvent, Events: []string{"pull_request"}, Actions: []string{"opened", "synchronize"}}
+	for _, tt := range []struct {
+		desc    string
+		rule    MatchRule
+		event   string
+		payload map[string]interface{}
+		ok      bool
+		err     bool
+	}{
+		{"listed event", rule, "push", nil, true, false},
+		{"unlisted event", rule, "issues", nil, false, false},
+		{"missing event", rule, "", nil, false, true},
+		{"listed action", withActions, "pull_request", map[string]interface{}{"action": "opened"}, true, false},
+		{"unlisted action", withActions, "pull_request", map[string]interface{}{"action": "closed"}, false, false},
+		{"missing action", withActions, "pull_request", map[string]interface{}{}, false, true},
+		{"any event", MatchRule{Type: MatchGitHubEvent, Actions: []string{"opened"}}, "issues", map[string]interface{}{"action": "opened"}, true, false},
+	} {
+		headers := map[string]interface{}{}
+		if tt.event != "" {
+			headers["X-Github-Event"] = tt.event
+		}
+		ok, err := tt.rule.Evaluate(&Request{Headers: headers, Payload: tt.payload})
+		if ok != tt.ok || (err != nil) != tt.err {
+			t.Errorf("%s: expected ok: %v, err: %v, got ok: %v, err: %v", tt.desc, tt.ok, tt.err, ok, err)
+		}
+	}
+}
+
+func TestGitLabRules(t *testing.T) {
+	token := MatchRule{Type: MatchGitLabToken, Secret: "s3cret"}
+	events := MatchRule{Type: MatchGitLabEvent, Events: []string{"Push Hook", "merge_request"}}
+	withActions := MatchRule{Type: MatchGitLabEvent, Events: []string{"merge_request"}, Actions: []string{"open", "update"}}
+	mergeRequest := func(action string) map[string]interface{} {
+		return map[string]interface{}{
+			"object_kind":       "merge_request",
+			"object_attributes": map[string]interface{}{"action": action},
+		}
+	}
+	for _, tt := range []struct {
+		desc    string
+		rule    MatchRule
+		headers map[string]interface{}
+		payload map[string]interface{}
+		ok      bool
+		err     bool
+	}{
+		{"valid token", token, map[string]interface{}{"X-Gitlab-Token": "s3cret"}, nil, true, false},
+		{"invalid token", token, map[string]interface{}{"X-Gitlab-Token": "guess"}, nil, false, false},
+		{"missing token", token, nil, nil, false, true},
+		{"empty secret", MatchRule{Type: MatchGitLabToken}, map[string]interface{}{"X-Gitlab-Token": ""}, nil, false, false},
+		{"event header", events, map[string]interface{}{"X-Gitlab-Event": "Push Hook"}, nil, true, false},
+		{"object kind", events, map[string]interface{}{"X-Gitlab-Event": "Merge Request Hook"}, mergeRequest("open"), true, false},
+		{"unlisted event", events, map[string]interface{}{"X-Gitlab-Event": "Tag Push Hook"}, map[string]interface{}{"object_kind": "tag_push"}, false, false},
+		{"missing event", events, nil, nil, false, true},
+		{"listed action", withActions, map[string]interface{}{"X-Gitlab-Event": "Merge Request Hook"}, mergeRequest("update"), true, false},
+		{"unlisted action", withActions, map[string]interface{}{"X-Gitlab-Event": "Merge Request Hook"}, mergeRequest("merge"), false, false},
+	} {
+		ok, err := tt.rule.Evaluate(&Request{Headers: tt.headers, Payload: tt.payload})
+		if ok != tt.ok || (err != nil) != tt.err {
+			t.Errorf("%s: expected ok: %v, err: %v, got ok: %v, err: %v", tt.desc, tt.ok, tt.err, ok, err)
+		}
+	}
+}
+
 var andRuleTests = []struct {
 	desc                    string // description of the test case
 	rule                    AndRule
@@ -526,8 +800,8 @@ var andRuleTests = []struct {
 	{
 		"(a=z, b=y): a=z && b=y",
 		AndRule{
-			{Match: &MatchRule{"value", "", "", "z", Argument{"header", "a", "", false}, ""}},
-			{Match: &MatchRule{"value", "", "", "y", Argument{"header", "b", "", false}, ""}},
+			{Match: &MatchRule{Type: "value", Value: "z", Parameter: Argument{Source: "header", Name: "a"}}},
+			{Match: &MatchRule{Type: "value", Value: "y", Parameter: Argument{Source: "header", Name: "b"}}},
 		},
 		map[string]interface{}{"A": "z", "B": "y"}, nil, nil,
 		[]byte{},
@@ -536,8 +810,8 @@ var andRuleTests = []struct {
 	{
 		"(a=z, b=Y): a=z && b=y",
 		AndRule{
-			{Match: &MatchRule{"value", "", "", "z", Argument{"header", "a", "", false}, ""}},
-			{Match: &MatchRule{"value", "", "", "y", Argument{"header", "b", "", false}, ""}},
+			{Match: &MatchRule{Type: "value", Value: "z", Parameter: Argument{Source: "header", Name: "a"}}},
+			{Match: &MatchRule{Type: "value", Value: "y", Parameter: Argument{Source: "header", Name: "b"}}},
 		},
 		map[string]interface{}{"A": "z", "B": "Y"}, nil, nil,
 		[]byte{},
@@ -547,22 +821,22 @@ var andRuleTests = []struct {
 	{
 		"(a=z, b=y, c=x, d=w=, e=X, f=X): a=z && (b=y && c=x) && (d=w || e=v) && !f=u",
 		AndRule{
-			{Match: &MatchRule{"value", "", "", "z", Argument{"header", "a", "", false}, ""}},
+			{Match: &MatchRule{Type: "value", Value: "z", Parameter: Argument{Source: "header", Name: "a"}}},
 			{
 				And: &AndRule{
-					{Match: &MatchRule{"value", "", "", "y", Argument{"header", "b", "", false}, ""}},
-					{Match: &MatchRule{"value", "", "", "x", Argument{"header", "c", "", false}, ""}},
+					{Match: &MatchRule{Type: "value", Value: "y", Parameter: Argument{Source: "header", Name: "b"}}},
+					{Match: &MatchRule{Type: "value", Value: "x", Parameter: Argument{Source: "header", Name: "c"}}},
 				},
 			},
 			{
 				Or: &OrRule{
-					{Match: &MatchRule{"value", "", "", "w", Argument{"header", "d", "", false}, ""}},
-					{Match: &MatchRule{"value", "", "", "v", Argument{"header", "e", "", false}, ""}},
+					{Match: &MatchRule{Type: "value", Value: "w", Parameter: Argument{Source: "header", Name: "d"}}},
+					{Match: &MatchRule{Type: "value", Value: "v", Parameter: Argument{Source: "header", Name: "e"}}},
 				},
 			},
 			{
 				Not: &NotRule{
-					Match: &MatchRule{"value", "", "", "u", Argument{"header", "f", "", false}, ""},
+					Match: &MatchRule{Type: "value", Value: "u", Parameter: Argument{Source: "header", Name: "f"}},
 				},
 			},
 		},
@@ -574,7 +848,7 @@ var andRuleTests = []struct {
 	// failures
 	{
 		"invalid rule",
-		AndRule{{Match: &MatchRule{"value", "", "", "X", Argument{"header", "a", "", false}, ""}}},
+		AndRule{{Match: &MatchRule{Type: "value", Value: "X", Parameter: Argument{Source: "header", Name: "a"}}}},
 		map[string]interface{}{"Y": "z"}, nil, nil, nil,
 		false, true,
 	},
@@ -606,8 +880,8 @@ var orRuleTests = []struct {
 	{
 		"(a=z, b=X): a=z || b=y",
 		OrRule{
-			{Match: &MatchRule{"value", "", "", "z", Argument{"header", "a", "", false}, ""}},
-			{Match: &MatchRule{"value", "", "", "y", Argument{"header", "b", "", false}, ""}},
+			{Match: &MatchRule{Type: "value", Value: "z", Parameter: Argument{Source: "header", Name: "a"}}},
+			{Match: &MatchRule{Type: "value", Value: "y", Parameter: Argument{Source: "header", Name: "b"}}},
 		},
 		map[string]interface{}{"A": "z", "B": "X"}, nil, nil,
 		[]byte{},
@@ -616,8 +890,8 @@ var orRuleTests = []struct {
 	{
 		"(a=X, b=y): a=z || b=y",
 		OrRule{
-			{Match: &MatchRule{"value", "", "", "z", Argument{"header", "a", "", false}, ""}},
-			{Match: &MatchRule{"value", "", "", "y", Argument{"header", "b", "", false}, ""}},
+			{Match: &MatchRule{Type: "value", Value: "z", Parameter: Argument{Source: "header", Name: "a"}}},
+			{Match: &MatchRule{Type: "value", Value: "y", Parameter: Argument{Source: "header", Name: "b"}}},
 		},
 		map[string]interface{}{"A": "X", "B": "y"}, nil, nil,
 		[]byte{},
@@ -626,8 +900,8 @@ var orRuleTests = []struct {
 	{
 		"(a=Z, b=Y): a=z || b=y",
 		OrRule{
-			{Match: &MatchRule{"value", "", "", "z", Argument{"header", "a", "", false}, ""}},
-			{Match: &MatchRule{"value", "", "", "y", Argument{"header", "b", "", false}, ""}},
+			{Match: &MatchRule{Type: "value", Value: "z", Parameter: Argument{Source: "header", Name: "a"}}},
+			{Match: &MatchRule{Type: "value", Value: "y", Parameter: Argument{Source: "header", Name: "b"}}},
 		},
 		map[string]interface{}{"A": "Z", "B": "Y"}, nil, nil,
 		[]byte{},
@@ -637,7 +911,7 @@ var orRuleTests = []struct {
 	{
 		"missing parameter node",
 		OrRule{
-			{Match: &MatchRule{"value", "", "", "z", Argument{"header", "a", "", false}, ""}},
+			{Match: &MatchRule{Type: "value", Value: "z", Parameter: Argument{Source: "header", Name: "a"}}},
 		},
 		map[string]interface{}{"Y": "Z"}, nil, nil,
 		[]byte{},
@@ -670,8 +944,8 @@ var notRuleTests = []struct {
 	ok                      bool
 	err                     bool
 }{
-	{"(a=z): !a=X", NotRule{Match: &MatchRule{"value", "", "", "X", Argument{"header", "a", "", false}, ""}}, map[string]interface{}{"A": "z"}, nil, nil, []byte{}, true, false},
-	{"(a=z): !a=z", NotRule{Match: &MatchRule{"value", "", "", "z", Argument{"header", "a", "", false}, ""}}, map[string]interface{}{"A": "z"}, nil, nil, []byte{}, false, false},
+	{"(a=z): !a=X", NotRule{Match: &MatchRule{Type: "value", Value: "X", Parameter: Argument{Source: "header", Name: "a"}}}, map[string]interface{}{"A": "z"}, nil, nil, []byte{}, true, false},
+	{"(a=z): !a=z", NotRule{Match: &MatchRule{Type: "value", Value: "z", Parameter: Argument{Source: "header", Name: "a"}}}, map[string]interface{}{"A": "z"}, nil, nil, []byte{}, false, false},
 }
 
 func TestNotRule(t *testing.T) {
@@ -689,6 +963,47 @@ func TestNotRule(t *testing.T) {
 	}
 }
 
+func TestMismatchedRules(t *testing.T) {
+	header := func(name, value string) Rules {
+		return Rules{Match: &MatchRule{Type: MatchValue, Value: value, Parameter: Argument{Source: "header", Name: name}}}
+	}
+	regex := Rules{Match: &MatchRule{Type: MatchRegex, Regex: "^z$", Parameter: Argument{Source: "header", Name: "b"}}}
+	for _, tt := range []struct {
+		desc       string
+		rule       Rules
+		mismatched []string
+	}{
+		{"satisfied", Rules{And: &AndRule{header("a", "z"), {Or: &OrRule{header("a", "X"), header("a", "z")}}}}, nil},
+		{"and", Rules{And: &AndRule{header("a", "z"), regex}}, []string{MatchRegex}},
+		{"or", Rules{Or: &OrRule{header("a", "X"), regex}}, []string{MatchValue, MatchRegex}},
+		{"not", Rules{Not: (*NotRule)(&Rules{Match: header("a", "z").Match})}, []string{"not"}},
+	} {
+		r := &Request{Headers: map[string]interface{}{"A": "z", "B": "y"}}
+		_, _ = tt.rule.Evaluate(r)
+		if !slices.Equal(r.MismatchedRules, tt.mismatched) {
+			t.Errorf("%s: expected mismatched rules %v, got %v", tt.desc, tt.mismatched, r.MismatchedRules)
+		}
+	}
+}
+
+func TestClassifyMismatch(t *testing.T) {
+	for _, tt := range []struct {
+		mismatched []string
+		err        error
+		class      string
+	}{
+		{[]string{MatchValue}, nil, MismatchRules},
+		{[]string{MatchValue}, &ParameterNodeError{"a"}, MismatchMissingParameter},
+		{[]string{IPWhitelist, MatchValue}, &ParameterNodeError{"a"}, MismatchIPWhitelist},
+		{[]string{MatchHMACSHA256}, nil, MismatchSignature},
+		{[]string{IPWhitelist}, &SignatureError{Signature: "x"}, MismatchSignature},
+	} {
+		if class := ClassifyMismatch(tt.mismatched, tt.err); class != tt.class {
+			t.Errorf("expected class %q for %v (%v), got %q", tt.class, tt.mismatched, tt.err, class)
+		}
+	}
+}
+
 func TestCompare(t *testing.T) {
 	for _, tt := range []struct {
 		a, b string
@@ -702,3 +1017,330 @@ func TestCompare(t *testing.T) {
 		}
 	}
 }
+
+func TestParseProtobufPayload(t *testing.T) {
+	file := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("event.proto"),
+		Package: proto.String("ci"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Event"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{Name: proto.String("ref_name"), Number: proto.Int32(1), Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()},
+				{Name: proto.String("build"), Number: proto.Int32(2), Type: descriptorpb.FieldDescriptorProto_TYPE_INT32.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()},
+			},
+		}},
+	}
+	set, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{file}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "event.pb")
+	if err := os.WriteFile(path, set, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &ProtobufPayload{DescriptorSet: path, Message: "ci.Event"}
+	desc, err := p.descriptor()
+	if err != nil {
+		t.Fatalf("unexpected error loading descriptor: %s", err)
+	}
+	msg := dynamicpb.NewMessage(desc)
+	msg.Set(desc.Fields().ByName("ref_name"), protoreflect.ValueOfString("main"))
+	msg.Set(desc.Fields().ByName("build"), protoreflect.ValueOfInt32(42))
+	body, err := proto.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &Request{Body: body}
+	if err := r.ParseProtobufPayload(p); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got, err := GetParameter("ref_name", r.Payload); err != nil || got != "main" {
+		t.Errorf("expected ref_name to be main, got %v", got)
+	}
+	if got, err := GetParameter("build", r.Payload); err != nil || got != json.Number("42") {
+		t.Errorf("expected build to be 42, got %v", got)
+	}
+
+	if err := r.ParseProtobufPayload(&ProtobufPayload{DescriptorSet: path, Message: "ci.Missing"}); err == nil {
+		t.Error("expected error for unknown message")
+	}
+}
+
+func TestParseFormPayload(t *testing.T) {
+	r := &Request{Body: []byte("a[b][c]=1&a[b][d]=2&tags[]=x&tags[]=y&plain=p&broken[x=z&a[e]=3")}
+	if err := r.ParseFormPayload(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := map[string]interface{}{
+		"a": map[string]interface{}{
+			"b": map[string]interface{}{"c": "1", "d": "2"},
+			"e": "3",
+		},
+		"tags":     []interface{}{"x", "y"},
+		"plain":    "p",
+		"broken[x": "z",
+	}
+	if !reflect.DeepEqual(r.Payload, expected) {
+		t.Errorf("expected payload %#v, got %#v", expected, r.Payload)
+	}
+	if got, err := GetParameter("a.b.d", r.Payload); err != nil || got != "2" {
+		t.Errorf("expected a.b.d to be 2, got %v", got)
+	}
+}
+
+func TestParseQueryRepeatedValues(t *testing.T) {
+	query := map[string][]string{"tag": {"a", "b"}, "ref": {"main"}}
+
+	r := &Request{}
+	r.ParseQuery(query)
+	expected := map[string]interface{}{"tag": []interface{}{"a", "b"}, "ref": "main"}
+	if !reflect.DeepEqual(r.Query, expected) {
+		t.Errorf("expected query %#v, got %#v", expected, r.Query)
+	}
+	a := Argument{Source: SourceEntireQuery}
+	if got, _ := a.Get(r); got != `{"ref":"main","tag":["a","b"]}` {
+		t.Errorf("expected entire query to contain all values, got %s", got)
+	}
+
+	r = &Request{SingleValueParameters: true}
+	r.ParseQuery(query)
+	expected = map[string]interface{}{"tag": "a", "ref": "main"}
+	if !reflect.DeepEqual(r.Query, expected) {
+		t.Errorf("expected query %#v, got %#v", expected, r.Query)
+	}
+}
+
+func TestParsePayloadCharset(t *testing.T) {
+	for _, tt := range []struct {
+		desc        string
+		contentType string
+		body        []byte
+		parse       func(r *Request) error
+		path        string
+		expected    string
+	}{
+		{"JSON ISO-8859-1", "application/json; charset=ISO-8859-1", []byte("{\"name\": \"M\xfcller\"}"), (*Request).ParseJSONPayload, "name", "Müller"},
+		{"form ISO-8859-1", "application/x-www-form-urlencoded; charset=iso-8859-1", []byte("name=M\xfcller"), (*Request).ParseFormPayload, "name", "Müller"},
+		{"JSON Shift_JIS", "application/json; charset=Shift_JIS", []byte("{\"name\": \"\x83e\x83X\x83g\"}"), (*Request).ParseJSONPayload, "name", "テスト"},
+		{"XML content type charset", "application/xml; charset=ISO-8859-1", []byte("<app><name>M\xfcller</name></app>"), (*Request).ParseXMLPayload, "app.name", "Müller"},
+		{"XML declaration", "application/xml", []byte("<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><app><name>M\xfcller</name></app>"), (*Request).ParseXMLPayload, "app.name", "Müller"},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			r := &Request{ContentType: tt.contentType, Body: tt.body}
+			if err := tt.parse(r); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			got, err := ExtractParameterAsString(tt.path, r.Payload)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+
+	r := &Request{ContentType: "application/json; charset=unknown", Body: []byte(`{}`)}
+	if err := r.ParseJSONPayload(); err == nil {
+		t.Error("expected error for unknown charset")
+	}
+}
+
+func TestParseXMLPayloadWithOptions(t *testing.T) {
+	body := []byte(`<?xml version="1.0"?>
+<ns:app xmlns:ns="urn:app" id="1">
+  <ns:user name="Jeff">admin</ns:user>
+  <ns:message>Hello</ns:message>
+</ns:app>`)
+
+	for _, tt := range []struct {
+		desc     string
+		options  XMLPayload
+		expected map[string]interface{}
+	}{
+		{
+			"defaults",
+			XMLPayload{},
+			map[string]interface{}{"ns:app": map[string]interface{}{
+				"-xmlns:ns":  "urn:app",
+				"-id":        "1",
+				"ns:user":    map[string]interface{}{"-name": "Jeff", "#text": "admin"},
+				"ns:message": "Hello",
+			}},
+		},
+		{
+			"custom keys, stripped namespaces and forced arrays",
+			XMLPayload{AttributePrefix: "@", TextKey: "value", StripNamespaces: true, ForceArray: []string{"user"}},
+			map[string]interface{}{"app": map[string]interface{}{
+				"@id":     "1",
+				"user":    []interface{}{map[string]interface{}{"@name": "Jeff", "value": "admin"}},
+				"message": "Hello",
+			}},
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			r := &Request{ContentType: "application/xml", Body: body}
+			if err := r.ParseXMLPayloadWithOptions(&tt.options); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(r.Payload, tt.expected) {
+				t.Errorf("expected payload %#v, got %#v", tt.expected, r.Payload)
+			}
+		})
+	}
+}
+
+func TestArgumentProjection(t *testing.T) {
+	r := &Request{
+		Payload: map[string]interface{}{
+			"ref":     "main",
+			"secret":  "s3cr3t",
+			"commits": []interface{}{map[string]interface{}{"id": "1", "diff": "..."}, map[string]interface{}{"id": "2", "diff": "..."}},
+			"repo":    map[string]interface{}{"name": "webhook", "token": "t"},
+		},
+		Headers: map[string]interface{}{"X-Token": "t", "X-Event": "push"},
+	}
+	for _, tt := range []struct {
+		arg      Argument
+		expected string
+	}{
+		{Argument{Source: SourceEntirePayload, Include: []string{"ref", "commits.id", "repo.name"}}, `{"commits":[{"id":"1"},{"id":"2"}],"ref":"main","repo":{"name":"webhook"}}`},
+		{Argument{Source: SourceEntirePayload, Exclude: []string{"secret", "commits.diff", "repo.token"}}, `{"commits":[{"id":"1"},{"id":"2"}],"ref":"main","repo":{"name":"webhook"}}`},
+		{Argument{Source: SourceEntirePayload, Include: []string{"commits.1"}, Exclude: []string{"commits.diff"}}, `{"commits":[{"id":"2"}]}`},
+		{Argument{Source: SourceEntirePayload, Include: []string{"missing"}}, `{}`},
+		{Argument{Source: SourceEntireHeaders, Exclude: []string{"x-token"}}, `{"X-Event":"push"}`},
+	} {
+		got, err := tt.arg.Get(r)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got != tt.expected {
+			t.Errorf("%+v: expected %s, got %s", tt.arg, tt.expected, got)
+		}
+	}
+}
+
+func TestTransformPayload(t *testing.T) {
+	transform := &PayloadTransform{Program: `{ref: (.ref // .object_attributes.ref), event: $headers["X-Event"]}`}
+	r := &Request{
+		Payload: map[string]interface{}{"object_attributes": map[string]interface{}{"ref": "main"}},
+		Headers: map[string]interface{}{"X-Event": "push"},
+	}
+	if err := r.TransformPayload(transform); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := map[string]interface{}{"ref": "main", "event": "push"}
+	if !reflect.DeepEqual(r.Payload, expected) {
+		t.Errorf("expected payload %#v, got %#v", expected, r.Payload)
+	}
+
+	for _, program := range []string{`.ref`, `{`, `error("failed")`} {
+		if err := r.TransformPayload(&PayloadTransform{Program: program}); err == nil {
+			t.Errorf("expected error for program %q", program)
+		}
+	}
+}
+
+func TestPayloadDigestEnv(t *testing.T) {
+	r := &Request{
+		Body:    []byte(`{"a": "z"}`),
+		Headers: map[string]interface{}{"X-Signature": "sha256=f417af3a21bd70379b5796d5f013915e7029f62c580fb0f500f59a35a6f04c89"},
+	}
+	rule := MatchRule{Type: MatchHMACSHA256, Secret: "secret", Parameter: Argument{Source: "header", Name: "X-Signature"}}
+	if ok, err := rule.Evaluate(r); !ok || err != nil {
+		t.Fatalf("expected signature to match, got %t, %v", ok, err)
+	}
+
+	expected := []string{
+		"WEBHOOK_PAYLOAD_SHA256=53aec37055e033d27ff92949257e458319acf9bddc0cb737a31e5896fb4e6645",
+		"WEBHOOK_PAYLOAD_SIGNATURE=sha256=f417af3a21bd70379b5796d5f013915e7029f62c580fb0f500f59a35a6f04c89",
+	}
+	if got := r.PayloadDigestEnv(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestHookUsesBody(t *testing.T) {
+	header := Argument{Source: SourceHeader, Name: "X-Event"}
+	payload := Argument{Source: SourcePayload, Name: "ref"}
+	for _, tt := range []struct {
+		desc string
+		hook Hook
+		uses bool
+	}{
+		{"no references", Hook{ID: "a", ExecuteCommand: "/bin/true"}, false},
+		{"header argument", Hook{PassArgumentsToCommand: []Argument{header, {Source: SourceString, Name: "x"}}}, false},
+		{"payload argument", Hook{PassArgumentsToCommand: []Argument{header, payload}}, true},
+		{"raw body env", Hook{PassEnvironmentToCommand: []Argument{{Source: SourceRawRequestBody}}}, true},
+		{"entire payload file", Hook{PassFileToCommand: []Argument{{Source: SourceEntirePayload}}}, true},
+		{"payload idempotency key", Hook{IdempotencyKey: &payload}, true},
+		{"header rules", Hook{TriggerRule: &Rules{And: &AndRule{
+			{Match: &MatchRule{Type: MatchValue, Value: "push", Parameter: header}},
+			{Not: &NotRule{Match: &MatchRule{Type: IPWhitelist, IPRange: "10.0.0.0/8"}}},
+			{Match: &MatchRule{Type: MatchGitLabToken, Secret: "s"}},
+		}}}, false},
+		{"payload rule", Hook{TriggerRule: &Rules{Or: &OrRule{
+			{Match: &MatchRule{Type: MatchValue, Value: "push", Parameter: header}},
+			{Match: &MatchRule{Type: MatchRegex, Regex: "main", Parameter: payload}},
+		}}}, true},
+		{"signature rule", Hook{TriggerRule: &Rules{Match: &MatchRule{Type: MatchHMACSHA256, Secret: "s", Parameter: header}}}, true},
+		{"event rule", Hook{TriggerRule: &Rules{Match: &MatchRule{Type: MatchGitHubEvent, Events: []string{"push"}}}}, true},
+		{"unresolved rule", Hook{TriggerRule: &Rules{Ref: "sig"}}, true},
+		{"forwarded", Hook{ForwardTo: []ForwardTarget{{URL: "http://example.com"}}}, true},
+		{"streamed", Hook{StreamBodyToStdin: true}, true},
+		{"chained", Hook{OnSuccess: []string{"next"}}, true},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			if uses := tt.hook.UsesBody(); uses != tt.uses {
+				t.Errorf("expected %t, got %t", tt.uses, uses)
+			}
+			tt.hook.AnalyzeBodyUsage()
+			if tt.hook.SkipsBody() == tt.uses {
+				t.Errorf("expected skipping the body %t, got %t", !tt.uses, tt.hook.SkipsBody())
+			}
+		})
+	}
+}
+
+func TestHookPrepare(t *testing.T) {
+	h := Hook{
+		HTTPMethods: []string{"Post ", "put", "POST", " "},
+		TriggerRule: &Rules{And: &AndRule{
+			{Match: &MatchRule{Type: MatchRegex, Regex: "^refs/heads/", Parameter: Argument{Source: SourcePayload, Name: "ref"}}},
+			{Not: &NotRule{Match: &MatchRule{Type: IPWhitelist, IPRange: "10.0.0.0/8 192.168.0.1"}}},
+			{Match: &MatchRule{Type: MatchHMACSHA256, Secret: "s", CanonicalString: `{{ header "X-Timestamp" }}.{{ body }}`}},
+		}},
+	}
+	if err := h.Prepare(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expected := []string{"POST", "PUT"}; !reflect.DeepEqual(h.HTTPMethods, expected) {
+		t.Errorf("expected methods %v, got %v", expected, h.HTTPMethods)
+	}
+	if h.SkipsBody() {
+		t.Error("expected the body usage to be analyzed")
+	}
+	rules := *h.TriggerRule.And
+	if rules[0].Match.regex == nil || len(rules[1].Not.Match.ipRanges) != 2 || rules[2].Match.canonical == nil {
+		t.Error("expected the patterns to be kept on the rules")
+	}
+	req := &Request{Body: []byte("payload"), Headers: map[string]interface{}{"X-Timestamp": "1700000000"}}
+	if canonical, err := rules[2].Match.canonicalString(req); err != nil || string(canonical) != "1700000000.payload" {
+		t.Errorf("unexpected canonical string %q: %v", canonical, err)
+	}
+
+	for _, rule := range []MatchRule{
+		{Type: MatchRegex, Regex: "("},
+		{Type: IPWhitelist, IPRange: "10.0.0.0/8 invalid"},
+		{Type: MatchHMACSHA256, CanonicalString: "{{ header }"},
+		{Type: MatchHMACSHA256, CanonicalString: "{{ unknown }}"},
+	} {
+		h := Hook{TriggerRule: &Rules{Or: &OrRule{{Match: &MatchRule{Type: MatchValue}}, {Match: &rule}}}}
+		if err := h.Prepare(); err == nil {
+			t.Errorf("expected error for rule %+v", rule)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package hook
+
+import "slices"
+
+// Classes of trigger rule failures, ordered by precedence.
+const (
+	MismatchSignature        = "signature"
+	MismatchIPWhitelist      = "ip-whitelist"
+	MismatchMissingParameter = "missing-parameter"
+	MismatchRules            = "rules"
+)
+
+// signatureRules are the match rule types verifying a signature, including
+// the signed identity assertions of authenticating proxies and secret tokens.
+var signatureRules = []string{
+	MatchHMACSHA1, MatchHMACSHA256, MatchHMACSHA512,
+	MatchHashSHA1, MatchHashSHA256, MatchHashSHA512,
+	ScalrSignature, RuleAuthProxy, MatchGitLabToken,
+}
+
+// ClassifyMismatch returns the class of a trigger rule failure from the
+// mismatched rules and the error of the evaluation, if any. Signature
+// failures take precedence over IP whitelist failures, which take precedence
+// over missing parameters.
+func ClassifyMismatch(mismatched []string, err error) string {
+	switch {
+	case IsSignatureError(err) || slices.ContainsFunc(mismatched, func(t string) bool {
+		return slices.Contains(signatureRules, t)
+	}):
+		return MismatchSignature
+	case slices.Contains(mismatched, IPWhitelist):
+		return MismatchIPWhitelist
+	case IsParameterNodeError(err):
+		return MismatchMissingParameter
+	}
+	return MismatchRules
+}
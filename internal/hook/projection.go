@@ -0,0 +1,129 @@
+package hook
+
+import (
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// project applies the include and exclude lists of the argument to the value
+// of an entire-* source. Paths use the dot-notation; a path segment which is
+// not an index applies to all elements of an array.
+func (ha *Argument) project(v map[string]interface{}) interface{} {
+	if len(ha.Include) == 0 && len(ha.Exclude) == 0 {
+		return v
+	}
+	var result interface{} = v
+	if len(ha.Include) > 0 {
+		result, _ = includePaths(result, ha.splitPaths(ha.Include))
+		if result == nil {
+			result = map[string]interface{}{}
+		}
+	}
+	if len(ha.Exclude) > 0 {
+		result = excludePaths(result, ha.splitPaths(ha.Exclude))
+	}
+	return result
+}
+
+func (ha *Argument) splitPaths(paths []string) [][]string {
+	split := make([][]string, len(paths))
+	for i, p := range paths {
+		split[i] = strings.Split(p, ".")
+		// header names are canonicalized when parsing the request
+		if ha.Source == SourceEntireHeaders {
+			split[i][0] = textproto.CanonicalMIMEHeaderKey(split[i][0])
+		}
+	}
+	return split
+}
+
+// subPaths returns the remainder of the paths starting with key.
+func subPaths(paths [][]string, key string) (sub [][]string, whole bool) {
+	for _, p := range paths {
+		if p[0] != key {
+			continue
+		}
+		if len(p) == 1 {
+			whole = true
+		}
+		sub = append(sub, p[1:])
+	}
+	return sub, whole
+}
+
+// elementPaths returns the paths applying to the i-th element of an array.
+func elementPaths(paths [][]string, i int) (sub [][]string, whole bool) {
+	sub, whole = subPaths(paths, strconv.Itoa(i))
+	for _, p := range paths {
+		if _, err := strconv.Atoi(p[0]); err != nil {
+			sub = append(sub, p)
+		}
+	}
+	return sub, whole
+}
+
+// includePaths returns a copy of v holding only the given paths. ok is false
+// if none of the paths exists in v.
+func includePaths(v interface{}, paths [][]string) (interface{}, bool) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{})
+		for k, child := range v {
+			sub, whole := subPaths(paths, k)
+			if whole {
+				result[k] = child
+			} else if len(sub) > 0 {
+				if projected, ok := includePaths(child, sub); ok {
+					result[k] = projected
+				}
+			}
+		}
+		return result, len(result) > 0
+	case []interface{}:
+		var result []interface{}
+		for i, elem := range v {
+			sub, whole := elementPaths(paths, i)
+			if whole {
+				result = append(result, elem)
+			} else if projected, ok := includePaths(elem, sub); ok {
+				result = append(result, projected)
+			}
+		}
+		return result, len(result) > 0
+	}
+	return nil, false
+}
+
+// excludePaths returns a copy of v without the given paths.
+func excludePaths(v interface{}, paths [][]string) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for k, child := range v {
+			sub, whole := subPaths(paths, k)
+			if whole {
+				continue
+			}
+			if len(sub) > 0 {
+				child = excludePaths(child, sub)
+			}
+			result[k] = child
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, 0, len(v))
+		for i, elem := range v {
+			sub, whole := elementPaths(paths, i)
+			if whole {
+				continue
+			}
+			if len(sub) > 0 {
+				elem = excludePaths(elem, sub)
+			}
+			result = append(result, elem)
+		}
+		return result
+	}
+	return v
+}
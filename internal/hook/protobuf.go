@@ -0,0 +1,57 @@
+package hook
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// ProtobufPayload configures the decoding of protobuf encoded payloads. The
+// message type is resolved from a compiled descriptor set, as produced by
+// `protoc --include_imports --descriptor_set_out`.
+type ProtobufPayload struct {
+	DescriptorSet string `json:"descriptor-set,omitempty"`
+	Message       string `json:"message,omitempty"`
+
+	once sync.Once
+	desc protoreflect.MessageDescriptor
+	err  error
+}
+
+// descriptor loads the descriptor set on first use and returns the
+// descriptor of the configured message.
+func (p *ProtobufPayload) descriptor() (protoreflect.MessageDescriptor, error) {
+	p.once.Do(func() {
+		p.desc, p.err = loadMessageDescriptor(p.DescriptorSet, p.Message)
+	})
+	return p.desc, p.err
+}
+
+func loadMessageDescriptor(path, message string) (protoreflect.MessageDescriptor, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading descriptor set: %w", err)
+	}
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(raw, &set); err != nil {
+		return nil, fmt.Errorf("error parsing descriptor set [%s]: %w", path, err)
+	}
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving descriptor set [%s]: %w", path, err)
+	}
+	d, err := files.FindDescriptorByName(protoreflect.FullName(message))
+	if err != nil {
+		return nil, fmt.Errorf("message %q not found in descriptor set [%s]: %w", message, path, err)
+	}
+	md, ok := d.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a message in descriptor set [%s]", message, path)
+	}
+	return md, nil
+}
@@ -2,13 +2,23 @@ package hook
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"os"
+	"strings"
+	"time"
 	"unicode"
 
 	"github.com/clbanning/mxj"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/dynamicpb"
 )
 
 // Request represents a webhook request.
@@ -27,20 +37,133 @@ type Request struct {
 	Payload map[string]interface{}
 	// The underlying HTTP request.
 	RawRequest *http.Request
+	// ReceivedAt is the time the request was received.
+	ReceivedAt time.Time
+	// Route describes where the request was received, ie. the matched URL
+	// pattern or the message source.
+	Route string
 	// Treat signature errors as simple validate failures.
 	AllowSignatureErrors bool
+	// ValidatedSignature is the payload HMAC which matched a signature rule,
+	// in the form algorithm=hex.
+	ValidatedSignature string
+	// MismatchedRules lists the types of the match rules, or "not", which
+	// caused the trigger rule to be unsatisfied.
+	MismatchedRules []string
+	// MismatchClass is the class of the trigger rule failure, one of the
+	// Mismatch* constants.
+	MismatchClass string
+	// MismatchReason tells why a rule rejected the request, if the rule
+	// tells, ie. why an auth-proxy assertion is invalid.
+	MismatchReason string
+	// Identity holds the claims of the identity asserted by an authenticating
+	// proxy, see AuthProxy.
+	Identity map[string]interface{}
+	// Claims holds the claims of the OIDC bearer token the request was
+	// authenticated with.
+	Claims map[string]interface{}
+	// IDMatch holds the values captured by the ID pattern of the hook.
+	IDMatch map[string]interface{}
+	// Use only the first value of repeated query and form parameters.
+	SingleValueParameters bool
+	// BodyStream is the request body passed to the command's stdin.
+	BodyStream io.Reader
+	// UploadedFiles are the multipart file parts saved for the command.
+	UploadedFiles []UploadedFile
+}
+
+// validatedSignature records the MAC of a successful signature check and
+// returns the outcome of the check.
+func (r *Request) validatedSignature(algorithm, mac string, err error) (bool, error) {
+	if err != nil {
+		return false, err
+	}
+	r.ValidatedSignature = algorithm + "=" + mac
+	return true, nil
+}
+
+// PayloadDigestEnv returns the environment variables holding the SHA-256
+// digest of the body and the signature validated by the trigger rules.
+func (r *Request) PayloadDigestEnv() []string {
+	sum := sha256.Sum256(r.Body)
+	return []string{
+		"WEBHOOK_PAYLOAD_SHA256=" + hex.EncodeToString(sum[:]),
+		"WEBHOOK_PAYLOAD_SIGNATURE=" + r.ValidatedSignature,
+	}
+}
+
+// UploadedFile describes a multipart file part saved to a temporary file.
+type UploadedFile struct {
+	EnvName     string
+	Path        string
+	FileName    string
+	ContentType string
+}
+
+// UploadedFilesEnv returns the environment variables describing the uploaded
+// files. For the i-th file of a variable NAME, NAME_i, NAME_i_FILENAME and
+// NAME_i_CONTENT_TYPE are set along with NAME_COUNT; the first file is also
+// available as NAME, NAME_FILENAME and NAME_CONTENT_TYPE.
+func (r *Request) UploadedFilesEnv() []string {
+	var env []string
+	counts := make(map[string]int)
+	var names []string
+	for _, f := range r.UploadedFiles {
+		i := counts[f.EnvName]
+		if i == 0 {
+			names = append(names, f.EnvName)
+			env = append(env,
+				f.EnvName+"="+f.Path,
+				f.EnvName+"_FILENAME="+f.FileName,
+				f.EnvName+"_CONTENT_TYPE="+f.ContentType,
+			)
+		}
+		prefix := fmt.Sprintf("%s_%d", f.EnvName, i)
+		env = append(env,
+			prefix+"="+f.Path,
+			prefix+"_FILENAME="+f.FileName,
+			prefix+"_CONTENT_TYPE="+f.ContentType,
+		)
+		counts[f.EnvName] = i + 1
+	}
+	for _, name := range names {
+		env = append(env, fmt.Sprintf("%s_COUNT=%d", name, counts[name]))
+	}
+	return env
+}
+
+// RemoveUploadedFiles deletes the temporary files of the uploaded files.
+func (r *Request) RemoveUploadedFiles() error {
+	var errs []error
+	for _, f := range r.UploadedFiles {
+		if err := os.Remove(f.Path); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+	}
+	r.UploadedFiles = nil
+	return errors.Join(errs...)
+}
+
+// payloadBody returns the body transcoded to UTF-8 according to the charset
+// of the content type, leaving the raw body untouched for signatures.
+func (r *Request) payloadBody() ([]byte, error) {
+	return toUTF8(r.ContentType, r.Body)
 }
 
 func (r *Request) ParseJSONPayload() error {
-	decoder := json.NewDecoder(bytes.NewReader(r.Body))
+	body, err := r.payloadBody()
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
 	decoder.UseNumber()
 
 	var firstChar byte
-	for i := 0; i < len(r.Body); i++ {
-		if unicode.IsSpace(rune(r.Body[i])) {
+	for i := 0; i < len(body); i++ {
+		if unicode.IsSpace(rune(body[i])) {
 			continue
 		}
-		firstChar = r.Body[i]
+		firstChar = body[i]
 		break
 	}
 
@@ -63,6 +186,33 @@ func (r *Request) ParseJSONPayload() error {
 	return nil
 }
 
+// ParseNDJSONPayload parses a body of newline delimited JSON values. The
+// values are exposed as an array under "root", like a JSON array payload.
+func (r *Request) ParseNDJSONPayload() error {
+	body, err := r.payloadBody()
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	events := make([]interface{}, 0)
+	for {
+		var event interface{}
+		err := decoder.Decode(&event)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error parsing NDJSON payload %+v", err)
+		}
+		events = append(events, event)
+	}
+
+	r.Payload = map[string]interface{}{"root": events}
+	return nil
+}
+
 func (r *Request) ParseHeaders(headers map[string][]string) {
 	r.Headers = make(map[string]interface{}, len(headers))
 
@@ -78,13 +228,30 @@ func (r *Request) ParseQuery(query map[string][]string) {
 
 	for k, v := range query {
 		if len(v) > 0 {
-			r.Query[k] = v[0]
+			r.Query[k] = r.parameterValue(v)
 		}
 	}
 }
 
+// parameterValue returns the value of a query or form parameter. Repeated
+// parameters are returned as an array, unless SingleValueParameters is set.
+func (r *Request) parameterValue(values []string) interface{} {
+	if len(values) == 1 || r.SingleValueParameters {
+		return values[0]
+	}
+	arr := make([]interface{}, len(values))
+	for i := range values {
+		arr[i] = values[i]
+	}
+	return arr
+}
+
 func (r *Request) ParseFormPayload() error {
-	fd, err := url.ParseQuery(string(r.Body))
+	body, err := r.payloadBody()
+	if err != nil {
+		return err
+	}
+	fd, err := url.ParseQuery(string(body))
 	if err != nil {
 		return fmt.Errorf("error parsing form payload %+v", err)
 	}
@@ -92,18 +259,117 @@ func (r *Request) ParseFormPayload() error {
 	r.Payload = make(map[string]interface{}, len(fd))
 
 	for k, v := range fd {
-		if len(v) > 0 {
-			r.Payload[k] = v[0]
+		if len(v) == 0 {
+			continue
+		}
+		name, path, ok := parseBracketKey(k)
+		if !ok {
+			r.Payload[k] = r.parameterValue(v)
+			continue
+		}
+		r.setNestedFormValue(r.Payload, append([]string{name}, path...), v)
+	}
+
+	return nil
+}
+
+// parseBracketKey splits a form key in the bracket notation, ie. a[b][c] or
+// a[], into its name and the path of keys. ok is false for plain or malformed
+// keys. An empty key, meaning an array, is only valid at the end of the path.
+func parseBracketKey(key string) (name string, path []string, ok bool) {
+	i := strings.IndexByte(key, '[')
+	if i <= 0 || !strings.HasSuffix(key, "]") {
+		return "", nil, false
+	}
+	name, rest := key[:i], key[i:]
+	for rest != "" {
+		end := strings.IndexByte(rest, ']')
+		if rest[0] != '[' || end < 0 {
+			return "", nil, false
+		}
+		segment := rest[1:end]
+		if strings.ContainsRune(segment, '[') {
+			return "", nil, false
+		}
+		path = append(path, segment)
+		rest = rest[end+1:]
+	}
+	for _, segment := range path[:len(path)-1] {
+		if segment == "" {
+			return "", nil, false
+		}
+	}
+	return name, path, true
+}
+
+// setNestedFormValue stores the values of a bracket notation form key in
+// nested maps, replacing non-map values on the way. A trailing empty key
+// always stores the values as an array.
+func (r *Request) setNestedFormValue(m map[string]interface{}, path []string, values []string) {
+	for _, key := range path[:len(path)-2] {
+		next, ok := m[key].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			m[key] = next
+		}
+		m = next
+	}
+
+	key, last := path[len(path)-2], path[len(path)-1]
+	if last == "" {
+		arr := make([]interface{}, len(values))
+		for i := range values {
+			arr[i] = values[i]
 		}
+		m[key] = arr
+		return
 	}
+	next, ok := m[key].(map[string]interface{})
+	if !ok {
+		next = make(map[string]interface{})
+		m[key] = next
+	}
+	next[last] = r.parameterValue(values)
+}
 
+// ParseProtobufPayload decodes the body as the protobuf message configured by
+// p. The message is exposed in its JSON mapping using the original field
+// names, so 64-bit integers and enums are represented as strings.
+func (r *Request) ParseProtobufPayload(p *ProtobufPayload) error {
+	desc, err := p.descriptor()
+	if err != nil {
+		return err
+	}
+	msg := dynamicpb.NewMessage(desc)
+	if err := proto.Unmarshal(r.Body, msg); err != nil {
+		return fmt.Errorf("error parsing protobuf payload: %+v", err)
+	}
+	data, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("error converting protobuf payload: %+v", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	r.Payload = nil
+	if err := decoder.Decode(&r.Payload); err != nil {
+		return fmt.Errorf("error converting protobuf payload: %+v", err)
+	}
 	return nil
 }
 
 func (r *Request) ParseXMLPayload() error {
-	var err error
+	body := r.Body
+	// an encoding declaration is decoded by the XML reader itself
+	if !declaresXMLEncoding(body) {
+		var err error
+		if body, err = r.payloadBody(); err != nil {
+			return err
+		}
+	}
 
-	r.Payload, err = mxj.NewMapXmlReader(bytes.NewReader(r.Body))
+	var err error
+	r.Payload, err = mxj.NewMapXmlReader(bytes.NewReader(body))
 	if err != nil {
 		return fmt.Errorf("error parsing XML payload: %+v", err)
 	}
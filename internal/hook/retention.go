@@ -0,0 +1,9 @@
+package hook
+
+// Retention limits the files an instance keeps for a hook. Files exceeding
+// any of the limits are removed, oldest first; zero values don't limit.
+type Retention struct {
+	MaxAge   Duration `json:"max-age,omitempty"`
+	MaxSize  int64    `json:"max-size,omitempty"`
+	MaxCount int      `json:"max-count,omitempty"`
+}
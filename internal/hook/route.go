@@ -0,0 +1,113 @@
+package hook
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// RequestHost returns the host name of a Host header in lower case, without
+// the port and a trailing dot, for comparing it with the hosts of hooks.
+func RequestHost(hostport string) string {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// HasHost returns whether the hook is bound to the given host name. Hooks
+// without a host are bound to the empty host name.
+func (h *Hook) HasHost(host string) bool {
+	return RequestHost(h.Host) == host
+}
+
+// URLBase returns the path the ID of the hook is appended to if it has its
+// own URL prefix, ie. /team-a/hooks/, or an empty string if it is served
+// under the global prefix.
+func (h *Hook) URLBase() string {
+	prefix := strings.Trim(h.URLPrefix, "/")
+	if prefix == "" {
+		return ""
+	}
+	return "/" + prefix + "/"
+}
+
+// RouteKey identifies the hook by its route: its host, URL base and ID. State
+// kept per hook uses it, so hooks of different hosts or URL prefixes sharing
+// an ID are kept apart.
+func (h *Hook) RouteKey() [3]string {
+	return [3]string{RequestHost(h.Host), h.URLBase(), h.ID}
+}
+
+// IsPattern returns whether the hook matches requested IDs by a pattern
+// instead of its ID.
+func (h *Hook) IsPattern() bool {
+	return h.IDRegex != "" || strings.Contains(h.ID, "*")
+}
+
+// compileIDPattern compiles the ID pattern of the hook. Each * of a wildcard
+// ID matches one or more characters, including slashes.
+func (h *Hook) compileIDPattern() (*regexp.Regexp, error) {
+	expr := h.IDRegex
+	if expr == "" {
+		parts := strings.Split(h.ID, "*")
+		for i := range parts {
+			parts[i] = regexp.QuoteMeta(parts[i])
+		}
+		expr = strings.Join(parts, "(.+)")
+	}
+	re, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid id-regex: %w", err)
+	}
+	return re, nil
+}
+
+// idPattern returns the ID pattern of the hook, compiled by Prepare or else
+// now.
+func (h *Hook) idPattern() (*regexp.Regexp, error) {
+	if h.idRegexp != nil {
+		return h.idRegexp, nil
+	}
+	return h.compileIDPattern()
+}
+
+// ValidateIDPattern returns an error if the hook has an invalid ID pattern.
+func (h *Hook) ValidateIDPattern() error {
+	if !h.IsPattern() {
+		return nil
+	}
+	_, err := h.idPattern()
+	return err
+}
+
+// MatchID returns whether the requested ID addresses the hook, and for hooks
+// with an ID pattern the captured values: the wildcards and groups by their
+// number, starting at 1, and named groups by their name as well.
+func (h *Hook) MatchID(id string) (bool, map[string]interface{}) {
+	if !h.IsPattern() {
+		return h.ID == id, nil
+	}
+	re, err := h.idPattern()
+	if err != nil {
+		return false, nil
+	}
+	match := re.FindStringSubmatch(id)
+	if match == nil {
+		return false, nil
+	}
+	captures := make(map[string]interface{}, len(match))
+	for i, name := range re.SubexpNames() {
+		if i == 0 {
+			continue
+		}
+		captures[strconv.Itoa(i)] = match[i]
+		if name != "" {
+			captures[name] = match[i]
+		}
+	}
+	return true, captures
+}
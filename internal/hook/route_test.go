@@ -0,0 +1,50 @@
+package hook
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHookMatchID(t *testing.T) {
+	for _, tt := range []struct {
+		hook     Hook
+		id       string
+		ok       bool
+		captures map[string]interface{}
+	}{
+		{Hook{ID: "deploy"}, "deploy", true, nil},
+		{Hook{ID: "deploy"}, "deploy/app", false, nil},
+		{Hook{ID: "deploy/*"}, "deploy/org/app", true, map[string]interface{}{"1": "org/app"}},
+		{Hook{ID: "deploy/*"}, "deploy/", false, nil},
+		{Hook{ID: "*/deploy.*"}, "app/deploy.prod", true, map[string]interface{}{"1": "app", "2": "prod"}},
+		{Hook{ID: "*/deploy.*"}, "app/deployXprod", false, nil},
+		{Hook{ID: "deploy", IDRegex: `deploy-(?P<env>staging|prod)`}, "deploy-prod", true, map[string]interface{}{"1": "prod", "env": "prod"}},
+		{Hook{ID: "deploy", IDRegex: `deploy-(?P<env>staging|prod)`}, "deploy-prod2", false, nil},
+		{Hook{ID: "deploy", IDRegex: `deploy-(?P<env>staging|prod)`}, "deploy", false, nil},
+	} {
+		ok, captures := tt.hook.MatchID(tt.id)
+		if ok != tt.ok || !reflect.DeepEqual(captures, tt.captures) {
+			t.Errorf("%+v: expected %v %v for %q, got %v %v", tt.hook, tt.ok, tt.captures, tt.id, ok, captures)
+		}
+	}
+
+	if err := (&Hook{ID: "x", IDRegex: "("}).ValidateIDPattern(); err == nil {
+		t.Error("expected error for invalid id-regex")
+	}
+}
+
+func TestHookPrepareIDPattern(t *testing.T) {
+	h := Hook{ID: "deploy/*"}
+	if err := h.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if h.idRegexp == nil {
+		t.Fatal("expected the ID pattern to be kept on the hook")
+	}
+	if ok, captures := h.MatchID("deploy/app"); !ok || captures["1"] != "app" {
+		t.Errorf("expected the compiled pattern to match, got %v %v", ok, captures)
+	}
+	if err := (&Hook{ID: "x", IDRegex: "("}).Prepare(); err == nil {
+		t.Error("expected error for invalid id-regex")
+	}
+}
@@ -2,8 +2,12 @@ package hook
 
 import (
 	"crypto/subtle"
+	"errors"
+	"fmt"
 	"log/slog"
+	"net"
 	"regexp"
+	"time"
 )
 
 // Rules is a structure that contains one of the valid rule types
@@ -12,6 +16,11 @@ type Rules struct {
 	Or    *OrRule    `json:"or,omitempty"`
 	Not   *NotRule   `json:"not,omitempty"`
 	Match *MatchRule `json:"match,omitempty"`
+	// AuthProxy requires a valid identity assertion of an authenticating proxy.
+	AuthProxy *AuthProxy `json:"auth-proxy,omitempty"`
+	// Ref names a rule defined in the rules of the hooks file. References
+	// are replaced by the named rule when the hooks file is loaded.
+	Ref string `json:"ref,omitempty"`
 }
 
 // Evaluate finds the first rule property that is not nil and returns the value
@@ -26,6 +35,14 @@ func (r Rules) Evaluate(req *Request) (bool, error) {
 		return r.Not.Evaluate(req)
 	case r.Match != nil:
 		return r.Match.Evaluate(req)
+	case r.AuthProxy != nil:
+		ok, err := r.AuthProxy.Verify(req)
+		if !ok {
+			req.MismatchedRules = append(req.MismatchedRules, RuleAuthProxy)
+		}
+		return ok, err
+	case r.Ref != "":
+		return false, fmt.Errorf("unresolved reference to rule %q", r.Ref)
 	}
 
 	return false, nil
@@ -59,6 +76,7 @@ type OrRule []Rules
 // Evaluate OrRule will return true if any of ChildRules evaluate to true
 func (r OrRule) Evaluate(req *Request) (bool, error) {
 	res := false
+	mismatched := len(req.MismatchedRules)
 
 	for _, v := range r {
 		rv, err := v.Evaluate(req)
@@ -72,6 +90,8 @@ func (r OrRule) Evaluate(req *Request) (bool, error) {
 
 		res = res || rv
 		if res {
+			// alternatives which did not match are irrelevant
+			req.MismatchedRules = req.MismatchedRules[:mismatched]
 			return res, nil
 		}
 	}
@@ -84,7 +104,12 @@ type NotRule Rules
 
 // Evaluate NotRule will return true if and only if ChildRule evaluates to false
 func (r NotRule) Evaluate(req *Request) (bool, error) {
+	mismatched := len(req.MismatchedRules)
 	rv, err := Rules(r).Evaluate(req)
+	req.MismatchedRules = req.MismatchedRules[:mismatched]
+	if rv {
+		req.MismatchedRules = append(req.MismatchedRules, "not")
+	}
 	return !rv, err
 }
 
@@ -94,31 +119,86 @@ type MatchRule struct {
 	Regex     string   `json:"regex,omitempty"`
 	Secret    string   `json:"secret,omitempty"`
 	Value     string   `json:"value,omitempty"`
-	Parameter Argument `json:"parameter,omitempty"`
+	Parameter Argument `json:"parameter,omitzero"`
 	IPRange   string   `json:"ip-range,omitempty"`
+	// Secrets are accepted by signature rules in addition to Secret.
+	Secrets []string `json:"secrets,omitempty"`
+	// Events and Actions filter the deliveries matched by provider rules,
+	// ie. github-event and gitlab-event.
+	Events  []string `json:"events,omitempty"`
+	Actions []string `json:"actions,omitempty"`
+	// ClockSkew is the tolerated difference between the signing time of
+	// timestamped signatures and the time they are checked, defaults to
+	// DefaultClockSkew.
+	ClockSkew Duration `json:"clock-skew,omitempty"`
+	// SignaturePrefix is stripped from the signatures of payload-hmac rules,
+	// defaults to the algorithm followed by "=", ie. "sha256=".
+	SignaturePrefix *string `json:"signature-prefix,omitempty"`
+	// SignatureEncoding is the encoding of the signatures of payload-hmac
+	// rules, one of the SignatureEncoding* constants, defaults to hex.
+	SignatureEncoding string `json:"signature-encoding,omitempty"`
+	// CanonicalString is a template of the string signed by payload-hmac
+	// rules instead of the raw body, ie. `{{ header "X-Timestamp" }}.{{ body }}`.
+	CanonicalString string `json:"canonical-string,omitempty"`
+	// SignatureTimestamp references the signing time, in seconds since the
+	// epoch, of payload-hmac rules, which is checked against the clock skew.
+	SignatureTimestamp *Argument `json:"signature-timestamp,omitempty"`
+
+	// compiled patterns of the rule, see Hook.Prepare
+	regex     *regexp.Regexp
+	ipRanges  []*net.IPNet
+	canonical *canonicalTemplate
 }
 
 // Constants for the MatchRule type
 const (
-	MatchValue      string = "value"
-	MatchRegex      string = "regex"
-	MatchHMACSHA1   string = "payload-hmac-sha1"
-	MatchHMACSHA256 string = "payload-hmac-sha256"
-	MatchHMACSHA512 string = "payload-hmac-sha512"
-	MatchHashSHA1   string = "payload-hash-sha1"
-	MatchHashSHA256 string = "payload-hash-sha256"
-	MatchHashSHA512 string = "payload-hash-sha512"
-	IPWhitelist     string = "ip-whitelist"
-	ScalrSignature  string = "scalr-signature"
+	MatchValue       string = "value"
+	MatchRegex       string = "regex"
+	MatchHMACSHA1    string = "payload-hmac-sha1"
+	MatchHMACSHA256  string = "payload-hmac-sha256"
+	MatchHMACSHA512  string = "payload-hmac-sha512"
+	MatchHashSHA1    string = "payload-hash-sha1"
+	MatchHashSHA256  string = "payload-hash-sha256"
+	MatchHashSHA512  string = "payload-hash-sha512"
+	IPWhitelist      string = "ip-whitelist"
+	ScalrSignature   string = "scalr-signature"
+	MatchGitHubEvent string = "github-event"
+	MatchGitLabToken string = "gitlab-token"
+	MatchGitLabEvent string = "gitlab-event"
 )
 
 // Evaluate MatchRule will return based on the type
 func (r MatchRule) Evaluate(req *Request) (bool, error) {
+	ok, err := r.evaluate(req)
+	if !ok {
+		req.MismatchedRules = append(req.MismatchedRules, r.Type)
+	}
+	return ok, err
+}
+
+func (r MatchRule) evaluate(req *Request) (bool, error) {
 	if r.Type == IPWhitelist {
-		return CheckIPWhitelist(req.RawRequest.RemoteAddr, r.IPRange)
+		if req.RawRequest == nil {
+			return false, errors.New("ip-whitelist rule requires an HTTP request")
+		}
+		ranges, err := r.compiledIPRanges()
+		if err != nil {
+			return false, err
+		}
+		return checkIPRanges(req.RawRequest.RemoteAddr, ranges)
 	}
 	if r.Type == ScalrSignature {
-		return CheckScalrSignature(req, r.Secret, true)
+		return r.withSecrets(func(secret string) (bool, error) {
+			return CheckScalrSignatureWithin(req, secret, r.clockSkew())
+		})
+	}
+	switch r.Type {
+	case MatchGitHubEvent:
+		return r.matchGitHubEvent(req)
+	case MatchGitLabToken:
+		return r.matchGitLabToken(req)
+	case MatchGitLabEvent:
+		return r.matchGitLabEvent(req)
 	}
 
 	arg, err := r.Parameter.Get(req)
@@ -127,30 +207,83 @@ func (r MatchRule) Evaluate(req *Request) (bool, error) {
 		case MatchValue:
 			return compare(arg, r.Value), nil
 		case MatchRegex:
-			return regexp.MatchString(r.Regex, arg)
+			re, err := r.compiledRegex()
+			if err != nil {
+				return false, err
+			}
+			return re.MatchString(arg), nil
 		case MatchHashSHA1:
 			slog.Warn("use of deprecated option payload-hash-sha1; use payload-hmac-sha1 instead")
 			fallthrough
 		case MatchHMACSHA1:
-			_, err := CheckPayloadSignature(req.Body, r.Secret, arg)
-			return err == nil, err
+			return r.checkHMAC(req, "sha1", arg)
 		case MatchHashSHA256:
 			slog.Warn("use of deprecated option payload-hash-sha256; use payload-hmac-sha256 instead")
 			fallthrough
 		case MatchHMACSHA256:
-			_, err := CheckPayloadSignature256(req.Body, r.Secret, arg)
-			return err == nil, err
+			return r.checkHMAC(req, "sha256", arg)
 		case MatchHashSHA512:
 			slog.Warn("use of deprecated option payload-hash-sha512; use payload-hmac-sha512 instead")
 			fallthrough
 		case MatchHMACSHA512:
-			_, err := CheckPayloadSignature512(req.Body, r.Secret, arg)
-			return err == nil, err
+			return r.checkHMAC(req, "sha512", arg)
 		}
 	}
 	return false, err
 }
 
+// checkHMAC verifies the payload signature of the request with the given
+// algorithm.
+func (r MatchRule) checkHMAC(req *Request, algorithm, signature string) (bool, error) {
+	prefix := algorithm + "="
+	if r.SignaturePrefix != nil {
+		prefix = *r.SignaturePrefix
+	}
+	payload := req.Body
+	if r.CanonicalString != "" {
+		var err error
+		if payload, err = r.canonicalString(req); err != nil {
+			return false, err
+		}
+	}
+	var mac string
+	ok, err := r.withSecrets(func(secret string) (bool, error) {
+		var err error
+		mac, err = CheckPayloadHMAC(algorithm, payload, secret, signature, prefix, r.SignatureEncoding)
+		return err == nil, err
+	})
+	if ok && r.SignatureTimestamp != nil {
+		err = r.checkSignatureTimestamp(req)
+	}
+	return req.validatedSignature(algorithm, mac, err)
+}
+
+// withSecrets runs the check with each secret of the rule until one of them
+// is accepted, so secrets can be rotated without rejecting deliveries. The
+// result of the last check is returned if none is accepted.
+func (r MatchRule) withSecrets(check func(secret string) (bool, error)) (bool, error) {
+	secrets := r.Secrets
+	if r.Secret != "" || len(secrets) == 0 {
+		secrets = append([]string{r.Secret}, secrets...)
+	}
+	var ok bool
+	var err error
+	for _, secret := range secrets {
+		if ok, err = check(secret); ok {
+			return ok, err
+		}
+	}
+	return ok, err
+}
+
+// clockSkew returns the tolerated clock skew of timestamped signatures.
+func (r MatchRule) clockSkew() time.Duration {
+	if r.ClockSkew <= 0 {
+		return DefaultClockSkew
+	}
+	return time.Duration(r.ClockSkew)
+}
+
 // compare is a helper function for constant time string comparisons.
 func compare(a, b string) bool {
 	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
@@ -0,0 +1,28 @@
+package hook
+
+// DefaultSampleMaxCount is the number of sampled requests kept per hook if
+// the sampling doesn't set a retention.
+const DefaultSampleMaxCount = 1000
+
+// RequestSampling persists a fraction of the raw requests of a hook to disk,
+// so deliveries which should have triggered the hook but didn't can be
+// investigated after the fact.
+type RequestSampling struct {
+	// Rate is the fraction of requests, between 0 and 1, which are persisted.
+	Rate float64 `json:"rate"`
+	// Directory receives a subdirectory per hook holding the sampled
+	// requests. Relative paths are resolved against the working directory
+	// of the command.
+	Directory string `json:"directory"`
+	// Retention limits the sampled requests kept for the hook, defaults to
+	// DefaultSampleMaxCount requests.
+	Retention *Retention `json:"retention,omitempty"`
+}
+
+// RetentionOrDefault returns the retention policy of the sampled requests.
+func (s *RequestSampling) RetentionOrDefault() *Retention {
+	if s.Retention == nil {
+		return &Retention{MaxCount: DefaultSampleMaxCount}
+	}
+	return s.Retention
+}
@@ -0,0 +1,12 @@
+package hook
+
+// Shadow is a command executed in parallel with the command of a hook, ie.
+// for testing a rewritten deploy script against real deliveries. Its result
+// is only logged.
+type Shadow struct {
+	// ExecuteCommand runs instead of the command of the hook, with the same
+	// arguments and environment.
+	ExecuteCommand string `json:"execute-command,omitempty"`
+	// Hook runs the command of the hook with this ID for the same request.
+	Hook string `json:"hook,omitempty"`
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/sha1"
 	"crypto/sha256"
 	"crypto/sha512"
+	"encoding/base64"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -48,19 +49,33 @@ func IsSignatureError(err error) bool {
 	}
 }
 
+// Constants for the encoding of payload signatures
+const (
+	SignatureEncodingHex    string = "hex"
+	SignatureEncodingBase64 string = "base64"
+)
+
 // ValidateMAC will verify that the expected mac for the given hash will match
 // the one provided.
 func ValidateMAC(payload []byte, mac hash.Hash, signatures []string) (string, error) {
+	return validateMAC(payload, mac, signatures, hex.EncodeToString)
+}
+
+// validateMAC verifies that one of the signatures matches the mac of the
+// payload in the given encoding. The mac is returned hex encoded.
+func validateMAC(payload []byte, mac hash.Hash, signatures []string, encode func([]byte) string) (string, error) {
 	// Write the payload to the provided hash.
 	_, err := mac.Write(payload)
 	if err != nil {
 		return "", err
 	}
 
-	actualMAC := hex.EncodeToString(mac.Sum(nil))
+	sum := mac.Sum(nil)
+	actualMAC := hex.EncodeToString(sum)
+	expected := encode(sum)
 
 	for _, signature := range signatures {
-		if hmac.Equal([]byte(signature), []byte(actualMAC)) {
+		if hmac.Equal([]byte(signature), []byte(expected)) {
 			return actualMAC, err
 		}
 	}
@@ -112,7 +127,102 @@ func CheckPayloadSignature512(payload []byte, secret, signature string) (string,
 	return ValidateMAC(payload, hmac.New(sha512.New, []byte(secret)), signatures)
 }
 
+// CheckPayloadHMAC calculates and verifies the HMAC signature of the payload
+// with the given algorithm (sha1, sha256 or sha512). The signatures are
+// extracted from signature with the prefix and compared in the encoding,
+// hex unless given. The mac is returned hex encoded.
+func CheckPayloadHMAC(algorithm string, payload []byte, secret, signature, prefix, encoding string) (string, error) {
+	if secret == "" {
+		return "", errors.New("signature validation secret can not be empty")
+	}
+
+	var fn func() hash.Hash
+	switch algorithm {
+	case "sha1":
+		fn = sha1.New
+	case "sha256":
+		fn = sha256.New
+	case "sha512":
+		fn = sha512.New
+	default:
+		return "", fmt.Errorf("unsupported signature algorithm: %s", algorithm)
+	}
+
+	var encode func([]byte) string
+	switch encoding {
+	case SignatureEncodingHex, "":
+		encode = hex.EncodeToString
+	case SignatureEncodingBase64:
+		encode = base64.StdEncoding.EncodeToString
+	default:
+		return "", fmt.Errorf("unsupported signature encoding: %s", encoding)
+	}
+
+	return validateMAC(payload, hmac.New(fn, []byte(secret)), ExtractSignatures(signature, prefix), encode)
+}
+
+// SignPayload calculates the HMAC signature of the payload with the given
+// algorithm (sha1, sha256 or sha512) and returns it in the algorithm=hex
+// notation used by the payload-hmac-* rules.
+func SignPayload(algorithm, secret string, payload []byte) (string, error) {
+	algorithm, mac, err := payloadMAC(algorithm, secret, payload)
+	if err != nil {
+		return "", err
+	}
+	return algorithm + "=" + hex.EncodeToString(mac), nil
+}
+
+// payloadMAC calculates the HMAC of the payload and returns it along with the
+// name of the algorithm used, which defaults to sha256.
+func payloadMAC(algorithm, secret string, payload []byte) (string, []byte, error) {
+	var fn func() hash.Hash
+	switch algorithm {
+	case "sha1":
+		fn = sha1.New
+	case "sha256", "":
+		algorithm = "sha256"
+		fn = sha256.New
+	case "sha512":
+		fn = sha512.New
+	default:
+		return "", nil, fmt.Errorf("unsupported signature algorithm: %s", algorithm)
+	}
+	if secret == "" {
+		return "", nil, errors.New("signing secret can not be empty")
+	}
+	mac := hmac.New(fn, []byte(secret))
+	_, _ = mac.Write(payload)
+	return algorithm, mac.Sum(nil), nil
+}
+
+// DefaultClockSkew is the maximum difference between the signing time of a
+// timestamped signature and the time it is checked, unless the rule sets a
+// clock skew.
+const DefaultClockSkew = 5 * time.Minute
+
+// checkTimestamp verifies that the signing time of a timestamped signature
+// is within the tolerated clock skew of now.
+func checkTimestamp(signed, now time.Time, skew time.Duration) error {
+	if math.Abs(float64(now.Sub(signed))) > float64(skew) {
+		return &SignatureError{Signature: "outdated"}
+	}
+	return nil
+}
+
+// CheckScalrSignature verifies the Scalr signature of the request and, if
+// checkDate is set, that it was signed within DefaultClockSkew.
 func CheckScalrSignature(r *Request, signingKey string, checkDate bool) (bool, error) {
+	var skew time.Duration
+	if checkDate {
+		skew = DefaultClockSkew
+	}
+	return CheckScalrSignatureWithin(r, signingKey, skew)
+}
+
+// CheckScalrSignatureWithin verifies the Scalr signature of the request and
+// that it was signed within the given clock skew. A zero skew doesn't check
+// the signing time.
+func CheckScalrSignatureWithin(r *Request, signingKey string, skew time.Duration) (bool, error) {
 	if r.Headers == nil {
 		return false, nil
 	}
@@ -139,7 +249,7 @@ func CheckScalrSignature(r *Request, signingKey string, checkDate bool) (bool, e
 		return false, &SignatureError{Signature: providedSignature}
 	}
 
-	if !checkDate {
+	if skew <= 0 {
 		return true, nil
 	}
 	// Example format: Fri 08 Sep 2017 11:24:32 UTC
@@ -147,11 +257,8 @@ func CheckScalrSignature(r *Request, signingKey string, checkDate bool) (bool, e
 	if err != nil {
 		return false, err
 	}
-	now := time.Now()
-	delta := math.Abs(now.Sub(date).Seconds())
-
-	if delta > 300 {
-		return false, &SignatureError{Signature: "outdated"}
+	if err := checkTimestamp(date, time.Now(), skew); err != nil {
+		return false, err
 	}
 	return true, nil
 }
@@ -0,0 +1,42 @@
+package hook
+
+// KafkaSource binds a hook to a Kafka topic. Every message consumed from the
+// topic is handled like an HTTP request to the hook, with the Kafka message
+// headers used as request headers.
+type KafkaSource struct {
+	Brokers     []string `json:"brokers,omitempty"`
+	Topic       string   `json:"topic,omitempty"`
+	GroupID     string   `json:"group-id,omitempty"`
+	ContentType string   `json:"content-type,omitempty"`
+}
+
+// MQTTSource subscribes a hook to an MQTT topic. Every message published on
+// the topic is handled like an HTTP request to the hook with the message as
+// the request body.
+type MQTTSource struct {
+	Broker      string     `json:"broker,omitempty"`
+	Topic       string     `json:"topic,omitempty"`
+	QoS         byte       `json:"qos,omitempty"`
+	ClientID    string     `json:"client-id,omitempty"`
+	Username    string     `json:"username,omitempty"`
+	Password    string     `json:"password,omitempty"`
+	ContentType string     `json:"content-type,omitempty"`
+	TLS         *TLSConfig `json:"tls,omitempty"`
+}
+
+// TLSConfig describes the client TLS settings used to connect to a broker.
+type TLSConfig struct {
+	CAFile             string `json:"ca-file,omitempty"`
+	CertFile           string `json:"cert-file,omitempty"`
+	KeyFile            string `json:"key-file,omitempty"`
+	InsecureSkipVerify bool   `json:"insecure-skip-verify,omitempty"`
+}
+
+// PubSubSource binds a hook to a Google Cloud Pub/Sub pull subscription.
+// Credentials are taken from the application default credentials.
+type PubSubSource struct {
+	Project                string `json:"project,omitempty"`
+	Subscription           string `json:"subscription,omitempty"`
+	ContentType            string `json:"content-type,omitempty"`
+	MaxOutstandingMessages int    `json:"max-outstanding-messages,omitempty"`
+}
@@ -0,0 +1,17 @@
+package hook
+
+import (
+	"regexp"
+	"strings"
+)
+
+// unsafeEnvChars matches the characters of tenant names replaced in the
+// prefix of their environment variables.
+var unsafeEnvChars = regexp.MustCompile(`[^A-Z0-9]`)
+
+// TenantEnvPrefix returns the prefix of the environment variables of the
+// tenant: its name in upper case with characters other than letters and
+// digits replaced by _, ie. TEAM_A_ for team-a.
+func TenantEnvPrefix(tenant string) string {
+	return unsafeEnvChars.ReplaceAllString(strings.ToUpper(tenant), "_") + "_"
+}
@@ -0,0 +1,80 @@
+package hook
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/itchyny/gojq"
+)
+
+// PayloadTransform is a jq program rewriting the payload of a request. The
+// program receives the payload as input and the request headers and query
+// as the $headers and $query variables, and has to yield an object.
+type PayloadTransform struct {
+	Program string
+
+	once sync.Once
+	code *gojq.Code
+	err  error
+}
+
+// UnmarshalJSON reads the program from a JSON string.
+func (t *PayloadTransform) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &t.Program)
+}
+
+// MarshalJSON writes the program as a JSON string.
+func (t *PayloadTransform) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.Program)
+}
+
+// compile parses and compiles the program on first use.
+func (t *PayloadTransform) compile() (*gojq.Code, error) {
+	t.once.Do(func() {
+		query, err := gojq.Parse(t.Program)
+		if err != nil {
+			t.err = fmt.Errorf("error parsing payload transform: %w", err)
+			return
+		}
+		t.code, err = gojq.Compile(query, gojq.WithVariables([]string{"$headers", "$query"}))
+		if err != nil {
+			t.err = fmt.Errorf("error compiling payload transform: %w", err)
+		}
+	})
+	return t.code, t.err
+}
+
+// TransformPayload replaces the payload of the request with the first
+// result of the transform program.
+func (r *Request) TransformPayload(t *PayloadTransform) error {
+	code, err := t.compile()
+	if err != nil {
+		return err
+	}
+	var payload interface{} = r.Payload
+	if r.Payload == nil {
+		payload = map[string]interface{}{}
+	}
+	headers, query := r.Headers, r.Query
+	if headers == nil {
+		headers = map[string]interface{}{}
+	}
+	if query == nil {
+		query = map[string]interface{}{}
+	}
+
+	result, ok := code.Run(payload, headers, query).Next()
+	if !ok {
+		return fmt.Errorf("payload transform yielded no result")
+	}
+	if err, ok := result.(error); ok {
+		return fmt.Errorf("error running payload transform: %w", err)
+	}
+	transformed, ok := result.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("payload transform yielded %T instead of an object", result)
+	}
+	r.Payload = transformed
+	return nil
+}
@@ -0,0 +1,156 @@
+package hook
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// Default keys used for XML attributes and text nodes, as chosen by the
+// default XML parser.
+const (
+	DefaultXMLAttributePrefix = "-"
+	DefaultXMLTextKey         = "#text"
+)
+
+// XMLPayload configures how XML payloads are mapped to parameter paths.
+type XMLPayload struct {
+	// AttributePrefix is prepended to attribute names, defaults to "-".
+	AttributePrefix string `json:"attribute-prefix,omitempty"`
+	// TextKey is the key of the text of elements which also have attributes
+	// or children, defaults to "#text".
+	TextKey string `json:"text-key,omitempty"`
+	// StripNamespaces drops namespace prefixes from element and attribute
+	// names along with the namespace declarations.
+	StripNamespaces bool `json:"strip-namespaces,omitempty"`
+	// ForceArray lists element names which are always mapped to an array,
+	// even if they occur only once.
+	ForceArray []string `json:"force-array,omitempty"`
+}
+
+// ParseXMLPayloadWithOptions parses the body as XML, mapping it according to
+// the given options.
+func (r *Request) ParseXMLPayloadWithOptions(o *XMLPayload) error {
+	body := r.Body
+	if !declaresXMLEncoding(body) {
+		var err error
+		if body, err = r.payloadBody(); err != nil {
+			return err
+		}
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	decoder.CharsetReader = charsetReader
+	payload, err := o.decode(decoder)
+	if err != nil {
+		return fmt.Errorf("error parsing XML payload: %+v", err)
+	}
+	r.Payload = payload
+	return nil
+}
+
+func (o *XMLPayload) decode(decoder *xml.Decoder) (map[string]interface{}, error) {
+	for {
+		// raw tokens keep the namespace prefixes instead of resolving them
+		t, err := decoder.RawToken()
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("no root element")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if start, ok := t.(xml.StartElement); ok {
+			value, err := o.decodeElement(decoder, start)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{o.name(start.Name): o.wrap(start.Name, value)}, nil
+		}
+	}
+}
+
+// decodeElement maps the element started by start. Elements with neither
+// attributes nor children are mapped to their text.
+func (o *XMLPayload) decodeElement(decoder *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	m := make(map[string]interface{})
+	prefix := o.AttributePrefix
+	if prefix == "" {
+		prefix = DefaultXMLAttributePrefix
+	}
+	for _, attr := range start.Attr {
+		if o.StripNamespaces && (attr.Name.Space == "xmlns" || attr.Name.Space == "" && attr.Name.Local == "xmlns") {
+			continue
+		}
+		m[prefix+o.name(attr.Name)] = attr.Value
+	}
+
+	var text strings.Builder
+	for {
+		t, err := decoder.RawToken()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		switch t := t.(type) {
+		case xml.StartElement:
+			value, err := o.decodeElement(decoder, t)
+			if err != nil {
+				return nil, err
+			}
+			o.addChild(m, t.Name, value)
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			content := strings.TrimSpace(text.String())
+			if len(m) == 0 {
+				return content, nil
+			}
+			if content != "" {
+				textKey := o.TextKey
+				if textKey == "" {
+					textKey = DefaultXMLTextKey
+				}
+				m[textKey] = content
+			}
+			return m, nil
+		}
+	}
+}
+
+// addChild stores the value of a child element, turning repeated elements
+// into an array.
+func (o *XMLPayload) addChild(m map[string]interface{}, name xml.Name, value interface{}) {
+	key := o.name(name)
+	existing, ok := m[key]
+	if !ok {
+		m[key] = o.wrap(name, value)
+		return
+	}
+	if arr, ok := existing.([]interface{}); ok {
+		m[key] = append(arr, value)
+		return
+	}
+	m[key] = []interface{}{existing, value}
+}
+
+// wrap returns the value of a first occurrence of an element, which is an
+// array for elements listed in ForceArray.
+func (o *XMLPayload) wrap(name xml.Name, value interface{}) interface{} {
+	if slices.Contains(o.ForceArray, o.name(name)) || slices.Contains(o.ForceArray, name.Local) {
+		return []interface{}{value}
+	}
+	return value
+}
+
+func (o *XMLPayload) name(name xml.Name) string {
+	if name.Space == "" || o.StripNamespaces {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
@@ -0,0 +1,52 @@
+package hook_manager
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+// expandArgumentSets replaces the references to the argument sets of a hooks
+// file in the arguments, environment and files passed to the commands with
+// the arguments of the sets.
+func expandArgumentSets(hooks Hooks, sets map[string][]hook.Argument) error {
+	for _, name := range slices.Sorted(maps.Keys(sets)) {
+		for _, arg := range sets[name] {
+			if arg.Ref != "" {
+				return fmt.Errorf("argument set %s: argument sets can't reference other sets", name)
+			}
+		}
+	}
+	for i := range hooks {
+		h := &hooks[i]
+		for _, args := range []*[]hook.Argument{&h.PassArgumentsToCommand, &h.PassEnvironmentToCommand, &h.PassFileToCommand} {
+			expanded, err := expandArguments(*args, sets)
+			if err != nil {
+				return fmt.Errorf("hook %s: %w", h.ID, err)
+			}
+			*args = expanded
+		}
+	}
+	return nil
+}
+
+func expandArguments(args []hook.Argument, sets map[string][]hook.Argument) ([]hook.Argument, error) {
+	if args == nil {
+		return nil, nil
+	}
+	expanded := make([]hook.Argument, 0, len(args))
+	for _, arg := range args {
+		if arg.Ref == "" {
+			expanded = append(expanded, arg)
+			continue
+		}
+		set, ok := sets[arg.Ref]
+		if !ok {
+			return nil, fmt.Errorf("unknown argument set %q", arg.Ref)
+		}
+		expanded = append(expanded, set...)
+	}
+	return expanded, nil
+}
@@ -0,0 +1,61 @@
+package hook_manager
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+func TestHooksLoadArgumentSets(t *testing.T) {
+	load := func(content string) (Hooks, error) {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "hooks.json")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		var hooks Hooks
+		err := hooks.LoadFromFile(path, false)
+		return hooks, err
+	}
+
+	hooks, err := load(`{
+		"argument-sets": {
+			"github-common": [
+				{"source": "payload", "name": "repository.full_name", "envname": "REPO"},
+				{"source": "payload", "name": "after", "envname": "SHA"}
+			]
+		},
+		"hooks": [{
+			"id": "deploy",
+			"execute-command": "/bin/true",
+			"pass-arguments-to-command": [{"source": "string", "name": "deploy"}, {"ref": "github-common"}],
+			"pass-environment-to-command": [{"ref": "github-common"}, {"source": "header", "name": "X-Env"}]
+		}]
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := hooks.Match("deploy")
+	repo := hook.Argument{Source: "payload", Name: "repository.full_name", EnvName: "REPO"}
+	sha := hook.Argument{Source: "payload", Name: "after", EnvName: "SHA"}
+	if expected := []hook.Argument{{Source: "string", Name: "deploy"}, repo, sha}; !reflect.DeepEqual(h.PassArgumentsToCommand, expected) {
+		t.Errorf("expected arguments %+v, got %+v", expected, h.PassArgumentsToCommand)
+	}
+	if expected := []hook.Argument{repo, sha, {Source: "header", Name: "X-Env"}}; !reflect.DeepEqual(h.PassEnvironmentToCommand, expected) {
+		t.Errorf("expected environment %+v, got %+v", expected, h.PassEnvironmentToCommand)
+	}
+
+	for content, expected := range map[string]string{
+		`{"hooks": [{"id": "x", "pass-arguments-to-command": [{"ref": "missing"}]}]}`: `hook x: unknown argument set "missing"`,
+		`{"argument-sets": {"a": [{"ref": "b"}], "b": []}, "hooks": []}`:              "argument set a: argument sets can't reference other sets",
+		`[{"id": "x", "pass-environment-to-command": [{"ref": "missing"}]}]`:          `hook x: unknown argument set "missing"`,
+	} {
+		if _, err := load(content); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected error %q for %s, got %v", expected, content, err)
+		}
+	}
+}
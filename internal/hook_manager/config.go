@@ -0,0 +1,162 @@
+package hook_manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+// configuration is the set of hooks loaded from the hooks files. It is never
+// modified once it is in use: reloads build and validate a new configuration
+// and swap it in as a whole, so requests never see a partially updated state.
+type configuration struct {
+	files        HooksFiles
+	hooksInFiles map[string]Hooks
+	versions     map[string]FileVersion
+	loadedAt     time.Time
+	index        *index
+}
+
+func newConfiguration() *configuration {
+	return &configuration{
+		hooksInFiles: make(map[string]Hooks),
+		versions:     make(map[string]FileVersion),
+	}
+}
+
+// with returns a copy of the configuration with the hooks of the file
+// replaced, or added if the file is not part of the configuration yet.
+func (c *configuration) with(hooksFilePath string, hooks Hooks, version FileVersion) *configuration {
+	next := newConfiguration()
+	next.files = append(next.files, c.files...)
+	for filePath, hooks := range c.hooksInFiles {
+		next.hooksInFiles[filePath] = hooks
+		next.versions[filePath] = c.versions[filePath]
+	}
+	if _, ok := c.hooksInFiles[hooksFilePath]; !ok {
+		next.files = append(next.files, hooksFilePath)
+	}
+	next.hooksInFiles[hooksFilePath] = hooks
+	next.versions[hooksFilePath] = version
+	return next
+}
+
+// without returns a copy of the configuration without the file.
+func (c *configuration) without(hooksFilePath string) *configuration {
+	next := newConfiguration()
+	for _, filePath := range c.files {
+		if filePath != hooksFilePath {
+			next.files = append(next.files, filePath)
+			next.hooksInFiles[filePath] = c.hooksInFiles[filePath]
+			next.versions[filePath] = c.versions[filePath]
+		}
+	}
+	return next
+}
+
+// validate checks the hooks of all files together: ID patterns must compile,
+// no two hooks may share the same route, within a file or across files,
+// hooks must be served in the namespace of their tenant and may only refer
+// to hooks of their tenant.
+func (c *configuration) validate() error {
+	var result *multierror.Error
+	var all []*hook.Hook
+	seen := make(map[[3]string]string)
+	for _, hooksFilePath := range c.files {
+		hooks := c.hooksInFiles[hooksFilePath]
+		for i := range hooks {
+			h := &hooks[i]
+			all = append(all, h)
+			if err := h.ValidateIDPattern(); err != nil {
+				result = multierror.Append(result, fmt.Errorf("hook id=%s: %w", h.ID, err))
+			}
+			route := h.RouteKey()
+			if previous, ok := seen[route]; ok {
+				result = multierror.Append(result, fmt.Errorf("hook id=%s in %s has already been loaded from %s, check your hooks files for duplicate hooks ids", h.ID, hooksFilePath, previous))
+				continue
+			}
+			seen[route] = hooksFilePath
+		}
+	}
+	if err := validateNamespaces(all); err != nil {
+		result = multierror.Append(result, err)
+	}
+	if err := validateReferences(all); err != nil {
+		result = multierror.Append(result, err)
+	}
+	return result.ErrorOrNil()
+}
+
+// Diff lists the hooks added, removed or changed by a reload, by their route,
+// see routeName.
+type Diff struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	Changed []string `json:"changed"`
+}
+
+// Empty returns whether the reload didn't change any hooks.
+func (d Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// diff compares the hooks of the configurations.
+func (c *configuration) diff(next *configuration) Diff {
+	previous := c.routes()
+	d := Diff{Added: []string{}, Removed: []string{}, Changed: []string{}}
+	for name, h := range next.routes() {
+		old, ok := previous[name]
+		switch {
+		case !ok:
+			d.Added = append(d.Added, name)
+		case !sameHook(old, h):
+			d.Changed = append(d.Changed, name)
+		}
+		delete(previous, name)
+	}
+	for name := range previous {
+		d.Removed = append(d.Removed, name)
+	}
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+	sort.Strings(d.Changed)
+	return d
+}
+
+// sameHook returns whether the hooks are configured the same. They are
+// compared by their encoded configuration, as the patterns compiled when
+// loading them, like the templates of rules, differ between loads.
+func sameHook(a, b *hook.Hook) bool {
+	encodedA, errA := json.Marshal(a)
+	encodedB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(encodedA, encodedB)
+}
+
+// routes returns the hooks of the configuration by their route name.
+func (c *configuration) routes() map[string]*hook.Hook {
+	routes := make(map[string]*hook.Hook)
+	for _, hooksFilePath := range c.files {
+		hooks := c.hooksInFiles[hooksFilePath]
+		for i := range hooks {
+			routes[routeName(&hooks[i])] = &hooks[i]
+		}
+	}
+	return routes
+}
+
+// routeName identifies the hook across configurations: its ID, preceded by
+// its own URL prefix and host if it has them, ie. example.com/team-a/deploy.
+func routeName(h *hook.Hook) string {
+	name := strings.TrimPrefix(h.URLBase(), "/") + h.ID
+	if host := hook.RequestHost(h.Host); host != "" {
+		name = host + "/" + name
+	}
+	return name
+}
@@ -0,0 +1,74 @@
+package hook_manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ghodss/yaml"
+	yamlv2 "gopkg.in/yaml.v2"
+)
+
+// Formats of converted hooks files
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+)
+
+// Convert converts the contents of a JSON or YAML hooks file to the given
+// format. The hooks are decoded into their definitions and encoded again
+// without resolving references, groups or variables, so the converted file
+// loads the same hooks. Properties are written in the order of the hook
+// definition rather than the order of the original file.
+func Convert(file []byte, format string) ([]byte, error) {
+	if format != FormatJSON && format != FormatYAML {
+		return nil, fmt.Errorf("unsupported format: %s", format)
+	}
+
+	var document interface{}
+	if err := yaml.Unmarshal(file, &document); err != nil {
+		return nil, err
+	}
+	var decoded interface{}
+	if _, ok := document.(map[string]interface{}); ok {
+		var f hooksFile
+		if err := yaml.Unmarshal(file, &f); err != nil {
+			return nil, err
+		}
+		decoded = f
+	} else {
+		var hooks Hooks
+		if err := yaml.Unmarshal(file, &hooks); err != nil {
+			return nil, err
+		}
+		decoded = hooks
+	}
+
+	// the JSON encoding keeps the order of the struct fields, and commands
+	// are easier to read without escaped HTML characters
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(decoded); err != nil {
+		return nil, err
+	}
+	if format == FormatJSON {
+		return buf.Bytes(), nil
+	}
+
+	// ordered YAML documents are decoded from the JSON encoding, which is
+	// valid YAML
+	if _, ok := decoded.(hooksFile); ok {
+		var ordered yamlv2.MapSlice
+		if err := yamlv2.Unmarshal(buf.Bytes(), &ordered); err != nil {
+			return nil, err
+		}
+		return yamlv2.Marshal(ordered)
+	}
+	var ordered []yamlv2.MapSlice
+	if err := yamlv2.Unmarshal(buf.Bytes(), &ordered); err != nil {
+		return nil, err
+	}
+	return yamlv2.Marshal(ordered)
+}
@@ -0,0 +1,75 @@
+package hook_manager
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestConvert(t *testing.T) {
+	for _, path := range []string{"../../hooks.json.example", "../../hooks.yaml.example"} {
+		for _, format := range []string{FormatJSON, FormatYAML} {
+			t.Run(path+" to "+format, func(t *testing.T) {
+				file, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				converted, err := Convert(file, format)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var want, got Hooks
+				if err := want.load(path, file, false); err != nil {
+					t.Fatal(err)
+				}
+				if err := got.load(path, converted, false); err != nil {
+					t.Fatalf("couldn't load converted file: %s\n%s", err, converted)
+				}
+				if !reflect.DeepEqual(want, got) {
+					t.Errorf("converted file loads different hooks:\n%#v\n%#v", want, got)
+				}
+			})
+		}
+	}
+}
+
+func TestConvertKeepsReferences(t *testing.T) {
+	file := []byte(`{
+  "vars": {"base": "/srv"},
+  "rules": {"main": {"match": {"type": "value", "value": "main", "parameter": {"source": "payload", "name": "ref"}}}},
+  "hooks": [{"trigger-rule": {"ref": "main"}, "execute-command": "${vars.base}/deploy.sh", "id": "deploy", "timeout": "90s"}]
+}`)
+	converted, err := Convert(file, FormatYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `vars:
+  base: /srv
+rules:
+  main:
+    match:
+      type: value
+      value: main
+      parameter:
+        source: payload
+        name: ref
+hooks:
+- id: deploy
+  execute-command: ${vars.base}/deploy.sh
+  trigger-rule:
+    ref: main
+  timeout: 1m30s
+`
+	if string(converted) != want {
+		t.Errorf("unexpected conversion:\n%s", converted)
+	}
+
+	if _, err := Convert(file, "toml"); err == nil {
+		t.Error("expected an error for an unsupported format")
+	}
+	if converted, err := Convert([]byte(`[{"id": "a", "execute-command": "a && b"}]`), FormatJSON); err != nil || !bytes.Contains(converted, []byte(`"a && b"`)) {
+		t.Errorf("expected the command to be kept unescaped, got %s: %v", converted, err)
+	}
+}
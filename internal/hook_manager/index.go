@@ -0,0 +1,83 @@
+package hook_manager
+
+import (
+	"slices"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+// index looks up the hooks of a configuration without scanning all of them,
+// so installations with thousands of hooks don't pay for their number on
+// every request. It is built once the configuration is complete and, like
+// the configuration, never modified afterwards.
+type index struct {
+	// byID holds the first hook with the ID in the order of the files
+	byID map[string]*hook.Hook
+	// byTenant holds the first hook of the tenant with the ID
+	byTenant map[[2]string]*hook.Hook
+	// tenants lists the tenants of the hooks
+	tenants []string
+	// byRoute holds the hooks by host, URL base and ID, see hook.RouteKey
+	byRoute map[[3]string]*hook.Hook
+	// patterns holds the hooks with an ID pattern by host and URL base, in
+	// the order of the files
+	patterns map[[2]string][]*hook.Hook
+	// bases lists the URL bases of hooks with their own URL prefix
+	bases []string
+}
+
+// buildIndex indexes the hooks of the configuration.
+func (c *configuration) buildIndex() {
+	idx := &index{
+		byID:     make(map[string]*hook.Hook),
+		byTenant: make(map[[2]string]*hook.Hook),
+		byRoute:  make(map[[3]string]*hook.Hook),
+		patterns: make(map[[2]string][]*hook.Hook),
+	}
+	seenBases := make(map[string]bool)
+	for _, hooksFilePath := range c.files {
+		hooks := c.hooksInFiles[hooksFilePath]
+		for i := range hooks {
+			h := &hooks[i]
+			if _, ok := idx.byID[h.ID]; !ok {
+				idx.byID[h.ID] = h
+			}
+			if key := [2]string{h.Tenant, h.ID}; idx.byTenant[key] == nil {
+				idx.byTenant[key] = h
+			}
+			if h.Tenant != "" && !slices.Contains(idx.tenants, h.Tenant) {
+				idx.tenants = append(idx.tenants, h.Tenant)
+			}
+			route := h.RouteKey()
+			if _, ok := idx.byRoute[route]; !ok {
+				idx.byRoute[route] = h
+			}
+			if h.IsPattern() {
+				key := [2]string{route[0], route[1]}
+				idx.patterns[key] = append(idx.patterns[key], h)
+			}
+			if base := route[1]; base != "" && !seenBases[base] {
+				seenBases[base] = true
+				idx.bases = append(idx.bases, base)
+			}
+		}
+	}
+	c.index = idx
+}
+
+// matchRoute returns the hook with the exact ID bound to the host and served
+// under the URL base.
+func (idx *index) matchRoute(host, base, id string) *hook.Hook {
+	return idx.byRoute[[3]string{host, base, id}]
+}
+
+// matchPattern returns the first hook bound to the host and served under the
+// URL base whose ID pattern matches the ID.
+func (idx *index) matchPattern(host, base, id string) *hook.Hook {
+	for _, h := range idx.patterns[[2]string{host, base}] {
+		if ok, _ := h.MatchID(id); ok {
+			return h
+		}
+	}
+	return nil
+}
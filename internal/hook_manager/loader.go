@@ -27,31 +27,134 @@ func (h *Hooks) LoadFromFile(path string, asTemplate bool) error {
 	if e != nil {
 		return fmt.Errorf("error reading hooks file: [%s]: %w", path, e)
 	}
+	return h.load(path, file, asTemplate)
+}
 
+// load parses the contents of the hooks file read from path.
+func (h *Hooks) load(path string, file []byte, asTemplate bool) error {
+	// the tenant of the file scopes the environment variables available to
+	// the template, so it is determined before the template is executed
+	var tenant string
 	if asTemplate {
-		funcMap := template.FuncMap{"getenv": getenv}
-
-		tmpl, err := template.New("hooks").Funcs(funcMap).Parse(string(file))
+		tenant = templateTenant(file)
+		rendered, err := executeTemplate(path, file, tenantGetenv(tenant))
 		if err != nil {
-			return fmt.Errorf("error parsing hooks file: [%s]: %w", path, err)
+			return err
 		}
+		file = rendered
+	}
 
-		var buf bytes.Buffer
-		err = tmpl.Execute(&buf, nil)
-		if err != nil {
-			return fmt.Errorf("executing template on file [%s]: %w", path, err)
+	// files may be an object setting defaults for their hooks instead of
+	// a plain list of hooks
+	var document interface{}
+	if err := yaml.Unmarshal(file, &document); err != nil {
+		return err
+	}
+	var f hooksFile
+	if m, ok := document.(map[string]interface{}); ok {
+		if _, ok := m["vars"]; ok {
+			interpolated, err := interpolateVars(m)
+			if err != nil {
+				return fmt.Errorf("error interpolating vars in hooks file: [%s]: %w", path, err)
+			}
+			file = interpolated
+		}
+		if err := yaml.Unmarshal(file, &f); err != nil {
+			return err
+		}
+	} else if err := yaml.Unmarshal(file, &f.Hooks); err != nil {
+		return err
+	}
+	if asTemplate && f.Tenant != tenant {
+		return fmt.Errorf("error in hooks file: [%s]: the tenant must not depend on the template", path)
+	}
+	hooks := f.hooks()
+	if err := f.checkTenant(hooks); err != nil {
+		return fmt.Errorf("error in hooks file: [%s]: %w", path, err)
+	}
+	if err := resolveRules(hooks, f.Rules); err != nil {
+		return fmt.Errorf("error resolving rules in hooks file: [%s]: %w", path, err)
+	}
+	if err := expandArgumentSets(hooks, f.ArgumentSets); err != nil {
+		return fmt.Errorf("error expanding argument sets in hooks file: [%s]: %w", path, err)
+	}
+	for i := range hooks {
+		if err := hooks[i].Prepare(); err != nil {
+			return fmt.Errorf("error in hooks file: [%s]: hook id=%s: %w", path, hooks[i].ID, err)
 		}
+	}
+	*h = hooks
+	return nil
+}
 
-		file = buf.Bytes()
+// hooksFile is a hooks file with defaults applying to all of its hooks.
+type hooksFile struct {
+	// Vars are interpolated before the file is decoded, and are only kept
+	// when the file is converted.
+	Vars            map[string]interface{}     `json:"vars,omitempty"`
+	Tenant          string                     `json:"tenant,omitempty"`
+	URLPrefix       string                     `json:"url-prefix,omitempty"`
+	ResponseHeaders hook.ResponseHeaders       `json:"response-headers,omitempty"`
+	Rules           map[string]hook.Rules      `json:"rules,omitempty"`
+	ArgumentSets    map[string][]hook.Argument `json:"argument-sets,omitempty"`
+	Hooks           Hooks                      `json:"hooks,omitempty"`
+	Groups          []hookGroup                `json:"groups,omitempty"`
+}
+
+// hookGroup is a set of hooks sharing a trigger rule, ie. the signature and
+// IP rules of a provider.
+type hookGroup struct {
+	Name        string      `json:"name,omitempty"`
+	TriggerRule *hook.Rules `json:"trigger-rule,omitempty"`
+	Hooks       Hooks       `json:"hooks"`
+}
+
+// hooks returns the hooks of the file and of its groups with the defaults
+// applied.
+func (f *hooksFile) hooks() Hooks {
+	hooks := f.Hooks
+	for _, g := range f.Groups {
+		for _, h := range g.Hooks {
+			h.TriggerRule = groupRule(g.TriggerRule, h.TriggerRule)
+			hooks = append(hooks, h)
+		}
 	}
+	for i := range hooks {
+		h := &hooks[i]
+		if h.Tenant == "" {
+			h.Tenant = f.Tenant
+		}
+		if h.URLPrefix == "" {
+			h.URLPrefix = f.URLPrefix
+		}
+		// hooks of a tenant are served in its namespace by default
+		if h.URLPrefix == "" {
+			h.URLPrefix = h.Tenant
+		}
+		h.ResponseHeaders = mergeHeaders(f.ResponseHeaders, h.ResponseHeaders)
+	}
+	return hooks
+}
 
-	return yaml.Unmarshal(file, h)
+// groupRule returns the trigger rule of a hook in a group: the rule of the
+// group has to be satisfied before the rule of the hook is evaluated, so
+// hooks can't drop it.
+func groupRule(group, own *hook.Rules) *hook.Rules {
+	switch {
+	case group == nil:
+		return own
+	case own == nil:
+		return group
+	default:
+		return &hook.Rules{And: &hook.AndRule{*group, *own}}
+	}
 }
 
 // Append appends hooks unless the new hooks contain a hook with an ID that already exists
+// for the same host and URL prefix
 func (h *Hooks) Append(other *Hooks) error {
 	for _, elem := range *other {
-		if h.Match(elem.ID) != nil {
+		if h.MatchRoute(hook.RequestHost(elem.Host), elem.URLBase(), elem.ID) != nil {
 			return fmt.Errorf("hook with ID %s is already defined", elem.ID)
 		}
 
@@ -73,6 +176,38 @@ func (h *Hooks) Match(id string) *hook.Hook {
 	return nil
 }
 
+// MatchRoute returns the first hook with the given ID which is bound to the
+// host, or to no host if the host is empty, and served under the URL base,
+// or under the global prefix if the base is empty. ID patterns are compared
+// as they are. If no hook matches, nil is returned.
+func (h *Hooks) MatchRoute(host, base, id string) *hook.Hook {
+	for i := range *h {
+		if (*h)[i].ID == id && (*h)[i].HasHost(host) && (*h)[i].URLBase() == base {
+			return &(*h)[i]
+		}
+	}
+
+	return nil
+}
+
+// executeTemplate executes the hooks file as a template, with getenv
+// retrieving the environment variables.
+func executeTemplate(path string, file []byte, getenv func(string) string) ([]byte, error) {
+	funcMap := template.FuncMap{"getenv": getenv}
+
+	tmpl, err := template.New("hooks").Funcs(funcMap).Parse(string(file))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing hooks file: [%s]: %w", path, err)
+	}
+
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, nil)
+	if err != nil {
+		return nil, fmt.Errorf("executing template on file [%s]: %w", path, err)
+	}
+	return buf.Bytes(), nil
+}
+
 // getenv provides a template function to retrieve OS environment variables.
 func getenv(s string) string {
 	return os.Getenv(s)
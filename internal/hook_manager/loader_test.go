@@ -2,7 +2,9 @@ package hook_manager
 
 import (
 	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
@@ -78,3 +80,88 @@ func TestHooksMatch(t *testing.T) {
 		}
 	}
 }
+
+func TestHooksLoadGroups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hooks.yaml")
+	if err := os.WriteFile(path, []byte(`
+hooks:
+  - id: standalone
+    execute-command: /bin/true
+groups:
+  - name: github
+    trigger-rule:
+      match:
+        type: ip-whitelist
+        ip-range: 192.0.2.0/24
+    hooks:
+      - id: deploy
+        execute-command: /bin/true
+        trigger-rule:
+          match:
+            type: value
+            value: refs/heads/main
+            parameter:
+              source: payload
+              name: ref
+      - id: build
+        execute-command: /bin/true
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var hooks Hooks
+	if err := hooks.LoadFromFile(path, false); err != nil {
+		t.Fatal(err)
+	}
+	if len(hooks) != 3 || hooks.Match("standalone").TriggerRule != nil {
+		t.Fatalf("unexpected hooks %+v", hooks)
+	}
+	build := hooks.Match("build").TriggerRule
+	if build == nil || build.Match == nil || build.Match.Type != hook.IPWhitelist {
+		t.Errorf("expected group rule for hook without rule, got %+v", build)
+	}
+	deploy := hooks.Match("deploy").TriggerRule
+	if deploy == nil || deploy.And == nil || len(*deploy.And) != 2 ||
+		(*deploy.And)[0].Match.Type != hook.IPWhitelist || (*deploy.And)[1].Match.Type != hook.MatchValue {
+		t.Errorf("expected group rule before the rule of the hook, got %+v", deploy)
+	}
+}
+
+func TestHooksLoadPrepares(t *testing.T) {
+	load := func(content string) (Hooks, error) {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "hooks.yaml")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		var hooks Hooks
+		err := hooks.LoadFromFile(path, false)
+		return hooks, err
+	}
+
+	hooks, err := load(`
+- id: deploy
+  execute-command: /bin/true
+  http-methods: [post, " GET "]
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if methods := hooks.Match("deploy").HTTPMethods; !reflect.DeepEqual(methods, []string{"POST", "GET"}) {
+		t.Errorf("expected normalized methods, got %v", methods)
+	}
+
+	_, err = load(`
+- id: deploy
+  execute-command: /bin/true
+  trigger-rule:
+    match:
+      type: regex
+      regex: "refs/(heads"
+      parameter:
+        source: payload
+        name: ref
+`)
+	if err == nil || !strings.Contains(err.Error(), "hook id=deploy: invalid regex rule") {
+		t.Errorf("expected the invalid regex to fail loading, got %v", err)
+	}
+}
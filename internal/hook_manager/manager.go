@@ -2,10 +2,13 @@ package hook_manager
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
-	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
@@ -14,27 +17,35 @@ import (
 	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
 )
 
+// ErrFileNotLoaded is returned when reloading a file which is not a loaded
+// hooks file.
+var ErrFileNotLoaded = errors.New("hooks file not loaded")
+
 type Manager struct {
-	ctx          context.Context
-	files        HooksFiles
-	logger       *slog.Logger
-	asTemplate   bool
-	hooksInFiles map[string]Hooks
-	watcher      *fsnotify.Watcher
-	notifyChan   chan struct{}
-	hotReload    bool
+	ctx        context.Context
+	files      HooksFiles
+	logger     *slog.Logger
+	asTemplate bool
+	config     atomic.Pointer[configuration]
+	reloadMu   sync.Mutex // serializes building new configurations
+	watcher    *fsnotify.Watcher
+	watched    map[string]string // resolved paths of the watched hooks files
+	notifyChan chan string
+	hotReload  bool
 }
 
 func NewManager(ctx context.Context, files HooksFiles, asTemplate bool, hotReload bool) *Manager {
-	return &Manager{
-		ctx:          ctx,
-		notifyChan:   make(chan struct{}, 5),
-		hooksInFiles: make(map[string]Hooks),
-		files:        files,
-		logger:       slog.Default(),
-		asTemplate:   asTemplate,
-		hotReload:    hotReload,
+	m := &Manager{
+		ctx:        ctx,
+		notifyChan: make(chan string, 5),
+		files:      files,
+		logger:     slog.Default(),
+		asTemplate: asTemplate,
+		hotReload:  hotReload,
 	}
+	m.store(newConfiguration())
+	go m.reloadWatcher()
+	return m
 }
 
 func (m *Manager) Start() error {
@@ -54,132 +65,251 @@ func (m *Manager) reloadWatcher() {
 		select {
 		case <-m.ctx.Done():
 			return
-		case <-m.notifyChan:
-			m.reloadAllHooks()
+		case hooksFilePath := <-m.notifyChan:
+			if hooksFilePath == "" {
+				_, _ = m.reloadAllHooks()
+			} else {
+				_, _ = m.reloadHooks(hooksFilePath)
+			}
 		}
 	}
 }
 
+// Load loads the hooks of all hooks files. Files which can't be loaded are
+// left out of the configuration, but all errors are returned.
 func (m *Manager) Load() error {
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
 	var result *multierror.Error
 
 	// load and parse hooks
+	config := newConfiguration()
 	for _, hooksFilePath := range m.files {
 		m.logger.Info("attempting to load hooks", "path", hooksFilePath)
-		newHooks := Hooks{}
-
-		err := newHooks.LoadFromFile(hooksFilePath, m.asTemplate)
+		newHooks, version, err := loadHooksFile(hooksFilePath, m.asTemplate)
 		if err != nil {
 			result = multierror.Append(result, err)
 			m.logger.Error("error loading hooks from file", "error", err)
-		} else {
-			m.logger.Info("loaded hook(s) from file", "path", hooksFilePath, "loaded", len(newHooks))
-
-			for _, h := range newHooks {
-				if m.matchLoadedHook(h.ID) != nil {
-					// fatal
-					result = multierror.Append(result, fmt.Errorf("hook id=%s has already been loaded, check your hooks file for duplicate hooks ids", h.ID))
-					m.logger.Error("hook has already been loaded! please check your hooks file for duplicate hooks ids!", "hook_id", h.ID)
-					continue
-				}
-				m.logger.Info("hook loaded", "hook_id", h.ID)
-			}
-			m.hooksInFiles[hooksFilePath] = newHooks
+			continue
+		}
+		m.logger.Info("loaded hook(s) from file", "path", hooksFilePath, "loaded", len(newHooks))
+		for _, h := range newHooks {
+			m.logger.Info("hook loaded", "hook_id", h.ID)
 		}
+		config = config.with(hooksFilePath, newHooks, version)
 	}
 
-	newHooksFiles := m.files[:0] // copy?
-	for _, filePath := range m.files {
-		if _, ok := m.hooksInFiles[filePath]; ok {
-			newHooksFiles = append(newHooksFiles, filePath)
-		}
+	if err := config.validate(); err != nil {
+		// fatal
+		result = multierror.Append(result, err)
+		m.logger.Error("invalid hooks configuration", "error", err)
 	}
-	m.files = newHooksFiles
+	config.loadedAt = time.Now()
+	m.store(config)
+	m.logger.Info("hooks configuration loaded", "checksum", config.version().Checksum)
 	return result.ErrorOrNil()
 }
 
+// store indexes the configuration and makes it the current one.
+func (m *Manager) store(config *configuration) {
+	config.buildIndex()
+	m.config.Store(config)
+}
+
+// Get returns the first hook with the ID in the order of the hooks files,
+// regardless of its host and URL prefix.
 func (m *Manager) Get(id string) *hook.Hook {
-	return m.matchLoadedHook(id)
+	return m.config.Load().index.byID[id]
+}
+
+// GetForTenant returns the first hook of the tenant with the ID in the order
+// of the hooks files. Hooks without a tenant belong to the empty tenant.
+func (m *Manager) GetForTenant(tenant, id string) *hook.Hook {
+	return m.config.Load().index.byTenant[[2]string{tenant, id}]
 }
 
-func (m *Manager) matchLoadedHook(id string) *hook.Hook {
-	for _, hooks := range m.hooksInFiles {
-		if h := hooks.Match(id); h != nil {
+// Tenants returns the tenants of the loaded hooks.
+func (m *Manager) Tenants() []string {
+	return m.config.Load().index.tenants
+}
+
+// GetForHost returns the hook addressed by the ID under the global URL
+// prefix for requests to the host. Hooks with the exact ID take precedence
+// over hooks with an ID pattern, and hooks bound to the host over hooks bound
+// to no host. Hooks bound to other hosts are never returned.
+func (m *Manager) GetForHost(host, id string) *hook.Hook {
+	return m.GetForPath(host, "", id)
+}
+
+// GetForPath is like GetForHost, but returns the hook with its own URL prefix
+// served at the base path, see hook.URLBase. An empty base refers to the
+// global URL prefix.
+func (m *Manager) GetForPath(host, base, id string) *hook.Hook {
+	config := m.config.Load()
+	host = hook.RequestHost(host)
+	hosts := []string{""}
+	if host != "" {
+		hosts = []string{host, ""}
+	}
+	for _, host := range hosts {
+		if h := config.index.matchRoute(host, base, id); h != nil {
+			return h
+		}
+	}
+	// patterns are matched in the order of the hooks files
+	for _, host := range hosts {
+		if h := config.index.matchPattern(host, base, id); h != nil {
 			return h
 		}
 	}
 	return nil
 }
 
-func (m *Manager) reloadHooks(hooksFilePath string) {
-	hooksInFile := Hooks{}
-	// parse and swap
-	m.logger.Info("attempting to reload hooks from file", "path", hooksFilePath)
-	err := hooksInFile.LoadFromFile(hooksFilePath, m.asTemplate)
+// GetByPath returns the hook with its own URL prefix served at the path for
+// requests to the host, along with the requested ID.
+func (m *Manager) GetByPath(host, path string) (*hook.Hook, string) {
+	for _, base := range m.config.Load().index.bases {
+		if !strings.HasPrefix(path, base) {
+			continue
+		}
+		id := strings.TrimPrefix(path, base)
+		if found := m.GetForPath(host, base, id); found != nil {
+			return found, id
+		}
+	}
+	return nil, ""
+}
 
-	if err != nil {
-		m.logger.Error("error loading hooks from file", "error", err, "path", hooksFilePath)
-	} else {
-		seenHooksIds := make(map[string]bool)
-		m.logger.Info("found hook(s) in file", "path", hooksFilePath, "loaded", len(hooksInFile))
-		for _, h := range hooksInFile {
-			wasHookIDAlreadyLoaded := false
-
-			for _, loadedHook := range m.hooksInFiles[hooksFilePath] {
-				if loadedHook.ID == h.ID {
-					wasHookIDAlreadyLoaded = true
-					break
-				}
-			}
+// Hooks returns all loaded hooks in the order of the hooks files.
+func (m *Manager) Hooks() []*hook.Hook {
+	config := m.config.Load()
+	var result []*hook.Hook
+	for _, hooksFilePath := range config.files {
+		hooks := config.hooksInFiles[hooksFilePath]
+		for i := range hooks {
+			result = append(result, &hooks[i])
+		}
+	}
+	return result
+}
 
-			if (m.matchLoadedHook(h.ID) != nil && !wasHookIDAlreadyLoaded) || seenHooksIds[h.ID] {
-				m.logger.Error("hook has already been loaded! please check your hooks file for duplicate hooks ids!", "hook_id", h.ID)
-				m.logger.Warn("reverting hooks back to the previous configuration")
-				return
-			}
+// swap validates the new configuration together with the hooks of all other
+// files and replaces the current configuration with it. Invalid
+// configurations are discarded, keeping the current one.
+func (m *Manager) swap(next *configuration) (Diff, error) {
+	if err := next.validate(); err != nil {
+		m.logger.Error("invalid hooks configuration", "error", err)
+		m.logger.Warn("reverting hooks back to the previous configuration")
+		return Diff{}, err
+	}
+	d := m.config.Load().diff(next)
+	next.loadedAt = time.Now()
+	m.store(next)
+	m.logger.Info("hooks reloaded",
+		"added", d.Added,
+		"removed", d.Removed,
+		"changed", d.Changed,
+		"checksum", next.version().Checksum,
+	)
+	return d, nil
+}
 
-			seenHooksIds[h.ID] = true
-			m.logger.Info("hook loaded", "hook_id", h.ID)
-		}
+// Reload reloads all hooks files at once and returns the changes of the
+// hooks. If any file can't be loaded, the hooks of all files are kept.
+func (m *Manager) Reload() (Diff, error) {
+	return m.reloadAllHooks()
+}
 
-		m.hooksInFiles[hooksFilePath] = hooksInFile
+// ReloadFile reloads the hooks of a single hooks file, leaving the hooks of
+// other files untouched, and returns the changes of the hooks.
+func (m *Manager) ReloadFile(hooksFilePath string) (Diff, error) {
+	loaded, err := m.loadedFile(hooksFilePath)
+	if err != nil {
+		return Diff{}, err
 	}
+	return m.reloadHooks(loaded)
 }
 
-func (m *Manager) reloadAllHooks() {
-	for _, hooksFilePath := range m.files {
-		m.reloadHooks(hooksFilePath)
+func (m *Manager) reloadHooks(hooksFilePath string) (Diff, error) {
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+
+	// parse and swap
+	m.logger.Info("attempting to reload hooks from file", "path", hooksFilePath)
+	hooksInFile, version, err := loadHooksFile(hooksFilePath, m.asTemplate)
+	if err != nil {
+		m.logger.Error("error loading hooks from file", "error", err, "path", hooksFilePath)
+		m.logger.Warn("reverting hooks back to the previous configuration")
+		return Diff{}, err
 	}
+	m.logger.Info("found hook(s) in file", "path", hooksFilePath, "loaded", len(hooksInFile))
+	return m.swap(m.config.Load().with(hooksFilePath, hooksInFile, version))
+}
+
+func (m *Manager) reloadAllHooks() (Diff, error) {
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+
+	next := m.config.Load()
+	for _, hooksFilePath := range next.files {
+		m.logger.Info("attempting to reload hooks from file", "path", hooksFilePath)
+		hooksInFile, version, err := loadHooksFile(hooksFilePath, m.asTemplate)
+		if err != nil {
+			m.logger.Error("error loading hooks from file", "error", err, "path", hooksFilePath)
+			m.logger.Warn("reverting hooks back to the previous configuration")
+			return Diff{}, err
+		}
+		m.logger.Info("found hook(s) in file", "path", hooksFilePath, "loaded", len(hooksInFile))
+		next = next.with(hooksFilePath, hooksInFile, version)
+	}
+	return m.swap(next)
 }
 
 func (m *Manager) removeHooks(hooksFilePath string) {
-	fileSourceToRemove := m.hooksInFiles[hooksFilePath]
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+
+	config := m.config.Load()
+	fileSourceToRemove := config.hooksInFiles[hooksFilePath]
 	for _, h := range fileSourceToRemove {
 		m.logger.Info("removing hook", "hook_id", h.ID)
 	}
-	// removes fileSourceToRemove from the file list
-	newHooksFiles := m.files[:0]
-	for _, filePath := range m.files {
-		if filePath != hooksFilePath {
-			newHooksFiles = append(newHooksFiles, filePath)
-		}
-	}
-	m.files = newHooksFiles
-
-	// removes fileSourceToRemove from the hooksInFiles map
-	removedHooksCount := len(fileSourceToRemove)
-	delete(m.hooksInFiles, hooksFilePath)
-	m.logger.Info("removed hooks", "count", removedHooksCount, "file_source", hooksFilePath)
+	// removing hooks can't introduce conflicts, no need to validate
+	next := config.without(hooksFilePath)
+	next.loadedAt = time.Now()
+	m.store(next)
+	m.logger.Info("removed hooks", "count", len(fileSourceToRemove), "file_source", hooksFilePath, "checksum", next.version().Checksum)
 }
 
 // Notify sends a notification to the manager that the hooks should be reloaded
 func (m *Manager) Notify() {
-	m.notifyChan <- struct{}{}
+	m.notifyChan <- ""
+}
+
+// NotifyFile sends a notification to the manager that the hooks of a single
+// hooks file should be reloaded, leaving the hooks of other files untouched.
+func (m *Manager) NotifyFile(hooksFilePath string) error {
+	loaded, err := m.loadedFile(hooksFilePath)
+	if err != nil {
+		return err
+	}
+	m.notifyChan <- loaded
+	return nil
+}
+
+// loadedFile returns the path the hooks file was loaded with.
+func (m *Manager) loadedFile(hooksFilePath string) (string, error) {
+	for _, loaded := range m.config.Load().files {
+		if filepath.Clean(loaded) == filepath.Clean(hooksFilePath) {
+			return loaded, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrFileNotLoaded, hooksFilePath)
 }
 
 func (m *Manager) Len() int {
 	sum := 0
-	for _, hooks := range m.hooksInFiles {
+	for _, hooks := range m.config.Load().hooksInFiles {
 		sum += len(hooks)
 	}
 	return sum
@@ -191,64 +321,6 @@ func (m *Manager) Close() {
 	}
 }
 
-func (m *Manager) StartFileWatcher() error {
-	var err error
-	m.watcher, err = fsnotify.NewWatcher()
-	if err != nil {
-		m.logger.Error("error creating file watcher instance", "error", err)
-		return err
-	}
-	for _, hooksFilePath := range m.files {
-		// set up file watcher
-		m.logger.Info("setting up watcher", "file", hooksFilePath)
-
-		err = m.watcher.Add(hooksFilePath)
-		if err != nil {
-			m.logger.Error("error adding hooks file to the watcher", "error", err, "file", hooksFilePath)
-			return err
-		}
-	}
-
-	go m.watchForFileChange(m.ctx)
-	return nil
-}
-
-func (m *Manager) watchForFileChange(ctx context.Context) {
-	watcher := m.watcher
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case event := <-watcher.Events:
-			if event.Op&fsnotify.Write == fsnotify.Write {
-				m.logger.Info("hooks file modified", "file", event.Name)
-				m.reloadHooks(event.Name)
-			} else if event.Op&fsnotify.Remove == fsnotify.Remove {
-				if _, err := os.Stat(event.Name); os.IsNotExist(err) {
-					m.logger.Info("hooks file removed, no longer watching this file for changes, removing hooks that were loaded from it", "file", event.Name)
-					_ = watcher.Remove(event.Name)
-					m.removeHooks(event.Name)
-				}
-			} else if event.Op&fsnotify.Rename == fsnotify.Rename {
-				time.Sleep(100 * time.Millisecond)
-				if _, err := os.Stat(event.Name); os.IsNotExist(err) {
-					// the file was removed
-					m.logger.Info("hooks file removed, no longer watching this file for changes, removing hooks that were loaded from it", "file", event.Name)
-					_ = watcher.Remove(event.Name)
-					m.removeHooks(event.Name)
-				} else {
-					m.logger.Info("hooks file overwritten, reloading hooks", "file", event.Name)
-					m.reloadHooks(event.Name)
-					_ = watcher.Remove(event.Name)
-					_ = watcher.Add(event.Name)
-				}
-			}
-		case err := <-watcher.Errors:
-			m.logger.Error("watcher error", "error", err)
-		}
-	}
-}
-
 // HooksFiles is a slice of String
 type HooksFiles []string
 
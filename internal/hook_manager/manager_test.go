@@ -0,0 +1,373 @@
+package hook_manager
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestManagerNotifyFile(t *testing.T) {
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "first.json"), filepath.Join(dir, "second.json")
+	write := func(path, id string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(`[{"id": "`+id+`", "execute-command": "/bin/true"}]`), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(first, "a")
+	write(second, "b")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewManager(ctx, HooksFiles{first, second}, false, false)
+	if err := m.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	write(first, "a2")
+	write(second, "b2")
+	if err := m.NotifyFile(filepath.Join(dir, ".", "first.json")); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.NotifyFile(filepath.Join(dir, "third.json")); !errors.Is(err, ErrFileNotLoaded) {
+		t.Errorf("expected ErrFileNotLoaded for unknown file, got %v", err)
+	}
+
+	// notifications are processed in the background
+	deadline := time.Now().Add(5 * time.Second)
+	for m.Get("a2") == nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if m.Get("a2") == nil {
+		t.Fatal("expected first hooks file to be reloaded")
+	}
+	if m.Get("b") == nil || m.Get("b2") != nil {
+		t.Error("expected second hooks file not to be reloaded")
+	}
+}
+
+func TestManagerGetForHost(t *testing.T) {
+	hooksFile := filepath.Join(t.TempDir(), "hooks.json")
+	if err := os.WriteFile(hooksFile, []byte(`[
+		{"id": "deploy", "execute-command": "/bin/default"},
+		{"id": "deploy", "host": "team-a.example.com", "execute-command": "/bin/team-a"},
+		{"id": "status", "host": "Team-B.example.com", "execute-command": "/bin/team-b"}
+	]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewManager(ctx, HooksFiles{hooksFile}, false, false)
+	if err := m.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		host, id, command string
+	}{
+		{"team-a.example.com", "deploy", "/bin/team-a"},
+		{"TEAM-A.example.com.:9000", "deploy", "/bin/team-a"},
+		{"team-b.example.com", "deploy", "/bin/default"},
+		{"", "deploy", "/bin/default"},
+		{"team-b.example.com:9000", "status", "/bin/team-b"},
+		{"team-a.example.com", "status", ""},
+		{"", "status", ""},
+	} {
+		h := m.GetForHost(tt.host, tt.id)
+		command := ""
+		if h != nil {
+			command = h.ExecuteCommand
+		}
+		if command != tt.command {
+			t.Errorf("expected %q for %s on %q, got %q", tt.command, tt.id, tt.host, command)
+		}
+	}
+}
+
+func TestManagerGetByPath(t *testing.T) {
+	dir := t.TempDir()
+	legacy, namespaced := filepath.Join(dir, "legacy.json"), filepath.Join(dir, "namespaced.yaml")
+	if err := os.WriteFile(legacy, []byte(`[{"id": "deploy", "execute-command": "/bin/legacy"}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(namespaced, []byte(`
+url-prefix: /team-a/hooks/
+hooks:
+  - id: deploy
+    execute-command: /bin/team-a
+  - id: deploy
+    url-prefix: v2
+    execute-command: /bin/v2
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewManager(ctx, HooksFiles{legacy, namespaced}, false, false)
+	if err := m.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if h := m.GetForHost("", "deploy"); h == nil || h.ExecuteCommand != "/bin/legacy" {
+		t.Errorf("expected legacy hook under the global prefix, got %+v", h)
+	}
+	for path, command := range map[string]string{
+		"/team-a/hooks/deploy": "/bin/team-a",
+		"/v2/deploy":           "/bin/v2",
+		"/hooks/deploy":        "",
+		"/team-a/hooks/other":  "",
+	} {
+		h, _ := m.GetByPath("", path)
+		if (h == nil && command != "") || (h != nil && h.ExecuteCommand != command) {
+			t.Errorf("expected %q for %s, got %+v", command, path, h)
+		}
+	}
+}
+
+func TestManagerGetIndex(t *testing.T) {
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "first.json"), filepath.Join(dir, "second.json")
+	if err := os.WriteFile(first, []byte(`[{"id": "deploy", "url-prefix": "a", "execute-command": "/bin/first"}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(second, []byte(`[{"id": "deploy", "url-prefix": "b", "execute-command": "/bin/second"}, {"id": "build", "execute-command": "/bin/build"}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewManager(ctx, HooksFiles{first, second}, false, false)
+	if h := m.Get("deploy"); h != nil {
+		t.Errorf("expected no hooks before loading, got %+v", h)
+	}
+	if err := m.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	// hooks sharing an ID are found in the order of the files
+	for i := 0; i < 10; i++ {
+		if h := m.Get("deploy"); h == nil || h.ExecuteCommand != "/bin/first" {
+			t.Fatalf("expected hook of the first file, got %+v", h)
+		}
+	}
+	if h := m.GetForPath("", "/b/", "deploy"); h == nil || h.ExecuteCommand != "/bin/second" {
+		t.Errorf("expected hook under its URL prefix, got %+v", h)
+	}
+
+	// the index follows changes of the configuration
+	m.removeHooks(first)
+	if h := m.Get("deploy"); h == nil || h.ExecuteCommand != "/bin/second" {
+		t.Errorf("expected hook of the second file after removing the first, got %+v", h)
+	}
+	if h, _ := m.GetByPath("", "/a/deploy"); h != nil {
+		t.Errorf("expected removed hook not to be found, got %+v", h)
+	}
+	if err := os.WriteFile(second, []byte(`[{"id": "test", "execute-command": "/bin/test"}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.ReloadFile(second); err != nil {
+		t.Fatal(err)
+	}
+	if m.Get("deploy") != nil || m.Get("build") != nil || m.Get("test") == nil {
+		t.Error("expected the index to be rebuilt on reload")
+	}
+}
+
+func TestManagerGetPattern(t *testing.T) {
+	hooksFile := filepath.Join(t.TempDir(), "hooks.json")
+	if err := os.WriteFile(hooksFile, []byte(`[
+		{"id": "deploy/*", "execute-command": "/bin/any"},
+		{"id": "deploy/app", "execute-command": "/bin/app"},
+		{"id": "deploy-regex", "id-regex": "deploy/(staging|prod)", "execute-command": "/bin/env"}
+	]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewManager(ctx, HooksFiles{hooksFile}, false, false)
+	if err := m.Load(); err != nil {
+		t.Fatal(err)
+	}
+	for id, command := range map[string]string{
+		"deploy/app":  "/bin/app",
+		"deploy/prod": "/bin/any",
+		"deploy/":     "",
+		"other":       "",
+	} {
+		h := m.GetForHost("", id)
+		if (h == nil && command != "") || (h != nil && h.ExecuteCommand != command) {
+			t.Errorf("expected %q for %s, got %+v", command, id, h)
+		}
+	}
+}
+
+func TestManagerReloadAtomic(t *testing.T) {
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "first.json"), filepath.Join(dir, "second.json")
+	write := func(path, content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(first, `[{"id": "a"}]`)
+	write(second, `[{"id": "b"}]`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewManager(ctx, HooksFiles{first, second}, false, false)
+	if err := m.Load(); err != nil {
+		t.Fatal(err)
+	}
+	unchanged := func(desc string) {
+		t.Helper()
+		if m.Get("a") == nil || m.Get("b") == nil || m.Len() != 2 {
+			t.Errorf("%s: expected the previous configuration to be kept", desc)
+		}
+	}
+
+	// a broken file keeps the valid edits of other files from being applied
+	write(first, `[{"id": "a2"}]`)
+	write(second, `[{"id": `)
+	if _, err := m.Reload(); err == nil {
+		t.Error("expected reload of broken file to fail")
+	}
+	unchanged("broken file")
+	if m.Get("a2") != nil {
+		t.Error("expected the edit of the first file not to be applied")
+	}
+
+	// duplicates across files are detected for the complete configuration
+	write(first, `[{"id": "a"}]`)
+	write(second, `[{"id": "a"}]`)
+	if _, err := m.ReloadFile(second); err == nil {
+		t.Error("expected reload of duplicate across files to fail")
+	}
+	if _, err := m.Reload(); err == nil {
+		t.Error("expected reload of duplicate across files to fail")
+	}
+	unchanged("duplicate across files")
+
+	write(second, `[{"id": "c"}, {"id": "c"}]`)
+	if _, err := m.ReloadFile(second); err == nil {
+		t.Error("expected reload of duplicate within file to fail")
+	}
+	unchanged("duplicate within file")
+
+	write(first, `[{"id": "b2"}]`)
+	write(second, `[{"id": "a2"}]`)
+	if _, err := m.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if m.Get("a2") == nil || m.Get("b2") == nil || m.Get("a") != nil || m.Get("b") != nil {
+		t.Error("expected the hooks to be swapped between the files")
+	}
+}
+
+func TestManagerLoadDuplicates(t *testing.T) {
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "first.json"), filepath.Join(dir, "second.json")
+	for _, path := range []string{first, second} {
+		if err := os.WriteFile(path, []byte(`[{"id": "a"}]`), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewManager(ctx, HooksFiles{first, second}, false, false)
+	err := m.Load()
+	if err == nil || !strings.Contains(err.Error(), "hook id=a in "+second+" has already been loaded from "+first) {
+		t.Errorf("expected duplicate error, got %v", err)
+	}
+}
+
+func TestManagerReloadDiff(t *testing.T) {
+	hooksFile := filepath.Join(t.TempDir(), "hooks.json")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(hooksFile, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	kept := `{"id": "kept", "execute-command": "/bin/true", "trigger-rule": {"and": [
+			{"match": {"type": "regex", "regex": "^refs/heads/", "parameter": {"source": "payload", "name": "ref"}}},
+			{"match": {"type": "payload-hmac-sha256", "secret": "s", "canonical-string": "{{ body }}", "parameter": {"source": "header", "name": "X-Signature"}}}
+		]}}`
+	write(`[
+		` + kept + `,
+		{"id": "changed", "execute-command": "/bin/true"},
+		{"id": "removed", "execute-command": "/bin/true"}
+	]`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewManager(ctx, HooksFiles{hooksFile}, false, false)
+	if err := m.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	write(`[
+		` + kept + `,
+		{"id": "changed", "execute-command": "/bin/false"},
+		{"id": "added", "host": "Example.com", "url-prefix": "team-a", "execute-command": "/bin/true"}
+	]`)
+	d, err := m.ReloadFile(hooksFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Diff{Added: []string{"example.com/team-a/added"}, Removed: []string{"removed"}, Changed: []string{"changed"}}
+	if !reflect.DeepEqual(d, expected) {
+		t.Errorf("expected diff %+v, got %+v", expected, d)
+	}
+
+	if d, err := m.Reload(); err != nil || !d.Empty() {
+		t.Errorf("expected empty diff, got %+v, %v", d, err)
+	}
+	if _, err := m.ReloadFile("other.json"); !errors.Is(err, ErrFileNotLoaded) {
+		t.Errorf("expected ErrFileNotLoaded for unknown file, got %v", err)
+	}
+}
+
+func TestManagerVersion(t *testing.T) {
+	hooksFile := filepath.Join(t.TempDir(), "hooks.json")
+	content := []byte(`[{"id": "a", "execute-command": "/bin/true"}]`)
+	if err := os.WriteFile(hooksFile, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewManager(ctx, HooksFiles{hooksFile}, false, false)
+	if err := m.Load(); err != nil {
+		t.Fatal(err)
+	}
+	v := m.Version()
+	fileSum := sha256.Sum256(content)
+	if len(v.Files) != 1 || v.Files[0].Path != hooksFile || v.Files[0].Checksum != hex.EncodeToString(fileSum[:]) {
+		t.Fatalf("unexpected file versions %+v", v.Files)
+	}
+	sum := sha256.Sum256([]byte(hex.EncodeToString(fileSum[:]) + "  " + hooksFile + "\n"))
+	if v.Checksum != hex.EncodeToString(sum[:]) {
+		t.Errorf("expected aggregate checksum %x, got %s", sum, v.Checksum)
+	}
+	if v.LoadedAt.IsZero() || v.Files[0].LoadedAt.IsZero() {
+		t.Error("expected load times to be set")
+	}
+
+	if err := os.WriteFile(hooksFile, []byte(`[{"id": "b", "execute-command": "/bin/true"}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if m.Version().Checksum == v.Checksum {
+		t.Error("expected the checksum to change on reload")
+	}
+}
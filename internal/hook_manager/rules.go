@@ -0,0 +1,108 @@
+package hook_manager
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+// ruleResolver replaces references to the named rules of a hooks file with
+// the rules themselves.
+type ruleResolver struct {
+	named    map[string]hook.Rules
+	resolved map[string]*hook.Rules
+	// path holds the names of the rules being resolved, for reporting cycles
+	path []string
+}
+
+// resolveRules resolves the references in the named rules and in the trigger
+// rules of the hooks. All named rules are resolved, so unknown references and
+// cycles are reported even if a rule is not used by any hook.
+func resolveRules(hooks Hooks, named map[string]hook.Rules) error {
+	r := &ruleResolver{named: named, resolved: make(map[string]*hook.Rules)}
+	for _, name := range slices.Sorted(maps.Keys(named)) {
+		if _, err := r.resolveRef(name); err != nil {
+			return err
+		}
+	}
+	for i := range hooks {
+		if hooks[i].TriggerRule == nil {
+			continue
+		}
+		rule, err := r.resolve(*hooks[i].TriggerRule)
+		if err != nil {
+			return fmt.Errorf("hook %s: %w", hooks[i].ID, err)
+		}
+		hooks[i].TriggerRule = &rule
+	}
+	return nil
+}
+
+func (r *ruleResolver) resolveRef(name string) (hook.Rules, error) {
+	if rule, ok := r.resolved[name]; ok {
+		return *rule, nil
+	}
+	for i, n := range r.path {
+		if n == name {
+			return hook.Rules{}, fmt.Errorf("rule cycle: %s -> %s", strings.Join(r.path[i:], " -> "), name)
+		}
+	}
+	rule, ok := r.named[name]
+	if !ok {
+		return hook.Rules{}, fmt.Errorf("unknown rule %q", name)
+	}
+	r.path = append(r.path, name)
+	resolved, err := r.resolve(rule)
+	r.path = r.path[:len(r.path)-1]
+	if err != nil {
+		return hook.Rules{}, err
+	}
+	r.resolved[name] = &resolved
+	return resolved, nil
+}
+
+// resolve returns a copy of the rule with all references replaced.
+func (r *ruleResolver) resolve(rule hook.Rules) (hook.Rules, error) {
+	switch {
+	case rule.And != nil:
+		children, err := r.resolveAll(*rule.And)
+		if err != nil {
+			return hook.Rules{}, err
+		}
+		and := hook.AndRule(children)
+		return hook.Rules{And: &and}, nil
+	case rule.Or != nil:
+		children, err := r.resolveAll(*rule.Or)
+		if err != nil {
+			return hook.Rules{}, err
+		}
+		or := hook.OrRule(children)
+		return hook.Rules{Or: &or}, nil
+	case rule.Not != nil:
+		child, err := r.resolve(hook.Rules(*rule.Not))
+		if err != nil {
+			return hook.Rules{}, err
+		}
+		not := hook.NotRule(child)
+		return hook.Rules{Not: &not}, nil
+	case rule.Match != nil, rule.AuthProxy != nil:
+		return rule, nil
+	case rule.Ref != "":
+		return r.resolveRef(rule.Ref)
+	}
+	return rule, nil
+}
+
+func (r *ruleResolver) resolveAll(rules []hook.Rules) ([]hook.Rules, error) {
+	resolved := make([]hook.Rules, len(rules))
+	for i, rule := range rules {
+		var err error
+		if resolved[i], err = r.resolve(rule); err != nil {
+			return nil, err
+		}
+	}
+	return resolved, nil
+}
@@ -0,0 +1,72 @@
+package hook_manager
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+func TestHooksLoadNamedRules(t *testing.T) {
+	load := func(content string) (Hooks, error) {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "hooks.yaml")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		var hooks Hooks
+		err := hooks.LoadFromFile(path, false)
+		return hooks, err
+	}
+
+	hooks, err := load(`
+rules:
+  office:
+    match:
+      type: ip-whitelist
+      ip-range: 192.0.2.0/24
+  main-from-office:
+    and:
+      - ref: office
+      - match:
+          type: value
+          value: refs/heads/main
+          parameter:
+            source: payload
+            name: ref
+hooks:
+  - id: deploy
+    execute-command: /bin/true
+    trigger-rule:
+      ref: main-from-office
+  - id: status
+    execute-command: /bin/true
+    trigger-rule:
+      not:
+        ref: office
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deploy := hooks.Match("deploy").TriggerRule
+	if deploy == nil || deploy.And == nil || (*deploy.And)[0].Match == nil || (*deploy.And)[0].Match.Type != hook.IPWhitelist {
+		t.Errorf("expected nested reference to be resolved, got %+v", deploy)
+	}
+	status := hooks.Match("status").TriggerRule
+	if status == nil || status.Not == nil || status.Not.Match == nil || status.Not.Ref != "" {
+		t.Errorf("expected reference in not rule to be resolved, got %+v", status)
+	}
+
+	for content, expected := range map[string]string{
+		`{"rules": {"a": {"ref": "b"}, "b": {"or": [{"ref": "a"}]}}, "hooks": []}`: "rule cycle: a -> b -> a",
+		`{"rules": {"a": {"ref": "a"}}, "hooks": []}`:                              "rule cycle: a -> a",
+		`{"hooks": [{"id": "x", "trigger-rule": {"ref": "missing"}}]}`:             `hook x: unknown rule "missing"`,
+		`[{"id": "x", "trigger-rule": {"ref": "missing"}}]`:                        `hook x: unknown rule "missing"`,
+	} {
+		if _, err := load(content); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected error %q for %s, got %v", expected, content, err)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package hook_manager
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/hashicorp/go-multierror"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+// templateTenant returns the tenant of a templated hooks file, read from the
+// file rendered without environment variables.
+func templateTenant(file []byte) string {
+	rendered, err := executeTemplate("", file, func(string) string { return "" })
+	if err != nil {
+		return ""
+	}
+	var f struct {
+		Tenant string `json:"tenant"`
+	}
+	if err := yaml.Unmarshal(rendered, &f); err != nil {
+		return ""
+	}
+	return f.Tenant
+}
+
+// tenantGetenv returns the getenv template function for the files of the
+// tenant. Tenants only see the environment variables prefixed with their
+// name, ie. getenv "GITHUB_SECRET" returns TEAM_A_GITHUB_SECRET for tenant
+// team-a, so they can't read the secrets of other tenants.
+func tenantGetenv(tenant string) func(string) string {
+	if tenant == "" {
+		return getenv
+	}
+	prefix := hook.TenantEnvPrefix(tenant)
+	return func(s string) string {
+		return os.Getenv(prefix + s)
+	}
+}
+
+// checkTenant ensures hooks in the file of a tenant belong to it.
+func (f *hooksFile) checkTenant(hooks Hooks) error {
+	if f.Tenant == "" {
+		return nil
+	}
+	for _, h := range hooks {
+		if h.Tenant != f.Tenant {
+			return fmt.Errorf("hook %s: tenant %s differs from the tenant %s of the file", h.ID, h.Tenant, f.Tenant)
+		}
+	}
+	return nil
+}
+
+// tenantNamespace returns the path the URL prefixes of the hooks of the
+// tenant have to start with.
+func tenantNamespace(tenant string) string {
+	return "/" + strings.Trim(tenant, "/") + "/"
+}
+
+// validateNamespaces ensures the hooks of tenants are served in the namespace
+// of their tenant, and no other hooks are.
+func validateNamespaces(hooks []*hook.Hook) error {
+	tenants := make(map[string]bool)
+	for _, h := range hooks {
+		if h.Tenant != "" {
+			tenants[tenantNamespace(h.Tenant)] = true
+		}
+	}
+	for _, h := range hooks {
+		base := h.URLBase()
+		if h.Tenant != "" {
+			if !strings.HasPrefix(base, tenantNamespace(h.Tenant)) {
+				return fmt.Errorf("hook id=%s of tenant %s is served outside of its namespace %s", h.ID, h.Tenant, tenantNamespace(h.Tenant))
+			}
+			continue
+		}
+		for namespace := range tenants {
+			if strings.HasPrefix(base, namespace) {
+				return fmt.Errorf("hook id=%s is served in the namespace %s of a tenant", h.ID, namespace)
+			}
+		}
+	}
+	return nil
+}
+
+// validateReferences ensures the hooks chained to or shadowing a hook belong
+// to its tenant, as they are run with its request. References to hooks which
+// don't exist are reported when running them.
+func validateReferences(hooks []*hook.Hook) error {
+	tenants := make(map[string][]string)
+	for _, h := range hooks {
+		if !slices.Contains(tenants[h.ID], h.Tenant) {
+			tenants[h.ID] = append(tenants[h.ID], h.Tenant)
+		}
+	}
+	var result *multierror.Error
+	for _, h := range hooks {
+		refs := slices.Concat(h.OnSuccess, h.OnFailure)
+		if h.Shadow != nil && h.Shadow.Hook != "" {
+			refs = append(refs, h.Shadow.Hook)
+		}
+		for _, ref := range refs {
+			if owners := tenants[ref]; len(owners) > 0 && !slices.Contains(owners, h.Tenant) {
+				result = multierror.Append(result, fmt.Errorf("hook id=%s refers to hook %s of another tenant", h.ID, ref))
+			}
+		}
+	}
+	return result.ErrorOrNil()
+}
+
+// mergeHeaders returns the default headers followed by the headers of the
+// hook, leaving out defaults the hook sets itself.
+func mergeHeaders(defaults, own hook.ResponseHeaders) hook.ResponseHeaders {
+	if len(defaults) == 0 {
+		return own
+	}
+	set := make(map[string]bool, len(own))
+	for _, header := range own {
+		set[http.CanonicalHeaderKey(header.Name)] = true
+	}
+	var merged hook.ResponseHeaders
+	for _, header := range defaults {
+		if !set[http.CanonicalHeaderKey(header.Name)] {
+			merged = append(merged, header)
+		}
+	}
+	return append(merged, own...)
+}
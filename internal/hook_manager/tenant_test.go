@@ -0,0 +1,141 @@
+package hook_manager
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+func TestHooksLoadTenant(t *testing.T) {
+	load := func(content string, asTemplate bool) (Hooks, error) {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "hooks.yaml")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		var hooks Hooks
+		err := hooks.LoadFromFile(path, asTemplate)
+		return hooks, err
+	}
+	t.Setenv("SECRET", "global")
+	t.Setenv("TEAM_A_SECRET", "team-a")
+	t.Setenv("TENANT", "team-b")
+
+	hooks, err := load(`
+tenant: team-a
+response-headers:
+  - name: X-Team
+    value: team-a
+  - name: Cache-Control
+    value: no-store
+hooks:
+  - id: deploy
+    execute-command: /bin/true
+    response-headers:
+      - name: cache-control
+        value: no-cache
+    trigger-rule:
+      match:
+        type: value
+        value: '{{ getenv "SECRET" }}'
+        parameter:
+          source: header
+          name: X-Token
+  - id: status
+    url-prefix: team-a/status
+    execute-command: /bin/true
+`, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deploy, status := hooks.Match("deploy"), hooks.Match("status")
+	if deploy.Tenant != "team-a" || deploy.URLBase() != "/team-a/" || status.URLBase() != "/team-a/status/" {
+		t.Errorf("unexpected tenant %q and URL bases %q, %q", deploy.Tenant, deploy.URLBase(), status.URLBase())
+	}
+	expected := hook.ResponseHeaders{{Name: "X-Team", Value: "team-a"}, {Name: "cache-control", Value: "no-cache"}}
+	if !reflect.DeepEqual(deploy.ResponseHeaders, expected) {
+		t.Errorf("expected headers %+v, got %+v", expected, deploy.ResponseHeaders)
+	}
+	if value := deploy.TriggerRule.Match.Value; value != "team-a" {
+		t.Errorf("expected the environment of the tenant, got %q", value)
+	}
+
+	for content, expected := range map[string]string{
+		`{"tenant": '{{ getenv "TENANT" }}', "hooks": []}`:            "the tenant must not depend on the template",
+		`{"tenant": "team-a", "hooks": [{"id": "x", "tenant": "b"}]}`: "hook x: tenant b differs from the tenant team-a of the file",
+	} {
+		if _, err := load(content, true); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected error %q for %s, got %v", expected, content, err)
+		}
+	}
+}
+
+func TestManagerTenantNamespaces(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for content, expected := range map[string]string{
+		`{"tenant": "team-a", "hooks": [{"id": "x", "url-prefix": "team-b"}]}`:   "hook id=x of tenant team-a is served outside of its namespace /team-a/",
+		`[{"id": "x", "tenant": "team-a"}, {"id": "y", "url-prefix": "team-a"}]`: "hook id=y is served in the namespace /team-a/ of a tenant",
+	} {
+		path := filepath.Join(dir, "hooks.json")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		m := NewManager(ctx, HooksFiles{path}, false, false)
+		if err := m.Load(); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected error %q for %s, got %v", expected, content, err)
+		}
+	}
+}
+
+func TestManagerTenantReferences(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	load := func(files map[string]string) (*Manager, error) {
+		t.Helper()
+		var paths HooksFiles
+		for name, content := range files {
+			path := filepath.Join(dir, name)
+			if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			paths = append(paths, path)
+		}
+		m := NewManager(ctx, paths, false, false)
+		return m, m.Load()
+	}
+	teamB := `{"tenant": "team-b", "hooks": [{"id": "notify"}, {"id": "rewrite"}]}`
+
+	for content, expected := range map[string]string{
+		`{"tenant": "team-a", "hooks": [{"id": "deploy", "on-success": ["notify"]}]}`:      "hook id=deploy refers to hook notify of another tenant",
+		`{"tenant": "team-a", "hooks": [{"id": "deploy", "on-failure": ["notify"]}]}`:      "hook id=deploy refers to hook notify of another tenant",
+		`{"tenant": "team-a", "hooks": [{"id": "deploy", "shadow": {"hook": "rewrite"}}]}`: "hook id=deploy refers to hook rewrite of another tenant",
+		`[{"id": "deploy", "on-success": ["notify"]}]`:                                     "hook id=deploy refers to hook notify of another tenant",
+	} {
+		if _, err := load(map[string]string{"a.json": content, "b.json": teamB}); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected error %q for %s, got %v", expected, content, err)
+		}
+	}
+
+	// hooks of other tenants sharing the ID don't take the place of the own
+	m, err := load(map[string]string{
+		"a.json": `{"tenant": "team-a", "hooks": [{"id": "deploy", "on-success": ["notify", "missing"]}, {"id": "notify"}]}`,
+		"b.json": teamB,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := m.GetForTenant("team-a", "notify"); h == nil || h.Tenant != "team-a" {
+		t.Errorf("expected the notify hook of team-a, got %+v", h)
+	}
+	if tenants := m.Tenants(); len(tenants) != 2 {
+		t.Errorf("expected both tenants, got %v", tenants)
+	}
+}
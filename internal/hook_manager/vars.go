@@ -0,0 +1,60 @@
+package hook_manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+)
+
+// varReference matches references to the variables of a hooks file.
+var varReference = regexp.MustCompile(`\$\{vars\.([A-Za-z0-9_.-]+)\}`)
+
+// interpolateVars replaces the references to the variables defined under
+// vars in all string values of the hooks file document, and returns the
+// document without the variables as JSON.
+func interpolateVars(document map[string]interface{}) ([]byte, error) {
+	vars, ok := document["vars"].(map[string]interface{})
+	if !ok && document["vars"] != nil {
+		return nil, fmt.Errorf("vars must be an object")
+	}
+	values := make(map[string]string, len(vars))
+	for name, value := range vars {
+		switch value.(type) {
+		case string, float64, int, int64, bool:
+			values[name] = fmt.Sprint(value)
+		default:
+			return nil, fmt.Errorf("variable %s must be a string, number or boolean", name)
+		}
+	}
+	delete(document, "vars")
+
+	var err error
+	var interpolate func(v interface{}) interface{}
+	interpolate = func(v interface{}) interface{} {
+		switch v := v.(type) {
+		case string:
+			return varReference.ReplaceAllStringFunc(v, func(ref string) string {
+				name := varReference.FindStringSubmatch(ref)[1]
+				value, ok := values[name]
+				if !ok && err == nil {
+					err = fmt.Errorf("undefined variable %q", name)
+				}
+				return value
+			})
+		case map[string]interface{}:
+			for k, child := range v {
+				v[k] = interpolate(child)
+			}
+		case []interface{}:
+			for i, child := range v {
+				v[i] = interpolate(child)
+			}
+		}
+		return v
+	}
+	interpolate(document)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(document)
+}
@@ -0,0 +1,70 @@
+package hook_manager
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHooksLoadVars(t *testing.T) {
+	load := func(name, content string, asTemplate bool) (Hooks, error) {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		var hooks Hooks
+		err := hooks.LoadFromFile(path, asTemplate)
+		return hooks, err
+	}
+
+	hooks, err := load("hooks.yaml", `
+vars:
+  base: /srv/team-a
+  team: team-a
+  retries: 3
+hooks:
+  - id: ${vars.team}-deploy
+    execute-command: ${vars.base}/deploy.sh
+    command-working-directory: ${vars.base}
+    pass-arguments-to-command:
+      - source: string
+        name: --retries=${vars.retries}
+`, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := hooks.Match("team-a-deploy")
+	if h == nil {
+		t.Fatal("expected the ID to be interpolated")
+	}
+	if h.ExecuteCommand != "/srv/team-a/deploy.sh" || h.CommandWorkingDirectory != "/srv/team-a" {
+		t.Errorf("unexpected command %q in %q", h.ExecuteCommand, h.CommandWorkingDirectory)
+	}
+	if name := h.PassArgumentsToCommand[0].Name; name != "--retries=3" {
+		t.Errorf("expected argument --retries=3, got %q", name)
+	}
+
+	// vars are interpolated after the template is executed
+	hooks, err = load("hooks.json", `{
+		"vars": {"base": "{{ "/srv" }}"},
+		"hooks": [{"id": "x", "execute-command": "${vars.base}/x.sh"}]
+	}`, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd := hooks.Match("x").ExecuteCommand; cmd != "/srv/x.sh" {
+		t.Errorf("expected command /srv/x.sh, got %q", cmd)
+	}
+
+	for content, expected := range map[string]string{
+		`{"vars": {}, "hooks": [{"id": "${vars.missing}"}]}`: `undefined variable "missing"`,
+		`{"vars": {"a": ["b"]}, "hooks": []}`:                "variable a must be a string, number or boolean",
+		`{"vars": ["a"], "hooks": []}`:                       "vars must be an object",
+	} {
+		if _, err := load("hooks.json", content, false); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected error %q for %s, got %v", expected, content, err)
+		}
+	}
+}
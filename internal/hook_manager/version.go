@@ -0,0 +1,65 @@
+package hook_manager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Version identifies the loaded configuration, so automation can verify that
+// a configuration change converged on all instances.
+type Version struct {
+	// Checksum is the SHA-256 of the checksums of all files in the format of
+	// sha256sum, one "<checksum>  <path>" line per file in the order of the
+	// hooks files.
+	Checksum string        `json:"checksum"`
+	LoadedAt time.Time     `json:"loaded_at"`
+	Files    []FileVersion `json:"files"`
+}
+
+// FileVersion identifies the loaded contents of a hooks file.
+type FileVersion struct {
+	Path string `json:"path"`
+	// Checksum is the SHA-256 of the file contents before executing them as
+	// a template.
+	Checksum string    `json:"checksum"`
+	LoadedAt time.Time `json:"loaded_at"`
+}
+
+// Version returns the version of the loaded configuration.
+func (m *Manager) Version() Version {
+	return m.config.Load().version()
+}
+
+func (c *configuration) version() Version {
+	v := Version{LoadedAt: c.loadedAt, Files: make([]FileVersion, 0, len(c.files))}
+	sum := sha256.New()
+	for _, hooksFilePath := range c.files {
+		fv := c.versions[hooksFilePath]
+		v.Files = append(v.Files, fv)
+		_, _ = fmt.Fprintf(sum, "%s  %s\n", fv.Checksum, fv.Path)
+	}
+	v.Checksum = hex.EncodeToString(sum.Sum(nil))
+	return v
+}
+
+// loadHooksFile loads the hooks of the file along with the version of its
+// contents.
+func loadHooksFile(hooksFilePath string, asTemplate bool) (Hooks, FileVersion, error) {
+	file, err := os.ReadFile(hooksFilePath)
+	if err != nil {
+		return nil, FileVersion{}, fmt.Errorf("error reading hooks file: [%s]: %w", hooksFilePath, err)
+	}
+	hooks := Hooks{}
+	if err := hooks.load(hooksFilePath, file, asTemplate); err != nil {
+		return nil, FileVersion{}, err
+	}
+	checksum := sha256.Sum256(file)
+	return hooks, FileVersion{
+		Path:     hooksFilePath,
+		Checksum: hex.EncodeToString(checksum[:]),
+		LoadedAt: time.Now(),
+	}, nil
+}
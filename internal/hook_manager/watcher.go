@@ -0,0 +1,114 @@
+package hook_manager
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// StartFileWatcher watches the hooks files for changes. The directories of
+// the files are watched rather than the files themselves, and the paths are
+// resolved again on every change, so files replaced by renames or by swapping
+// a symlink, like the ..data symlink of Kubernetes ConfigMap volumes, are
+// reloaded as well.
+func (m *Manager) StartFileWatcher() error {
+	var err error
+	m.watcher, err = fsnotify.NewWatcher()
+	if err != nil {
+		m.logger.Error("error creating file watcher instance", "error", err)
+		return err
+	}
+	m.watched = make(map[string]string)
+	for _, hooksFilePath := range m.config.Load().files {
+		// set up file watcher
+		m.logger.Info("setting up watcher", "file", hooksFilePath)
+
+		if err = m.watch(hooksFilePath); err != nil {
+			m.logger.Error("error adding hooks file to the watcher", "error", err, "file", hooksFilePath)
+			return err
+		}
+	}
+
+	go m.watchForFileChange(m.ctx)
+	return nil
+}
+
+// watch adds the directories of the hooks file and of the file it resolves to
+// to the watcher.
+func (m *Manager) watch(hooksFilePath string) error {
+	resolved, err := filepath.EvalSymlinks(hooksFilePath)
+	if err != nil {
+		return err
+	}
+	m.watched[hooksFilePath] = resolved
+	if err := m.watcher.Add(filepath.Dir(hooksFilePath)); err != nil {
+		return err
+	}
+	if filepath.Dir(resolved) != filepath.Dir(hooksFilePath) {
+		return m.watcher.Add(filepath.Dir(resolved))
+	}
+	return nil
+}
+
+func (m *Manager) watchForFileChange(ctx context.Context) {
+	watcher := m.watcher
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			for hooksFilePath := range m.watched {
+				m.handleFileEvent(hooksFilePath, event)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			m.logger.Error("watcher error", "error", err)
+		}
+	}
+}
+
+// handleFileEvent reloads or removes the hooks of the file if the event
+// in one of the watched directories changed it.
+func (m *Manager) handleFileEvent(hooksFilePath string, event fsnotify.Event) {
+	previous := m.watched[hooksFilePath]
+	name := filepath.Clean(event.Name)
+	concernsFile := name == filepath.Clean(hooksFilePath) || name == previous
+
+	resolved, err := filepath.EvalSymlinks(hooksFilePath)
+	if os.IsNotExist(err) && concernsFile && event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+		// editors replacing the file may rename it away before the new one
+		// is in place
+		time.Sleep(100 * time.Millisecond)
+		resolved, err = filepath.EvalSymlinks(hooksFilePath)
+		if os.IsNotExist(err) {
+			m.logger.Info("hooks file removed, no longer watching this file for changes, removing hooks that were loaded from it", "file", hooksFilePath)
+			delete(m.watched, hooksFilePath)
+			m.removeHooks(hooksFilePath)
+			return
+		}
+	}
+	if err != nil {
+		return
+	}
+
+	switch {
+	case resolved != previous:
+		m.logger.Info("hooks file replaced, reloading hooks", "file", hooksFilePath, "resolved", resolved)
+		if err := m.watch(hooksFilePath); err != nil {
+			m.logger.Error("error adding hooks file to the watcher", "error", err, "file", hooksFilePath)
+		}
+	case concernsFile && event.Op&(fsnotify.Write|fsnotify.Create) != 0:
+		m.logger.Info("hooks file modified", "file", hooksFilePath)
+	default:
+		return
+	}
+	_, _ = m.reloadHooks(hooksFilePath)
+}
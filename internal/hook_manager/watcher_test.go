@@ -0,0 +1,112 @@
+package hook_manager
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestManagerWatchConfigMap replaces the hooks file the way the kubelet
+// updates ConfigMap volumes: the file is a symlink into ..data, which is
+// atomically swapped to a new directory.
+func TestManagerWatchConfigMap(t *testing.T) {
+	dir := t.TempDir()
+	version := func(name, id string) {
+		t.Helper()
+		if err := os.Mkdir(filepath.Join(dir, name), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		content := []byte(`[{"id": "` + id + `", "execute-command": "/bin/true"}]`)
+		if err := os.WriteFile(filepath.Join(dir, name, "hooks.json"), content, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	version("..2026_01_01", "a")
+	if err := os.Symlink("..2026_01_01", filepath.Join(dir, "..data")); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+	hooksFile := filepath.Join(dir, "hooks.json")
+	if err := os.Symlink(filepath.Join("..data", "hooks.json"), hooksFile); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewManager(ctx, HooksFiles{hooksFile}, false, true)
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if m.Get("a") == nil {
+		t.Fatal("expected hook a to be loaded")
+	}
+
+	version("..2026_01_02", "b")
+	if err := os.Symlink("..2026_01_02", filepath.Join(dir, "..data_tmp")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(filepath.Join(dir, "..2026_01_01")); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for m.Get("b") == nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if m.Get("b") == nil || m.Get("a") != nil {
+		t.Error("expected the swapped hooks file to be reloaded")
+	}
+}
+
+func TestManagerWatchFile(t *testing.T) {
+	dir := t.TempDir()
+	hooksFile := filepath.Join(dir, "hooks.json")
+	write := func(path, id string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(`[{"id": "`+id+`", "execute-command": "/bin/true"}]`), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(hooksFile, "a")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewManager(ctx, HooksFiles{hooksFile}, false, true)
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	waitFor := func(done func() bool) bool {
+		deadline := time.Now().Add(5 * time.Second)
+		for !done() && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		return done()
+	}
+
+	write(hooksFile, "b")
+	if !waitFor(func() bool { return m.Get("b") != nil }) {
+		t.Fatal("expected the written hooks file to be reloaded")
+	}
+
+	// replaced by renaming another file over it
+	write(filepath.Join(dir, "hooks.json.tmp"), "c")
+	if err := os.Rename(filepath.Join(dir, "hooks.json.tmp"), hooksFile); err != nil {
+		t.Fatal(err)
+	}
+	if !waitFor(func() bool { return m.Get("c") != nil }) {
+		t.Fatal("expected the replaced hooks file to be reloaded")
+	}
+
+	if err := os.Remove(hooksFile); err != nil {
+		t.Fatal(err)
+	}
+	if !waitFor(func() bool { return m.Len() == 0 }) {
+		t.Error("expected the hooks of the removed file to be removed")
+	}
+}
@@ -0,0 +1,208 @@
+// Package jwt verifies JSON Web Tokens signed with asymmetric keys, as issued
+// by OpenID Connect providers and authenticating proxies.
+package jwt
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	_ "crypto/sha256" // register hash functions used by the algorithms
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrInvalidToken is wrapped by all errors about tokens which are malformed,
+// badly signed or not valid according to their claims.
+var ErrInvalidToken = errors.New("invalid token")
+
+// Claims are the decoded claims of a token.
+type Claims map[string]interface{}
+
+// KeySet resolves the public key a token was signed with.
+type KeySet interface {
+	Key(ctx context.Context, kid string) (crypto.PublicKey, error)
+}
+
+// Validation describes the claims a token has to carry. Tokens always have to
+// carry an exp claim, so they can't be used forever.
+type Validation struct {
+	// Issuer is the expected iss claim, not checked if empty.
+	Issuer string
+	// Audience must be contained in the aud claim, not checked if empty.
+	Audience string
+	// Leeway is the tolerated clock skew when checking exp and nbf.
+	Leeway time.Duration
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verify checks the signature of a compact serialized token with the matching
+// key of the key set and validates its claims.
+func Verify(ctx context.Context, token string, keys KeySet, v Validation) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, fmt.Errorf("%w: header: %s", ErrInvalidToken, err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature: %s", ErrInvalidToken, err)
+	}
+
+	key, err := keys.Key(ctx, h.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(h.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidToken, err)
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: claims: %s", ErrInvalidToken, err)
+	}
+	if err := claims.validate(v, time.Now()); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidToken, err)
+	}
+	return claims, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// verifySignature checks the signature for one of the asymmetric algorithms.
+// Symmetric algorithms and unsigned tokens are rejected, as the keys are
+// public.
+func verifySignature(alg string, key crypto.PublicKey, signed, signature []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "PS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "PS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "PS512", "ES512":
+		hash = crypto.SHA512
+	case "EdDSA":
+		k, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return fmt.Errorf("key does not match algorithm %s", alg)
+		}
+		if !ed25519.Verify(k, signed, signature) {
+			return errors.New("signature mismatch")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if alg[0] == 'R' {
+			return rsa.VerifyPKCS1v15(k, hash, digest, signature)
+		}
+		if alg[0] == 'P' {
+			return rsa.VerifyPSS(k, hash, digest, signature, nil)
+		}
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if alg[0] != 'E' || len(signature) != 2*size {
+			break
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return errors.New("signature mismatch")
+		}
+		return nil
+	}
+	return fmt.Errorf("key does not match algorithm %s", alg)
+}
+
+func (c Claims) validate(v Validation, now time.Time) error {
+	exp, ok := c.time("exp")
+	if !ok {
+		return errors.New("token has no expiration time")
+	}
+	if !now.Before(exp.Add(v.Leeway)) {
+		return errors.New("token is expired")
+	}
+	if nbf, ok := c.time("nbf"); ok && now.Add(v.Leeway).Before(nbf) {
+		return errors.New("token is not valid yet")
+	}
+	if v.Issuer != "" && c["iss"] != v.Issuer {
+		return fmt.Errorf("unexpected issuer %v", c["iss"])
+	}
+	if v.Audience != "" && !slices.Contains(c.Audience(), v.Audience) {
+		return fmt.Errorf("unexpected audience %v", c["aud"])
+	}
+	return nil
+}
+
+// time returns a NumericDate claim.
+func (c Claims) time(name string) (time.Time, bool) {
+	n, ok := c[name].(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(f*float64(time.Second))), true
+}
+
+// Audience returns the aud claim, which may be a single string or a list.
+func (c Claims) Audience() []string {
+	switch aud := c["aud"].(type) {
+	case string:
+		return []string{aud}
+	case []interface{}:
+		var result []string
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+// Subject returns a human-readable identifier of the authenticated user: the
+// email address, the preferred username or else the subject.
+func (c Claims) Subject() string {
+	for _, name := range []string{"email", "preferred_username", "sub"} {
+		if s, ok := c[name].(string); ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
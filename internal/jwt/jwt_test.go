@@ -0,0 +1,141 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func encode(t *testing.T, v interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func sign(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]interface{}) string {
+	t.Helper()
+	signed := encode(t, map[string]string{"alg": alg, "kid": kid}) + "." + encode(t, claims)
+	var sig []byte
+	var err error
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(k, []byte(signed))
+	case *ecdsa.PrivateKey:
+		digest := crypto.SHA256.New()
+		digest.Write([]byte(signed))
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, k, digest.Sum(nil))
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	case *rsa.PrivateKey:
+		digest := crypto.SHA256.New()
+		digest.Write([]byte(signed))
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest.Sum(nil))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestVerify(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	ecPoint, _ := ecKey.PublicKey.Bytes()
+
+	fetches := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa", "n": base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()), "e": "AQAB"},
+			{"kty": "EC", "kid": "ec", "crv": "P-256",
+				"x": base64.RawURLEncoding.EncodeToString(ecPoint[1:33]),
+				"y": base64.RawURLEncoding.EncodeToString(ecPoint[33:])},
+			{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": base64.RawURLEncoding.EncodeToString(edKey.Public().(ed25519.PublicKey))},
+			{"kty": "oct", "kid": "secret", "k": "c2VjcmV0"},
+		}})
+	}))
+	defer srv.Close()
+	keys := Remote(srv.URL)
+	v := Validation{Issuer: "https://issuer.example", Audience: "webhook"}
+
+	valid := map[string]interface{}{
+		"iss":   "https://issuer.example",
+		"aud":   []string{"other", "webhook"},
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"email": "jane@example.com",
+	}
+	for _, tt := range []struct {
+		alg, kid string
+		key      crypto.Signer
+	}{
+		{"RS256", "rsa", rsaKey},
+		{"ES256", "ec", ecKey},
+		{"EdDSA", "ed", edKey},
+	} {
+		claims, err := Verify(context.Background(), sign(t, tt.alg, tt.kid, tt.key, valid), keys, v)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.alg, err)
+			continue
+		}
+		if claims.Subject() != "jane@example.com" {
+			t.Errorf("%s: unexpected subject %q", tt.alg, claims.Subject())
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("expected keys to be fetched once, got %d fetches", fetches)
+	}
+
+	expired := map[string]interface{}{"iss": valid["iss"], "aud": "webhook", "exp": time.Now().Add(-time.Minute).Unix()}
+	wrongAudience := map[string]interface{}{"iss": valid["iss"], "aud": "other", "exp": valid["exp"]}
+	noExpiration := map[string]interface{}{"iss": valid["iss"], "aud": "webhook"}
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	for desc, token := range map[string]string{
+		"expired":        sign(t, "RS256", "rsa", rsaKey, expired),
+		"wrong audience": sign(t, "RS256", "rsa", rsaKey, wrongAudience),
+		"no expiration":  sign(t, "RS256", "rsa", rsaKey, noExpiration),
+		"wrong key":      sign(t, "RS256", "rsa", otherKey, valid),
+		"wrong alg":      sign(t, "ES256", "rsa", ecKey, valid),
+		"unknown key":    sign(t, "RS256", "unknown", rsaKey, valid),
+		"malformed":      "not-a-token",
+		"unsigned":       encode(t, map[string]string{"alg": "none"}) + "." + encode(t, valid) + ".",
+	} {
+		if _, err := Verify(context.Background(), token, keys, v); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: expected ErrInvalidToken, got %v", desc, err)
+		}
+	}
+}
+
+func TestDiscoverKeySet(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/realms/ci/.well-known/openid-configuration" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(`{"issuer": "https://id.example/realms/ci", "jwks_uri": "https://id.example/realms/ci/certs"}`))
+	}))
+	defer srv.Close()
+
+	url, err := DiscoverKeySet(context.Background(), srv.URL+"/realms/ci/")
+	if err != nil || url != "https://id.example/realms/ci/certs" {
+		t.Errorf("expected discovered JWKS URL, got %q (%v)", url, err)
+	}
+	if _, err := DiscoverKeySet(context.Background(), srv.URL+"/unknown"); err == nil {
+		t.Error("expected error for missing discovery document")
+	}
+}
@@ -8,26 +8,35 @@ import (
 	"bytes"
 	"fmt"
 	"io"
-	"net"
+	"math/rand/v2"
 	"net/http"
 	"net/http/httputil"
+	"os"
+	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
 )
 
-// responseDupper tees the response to a buffer and a response writer.
-type responseDupper struct {
-	http.ResponseWriter
-	Buffer *bytes.Buffer
-	Status int
-}
+// dumpFileExt is the extension of request dumps written to a directory.
+const dumpFileExt = ".dump"
 
 // Dumper returns a debug middleware which prints detailed information about
 // incoming requests and outgoing responses including all headers, parameters
 // and bodies.
-func Dumper(w io.Writer) func(http.Handler) http.Handler {
+func Dumper(w io.Writer, options ...DumperOption) func(http.Handler) http.Handler {
+	o := newDumperOptions(options...)
+
 	return func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if !o.sampled() {
+				h.ServeHTTP(rw, r)
+				return
+			}
+
 			buf := &bytes.Buffer{}
 			// Request ID
 			rid := r.Context().Value(RequestIDKey)
@@ -46,67 +55,150 @@ func Dumper(w io.Writer) func(http.Handler) http.Handler {
 				buf.WriteString(sc.Text() + "\n")
 			}
 
-			_, _ = w.Write(buf.Bytes())
-			buf.Reset()
+			// dumps written to files keep request and response together
+			if o.dir == "" {
+				_, _ = w.Write(buf.Bytes())
+				buf.Reset()
+			}
 
 			// Dump Response
 
-			dupper := &responseDupper{ResponseWriter: rw, Buffer: &bytes.Buffer{}}
-			h.ServeHTTP(dupper, r)
+			// the wrapper keeps optional interfaces like http.Flusher and
+			// http.Hijacker intact, so streaming responses still work
+			ww := middleware.NewWrapResponseWriter(rw, r.ProtoMajor)
+			body := &bytes.Buffer{}
+			ww.Tee(body)
+			h.ServeHTTP(ww, r)
 
 			// Response Status
-			buf.WriteString(fmt.Sprintf("< [%s] %d %s\n", rid, dupper.Status, http.StatusText(dupper.Status)))
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			buf.WriteString(fmt.Sprintf("< [%s] %d %s\n", rid, status, http.StatusText(status)))
 
 			// Response Headers
-			keys := make([]string, len(dupper.Header()))
-			i := 0
-			for k := range dupper.Header() {
-				keys[i] = k
-				i++
+			keys := make([]string, 0, len(ww.Header()))
+			for k := range ww.Header() {
+				keys = append(keys, k)
 			}
 			sort.Strings(keys)
 			for _, k := range keys {
-				buf.WriteString(fmt.Sprintf("< [%s] %s: %s\n", rid, k, strings.Join(dupper.Header()[k], ", ")))
+				buf.WriteString(fmt.Sprintf("< [%s] %s: %s\n", rid, k, strings.Join(ww.Header()[k], ", ")))
 			}
 
 			// Response Body
-			if dupper.Buffer.Len() > 0 {
+			if body.Len() > 0 {
 				buf.WriteString(fmt.Sprintf("< [%s]\n", rid))
-				sc = bufio.NewScanner(dupper.Buffer)
+				sc = bufio.NewScanner(body)
 				sc.Split(bufio.ScanLines)
 				for sc.Scan() {
 					buf.WriteString(fmt.Sprintf("< [%s] ", rid))
 					buf.WriteString(sc.Text() + "\n")
 				}
 			}
-			_, _ = w.Write(buf.Bytes())
+
+			if o.dir == "" {
+				_, _ = w.Write(buf.Bytes())
+				return
+			}
+			if err := o.writeFile(GetReqID(r.Context()), buf.Bytes()); err != nil {
+				_, _ = fmt.Fprintf(w, "[%s] Error writing request dump: %s\n", rid, err)
+			}
 		})
 	}
 }
 
-// Write writes the data to the buffer and connection as part of an HTTP reply.
-func (r *responseDupper) Write(b []byte) (int, error) {
-	r.Buffer.Write(b)
-	return r.ResponseWriter.Write(b)
+// DumpDirOption writes every dump to its own file in the given directory
+// instead of the log writer.
+func DumpDirOption(dir string) DumperOption {
+	return func(o *DumperOptions) *DumperOptions {
+		o.dir = dir
+		return o
+	}
 }
 
-// WriteHeader records the status and sends an HTTP response header with status code.
-func (r *responseDupper) WriteHeader(s int) {
-	r.Status = s
-	r.ResponseWriter.WriteHeader(s)
+// DumpSampleRateOption sets the fraction of requests, between 0 and 1, which
+// are dumped.
+func DumpSampleRateOption(rate float64) DumperOption {
+	return func(o *DumperOptions) *DumperOptions {
+		o.sampleRate = rate
+		return o
+	}
 }
 
-// Hijack supports the http.Hijacker interface.
-func (r *responseDupper) Hijack() (net.Conn, *bufio.ReadWriter, error) {
-	if hijacker, ok := r.ResponseWriter.(http.Hijacker); ok {
-		return hijacker.Hijack()
+// DumpMaxFilesOption sets the number of dump files retained in the dump
+// directory, older dumps are removed; zero keeps all of them.
+func DumpMaxFilesOption(n int) DumperOption {
+	return func(o *DumperOptions) *DumperOptions {
+		o.maxFiles = n
+		return o
 	}
-	return nil, nil, fmt.Errorf("dumper middleware: inner ResponseWriter cannot be hijacked: %T", r.ResponseWriter)
 }
 
-// Flush supports the http.Flusher interface.
-func (r *responseDupper) Flush() {
-	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
-		flusher.Flush()
+type (
+	DumperOption func(*DumperOptions) *DumperOptions
+
+	DumperOptions struct {
+		// dir is the directory receiving dump files, dumps are written to
+		// the log writer if empty.
+		dir string
+
+		// sampleRate is the fraction of requests being dumped.
+		sampleRate float64
+
+		// maxFiles is the maximum number of dump files kept in dir.
+		maxFiles int
+
+		// mu serializes writing and pruning dump files.
+		mu sync.Mutex
+	}
+)
+
+func newDumperOptions(options ...DumperOption) *DumperOptions {
+	o := &DumperOptions{sampleRate: 1}
+	for _, opt := range options {
+		o = opt(o)
+	}
+	return o
+}
+
+func (o *DumperOptions) sampled() bool {
+	return o.sampleRate >= 1 || rand.Float64() < o.sampleRate
+}
+
+// writeFile stores a dump in the dump directory and removes the oldest dumps
+// exceeding the retention limit. File names start with the time of the
+// request, so they sort chronologically.
+func (o *DumperOptions) writeFile(rid string, dump []byte) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if err := os.MkdirAll(o.dir, 0o750); err != nil {
+		return err
+	}
+	name := time.Now().UTC().Format("20060102T150405.000000000")
+	if rid != "" {
+		name += "-" + filepath.Base(rid)
+	}
+	name += dumpFileExt
+	if err := os.WriteFile(filepath.Join(o.dir, name), dump, 0o600); err != nil {
+		return err
+	}
+	if o.maxFiles <= 0 {
+		return nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(o.dir, "*"+dumpFileExt))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+	for len(files) > o.maxFiles {
+		if err := os.Remove(files[0]); err != nil {
+			return err
+		}
+		files = files[1:]
 	}
+	return nil
 }
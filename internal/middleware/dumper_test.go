@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDumperPreservesFlusher(t *testing.T) {
+	var out bytes.Buffer
+	var flushable bool
+	h := Dumper(&out)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, flushable = w.(http.Flusher)
+		_, _ = w.Write([]byte("chunk\n"))
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Errorf("flush failed: %s", err)
+		}
+	}))
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/hooks/x", strings.NewReader("payload"))
+	req = req.WithContext(context.WithValue(req.Context(), RequestIDKey, "abc123"))
+	h.ServeHTTP(rr, req)
+
+	if !flushable {
+		t.Error("wrapped writer does not implement http.Flusher")
+	}
+	if !rr.Flushed {
+		t.Error("flush was not passed through")
+	}
+	if rr.Body.String() != "chunk\n" {
+		t.Errorf("unexpected body %q", rr.Body.String())
+	}
+	for _, want := range []string{"> [abc123] payload", "< [abc123] 200 OK", "< [abc123] chunk"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("dump is missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestDumperFiles(t *testing.T) {
+	dir := t.TempDir()
+	h := Dumper(io.Discard, DumpDirOption(dir), DumpMaxFilesOption(2))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("done"))
+	}))
+
+	for _, rid := range []string{"first", "second", "third"} {
+		req := httptest.NewRequest(http.MethodPost, "/hooks/x", strings.NewReader("payload"))
+		req = req.WithContext(context.WithValue(req.Context(), RequestIDKey, rid))
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.dump"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || !strings.HasSuffix(files[0], "-second.dump") || !strings.HasSuffix(files[1], "-third.dump") {
+		t.Fatalf("unexpected dump files %v", files)
+	}
+	dump, err := os.ReadFile(files[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"> [third] payload", "< [third] 200 OK", "< [third] done"} {
+		if !strings.Contains(string(dump), want) {
+			t.Errorf("dump is missing %q:\n%s", want, dump)
+		}
+	}
+}
+
+func TestDumperSampling(t *testing.T) {
+	var out bytes.Buffer
+	h := Dumper(&out, DumpSampleRateOption(0))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if out.Len() != 0 {
+		t.Errorf("expected no dump, got:\n%s", out.String())
+	}
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"net/http"
+)
+
+// InFlightLimiter caps the number of requests handled at the same time. A nil
+// limiter is unlimited.
+type InFlightLimiter struct {
+	slots chan struct{}
+}
+
+// NewInFlightLimiter returns a limiter admitting up to limit requests at the
+// same time, or nil, i.e. no limit, if limit is not positive.
+func NewInFlightLimiter(limit int) *InFlightLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	return &InFlightLimiter{slots: make(chan struct{}, limit)}
+}
+
+// TryAcquire reserves a slot without waiting. The returned function frees the
+// slot again, ok is false if all slots are taken.
+func (l *InFlightLimiter) TryAcquire() (release func(), ok bool) {
+	if l == nil {
+		return func() {}, true
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return func() { <-l.slots }, true
+	default:
+		return nil, false
+	}
+}
+
+// Handler rejects requests with 503 Service Unavailable while the limit is
+// reached.
+func (l *InFlightLimiter) Handler(next http.Handler) http.Handler {
+	if l == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		release, ok := l.TryAcquire()
+		if !ok {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Too many requests in flight.", http.StatusServiceUnavailable)
+			return
+		}
+		defer release()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// MaxInFlight is a middleware which rejects requests while limit requests are
+// already being handled; zero means no limit.
+func MaxInFlight(limit int) func(http.Handler) http.Handler {
+	return NewInFlightLimiter(limit).Handler
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMaxInFlight(t *testing.T) {
+	entered, unblock := make(chan struct{}), make(chan struct{})
+	h := MaxInFlight(1)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-unblock
+	}))
+
+	done := make(chan int)
+	go func() {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/hooks/slow", nil))
+		done <- rr.Code
+	}()
+	<-entered
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/hooks/slow", nil))
+	if rr.Code != http.StatusServiceUnavailable || rr.Header().Get("Retry-After") == "" {
+		t.Errorf("expected 503 with Retry-After while the limit is reached, got %d %v", rr.Code, rr.Header())
+	}
+
+	close(unblock)
+	if code := <-done; code != http.StatusOK {
+		t.Errorf("expected first request to succeed, got %d", code)
+	}
+
+	// the slot is free again
+	go func() { <-entered }()
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/hooks/slow", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected request to succeed after release, got %d", rr.Code)
+	}
+}
+
+func TestNilInFlightLimiter(t *testing.T) {
+	var l *InFlightLimiter
+	release, ok := l.TryAcquire()
+	if !ok {
+		t.Fatal("expected nil limiter to be unlimited")
+	}
+	release()
+	if NewInFlightLimiter(0) != nil {
+		t.Error("expected no limiter for limit 0")
+	}
+}
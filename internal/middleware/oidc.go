@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/jwt"
+)
+
+// Key to use when setting the claims of the bearer token.
+type ctxKeyClaims int
+
+// ClaimsKey is the key that holds the verified token claims in a request
+// context.
+const ClaimsKey ctxKeyClaims = 0
+
+// OIDC is a middleware which rejects requests that do not carry a valid
+// OpenID Connect token, signed with one of the keys, in the Authorization
+// header using the Bearer scheme. The claims of the token are stored in the
+// request context.
+func OIDC(keys jwt.KeySet, v jwt.Validation, logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || token == "" {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="webhook"`)
+				http.Error(w, "Unauthorized.", http.StatusUnauthorized)
+				return
+			}
+			claims, err := jwt.Verify(r.Context(), token, keys, v)
+			if errors.Is(err, jwt.ErrInvalidToken) {
+				logger.Warn("rejecting invalid bearer token", "http.request_id", GetReqID(r.Context()), "error", err)
+				w.Header().Set("WWW-Authenticate", `Bearer realm="webhook", error="invalid_token"`)
+				http.Error(w, "Unauthorized.", http.StatusUnauthorized)
+				return
+			}
+			if err != nil {
+				logger.Error("error verifying bearer token", "http.request_id", GetReqID(r.Context()), "error", err)
+				http.Error(w, "Error occurred while verifying the token.", http.StatusInternalServerError)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ClaimsKey, map[string]interface{}(claims))))
+		})
+	}
+}
+
+// GetClaims returns the claims of the verified bearer token from the given
+// context, or nil if the request was not authenticated by OIDC.
+func GetClaims(ctx context.Context) map[string]interface{} {
+	if ctx == nil {
+		return nil
+	}
+	claims, _ := ctx.Value(ClaimsKey).(map[string]interface{})
+	return claims
+}
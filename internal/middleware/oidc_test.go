@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/jwt"
+)
+
+func TestOIDC(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "k1", "n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()), "e": "AQAB"},
+		}})
+	}))
+	defer srv.Close()
+
+	token := func(claims map[string]interface{}) string {
+		header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "k1"})
+		payload, _ := json.Marshal(claims)
+		signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+		digest := crypto.SHA256.New()
+		digest.Write([]byte(signed))
+		sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest.Sum(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+	}
+
+	var subject interface{}
+	h := OIDC(jwt.Remote(srv.URL), jwt.Validation{Issuer: "https://ci.example", Audience: "webhook"},
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subject = GetClaims(r.Context())["sub"]
+	}))
+
+	exp := time.Now().Add(time.Hour).Unix()
+	for _, tt := range []struct {
+		desc          string
+		authorization string
+		status        int
+		challenge     string
+	}{
+		{"valid token", "Bearer " + token(map[string]interface{}{"iss": "https://ci.example", "aud": "webhook", "sub": "pipeline", "exp": exp}), http.StatusOK, ""},
+		{"missing token", "", http.StatusUnauthorized, `Bearer realm="webhook"`},
+		{"basic auth", "Basic dXNlcjpwYXNz", http.StatusUnauthorized, `Bearer realm="webhook"`},
+		{"wrong issuer", "Bearer " + token(map[string]interface{}{"iss": "https://evil.example", "aud": "webhook", "exp": exp}), http.StatusUnauthorized, "invalid_token"},
+	} {
+		subject = nil
+		r := httptest.NewRequest(http.MethodPost, "/hooks/deploy", nil)
+		if tt.authorization != "" {
+			r.Header.Set("Authorization", tt.authorization)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, r)
+		if rr.Code != tt.status || !strings.Contains(rr.Header().Get("WWW-Authenticate"), tt.challenge) {
+			t.Errorf("%s: expected %d with challenge %q, got %d %q", tt.desc, tt.status, tt.challenge, rr.Code, rr.Header().Get("WWW-Authenticate"))
+		}
+		if (tt.status == http.StatusOK) != (subject == "pipeline") {
+			t.Errorf("%s: unexpected claims subject %v", tt.desc, subject)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// clientLimiterIdle is how long the limiter of a client is kept after its
+// last request.
+const clientLimiterIdle = 10 * time.Minute
+
+// RateLimit is a middleware which limits the requests of every client IP
+// address to perSecond requests per second, allowing bursts of burst requests.
+// Requests over the limit are rejected with 429 Too Many Requests.
+func RateLimit(perSecond float64, burst int, options ...RateLimitOption) func(http.Handler) http.Handler {
+	o := newRateLimitOptions(options...)
+	clients := &clientLimiters{
+		limit:   rate.Limit(perSecond),
+		burst:   max(burst, 1),
+		clients: make(map[string]*clientLimiter),
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := ClientIP(r, o.trustedProxies)
+			if ip == nil || containsIP(o.exempt, ip) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			reservation := clients.get(ip.String()).ReserveN(time.Now(), 1)
+			if delay := reservation.Delay(); delay > 0 {
+				reservation.Cancel()
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+				http.Error(w, "Too many requests.", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// TrustedProxiesOption sets the proxies whose X-Forwarded-For header is used
+// to determine the client IP address, see ClientIP.
+func TrustedProxiesOption(nets []*net.IPNet) RateLimitOption {
+	return func(o *RateLimitOptions) *RateLimitOptions {
+		o.trustedProxies = nets
+		return o
+	}
+}
+
+// ExemptOption sets the client IP ranges which are not rate limited.
+func ExemptOption(nets []*net.IPNet) RateLimitOption {
+	return func(o *RateLimitOptions) *RateLimitOptions {
+		o.exempt = nets
+		return o
+	}
+}
+
+type (
+	RateLimitOption func(*RateLimitOptions) *RateLimitOptions
+
+	RateLimitOptions struct {
+		// trustedProxies are the proxies allowed to pass the client IP
+		// address in the X-Forwarded-For header.
+		trustedProxies []*net.IPNet
+
+		// exempt are the client IP ranges which are not rate limited.
+		exempt []*net.IPNet
+	}
+)
+
+func newRateLimitOptions(options ...RateLimitOption) *RateLimitOptions {
+	o := &RateLimitOptions{}
+	for _, opt := range options {
+		o = opt(o)
+	}
+	return o
+}
+
+type clientLimiter struct {
+	*rate.Limiter
+	lastSeen time.Time
+}
+
+// clientLimiters holds a token bucket per client IP address. Buckets of
+// clients which have been idle for a while are dropped.
+type clientLimiters struct {
+	limit rate.Limit
+	burst int
+
+	mu        sync.Mutex
+	clients   map[string]*clientLimiter
+	lastSweep time.Time
+}
+
+func (c *clientLimiters) get(ip string) *rate.Limiter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(c.lastSweep) > time.Minute {
+		for k, l := range c.clients {
+			if now.Sub(l.lastSeen) > clientLimiterIdle {
+				delete(c.clients, k)
+			}
+		}
+		c.lastSweep = now
+	}
+
+	l, ok := c.clients[ip]
+	if !ok {
+		l = &clientLimiter{Limiter: rate.NewLimiter(c.limit, c.burst)}
+		c.clients[ip] = l
+	}
+	l.lastSeen = now
+	return l.Limiter
+}
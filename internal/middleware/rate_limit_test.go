@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted, err := ParseCIDRs("10.0.0.0/8, 192.168.1.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		desc, remoteAddr, forwardedFor, want string
+	}{
+		{"direct", "203.0.113.7:1234", "", "203.0.113.7"},
+		{"untrusted proxy", "203.0.113.7:1234", "198.51.100.1", "203.0.113.7"},
+		{"trusted proxy", "10.1.2.3:1234", "198.51.100.1", "198.51.100.1"},
+		{"proxy chain", "10.1.2.3:1234", "6.6.6.6, 198.51.100.1, 192.168.1.1", "198.51.100.1"},
+		{"only proxies", "10.1.2.3:1234", "10.9.9.9", "10.9.9.9"},
+		{"garbage", "10.1.2.3:1234", "unknown", "10.1.2.3"},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/hooks/x", nil)
+		r.RemoteAddr = tt.remoteAddr
+		if tt.forwardedFor != "" {
+			r.Header.Set("X-Forwarded-For", tt.forwardedFor)
+		}
+		if got := ClientIP(r, trusted).String(); got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.desc, tt.want, got)
+		}
+	}
+	if _, err := ParseCIDRs("10.0.0.0/33"); err == nil {
+		t.Error("expected error for invalid CIDR")
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	exempt, _ := ParseCIDRs("192.0.2.0/24")
+	h := RateLimit(0.001, 2, ExemptOption(exempt))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	serve := func(remoteAddr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/hooks/x", nil)
+		r.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, r)
+		return rr
+	}
+
+	for i := 0; i < 2; i++ {
+		if rr := serve("203.0.113.7:1234"); rr.Code != http.StatusOK {
+			t.Fatalf("request %d within burst: expected 200, got %d", i, rr.Code)
+		}
+	}
+	rr := serve("203.0.113.7:1234")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+		t.Errorf("expected 429 with Retry-After over the limit, got %d %v", rr.Code, rr.Header())
+	}
+	if rr := serve("203.0.113.8:1234"); rr.Code != http.StatusOK {
+		t.Errorf("expected other clients not to be limited, got %d", rr.Code)
+	}
+	for i := 0; i < 5; i++ {
+		if rr := serve("192.0.2.10:1234"); rr.Code != http.StatusOK {
+			t.Fatalf("expected exempt client not to be limited, got %d", rr.Code)
+		}
+	}
+}
@@ -5,7 +5,12 @@ package middleware
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math/big"
 	"net/http"
+	"time"
 
 	"github.com/gofrs/uuid/v5"
 )
@@ -16,6 +21,15 @@ type ctxKeyRequestID int
 // RequestIDKey is the key that holds the unique request ID in a request context.
 const RequestIDKey ctxKeyRequestID = 0
 
+// Formats of generated request IDs.
+const (
+	// RequestIDShort is a random ID of 6 hex digits.
+	RequestIDShort  = "short"
+	RequestIDUUIDv4 = "uuidv4"
+	RequestIDUUIDv7 = "uuidv7"
+	RequestIDULID   = "ulid"
+)
+
 // RequestID is a middleware that injects a request ID into the context of each
 // request.
 func RequestID(options ...RequestIDOption) func(http.Handler) http.Handler {
@@ -35,7 +49,10 @@ func RequestID(options ...RequestIDOption) func(http.Handler) http.Handler {
 			}
 
 			if id == "" {
-				id = uuid.Must(uuid.NewV4()).String()[:6]
+				id = o.generate()
+			}
+			if o.responseHeader != "" {
+				w.Header().Set(o.responseHeader, id)
 			}
 
 			ctx = context.WithValue(ctx, RequestIDKey, id)
@@ -44,6 +61,48 @@ func RequestID(options ...RequestIDOption) func(http.Handler) http.Handler {
 	}
 }
 
+// NewReqID generates a new short random request ID.
+func NewReqID() string {
+	return uuid.Must(uuid.NewV4()).String()[:6]
+}
+
+// RequestIDGenerator returns the function generating request IDs in the
+// given format, one of the RequestID* constants.
+func RequestIDGenerator(format string) (func() string, error) {
+	switch format {
+	case RequestIDShort, "":
+		return NewReqID, nil
+	case RequestIDUUIDv4:
+		return func() string { return uuid.Must(uuid.NewV4()).String() }, nil
+	case RequestIDUUIDv7:
+		return func() string { return uuid.Must(uuid.NewV7()).String() }, nil
+	case RequestIDULID:
+		return newULID, nil
+	}
+	return nil, fmt.Errorf("unknown request ID format: %s", format)
+}
+
+// crockford is the base32 alphabet of ULIDs.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// newULID generates a ULID, a lexicographically sortable ID made of the
+// milliseconds since the epoch and 80 random bits.
+func newULID() string {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], uint64(time.Now().UnixMilli())<<16)
+	_, _ = rand.Read(b[6:])
+
+	n := new(big.Int).SetBytes(b[:])
+	mod := new(big.Int)
+	base := big.NewInt(32)
+	var id [26]byte
+	for i := len(id) - 1; i >= 0; i-- {
+		n.DivMod(n, base, mod)
+		id[i] = crockford[mod.Int64()]
+	}
+	return string(id[:])
+}
+
 // GetReqID returns a request ID from the given context if one is present.
 // Returns the empty string if a request ID cannot be found.
 func GetReqID(ctx context.Context) string {
@@ -70,6 +129,24 @@ func XRequestIDLimitOption(limit int) RequestIDOption {
 	}
 }
 
+// RequestIDGeneratorOption sets the function generating request IDs, see
+// RequestIDGenerator.
+func RequestIDGeneratorOption(generate func() string) RequestIDOption {
+	return func(o *RequestIDOptions) *RequestIDOptions {
+		o.generate = generate
+		return o
+	}
+}
+
+// ResponseHeaderOption sets the name of the response header carrying the
+// request ID; the ID is not sent if the name is empty.
+func ResponseHeaderOption(name string) RequestIDOption {
+	return func(o *RequestIDOptions) *RequestIDOptions {
+		o.responseHeader = name
+		return o
+	}
+}
+
 type (
 	RequestIDOption func(*RequestIDOptions) *RequestIDOptions
 
@@ -82,11 +159,18 @@ type (
 		// allowed. Values longer than this value are truncated. Zero value
 		// means no limit.
 		requestIDLimit int
+
+		// generate creates new request IDs.
+		generate func() string
+
+		// responseHeader is the name of the response header carrying the
+		// request ID.
+		responseHeader string
 	}
 )
 
 func newRequestIDOptions(options ...RequestIDOption) *RequestIDOptions {
-	o := new(RequestIDOptions)
+	o := &RequestIDOptions{generate: NewReqID}
 	for _, opt := range options {
 		o = opt(o)
 	}
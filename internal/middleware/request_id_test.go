@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestRequestIDGenerator(t *testing.T) {
+	for format, re := range map[string]string{
+		RequestIDShort:  `^[0-9a-f]{6}$`,
+		RequestIDUUIDv4: `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[0-9a-f]{4}-[0-9a-f]{12}$`,
+		RequestIDUUIDv7: `^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[0-9a-f]{4}-[0-9a-f]{12}$`,
+		RequestIDULID:   `^[0-7][0-9A-HJKMNP-TV-Z]{25}$`,
+	} {
+		generate, err := RequestIDGenerator(format)
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %s", format, err)
+		}
+		if id := generate(); !regexp.MustCompile(re).MatchString(id) {
+			t.Errorf("%s: ID %q does not match %s", format, id, re)
+		}
+	}
+	if _, err := RequestIDGenerator("snowflake"); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func TestULIDIsSortable(t *testing.T) {
+	first := newULID()
+	time.Sleep(2 * time.Millisecond)
+	if second := newULID(); second <= first {
+		t.Errorf("expected %q to sort after %q", second, first)
+	}
+}
+
+func TestRequestIDResponseHeader(t *testing.T) {
+	var id string
+	handler := RequestID(
+		RequestIDGeneratorOption(func() string { return "generated" }),
+		ResponseHeaderOption("X-Request-Id"),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id = GetReqID(r.Context())
+	}))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/", nil))
+	if id != "generated" || rr.Header().Get("X-Request-Id") != "generated" {
+		t.Errorf("expected generated request ID in context and header, got %q and %q", id, rr.Header().Get("X-Request-Id"))
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+
+package pidfile
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// lock takes an exclusive lock on the file without blocking. The lock is
+// released when the file is closed or the process exits.
+func lock(f *os.File) error {
+	return unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB)
+}
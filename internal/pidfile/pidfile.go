@@ -1,6 +1,7 @@
 // Package pidfile provides structure and helper functions to create and remove
 // PID file. A PID file is usually a file used to store the process ID of a
-// running process.
+// running process. The file is locked while the process runs, so a second
+// instance using the same PID file refuses to start.
 package pidfile
 
 import (
@@ -15,37 +16,77 @@ import (
 // PIDFile is a file used to store the process ID of a running process.
 type PIDFile struct {
 	path string
+	// f is the open PID file holding the lock.
+	f *os.File
+	// stale is the PID of the exited process which left the file behind.
+	stale int
 }
 
-func checkPIDFileAlreadyExists(path string) error {
-	if pidByte, err := ioutil.ReadFile(path); err == nil {
-		pidString := strings.TrimSpace(string(pidByte))
-		if pid, err := strconv.Atoi(pidString); err == nil {
-			if processExists(pid) {
-				return fmt.Errorf("pid file found, ensure webhook is not running or delete %s", path)
-			}
-		}
+// readPID returns the process ID stored in the file, or 0 if there is none.
+func readPID(f *os.File) int {
+	pidByte, err := ioutil.ReadAll(f)
+	if err != nil {
+		return 0
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(pidByte)))
+	if err != nil {
+		return 0
 	}
-	return nil
+	return pid
 }
 
-// New creates a PIDfile using the specified path.
+// New creates a PIDfile using the specified path. It fails if another process
+// holds the lock of the file. A PID file which is not locked is stale, ie. left
+// behind by a crashed process, and is taken over.
 func New(path string) (*PIDFile, error) {
-	if err := checkPIDFileAlreadyExists(path); err != nil {
-		return nil, err
-	}
 	// Note MkdirAll returns nil if a directory already exists
 	if err := MkdirAll(filepath.Dir(path), os.FileMode(0o755)); err != nil {
 		return nil, err
 	}
-	if err := ioutil.WriteFile(path, []byte(fmt.Sprintf("%d", os.Getpid())), 0o600); err != nil {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
 		return nil, err
 	}
+	pid := readPID(f)
+	if err := lock(f); err != nil {
+		_ = f.Close()
+		if pid != 0 {
+			return nil, fmt.Errorf("pid file %s is locked by process %d, ensure webhook is not running", path, pid)
+		}
+		return nil, fmt.Errorf("pid file %s is locked, ensure webhook is not running: %w", path, err)
+	}
 
-	return &PIDFile{path: path}, nil
+	file := &PIDFile{path: path, f: f}
+	if pid != 0 && !processExists(pid) {
+		file.stale = pid
+	}
+	if err := f.Truncate(0); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if _, err := f.WriteAt([]byte(strconv.Itoa(os.Getpid())), 0); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// StalePID returns the PID found in a stale PID file which was taken over,
+// or 0 if there was none.
+func (file PIDFile) StalePID() int {
+	return file.stale
 }
 
-// Remove removes the PIDFile.
+// Remove removes the PIDFile and releases its lock.
 func (file PIDFile) Remove() error {
-	return os.Remove(file.path)
+	err := os.Remove(file.path)
+	if file.f != nil {
+		_ = file.f.Close()
+	}
+	return err
 }
@@ -4,6 +4,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
 	"testing"
 )
 
@@ -36,3 +37,24 @@ func TestRemoveInvalidPath(t *testing.T) {
 		t.Fatal("Non-existing file doesn't give an error on delete")
 	}
 }
+
+func TestNewStale(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "testfile")
+	if err := ioutil.WriteFile(path, []byte("2147483646"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := New(path)
+	if err != nil {
+		t.Fatal("Stale test file not taken over", err)
+	}
+	defer file.Remove()
+
+	if file.StalePID() != 2147483646 {
+		t.Fatalf("Expected stale PID 2147483646, got %d", file.StalePID())
+	}
+	pid, err := ioutil.ReadFile(path)
+	if err != nil || string(pid) != strconv.Itoa(os.Getpid()) {
+		t.Fatalf("Expected own PID in test file, got %q", pid)
+	}
+}
@@ -0,0 +1,59 @@
+//go:build ignore
+
+// mksyscalls generates the syscall tables used by seccomp profiles from the
+// syscall numbers of golang.org/x/sys/unix.
+//
+//	go run mksyscalls.go amd64 arm64
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var auditArch = map[string]string{
+	"amd64": "AUDIT_ARCH_X86_64",
+	"arm64": "AUDIT_ARCH_AARCH64",
+}
+
+var sysnum = regexp.MustCompile(`(?m)^\s*SYS_(\w+)\s*=\s*(\d+)$`)
+
+func main() {
+	out, err := exec.Command("go", "list", "-m", "-f", "{{.Dir}}", "golang.org/x/sys").Output()
+	if err != nil {
+		log.Fatal(err)
+	}
+	dir := strings.TrimSpace(string(out))
+
+	for _, arch := range os.Args[1:] {
+		src, err := os.ReadFile(filepath.Join(dir, "unix", "zsysnum_linux_"+arch+".go"))
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		fmt.Fprintf(&buf, "// Code generated by go run mksyscalls.go %s; DO NOT EDIT.\n\n", arch)
+		fmt.Fprintf(&buf, "package sandbox\n\nimport \"golang.org/x/sys/unix\"\n\n")
+		fmt.Fprintf(&buf, "const auditArch = unix.%s\n\n", auditArch[arch])
+		fmt.Fprintf(&buf, "var syscallNumbers = map[string]uint32{\n")
+		for _, m := range sysnum.FindAllStringSubmatch(string(src), -1) {
+			fmt.Fprintf(&buf, "%q: %s,\n", strings.ToLower(m[1]), m[2])
+		}
+		fmt.Fprintf(&buf, "}\n")
+
+		formatted, err := format.Source(buf.Bytes())
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := os.WriteFile("syscalls_linux_"+arch+".go", formatted, 0o644); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
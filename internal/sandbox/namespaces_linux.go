@@ -0,0 +1,71 @@
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// Namespaces which commands can be started in.
+const (
+	NamespaceMount   = "mount"
+	NamespaceNetwork = "network"
+)
+
+var namespaceFlags = map[string]uintptr{
+	NamespaceMount:   unix.CLONE_NEWNS,
+	NamespaceNetwork: unix.CLONE_NEWNET,
+}
+
+// cloneflags returns the namespaces the launcher has to be started in.
+func (c *Config) cloneflags() (uintptr, error) {
+	var flags uintptr
+	for _, name := range c.Namespaces {
+		flag, ok := namespaceFlags[name]
+		if !ok {
+			return 0, fmt.Errorf("unknown namespace %q", name)
+		}
+		flags |= flag
+	}
+	if c.PrivateTmp {
+		flags |= unix.CLONE_NEWNS
+	}
+	return flags, nil
+}
+
+// prepare starts the launcher in new namespaces. Creating them requires
+// CAP_SYS_ADMIN, so unprivileged webhooks create a user namespace as well,
+// in which the command keeps its user and group.
+func (c *Config) prepare(cmd *exec.Cmd) error {
+	flags, err := c.cloneflags()
+	if err != nil || flags == 0 {
+		return err
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Cloneflags |= flags
+	if os.Geteuid() != 0 {
+		uid, gid := os.Getuid(), os.Getgid()
+		cmd.SysProcAttr.Cloneflags |= unix.CLONE_NEWUSER
+		cmd.SysProcAttr.UidMappings = []syscall.SysProcIDMap{{ContainerID: uid, HostID: uid, Size: 1}}
+		cmd.SysProcAttr.GidMappings = []syscall.SysProcIDMap{{ContainerID: gid, HostID: gid, Size: 1}}
+	}
+	return nil
+}
+
+// mountPrivateTmp replaces /tmp with an empty tmpfs, which is removed with
+// the mount namespace of the command.
+func mountPrivateTmp() error {
+	// keep the mount from propagating to the namespace of webhook
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("making mounts private: %w", err)
+	}
+	if err := unix.Mount("tmpfs", "/tmp", "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=1777"); err != nil {
+		return fmt.Errorf("mounting private /tmp: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+// Package sandbox confines the commands executed by hooks and sets their
+// scheduling.
+//
+// Most restrictions have to be applied by the process itself, between fork
+// and exec, which os/exec does not allow. Commands are therefore started
+// through webhook itself: Wrap replaces the command with a call of the
+// sandbox launcher, which applies the configuration to its own process and
+// then executes the original command in place, keeping the PID, the
+// environment and the standard streams.
+package sandbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// Command is the argument which makes webhook run as sandbox launcher, see
+// Main.
+const Command = "sandbox-exec"
+
+// configEnv passes the configuration to the launcher, which removes it from
+// the environment of the command.
+const configEnv = "WEBHOOK_SANDBOX_CONFIG"
+
+// Config describes the restrictions of a command.
+type Config struct {
+	// NoNewPrivileges prevents the command from gaining privileges, ie.
+	// through setuid binaries or file capabilities.
+	NoNewPrivileges bool `json:"no-new-privileges,omitempty"`
+	// DropCapabilities are removed from the bounding, ambient, permitted,
+	// effective and inheritable sets; "ALL" drops every capability.
+	DropCapabilities []string `json:"drop-capabilities,omitempty"`
+	// Seccomp restricts the syscalls of the command with the builtin
+	// "default" profile or the JSON profile at the given path. It implies
+	// NoNewPrivileges.
+	Seccomp string `json:"seccomp,omitempty"`
+	// Landlock confines the filesystem access of the command on kernels
+	// supporting Landlock. It implies NoNewPrivileges.
+	Landlock *Landlock `json:"landlock,omitempty"`
+	// Namespaces are created for the command, "mount" and "network" are
+	// supported. A new network namespace cuts the command off from the
+	// network.
+	Namespaces []string `json:"namespaces,omitempty"`
+	// PrivateTmp mounts an empty /tmp for the command in a new mount
+	// namespace.
+	PrivateTmp bool `json:"private-tmp,omitempty"`
+}
+
+// Landlock lists the paths the command may access, including everything
+// beneath them. All other paths are inaccessible.
+type Landlock struct {
+	// ReadOnly paths may be read and executed.
+	ReadOnly []string `json:"read-only,omitempty"`
+	// ReadWrite paths may also be written, created and removed.
+	ReadWrite []string `json:"read-write,omitempty"`
+}
+
+// Scheduling sets the priorities and the file mode creation mask of a
+// command, so heavy commands don't starve other workloads of the host.
+type Scheduling struct {
+	// Nice is the CPU niceness, from -20 (highest priority) to 19 (lowest).
+	Nice *int `json:"nice,omitempty"`
+	// IONice is the IO scheduling class, optionally followed by the
+	// priority within the class: "idle", "best-effort[:0-7]" or
+	// "realtime[:0-7]", with 0 being the highest priority.
+	IONice string `json:"ionice,omitempty"`
+	// Umask is the octal file mode creation mask, ie. "027".
+	Umask string `json:"umask,omitempty"`
+}
+
+// IsZero reports whether the scheduling is left unchanged.
+func (s Scheduling) IsZero() bool {
+	return s.Nice == nil && s.IONice == "" && s.Umask == ""
+}
+
+// spec is the configuration passed to the launcher.
+type spec struct {
+	Config     *Config    `json:"config,omitempty"`
+	Scheduling Scheduling `json:"scheduling"`
+}
+
+// Wrap changes the command to be started through the sandbox launcher with
+// the given configuration and scheduling. It does nothing if config is nil
+// and the scheduling is zero.
+func Wrap(cmd *exec.Cmd, config *Config, scheduling Scheduling) error {
+	if config == nil && scheduling.IsZero() {
+		return nil
+	}
+	if config != nil {
+		if err := config.Validate(); err != nil {
+			return err
+		}
+	}
+	if err := scheduling.Validate(); err != nil {
+		return err
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("locating sandbox launcher: %w", err)
+	}
+	encoded, err := json.Marshal(spec{Config: config, Scheduling: scheduling})
+	if err != nil {
+		return err
+	}
+
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	if config != nil {
+		if err := config.prepare(cmd); err != nil {
+			return err
+		}
+	}
+	cmd.Env = append(cmd.Env, configEnv+"="+string(encoded))
+	cmd.Args = append([]string{self, Command, cmd.Path}, cmd.Args...)
+	cmd.Path = self
+	return nil
+}
+
+// Main runs the sandbox launcher with the arguments following Command: the
+// path of the command and its arguments, starting with the program name. It
+// only returns if the command could not be executed, with exit code 127 like
+// a shell.
+func Main(args []string) {
+	err := launch(args)
+	fmt.Fprintf(os.Stderr, "webhook sandbox: %s\n", err)
+	os.Exit(127)
+}
+
+// decodeSpec reads the configuration passed by Wrap and returns the
+// environment without it.
+func decodeSpec(environ []string) (*spec, []string, error) {
+	var sp spec
+	env := make([]string, 0, len(environ))
+	found := false
+	for _, kv := range environ {
+		if value, ok := cutEnv(kv, configEnv); ok {
+			if err := json.Unmarshal([]byte(value), &sp); err != nil {
+				return nil, nil, fmt.Errorf("decoding configuration: %w", err)
+			}
+			found = true
+			continue
+		}
+		env = append(env, kv)
+	}
+	if !found {
+		return nil, nil, fmt.Errorf("%s is not set", configEnv)
+	}
+	return &sp, env, nil
+}
+
+func cutEnv(kv, name string) (string, bool) {
+	if len(kv) > len(name) && kv[:len(name)] == name && kv[len(name)] == '=' {
+		return kv[len(name)+1:], true
+	}
+	return "", false
+}
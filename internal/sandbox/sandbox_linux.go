@@ -0,0 +1,203 @@
+package sandbox
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// capabilities maps the names of the capabilities to their numbers.
+var capabilities = map[string]int{
+	"CAP_CHOWN":              unix.CAP_CHOWN,
+	"CAP_DAC_OVERRIDE":       unix.CAP_DAC_OVERRIDE,
+	"CAP_DAC_READ_SEARCH":    unix.CAP_DAC_READ_SEARCH,
+	"CAP_FOWNER":             unix.CAP_FOWNER,
+	"CAP_FSETID":             unix.CAP_FSETID,
+	"CAP_KILL":               unix.CAP_KILL,
+	"CAP_SETGID":             unix.CAP_SETGID,
+	"CAP_SETUID":             unix.CAP_SETUID,
+	"CAP_SETPCAP":            unix.CAP_SETPCAP,
+	"CAP_LINUX_IMMUTABLE":    unix.CAP_LINUX_IMMUTABLE,
+	"CAP_NET_BIND_SERVICE":   unix.CAP_NET_BIND_SERVICE,
+	"CAP_NET_BROADCAST":      unix.CAP_NET_BROADCAST,
+	"CAP_NET_ADMIN":          unix.CAP_NET_ADMIN,
+	"CAP_NET_RAW":            unix.CAP_NET_RAW,
+	"CAP_IPC_LOCK":           unix.CAP_IPC_LOCK,
+	"CAP_IPC_OWNER":          unix.CAP_IPC_OWNER,
+	"CAP_SYS_MODULE":         unix.CAP_SYS_MODULE,
+	"CAP_SYS_RAWIO":          unix.CAP_SYS_RAWIO,
+	"CAP_SYS_CHROOT":         unix.CAP_SYS_CHROOT,
+	"CAP_SYS_PTRACE":         unix.CAP_SYS_PTRACE,
+	"CAP_SYS_PACCT":          unix.CAP_SYS_PACCT,
+	"CAP_SYS_ADMIN":          unix.CAP_SYS_ADMIN,
+	"CAP_SYS_BOOT":           unix.CAP_SYS_BOOT,
+	"CAP_SYS_NICE":           unix.CAP_SYS_NICE,
+	"CAP_SYS_RESOURCE":       unix.CAP_SYS_RESOURCE,
+	"CAP_SYS_TIME":           unix.CAP_SYS_TIME,
+	"CAP_SYS_TTY_CONFIG":     unix.CAP_SYS_TTY_CONFIG,
+	"CAP_MKNOD":              unix.CAP_MKNOD,
+	"CAP_LEASE":              unix.CAP_LEASE,
+	"CAP_AUDIT_WRITE":        unix.CAP_AUDIT_WRITE,
+	"CAP_AUDIT_CONTROL":      unix.CAP_AUDIT_CONTROL,
+	"CAP_SETFCAP":            unix.CAP_SETFCAP,
+	"CAP_MAC_OVERRIDE":       unix.CAP_MAC_OVERRIDE,
+	"CAP_MAC_ADMIN":          unix.CAP_MAC_ADMIN,
+	"CAP_SYSLOG":             unix.CAP_SYSLOG,
+	"CAP_WAKE_ALARM":         unix.CAP_WAKE_ALARM,
+	"CAP_BLOCK_SUSPEND":      unix.CAP_BLOCK_SUSPEND,
+	"CAP_AUDIT_READ":         unix.CAP_AUDIT_READ,
+	"CAP_PERFMON":            unix.CAP_PERFMON,
+	"CAP_BPF":                unix.CAP_BPF,
+	"CAP_CHECKPOINT_RESTORE": unix.CAP_CHECKPOINT_RESTORE,
+}
+
+// parseCapabilities returns the numbers of the named capabilities. Names are
+// case-insensitive and the CAP_ prefix is optional.
+func parseCapabilities(names []string) ([]int, error) {
+	var caps []int
+	for _, name := range names {
+		name = strings.ToUpper(name)
+		if name == "ALL" {
+			caps = caps[:0]
+			for c := 0; c <= unix.CAP_LAST_CAP; c++ {
+				caps = append(caps, c)
+			}
+			return caps, nil
+		}
+		if !strings.HasPrefix(name, "CAP_") {
+			name = "CAP_" + name
+		}
+		c, ok := capabilities[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown capability %q", name)
+		}
+		caps = append(caps, c)
+	}
+	return caps, nil
+}
+
+// Validate checks the configuration before any command is started.
+func (c *Config) Validate() error {
+	if _, err := parseCapabilities(c.DropCapabilities); err != nil {
+		return err
+	}
+	if _, err := c.cloneflags(); err != nil {
+		return err
+	}
+	if c.Seccomp != "" {
+		profile, err := loadSeccompProfile(c.Seccomp)
+		if err != nil {
+			return err
+		}
+		if _, err := profile.compile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func launch(args []string) error {
+	if len(args) < 2 {
+		return errors.New("usage: webhook " + Command + " PATH ARG0 [ARGS...]")
+	}
+	sp, env, err := decodeSpec(os.Environ())
+	if err != nil {
+		return err
+	}
+	// the restrictions apply to the calling thread, which executes the
+	// command below
+	runtime.LockOSThread()
+	// lowering the niceness may require capabilities dropped by the sandbox
+	if err := sp.Scheduling.apply(); err != nil {
+		return err
+	}
+	if sp.Config != nil {
+		if err := sp.Config.apply(); err != nil {
+			return err
+		}
+	}
+	return syscall.Exec(args[0], args[1:], env)
+}
+
+// apply restricts the calling thread according to the configuration.
+func (c *Config) apply() error {
+	// mounting needs the capabilities and syscalls restricted below
+	if c.PrivateTmp {
+		if err := mountPrivateTmp(); err != nil {
+			return err
+		}
+	}
+	if len(c.DropCapabilities) > 0 {
+		caps, err := parseCapabilities(c.DropCapabilities)
+		if err != nil {
+			return err
+		}
+		if err := dropCapabilities(caps, c.NoNewPrivileges); err != nil {
+			return err
+		}
+	}
+	if c.NoNewPrivileges || c.Seccomp != "" || c.Landlock != nil {
+		if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+			return fmt.Errorf("setting no_new_privs: %w", err)
+		}
+	}
+	if c.Landlock != nil {
+		err := installLandlock(c.Landlock)
+		if errors.Is(err, errLandlockUnsupported) {
+			fmt.Fprintf(os.Stderr, "webhook sandbox: %s, running without filesystem restrictions\n", err)
+		} else if err != nil {
+			return err
+		}
+	}
+	// the filter comes last, as it may forbid the syscalls above
+	if c.Seccomp != "" {
+		if err := installSeccomp(c.Seccomp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropCapabilities removes the capabilities from all sets of the thread.
+// Shrinking the bounding set requires CAP_SETPCAP. Without it, ie. when
+// webhook runs unprivileged, the bounding set is left alone if no_new_privs
+// is set, as the command can't gain capabilities anyway.
+func dropCapabilities(caps []int, noNewPrivileges bool) error {
+	for _, c := range caps {
+		err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(c), 0, 0, 0)
+		if errors.Is(err, unix.EPERM) && noNewPrivileges {
+			break
+		}
+		// EINVAL: the kernel does not know the capability
+		if err != nil && !errors.Is(err, unix.EINVAL) {
+			return fmt.Errorf("dropping capability %d from bounding set: %w", c, err)
+		}
+	}
+	for _, c := range caps {
+		err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_LOWER, uintptr(c), 0, 0)
+		if err != nil && !errors.Is(err, unix.EINVAL) {
+			return fmt.Errorf("dropping ambient capability %d: %w", c, err)
+		}
+	}
+
+	header := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	if err := unix.Capget(&header, &data[0]); err != nil {
+		return fmt.Errorf("reading capabilities: %w", err)
+	}
+	for _, c := range caps {
+		mask := ^uint32(1 << (c % 32))
+		data[c/32].Effective &= mask
+		data[c/32].Permitted &= mask
+		data[c/32].Inheritable &= mask
+	}
+	if err := unix.Capset(&header, &data[0]); err != nil {
+		return fmt.Errorf("dropping capabilities: %w", err)
+	}
+	return nil
+}
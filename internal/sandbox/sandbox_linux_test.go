@@ -0,0 +1,202 @@
+package sandbox
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+// TestMain lets the test binary act as sandbox launcher, like webhook does.
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && os.Args[1] == Command {
+		Main(os.Args[2:])
+	}
+	os.Exit(m.Run())
+}
+
+// status runs the shell script in the sandbox and returns its output.
+func status(t *testing.T, config *Config, scheduling Scheduling, script string) string {
+	t.Helper()
+	cmd := exec.Command("/bin/sh", "-c", script)
+	if err := Wrap(cmd, config, scheduling); err != nil {
+		t.Fatal(err)
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("sandboxed command failed: %s\n%s", err, out)
+	}
+	return string(out)
+}
+
+func TestNoNewPrivileges(t *testing.T) {
+	out := status(t, &Config{NoNewPrivileges: true}, Scheduling{}, `grep NoNewPrivs /proc/self/status; echo "config=${WEBHOOK_SANDBOX_CONFIG:-unset}"`)
+	if !regexp.MustCompile(`NoNewPrivs:\s+1`).MatchString(out) {
+		t.Errorf("expected no_new_privs to be set:\n%s", out)
+	}
+	if !regexp.MustCompile(`config=unset`).MatchString(out) {
+		t.Errorf("expected sandbox configuration to be removed from the environment:\n%s", out)
+	}
+}
+
+func TestDropCapabilities(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("requires root")
+	}
+	out := status(t, &Config{DropCapabilities: []string{"net_raw", "CAP_SYS_ADMIN"}}, Scheduling{}, `grep -E 'Cap(Bnd|Eff)' /proc/self/status`)
+	for _, set := range []string{"CapBnd", "CapEff"} {
+		m := regexp.MustCompile(set + `:\s+([0-9a-f]+)`).FindStringSubmatch(out)
+		if m == nil {
+			t.Fatalf("missing %s:\n%s", set, out)
+		}
+		bits, _ := strconv.ParseUint(m[1], 16, 64)
+		if bits&(1<<13|1<<21) != 0 {
+			t.Errorf("expected CAP_NET_RAW and CAP_SYS_ADMIN to be dropped from %s: %s", set, m[1])
+		}
+	}
+}
+
+func TestWrapValidates(t *testing.T) {
+	if err := Wrap(exec.Command("/bin/true"), &Config{DropCapabilities: []string{"CAP_TELEPORT"}}, Scheduling{}); err == nil {
+		t.Error("expected error for unknown capability")
+	}
+	cmd := exec.Command("/bin/true")
+	if err := Wrap(cmd, nil, Scheduling{}); err != nil || cmd.Path != "/bin/true" {
+		t.Errorf("expected command to be unchanged without configuration, got %s (%v)", cmd.Path, err)
+	}
+}
+
+func TestSeccompDefault(t *testing.T) {
+	out := status(t, &Config{Seccomp: SeccompDefault}, Scheduling{}, `grep -E '^(Seccomp|NoNewPrivs):' /proc/self/status`)
+	if !regexp.MustCompile(`Seccomp:\s+2`).MatchString(out) {
+		t.Errorf("expected seccomp filter to be installed:\n%s", out)
+	}
+	if !regexp.MustCompile(`NoNewPrivs:\s+1`).MatchString(out) {
+		t.Errorf("expected seccomp to imply no_new_privs:\n%s", out)
+	}
+}
+
+func TestSeccompProfile(t *testing.T) {
+	profile := filepath.Join(t.TempDir(), "profile.json")
+	err := os.WriteFile(profile, []byte(`{
+		"defaultAction": "SCMP_ACT_ALLOW",
+		"syscalls": [
+			{"names": ["mkdir", "mkdirat", "no_such_syscall"], "action": "SCMP_ACT_ERRNO", "errnoRet": 13}
+		]
+	}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(t.TempDir(), "denied")
+	out := status(t, &Config{Seccomp: profile}, Scheduling{}, `mkdir `+dir+` 2>&1; echo "status=$?"`)
+	if !regexp.MustCompile(`(?i)permission denied`).MatchString(out) || regexp.MustCompile(`status=0`).MatchString(out) {
+		t.Errorf("expected mkdir to be denied:\n%s", out)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("expected %s not to be created", dir)
+	}
+}
+
+func TestSeccompValidates(t *testing.T) {
+	profile := filepath.Join(t.TempDir(), "profile.json")
+	err := os.WriteFile(profile, []byte(`{
+		"defaultAction": "SCMP_ACT_ALLOW",
+		"syscalls": [
+			{"names": ["personality"], "action": "SCMP_ACT_ERRNO", "args": [{"index": 0, "value": 8, "op": "SCMP_CMP_EQ"}]}
+		]
+	}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{profile, filepath.Join(t.TempDir(), "missing.json")} {
+		if err := Wrap(exec.Command("/bin/true"), &Config{Seccomp: name}, Scheduling{}); err == nil {
+			t.Errorf("expected error for profile %s", name)
+		}
+	}
+}
+
+func TestLandlock(t *testing.T) {
+	if _, err := landlockABI(); err != nil {
+		t.Skip(err)
+	}
+	writable, other := t.TempDir(), t.TempDir()
+	config := &Config{Landlock: &Landlock{ReadOnly: []string{"/"}, ReadWrite: []string{writable}}}
+	out := status(t, config, Scheduling{}, `
+		touch `+writable+`/allowed && echo "allowed=ok"
+		touch `+other+`/denied || echo "denied=failed"
+		test -n "$(cat /etc/passwd)" && echo "read=ok"`)
+	for _, want := range []string{"allowed=ok", "denied=failed", "read=ok"} {
+		if !regexp.MustCompile(want).MatchString(out) {
+			t.Errorf("expected %s:\n%s", want, out)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(other, "denied")); !os.IsNotExist(err) {
+		t.Errorf("expected file outside of read-write paths not to be created")
+	}
+}
+
+func TestScheduling(t *testing.T) {
+	nice := 7
+	out := status(t, nil, Scheduling{Nice: &nice, IONice: "idle", Umask: "027"}, `umask; cut -d' ' -f19 /proc/self/stat; ionice -p $$ 2>/dev/null || echo "ionice=unavailable"`)
+	for _, want := range []string{`(?m)^0027$`, `(?m)^7$`, `(?m)^(idle|ionice=unavailable)$`} {
+		if !regexp.MustCompile(want).MatchString(out) {
+			t.Errorf("expected %s:\n%s", want, out)
+		}
+	}
+}
+
+func TestSchedulingValidates(t *testing.T) {
+	nice := 20
+	for _, s := range []Scheduling{{Nice: &nice}, {IONice: "idle:3"}, {IONice: "best-effort:8"}, {IONice: "fast"}, {Umask: "999"}} {
+		if err := Wrap(exec.Command("/bin/true"), nil, s); err == nil {
+			t.Errorf("expected error for %+v", s)
+		}
+	}
+}
+
+// requireNamespaces skips the test if the environment does not allow to
+// create namespaces, ie. in containers.
+func requireNamespaces(t *testing.T, config *Config) {
+	t.Helper()
+	cmd := exec.Command("/bin/true")
+	if err := Wrap(cmd, config, Scheduling{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Run(); err != nil {
+		t.Skipf("creating namespaces: %s", err)
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	config := &Config{Namespaces: []string{NamespaceNetwork, NamespaceMount}}
+	requireNamespaces(t, config)
+
+	out := status(t, config, Scheduling{}, `readlink /proc/self/ns/net /proc/self/ns/mnt`)
+	for _, ns := range []string{"net", "mnt"} {
+		own, err := os.Readlink("/proc/self/ns/" + ns)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !regexp.MustCompile(ns+`:\[\d+\]`).MatchString(out) || regexp.MustCompile(regexp.QuoteMeta(own)).MatchString(out) {
+			t.Errorf("expected a new %s namespace, webhook has %s:\n%s", ns, own, out)
+		}
+	}
+}
+
+func TestPrivateTmp(t *testing.T) {
+	config := &Config{PrivateTmp: true}
+	requireNamespaces(t, config)
+
+	name := filepath.Base(t.TempDir())
+	marker := filepath.Join("/tmp", name+"-private")
+	out := status(t, config, Scheduling{}, `ls -A /tmp | grep -c . ; touch `+marker+` && echo "touched=ok"`)
+	if !regexp.MustCompile(`(?m)^0$`).MatchString(out) || !regexp.MustCompile(`touched=ok`).MatchString(out) {
+		t.Errorf("expected an empty, writable /tmp:\n%s", out)
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		os.Remove(marker)
+		t.Errorf("expected %s to be written to the private /tmp", marker)
+	}
+}
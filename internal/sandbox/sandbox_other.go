@@ -0,0 +1,32 @@
+//go:build !linux
+
+package sandbox
+
+import (
+	"errors"
+	"os/exec"
+	"runtime"
+)
+
+var errUnsupported = errors.New("sandbox is not supported on " + runtime.GOOS)
+
+// Validate checks the configuration before any command is started.
+func (c *Config) Validate() error {
+	return errUnsupported
+}
+
+// Validate checks the scheduling before any command is started.
+func (s Scheduling) Validate() error {
+	if s.IsZero() {
+		return nil
+	}
+	return errUnsupported
+}
+
+func (c *Config) prepare(cmd *exec.Cmd) error {
+	return errUnsupported
+}
+
+func launch(args []string) error {
+	return errUnsupported
+}
@@ -0,0 +1,105 @@
+package sandbox
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// IO scheduling classes and the shift of the class within an IO priority,
+// see ioprio_set(2).
+const (
+	ioprioClassRT   = 1
+	ioprioClassBE   = 2
+	ioprioClassIdle = 3
+	ioprioClassSh   = 13
+	ioprioWhoProc   = 1
+)
+
+var ioprioClasses = map[string]int{
+	"realtime":    ioprioClassRT,
+	"best-effort": ioprioClassBE,
+	"idle":        ioprioClassIdle,
+}
+
+// parseIONice returns the IO priority of the ionice setting.
+func parseIONice(s string) (int, error) {
+	name, level, hasLevel := strings.Cut(s, ":")
+	class, ok := ioprioClasses[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown IO scheduling class %q", name)
+	}
+	data := 4 // default priority within the class
+	if hasLevel {
+		if class == ioprioClassIdle {
+			return 0, fmt.Errorf("IO scheduling class idle has no priority levels")
+		}
+		var err error
+		data, err = strconv.Atoi(level)
+		if err != nil || data < 0 || data > 7 {
+			return 0, fmt.Errorf("invalid IO priority %q, must be between 0 and 7", level)
+		}
+	}
+	if class == ioprioClassIdle {
+		data = 0
+	}
+	return class<<ioprioClassSh | data, nil
+}
+
+// parseUmask returns the octal file mode creation mask.
+func parseUmask(s string) (int, error) {
+	mask, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mask > 0o777 {
+		return 0, fmt.Errorf("invalid umask %q, must be octal between 000 and 777", s)
+	}
+	return int(mask), nil
+}
+
+// Validate checks the scheduling before any command is started.
+func (s Scheduling) Validate() error {
+	if s.Nice != nil && (*s.Nice < -20 || *s.Nice > 19) {
+		return fmt.Errorf("invalid nice value %d, must be between -20 and 19", *s.Nice)
+	}
+	if s.IONice != "" {
+		if _, err := parseIONice(s.IONice); err != nil {
+			return err
+		}
+	}
+	if s.Umask != "" {
+		if _, err := parseUmask(s.Umask); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// apply sets the priorities of the calling thread and the umask of the
+// process.
+func (s Scheduling) apply() error {
+	if s.Nice != nil {
+		// on Linux, the niceness is an attribute of the thread
+		if err := unix.Setpriority(unix.PRIO_PROCESS, 0, *s.Nice); err != nil {
+			return fmt.Errorf("setting nice value: %w", err)
+		}
+	}
+	if s.IONice != "" {
+		prio, err := parseIONice(s.IONice)
+		if err != nil {
+			return err
+		}
+		if _, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProc, 0, uintptr(prio)); errno != 0 {
+			return fmt.Errorf("setting IO priority: %w", errno)
+		}
+	}
+	if s.Umask != "" {
+		mask, err := parseUmask(s.Umask)
+		if err != nil {
+			return err
+		}
+		syscall.Umask(mask)
+	}
+	return nil
+}
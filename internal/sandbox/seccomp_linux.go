@@ -0,0 +1,183 @@
+package sandbox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// SeccompDefault is the name of the builtin seccomp profile, which allows
+// all syscalls except those administering the system, the kernel or other
+// processes.
+const SeccompDefault = "default"
+
+// SeccompProfile is a seccomp profile in the format used by Docker and the
+// OCI runtime specification. Syscalls not listed get the default action.
+type SeccompProfile struct {
+	DefaultAction   string           `json:"defaultAction"`
+	DefaultErrnoRet *uint            `json:"defaultErrnoRet,omitempty"`
+	Syscalls        []SeccompSyscall `json:"syscalls"`
+}
+
+// SeccompSyscall sets the action of the named syscalls. Argument filters are
+// not supported.
+type SeccompSyscall struct {
+	Names    []string        `json:"names"`
+	Action   string          `json:"action"`
+	ErrnoRet *uint           `json:"errnoRet,omitempty"`
+	Args     json.RawMessage `json:"args,omitempty"`
+}
+
+// defaultDenied are the syscalls rejected with EPERM by the builtin profile,
+// following the syscalls Docker only allows to privileged containers.
+var defaultDenied = []string{
+	"acct", "add_key", "bpf", "clock_adjtime", "clock_settime", "create_module",
+	"delete_module", "finit_module", "fsconfig", "fsmount", "fsopen", "fspick",
+	"get_kernel_syms", "init_module", "ioperm", "iopl", "kcmp", "kexec_file_load",
+	"kexec_load", "keyctl", "lookup_dcookie", "mount", "mount_setattr", "move_mount",
+	"name_to_handle_at", "nfsservctl", "open_by_handle_at", "open_tree",
+	"perf_event_open", "pivot_root", "process_vm_readv", "process_vm_writev",
+	"ptrace", "query_module", "quotactl", "quotactl_fd", "reboot", "request_key",
+	"setns", "settimeofday", "stime", "swapoff", "swapon", "sysfs", "_sysctl",
+	"umount", "umount2", "unshare", "uselib", "userfaultfd", "ustat", "vm86",
+	"vm86old",
+}
+
+// x32SyscallBit marks syscalls of the x32 ABI on amd64, which share the
+// architecture of regular syscalls and would bypass the filter.
+const x32SyscallBit = 0x40000000
+
+// loadSeccompProfile returns the builtin profile or reads the profile from
+// the given path.
+func loadSeccompProfile(name string) (*SeccompProfile, error) {
+	if name == SeccompDefault {
+		return &SeccompProfile{
+			DefaultAction: "SCMP_ACT_ALLOW",
+			Syscalls:      []SeccompSyscall{{Names: defaultDenied, Action: "SCMP_ACT_ERRNO"}},
+		}, nil
+	}
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("reading seccomp profile: %w", err)
+	}
+	var profile SeccompProfile
+	if err := json.Unmarshal(data, &profile); err != nil {
+		return nil, fmt.Errorf("parsing seccomp profile %s: %w", name, err)
+	}
+	return &profile, nil
+}
+
+// seccompAction returns the filter return value of the action.
+func seccompAction(action string, errnoRet *uint) (uint32, error) {
+	errno := uint32(unix.EPERM)
+	if errnoRet != nil {
+		errno = uint32(*errnoRet)
+	}
+	switch action {
+	case "SCMP_ACT_ALLOW":
+		return unix.SECCOMP_RET_ALLOW, nil
+	case "SCMP_ACT_ERRNO":
+		return unix.SECCOMP_RET_ERRNO | errno&unix.SECCOMP_RET_DATA, nil
+	case "SCMP_ACT_KILL", "SCMP_ACT_KILL_THREAD":
+		return unix.SECCOMP_RET_KILL_THREAD, nil
+	case "SCMP_ACT_KILL_PROCESS":
+		return unix.SECCOMP_RET_KILL_PROCESS, nil
+	case "SCMP_ACT_TRAP":
+		return unix.SECCOMP_RET_TRAP, nil
+	case "SCMP_ACT_LOG":
+		return unix.SECCOMP_RET_LOG, nil
+	}
+	return 0, fmt.Errorf("unsupported seccomp action %q", action)
+}
+
+// compile translates the profile into a BPF program. Syscalls unknown on
+// this architecture are skipped, so profiles covering several architectures
+// can be used. Syscalls listed more than once get their first action.
+func (p *SeccompProfile) compile() ([]unix.SockFilter, error) {
+	if syscallNumbers == nil {
+		return nil, errors.New("seccomp profiles are not supported on " + runtime.GOARCH)
+	}
+	defaultAction, err := seccompAction(p.DefaultAction, p.DefaultErrnoRet)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := func(code uint16, k uint32) unix.SockFilter {
+		return unix.SockFilter{Code: code, K: k}
+	}
+	const (
+		ld   = unix.BPF_LD | unix.BPF_W | unix.BPF_ABS
+		jeq  = unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K
+		jge  = unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K
+		ret  = unix.BPF_RET | unix.BPF_K
+		arch = 4 // offsetof(struct seccomp_data, arch)
+		nr   = 0 // offsetof(struct seccomp_data, nr)
+	)
+
+	// syscalls of other architectures, ie. 32-bit ones on 64-bit
+	// systems, have different numbers and are not allowed at all
+	prog := []unix.SockFilter{
+		stmt(ld, arch),
+		{Code: jeq, Jt: 1, K: auditArch},
+		stmt(ret, unix.SECCOMP_RET_KILL_PROCESS),
+		stmt(ld, nr),
+	}
+	if runtime.GOARCH == "amd64" {
+		prog = append(prog,
+			unix.SockFilter{Code: jge, Jf: 1, K: x32SyscallBit},
+			stmt(ret, unix.SECCOMP_RET_ERRNO|uint32(unix.EPERM)),
+		)
+	}
+
+	seen := make(map[uint32]bool)
+	for _, rule := range p.Syscalls {
+		if len(rule.Args) > 0 && string(rule.Args) != "null" && string(rule.Args) != "[]" {
+			return nil, fmt.Errorf("seccomp argument filters are not supported (syscalls %v)", rule.Names)
+		}
+		action, err := seccompAction(rule.Action, rule.ErrnoRet)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range rule.Names {
+			n, ok := syscallNumbers[name]
+			if !ok || seen[n] {
+				continue
+			}
+			seen[n] = true
+			prog = append(prog,
+				unix.SockFilter{Code: jeq, Jf: 1, K: n},
+				stmt(ret, action),
+			)
+		}
+	}
+	prog = append(prog, stmt(ret, defaultAction))
+
+	if len(prog) > unix.BPF_MAXINSNS {
+		return nil, fmt.Errorf("seccomp profile too large: %d instructions", len(prog))
+	}
+	return prog, nil
+}
+
+// installSeccomp applies the profile to the calling thread. It requires
+// no_new_privs or CAP_SYS_ADMIN.
+func installSeccomp(name string) error {
+	profile, err := loadSeccompProfile(name)
+	if err != nil {
+		return err
+	}
+	filter, err := profile.compile()
+	if err != nil {
+		return err
+	}
+	prog := unix.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+	if err := unix.Prctl(unix.PR_SET_SECCOMP, unix.SECCOMP_MODE_FILTER, uintptr(unsafe.Pointer(&prog)), 0, 0); err != nil {
+		return fmt.Errorf("installing seccomp profile: %w", err)
+	}
+	return nil
+}
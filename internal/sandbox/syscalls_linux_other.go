@@ -0,0 +1,9 @@
+//go:build linux && !amd64 && !arm64
+
+package sandbox
+
+// seccomp profiles are only supported on the architectures with a syscall
+// table, see mksyscalls.go.
+const auditArch = 0
+
+var syscallNumbers map[string]uint32
@@ -5,6 +5,7 @@ import (
 	"io"
 	"log/slog"
 	"os"
+	"sync"
 )
 
 type LogInit struct {
@@ -14,6 +15,7 @@ type LogInit struct {
 	json         bool
 	handler      slog.Handler
 	rootLogger   *slog.Logger
+	file         *logFile
 }
 
 func NewLogInit() *LogInit {
@@ -45,10 +47,11 @@ func (l *LogInit) SetJSON(json bool) {
 func (l *LogInit) InitLogger() *slog.Logger {
 	var destination io.Writer = os.Stdout
 	if l.filePath != "" {
-		file, err := os.OpenFile(l.filePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o666)
-		if err != nil {
+		file := &logFile{path: l.filePath}
+		if err := file.Reopen(); err != nil {
 			l.PreInitLogf("error opening log file %q: %v", l.filePath, err)
 		} else {
+			l.file = file
 			destination = file
 		}
 	}
@@ -71,3 +74,43 @@ func (l *LogInit) InitLogger() *slog.Logger {
 func (l *LogInit) ShouldExit() bool {
 	return len(l.preInitQueue) > 0
 }
+
+// ReopenLogFile closes and reopens the log file, so logs continue in a new
+// file after the old one was moved away, ie. by logrotate. It does nothing
+// when logging to stdout.
+func (l *LogInit) ReopenLogFile() error {
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Reopen()
+}
+
+// logFile is a log file which can be reopened while it is written to.
+type logFile struct {
+	path string
+
+	mu sync.Mutex
+	f  *os.File
+}
+
+func (f *logFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.f.Write(p)
+}
+
+// Reopen opens the file at the path again and closes the previously opened
+// file. The previous file is kept if the path can't be opened.
+func (f *logFile) Reopen() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o666)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.f != nil {
+		_ = f.f.Close()
+	}
+	f.f = file
+	return nil
+}
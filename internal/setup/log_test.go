@@ -0,0 +1,37 @@
+package setup
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReopenLogFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "webhook.log")
+	defer slog.SetDefault(slog.Default())
+	l := NewLogInit()
+	l.SetLogFile(path)
+	logger := l.InitLogger()
+
+	logger.Error("before rotation")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	logger.Error("still old file")
+	if err := l.ReopenLogFile(); err != nil {
+		t.Fatal(err)
+	}
+	logger.Error("after rotation")
+
+	for file, want := range map[string]int{path + ".1": 2, path: 1} {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lines := bytes.Count(data, []byte("\n")); lines != want {
+			t.Errorf("expected %d lines in %s, got %d:\n%s", want, file, lines, data)
+		}
+	}
+}
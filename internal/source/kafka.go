@@ -0,0 +1,71 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+// defaultKafkaGroupID is the consumer group used when the hook does not
+// specify one.
+const defaultKafkaGroupID = "webhook"
+
+func (r *Runner) startKafka(ctx context.Context, hookID string, cfg hook.KafkaSource) error {
+	if len(cfg.Brokers) == 0 || cfg.Topic == "" {
+		return fmt.Errorf("hook %s: kafka source requires brokers and topic", hookID)
+	}
+	if cfg.GroupID == "" {
+		cfg.GroupID = defaultKafkaGroupID
+	}
+	logger := r.logger.With("hook_id", hookID, "kafka.topic", cfg.Topic, "kafka.group_id", cfg.GroupID)
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers: cfg.Brokers,
+		Topic:   cfg.Topic,
+		GroupID: cfg.GroupID,
+	})
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		defer func() { _ = reader.Close() }()
+		logger.Info("kafka consumer started")
+		for {
+			msg, err := reader.FetchMessage(ctx)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				logger.Error("error fetching kafka message", "error", err)
+				if !sleep(ctx, retryInterval) {
+					return
+				}
+				continue
+			}
+
+			headers := make(http.Header, len(msg.Headers))
+			for _, h := range msg.Headers {
+				headers.Add(h.Key, string(h.Value))
+			}
+			req := newRequest(msg.Value, cfg.ContentType, headers)
+			req.Route = "kafka:" + cfg.Topic
+			logger.Info("kafka message received",
+				"request_id", req.ID,
+				"kafka.partition", msg.Partition,
+				"kafka.offset", msg.Offset,
+			)
+			if err := r.dispatch(ctx, hookID, req); err != nil {
+				logger.Error("error handling kafka message", "request_id", req.ID, "error", err)
+			}
+			// messages are committed regardless of the outcome, a failing
+			// command must not block the partition
+			if err := reader.CommitMessages(ctx, msg); err != nil && ctx.Err() == nil {
+				logger.Error("error committing kafka message", "request_id", req.ID, "error", err)
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,96 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+	"github.com/kaufland-ecommerce/ci-webhook/internal/middleware"
+)
+
+// MQTTTopicHeader is the request header carrying the topic a message was
+// published on, useful with wildcard subscriptions.
+const MQTTTopicHeader = "X-Mqtt-Topic"
+
+func (r *Runner) startMQTT(ctx context.Context, hookID string, cfg hook.MQTTSource) error {
+	opts, err := mqttClientOptions(hookID, &cfg)
+	if err != nil {
+		return err
+	}
+	logger := r.logger.With("hook_id", hookID, "mqtt.topic", cfg.Topic, "mqtt.client_id", cfg.ClientID)
+
+	handle := func(_ mqtt.Client, msg mqtt.Message) {
+		req := mqttRequest(msg, cfg)
+		logger.Info("mqtt message received", "request_id", req.ID, "mqtt.message_id", msg.MessageID())
+		if err := r.dispatch(ctx, hookID, req); err != nil {
+			logger.Error("error handling mqtt message", "request_id", req.ID, "error", err)
+		}
+	}
+	// subscriptions are renewed on every (re)connect
+	opts.SetOnConnectHandler(func(c mqtt.Client) {
+		logger.Info("connected to mqtt broker")
+		token := c.Subscribe(cfg.Topic, cfg.QoS, handle)
+		go func() {
+			if token.Wait(); token.Error() != nil {
+				logger.Error("error subscribing to mqtt topic", "error", token.Error())
+			}
+		}()
+	})
+	opts.SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+		logger.Warn("connection to mqtt broker lost", "error", err)
+	})
+
+	client := mqtt.NewClient(opts)
+	client.Connect()
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		<-ctx.Done()
+		client.Disconnect(250)
+	}()
+	return nil
+}
+
+// mqttClientOptions validates the source and returns the options of its
+// client, without handlers. A client ID is generated if none is configured.
+func mqttClientOptions(hookID string, cfg *hook.MQTTSource) (*mqtt.ClientOptions, error) {
+	if cfg.Broker == "" || cfg.Topic == "" {
+		return nil, fmt.Errorf("hook %s: mqtt source requires broker and topic", hookID)
+	}
+	if cfg.QoS > 2 {
+		return nil, fmt.Errorf("hook %s: invalid mqtt qos %d", hookID, cfg.QoS)
+	}
+	if cfg.ClientID == "" {
+		cfg.ClientID = "webhook-" + middleware.NewReqID()
+	}
+	opts := mqtt.NewClientOptions().
+		AddBroker(cfg.Broker).
+		SetClientID(cfg.ClientID).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		// run handlers concurrently, commands may take a while
+		SetOrderMatters(false)
+	if cfg.TLS != nil {
+		tlsConfig, err := newTLSConfig(cfg.TLS)
+		if err != nil {
+			return nil, fmt.Errorf("hook %s: %w", hookID, err)
+		}
+		opts.SetTLSConfig(tlsConfig)
+	}
+	return opts, nil
+}
+
+// mqttRequest creates the hook request for a received message.
+func mqttRequest(msg mqtt.Message, cfg hook.MQTTSource) *hook.Request {
+	headers := http.Header{}
+	headers.Set(MQTTTopicHeader, msg.Topic())
+	req := newRequest(msg.Payload(), cfg.ContentType, headers)
+	req.Route = "mqtt:" + cfg.Topic
+	return req
+}
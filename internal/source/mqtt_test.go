@@ -0,0 +1,94 @@
+package source
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+func TestMQTTClientOptions(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.pem")
+	for _, tt := range []struct {
+		desc string
+		cfg  hook.MQTTSource
+		err  string
+	}{
+		{"valid", hook.MQTTSource{Broker: "tcp://localhost:1883", Topic: "deploy/#", QoS: 2}, ""},
+		{"missing broker", hook.MQTTSource{Topic: "deploy/#"}, "hook deploy: mqtt source requires broker and topic"},
+		{"missing topic", hook.MQTTSource{Broker: "tcp://localhost:1883"}, "hook deploy: mqtt source requires broker and topic"},
+		{"invalid qos", hook.MQTTSource{Broker: "tcp://localhost:1883", Topic: "deploy/#", QoS: 3}, "hook deploy: invalid mqtt qos 3"},
+		{"invalid tls", hook.MQTTSource{Broker: "ssl://localhost:8883", Topic: "deploy/#", TLS: &hook.TLSConfig{CAFile: missing}}, "hook deploy: error reading CA file"},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			opts, err := mqttClientOptions("deploy", &tt.cfg)
+			if tt.err != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if len(opts.Servers) != 1 || opts.Servers[0].String() != tt.cfg.Broker {
+				t.Errorf("expected broker %s, got %v", tt.cfg.Broker, opts.Servers)
+			}
+		})
+	}
+
+	cfg := hook.MQTTSource{Broker: "tcp://localhost:1883", Topic: "deploy"}
+	opts, err := mqttClientOptions("deploy", &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(cfg.ClientID, "webhook-") || opts.ClientID != cfg.ClientID {
+		t.Errorf("expected a generated client ID, got %q and %q", cfg.ClientID, opts.ClientID)
+	}
+	cfg = hook.MQTTSource{Broker: "tcp://localhost:1883", Topic: "deploy", ClientID: "ci", TLS: &hook.TLSConfig{InsecureSkipVerify: true}}
+	opts, err = mqttClientOptions("deploy", &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.ClientID != "ci" || opts.TLSConfig == nil || !opts.TLSConfig.InsecureSkipVerify {
+		t.Errorf("expected the configured client ID and TLS settings, got %q and %+v", opts.ClientID, opts.TLSConfig)
+	}
+}
+
+// mqttMessage is a received MQTT message.
+type mqttMessage struct {
+	topic   string
+	payload []byte
+}
+
+func (m mqttMessage) Duplicate() bool   { return false }
+func (m mqttMessage) Qos() byte         { return 1 }
+func (m mqttMessage) Retained() bool    { return false }
+func (m mqttMessage) Topic() string     { return m.topic }
+func (m mqttMessage) MessageID() uint16 { return 1 }
+func (m mqttMessage) Payload() []byte   { return m.payload }
+func (m mqttMessage) Ack()              {}
+
+func TestMQTTRequest(t *testing.T) {
+	msg := mqttMessage{topic: "deploy/app", payload: []byte(`{"ref": "main"}`)}
+
+	r := mqttRequest(msg, hook.MQTTSource{Topic: "deploy/+"})
+	if r.Route != "mqtt:deploy/+" {
+		t.Errorf("expected the subscribed topic as route, got %q", r.Route)
+	}
+	if r.Headers[MQTTTopicHeader] != "deploy/app" {
+		t.Errorf("expected the topic of the message as header, got %v", r.Headers)
+	}
+	if string(r.Body) != `{"ref": "main"}` || r.ContentType != DefaultContentType {
+		t.Errorf("expected the payload as JSON body, got %q of %q", r.Body, r.ContentType)
+	}
+	if r.ID == "" {
+		t.Error("expected request ID to be generated")
+	}
+
+	r = mqttRequest(msg, hook.MQTTSource{Topic: "deploy/+", ContentType: "application/x-www-form-urlencoded"})
+	if r.ContentType != "application/x-www-form-urlencoded" {
+		t.Errorf("expected configured content type, got %q", r.ContentType)
+	}
+}
@@ -0,0 +1,78 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"cloud.google.com/go/pubsub/v2"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+func (r *Runner) startPubSub(ctx context.Context, hookID string, cfg hook.PubSubSource) error {
+	if cfg.Subscription == "" {
+		return fmt.Errorf("hook %s: pubsub source requires subscription", hookID)
+	}
+	project := pubSubProject(cfg)
+	logger := r.logger.With("hook_id", hookID, "pubsub.subscription", cfg.Subscription)
+
+	client, err := pubsub.NewClient(ctx, project)
+	if err != nil {
+		return fmt.Errorf("hook %s: error creating pubsub client: %w", hookID, err)
+	}
+	subscriber := client.Subscriber(cfg.Subscription)
+	if cfg.MaxOutstandingMessages != 0 {
+		subscriber.ReceiveSettings.MaxOutstandingMessages = cfg.MaxOutstandingMessages
+	}
+
+	handle := func(ctx context.Context, msg *pubsub.Message) {
+		headers := make(http.Header, len(msg.Attributes))
+		for k, v := range msg.Attributes {
+			headers.Set(k, v)
+		}
+		req := newRequest(msg.Data, cfg.ContentType, headers)
+		req.Route = "pubsub:" + cfg.Subscription
+		logger.Info("pubsub message received", "request_id", req.ID, "pubsub.message_id", msg.ID)
+		if err := r.dispatch(ctx, hookID, req); err != nil {
+			logger.Error("error handling pubsub message", "request_id", req.ID, "error", err)
+			// redeliver the message according to the subscription's retry policy
+			msg.Nack()
+			return
+		}
+		msg.Ack()
+	}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		defer func() { _ = client.Close() }()
+		logger.Info("pubsub subscriber started")
+		for {
+			err := subscriber.Receive(ctx, handle)
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Error("error receiving pubsub messages", "error", err)
+			if !sleep(ctx, retryInterval) {
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// pubSubProject returns the project of the subscription. Fully qualified
+// subscription names take precedence, otherwise the project is detected from
+// the credentials unless configured explicitly.
+func pubSubProject(cfg hook.PubSubSource) string {
+	// projects/{project}/subscriptions/{subscription}
+	if parts := strings.Split(cfg.Subscription, "/"); len(parts) == 4 && parts[0] == "projects" {
+		return parts[1]
+	}
+	if cfg.Project != "" {
+		return cfg.Project
+	}
+	return pubsub.DetectProjectID
+}
@@ -0,0 +1,125 @@
+// Package source implements trigger sources, which deliver messages to hooks
+// from systems other than the HTTP server, such as message brokers.
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/handler"
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook_manager"
+	"github.com/kaufland-ecommerce/ci-webhook/internal/middleware"
+)
+
+// DefaultContentType is used to parse messages which do not specify one.
+const DefaultContentType = "application/json"
+
+// retryInterval is the pause between attempts after a consumer failed to
+// receive messages.
+const retryInterval = 5 * time.Second
+
+// Runner starts and supervises the consumers for all hooks bound to a source.
+type Runner struct {
+	hooks      *hook_manager.Manager
+	dispatcher *handler.Dispatcher
+	logger     *slog.Logger
+	wg         sync.WaitGroup
+}
+
+func NewRunner(hooks *hook_manager.Manager, dispatcher *handler.Dispatcher, logger *slog.Logger) *Runner {
+	return &Runner{
+		hooks:      hooks,
+		dispatcher: dispatcher,
+		logger:     logger,
+	}
+}
+
+// Start starts a consumer for every loaded hook bound to a source. Consumers
+// run until the context is cancelled. Hooks are resolved again for every
+// message, so reloaded commands and rules are honored, but changes to the
+// source bindings themselves require a restart. If a consumer fails to
+// start, the ones already started are stopped before the error is returned.
+func (r *Runner) Start(ctx context.Context) (err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer func() {
+		if err != nil {
+			cancel()
+			r.wg.Wait()
+		}
+	}()
+	for _, h := range r.hooks.Hooks() {
+		if h.KafkaSource != nil {
+			if err := r.startKafka(ctx, h.ID, *h.KafkaSource); err != nil {
+				return err
+			}
+		}
+		if h.MQTTSource != nil {
+			if err := r.startMQTT(ctx, h.ID, *h.MQTTSource); err != nil {
+				return err
+			}
+		}
+		if h.PubSubSource != nil {
+			if err := r.startPubSub(ctx, h.ID, *h.PubSubSource); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Wait blocks until all consumers have stopped after the context passed to
+// Start was cancelled, including the messages they are handling.
+func (r *Runner) Wait() {
+	r.wg.Wait()
+}
+
+// dispatch runs the hook with the given ID for a received message. Messages
+// which do not satisfy the trigger rules are not reported as errors.
+func (r *Runner) dispatch(ctx context.Context, hookID string, req *hook.Request) error {
+	h := r.hooks.Get(hookID)
+	if h == nil {
+		return fmt.Errorf("hook %s is no longer loaded", hookID)
+	}
+	err := r.dispatcher.Dispatch(ctx, h, req)
+	if errors.Is(err, handler.ErrRulesNotSatisfied) {
+		return nil
+	}
+	return err
+}
+
+// newRequest creates a hook request for a received message. The Content-Type
+// header of the message takes precedence over the configured content type.
+func newRequest(body []byte, contentType string, headers http.Header) *hook.Request {
+	if ct := headers.Get("Content-Type"); ct != "" {
+		contentType = ct
+	}
+	if contentType == "" {
+		contentType = DefaultContentType
+	}
+	r := &hook.Request{
+		ID:          middleware.NewReqID(),
+		ContentType: contentType,
+		Body:        body,
+		ReceivedAt:  time.Now(),
+	}
+	r.ParseHeaders(headers)
+	r.ParseQuery(nil)
+	return r
+}
+
+// sleep pauses for the given duration and reports whether the context is
+// still alive afterward.
+func sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
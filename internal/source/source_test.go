@@ -0,0 +1,90 @@
+package source
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/pubsub/v2"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook_manager"
+)
+
+func TestNewRequest(t *testing.T) {
+	headers := http.Header{}
+	headers.Set("X-Event", "push")
+
+	r := newRequest([]byte(`{"a": 1}`), "", headers)
+	if r.ContentType != DefaultContentType {
+		t.Errorf("expected default content type, got %q", r.ContentType)
+	}
+	if r.Headers["X-Event"] != "push" {
+		t.Errorf("expected header X-Event to be passed, got %v", r.Headers)
+	}
+	if r.ID == "" {
+		t.Error("expected request ID to be generated")
+	}
+
+	r = newRequest(nil, "application/xml", headers)
+	if r.ContentType != "application/xml" {
+		t.Errorf("expected configured content type, got %q", r.ContentType)
+	}
+
+	headers.Set("Content-Type", "application/x-www-form-urlencoded")
+	r = newRequest(nil, "application/xml", headers)
+	if r.ContentType != "application/x-www-form-urlencoded" {
+		t.Errorf("expected message content type to take precedence, got %q", r.ContentType)
+	}
+}
+
+func TestPubSubProject(t *testing.T) {
+	for _, tt := range []struct {
+		cfg  hook.PubSubSource
+		want string
+	}{
+		{hook.PubSubSource{Subscription: "projects/p1/subscriptions/s"}, "p1"},
+		{hook.PubSubSource{Subscription: "projects/p1/subscriptions/s", Project: "p2"}, "p1"},
+		{hook.PubSubSource{Subscription: "s", Project: "p2"}, "p2"},
+		{hook.PubSubSource{Subscription: "s"}, pubsub.DetectProjectID},
+	} {
+		if got := pubSubProject(tt.cfg); got != tt.want {
+			t.Errorf("pubSubProject(%+v) = %q, want %q", tt.cfg, got, tt.want)
+		}
+	}
+}
+
+func TestRunnerStartError(t *testing.T) {
+	hooksFile := filepath.Join(t.TempDir(), "hooks.json")
+	if err := os.WriteFile(hooksFile, []byte(`[
+		{"id": "a", "execute-command": "true", "kafka": {"brokers": ["127.0.0.1:1"], "topic": "a"}},
+		{"id": "b", "execute-command": "true", "mqtt": {"broker": "tcp://127.0.0.1:1", "topic": "b", "qos": 3}}
+	]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hooks := hook_manager.NewManager(ctx, hook_manager.HooksFiles{hooksFile}, false, false)
+	if err := hooks.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRunner(hooks, nil, slog.New(slog.DiscardHandler))
+	if err := r.Start(ctx); err == nil {
+		t.Fatal("expected an error for the invalid mqtt source")
+	}
+	stopped := make(chan struct{})
+	go func() {
+		r.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Error("expected the started kafka consumer to be stopped")
+	}
+}
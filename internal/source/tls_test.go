@@ -0,0 +1,107 @@
+package source
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+// writeCertificate writes a self-signed certificate and its key to dir and
+// returns the paths of the PEM files.
+func writeCertificate(t *testing.T, dir string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "broker"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	for path, block := range map[string]*pem.Block{
+		certFile: {Type: "CERTIFICATE", Bytes: der},
+		keyFile:  {Type: "EC PRIVATE KEY", Bytes: keyDER},
+	} {
+		if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return certFile, keyFile
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCertificate(t, dir)
+	empty := filepath.Join(dir, "empty.pem")
+	if err := os.WriteFile(empty, []byte("no certificates"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "missing.pem")
+
+	for _, tt := range []struct {
+		desc string
+		cfg  hook.TLSConfig
+		err  string
+	}{
+		{"defaults", hook.TLSConfig{}, ""},
+		{"CA and client certificate", hook.TLSConfig{CAFile: certFile, CertFile: certFile, KeyFile: keyFile}, ""},
+		{"missing CA file", hook.TLSConfig{CAFile: missing}, "error reading CA file"},
+		{"CA file without certificates", hook.TLSConfig{CAFile: empty}, "no certificates found in CA file"},
+		{"cert without key", hook.TLSConfig{CertFile: certFile}, "cert-file and key-file must be used together"},
+		{"key without cert", hook.TLSConfig{KeyFile: keyFile}, "cert-file and key-file must be used together"},
+		{"missing key file", hook.TLSConfig{CertFile: certFile, KeyFile: missing}, "error loading client certificate"},
+		{"key file without key", hook.TLSConfig{CertFile: certFile, KeyFile: empty}, "error loading client certificate"},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			cfg, err := newTLSConfig(&tt.cfg)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if cfg.MinVersion != tls.VersionTLS12 {
+				t.Errorf("expected TLS 1.2 at least, got %x", cfg.MinVersion)
+			}
+			if (tt.cfg.CAFile != "") != (cfg.RootCAs != nil) {
+				t.Errorf("expected root CAs only with a CA file, got %v", cfg.RootCAs)
+			}
+			if (tt.cfg.CertFile != "") != (len(cfg.Certificates) == 1) {
+				t.Errorf("expected a client certificate only with a cert file, got %d", len(cfg.Certificates))
+			}
+		})
+	}
+
+	cfg, err := newTLSConfig(&hook.TLSConfig{InsecureSkipVerify: true})
+	if err != nil || !cfg.InsecureSkipVerify {
+		t.Errorf("expected verification to be skipped, got %v", err)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/pprof"
+)
+
+// checkPprofAddress ensures the profiling endpoints are only reachable from
+// the host itself, as they expose internals and can be expensive.
+func checkPprofAddress(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("%q is not a loopback address", host)
+	}
+	return nil
+}
+
+// servePprof serves the net/http/pprof endpoints under /debug/pprof/ on the
+// listener, separate from the hooks.
+func servePprof(ln net.Listener, logger *slog.Logger) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	logger.Info(fmt.Sprintf("serving profiling endpoints on http://%s/debug/pprof/", ln.Addr()))
+	if err := http.Serve(ln, mux); err != nil {
+		logger.Error("error serving profiling endpoints", "error", err)
+	}
+}
@@ -0,0 +1,16 @@
+package main
+
+import "testing"
+
+func TestCheckPprofAddress(t *testing.T) {
+	for _, addr := range []string{"localhost:6060", "127.0.0.1:6060", "[::1]:6060"} {
+		if err := checkPprofAddress(addr); err != nil {
+			t.Errorf("expected %s to be accepted, got %s", addr, err)
+		}
+	}
+	for _, addr := range []string{":6060", "0.0.0.0:6060", "192.0.2.1:6060", "example.com:6060", "localhost"} {
+		if err := checkPprofAddress(addr); err == nil {
+			t.Errorf("expected %s to be rejected", addr)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+)
+
+// lookupIDs resolves the user and group names to the IDs webhook switches to
+// after opening the listening port. Without a group name, the primary group of
+// the user is used. The supplementary groups are the groups the user is a
+// member of.
+func lookupIDs(userName, groupName string) (uid, gid int, groups []int, err error) {
+	u, err := user.Lookup(userName)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	if uid, err = strconv.Atoi(u.Uid); err != nil {
+		return 0, 0, nil, fmt.Errorf("user %s has non-numeric ID %q", userName, u.Uid)
+	}
+
+	gidString := u.Gid
+	if groupName != "" {
+		g, err := user.LookupGroup(groupName)
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		gidString = g.Gid
+	}
+	if gid, err = strconv.Atoi(gidString); err != nil {
+		return 0, 0, nil, fmt.Errorf("group of user %s has non-numeric ID %q", userName, gidString)
+	}
+
+	groupIDs, err := u.GroupIds()
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("looking up groups of user %s: %w", userName, err)
+	}
+	groups = []int{gid}
+	for _, id := range groupIDs {
+		if g, err := strconv.Atoi(id); err == nil && g != gid {
+			groups = append(groups, g)
+		}
+	}
+	return uid, gid, groups, nil
+}
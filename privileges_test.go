@@ -0,0 +1,28 @@
+package main
+
+import (
+	"os/user"
+	"slices"
+	"testing"
+)
+
+func TestLookupIDs(t *testing.T) {
+	root, err := user.LookupId("0")
+	if err != nil {
+		t.Skip("no root user:", err)
+	}
+	uid, gid, groups, err := lookupIDs(root.Username, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uid != 0 || gid != 0 || !slices.Contains(groups, 0) {
+		t.Errorf("expected root user and group, got uid %d, gid %d, groups %v", uid, gid, groups)
+	}
+
+	if _, _, _, err := lookupIDs("no-such-user-for-webhook", ""); err == nil {
+		t.Error("expected error for unknown user")
+	}
+	if _, _, _, err := lookupIDs(root.Username, "no-such-group-for-webhook"); err == nil {
+		t.Error("expected error for unknown group")
+	}
+}
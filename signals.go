@@ -10,7 +10,7 @@ import (
 	"syscall"
 )
 
-func setupSignals(notifyReload func()) {
+func setupSignals(notifyReload func(), reopenLog func() error, shutdown func()) {
 	slog.Info("setting up os signal watcher")
 	signals := make(chan os.Signal, 1)
 
@@ -18,6 +18,7 @@ func setupSignals(notifyReload func()) {
 		signals,
 		syscall.SIGUSR1,
 		syscall.SIGHUP,
+		syscall.SIGUSR2,
 		syscall.SIGTERM,
 		os.Interrupt,
 	)
@@ -30,9 +31,14 @@ func setupSignals(notifyReload func()) {
 			case syscall.SIGUSR1, syscall.SIGHUP:
 				slog.Warn("caught signal", "signal", sig)
 				notifyReload()
+			case syscall.SIGUSR2:
+				slog.Warn("caught signal, reopening log file", "signal", sig)
+				if err := reopenLog(); err != nil {
+					slog.Error("error reopening log file", "error", err)
+				}
 			case os.Interrupt, syscall.SIGTERM:
-				log.Printf("caught %s signal; exiting\n", sig)
-				slog.Warn("caught signal", "signal", sig)
+				slog.Warn("caught signal, terminating running commands", "signal", sig)
+				shutdown()
 				// todo: do proper shutdown, by notifying main loop, and remove this
 				if pidFile != nil {
 					err := pidFile.Remove()
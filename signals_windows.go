@@ -3,6 +3,6 @@
 
 package main
 
-func setupSignals(notifyReload func()) {
+func setupSignals(notifyReload func(), reopenLog func() error, shutdown func()) {
 	// NOOP: Windows doesn't have signals equivalent to the Unix world.
 }
@@ -4,6 +4,7 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"strconv"
 	"strings"
@@ -30,6 +31,14 @@ func main() {
 	if len(os.Args) > 1 {
 		var exitCode string
 		for _, arg := range os.Args[1:] {
+			if arg == "stdin" {
+				fmt.Print("stdin: ")
+				if _, err := io.Copy(os.Stdout, os.Stdin); err != nil {
+					fmt.Printf("could not read stdin: %s", err)
+					os.Exit(-1)
+				}
+				fmt.Println()
+			}
 			if strings.HasPrefix(arg, "sleep=") {
 				timeout, err := time.ParseDuration(arg[6:])
 				if err != nil {
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/kaufland-ecommerce/ci-webhook/internal/handler"
+	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
+)
+
+// runTriggerCommand implements the `webhook trigger` subcommand, which asks a
+// running webhook instance to execute a hook through the admin API.
+func runTriggerCommand(args []string) int {
+	fs := flag.NewFlagSet("trigger", flag.ContinueOnError)
+	serverURL := fs.String("url", "http://127.0.0.1:9000", "base URL of the running webhook instance")
+	token := fs.String("token", os.Getenv("WEBHOOK_ADMIN_TOKEN"), "admin token; defaults to the WEBHOOK_ADMIN_TOKEN environment variable")
+	payload := fs.String("payload", "", "JSON object to use as the hook payload")
+	payloadFile := fs.String("payload-file", "", "read the JSON payload from the given file; use - for stdin")
+	host := fs.String("host", "", "host name of the request, for hooks bound to a host")
+	urlPrefix := fs.String("url-prefix", "", "URL prefix of hooks served under their own prefix")
+	var headers hook.ResponseHeaders
+	fs.Var(&headers, "header", "request header to pass to the hook, specified in format name=value, use multiple times to set multiple headers")
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(fs.Output(), "Usage: webhook trigger [options] <hook-id>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	hookID := fs.Arg(0)
+
+	tr := handler.TriggerRequest{Headers: make(map[string]string), Host: *host, URLPrefix: *urlPrefix}
+	for _, h := range headers {
+		tr.Headers[h.Name] = h.Value
+	}
+	rawPayload := []byte(*payload)
+	if *payloadFile != "" {
+		var err error
+		if *payloadFile == "-" {
+			rawPayload, err = io.ReadAll(os.Stdin)
+		} else {
+			rawPayload, err = os.ReadFile(*payloadFile)
+		}
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, "error reading payload:", err)
+			return 1
+		}
+	}
+	if len(bytes.TrimSpace(rawPayload)) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(rawPayload))
+		decoder.UseNumber()
+		if err := decoder.Decode(&tr.Payload); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, "error parsing payload:", err)
+			return 1
+		}
+	}
+
+	body, err := json.Marshal(tr)
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	endpoint := strings.TrimSuffix(*serverURL, "/") + "/admin/hooks/" + hookID + "/trigger"
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+*token)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "error triggering hook:", err)
+		return 1
+	}
+	defer func() { _ = res.Body.Close() }()
+	_, _ = io.Copy(os.Stdout, res.Body)
+
+	if res.StatusCode >= 300 {
+		_, _ = fmt.Fprintf(os.Stderr, "webhook responded with %s\n", res.Status)
+		return 1
+	}
+	return 0
+}
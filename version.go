@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	runtimedebug "runtime/debug"
+)
+
+// buildInfo describes the running binary, so operators can audit which build
+// is deployed where.
+type buildInfo struct {
+	Version   string `json:"version"`
+	GoVersion string `json:"go_version"`
+	Revision  string `json:"revision,omitempty"`
+	BuildDate string `json:"build_date,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+}
+
+// readBuildInfo returns the version and the VCS information embedded by the
+// Go toolchain. The build date is the time of the built commit, which keeps
+// builds reproducible.
+func readBuildInfo() buildInfo {
+	info := buildInfo{Version: Version, GoVersion: runtime.Version()}
+	bi, ok := runtimedebug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	for _, setting := range bi.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			info.Revision = setting.Value
+		case "vcs.time":
+			info.BuildDate = setting.Value
+		case "vcs.modified":
+			info.Modified = setting.Value == "true"
+		}
+	}
+	return info
+}
+
+// logAttrs returns the build info as log attributes.
+func (info buildInfo) logAttrs() []any {
+	return []any{
+		"version", info.Version,
+		"go_version", info.GoVersion,
+		"revision", info.Revision,
+		"build_date", info.BuildDate,
+		"modified", info.Modified,
+	}
+}
+
+// ServeHTTP responds with the build info as JSON.
+func (info buildInfo) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(info)
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+)
+
+func TestVersionEndpoint(t *testing.T) {
+	rec := httptest.NewRecorder()
+	readBuildInfo().ServeHTTP(rec, httptest.NewRequest("GET", "/version", nil))
+
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected JSON response, got %q", ct)
+	}
+	var info buildInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &info); err != nil {
+		t.Fatalf("invalid response %q: %s", rec.Body.String(), err)
+	}
+	if info.Version != Version || info.GoVersion != runtime.Version() {
+		t.Errorf("unexpected build info %+v", info)
+	}
+}
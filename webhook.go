@@ -9,6 +9,7 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"slices"
 	"strings"
 
 	"github.com/go-chi/chi/v5"
@@ -16,9 +17,12 @@ import (
 	"github.com/kaufland-ecommerce/ci-webhook/internal/handler"
 	"github.com/kaufland-ecommerce/ci-webhook/internal/hook"
 	"github.com/kaufland-ecommerce/ci-webhook/internal/hook_manager"
+	"github.com/kaufland-ecommerce/ci-webhook/internal/jwt"
 	"github.com/kaufland-ecommerce/ci-webhook/internal/middleware"
 	"github.com/kaufland-ecommerce/ci-webhook/internal/pidfile"
+	"github.com/kaufland-ecommerce/ci-webhook/internal/sandbox"
 	"github.com/kaufland-ecommerce/ci-webhook/internal/setup"
+	"github.com/kaufland-ecommerce/ci-webhook/internal/source"
 
 	chimiddleware "github.com/go-chi/chi/v5/middleware"
 )
@@ -34,6 +38,9 @@ var (
 	logJSON            = flag.Bool("log-json", false, "show verbose output")
 	logPath            = flag.String("logfile", "", "send log output to a file; implicitly enables verbose logging")
 	debug              = flag.Bool("debug", false, "show debug output")
+	debugDumpDir       = flag.String("debug-dump-dir", "", "write request dumps of -debug to one file per request in the given directory instead of the log")
+	debugDumpSample    = flag.Float64("debug-dump-sample-rate", 1, "fraction of requests between 0 and 1 dumped by -debug")
+	debugDumpMaxFiles  = flag.Int("debug-dump-max-files", 100, "maximum number of dump files retained in -debug-dump-dir, oldest are removed first; 0 keeps all")
 	noPanic            = flag.Bool("nopanic", false, "do not panic if hooks cannot be loaded when webhook is not running in verbose mode")
 	hotReload          = flag.Bool("hotreload", false, "watch hooks file for changes and reload them automatically")
 	hooksURLPrefix     = flag.String("urlprefix", "hooks", "url prefix to use for served hooks (protocol://yourserver:port/PREFIX/:hook-id)")
@@ -47,22 +54,55 @@ var (
 	tlsCipherSuites    = flag.String("cipher-suites", "", "comma-separated list of supported TLS cipher suites")
 	useXRequestID      = flag.Bool("x-request-id", false, "use X-Request-Id header, if present, as request ID")
 	xRequestIDLimit    = flag.Int("x-request-id-limit", 0, "truncate X-Request-Id header to limit; default no limit")
+	requestIDFormat    = flag.String("request-id-format", middleware.RequestIDShort, "format of generated request IDs: short, uuidv4, uuidv7 or ulid")
+	requestIDHeader    = flag.String("request-id-header", "X-Request-Id", "name of the response header returning the request ID; empty to omit the header")
 	maxMultipartMem    = flag.Int64("max-multipart-mem", 1<<20, "maximum memory in bytes for parsing multipart form data before disk caching")
-	setGID             = flag.Int("setgid", 0, "set group ID after opening listening port; must be used with setuid")
+	compressMinSize    = flag.Int("compress-min-size", 0, "compress captured command output responses of at least the given size in bytes with gzip for clients accepting it; default no compression")
+	bodyReadTimeout    = flag.Duration("body-read-timeout", 0, "maximum time for receiving the body of a hook request, slower requests are rejected with 408; hooks may override it; default no limit")
+	setGID             = flag.Int("setgid", 0, "set group ID, and the supplementary groups to it, after opening listening port; must be used with setuid")
 	setUID             = flag.Int("setuid", 0, "set user ID after opening listening port; must be used with setgid")
+	setUser            = flag.String("setuser", "", "set user and supplementary groups by user name after opening listening port; alternative to setuid and setgid")
+	setGroup           = flag.String("setgroup", "", "set group by name after opening listening port instead of the primary group of setuser; must be used with setuser")
 	httpMethods        = flag.String("http-methods", "", `set default allowed HTTP methods (ie. "POST"); separate methods with comma`)
-	pidPath            = flag.String("pidfile", "", "create PID file at the given path")
+	pidPath            = flag.String("pidfile", "", "create and lock PID file at the given path, refusing to start while another instance holds it")
 	withTracing        = flag.Bool("trace", false, "enable OTEL tracing for webhook operations")
-
-	responseHeaders hook.ResponseHeaders
-	hooksFiles      hook_manager.HooksFiles
+	maxConcurrentExecs = flag.Int("max-concurrent-executions", 0, "maximum number of hook commands running at the same time, further executions are queued by hook priority; default no limit")
+	maxInFlight        = flag.Int("max-in-flight", 0, "maximum number of requests handled at the same time, further requests are rejected with 503; default no limit")
+	maxStreams         = flag.Int("max-streaming-connections", 0, "maximum number of simultaneous requests to hooks streaming their command output, further requests are rejected with 503; default no limit")
+	rateLimit          = flag.Float64("rate-limit", 0, "maximum number of requests per second from a single client IP address, further requests are rejected with 429; default no limit")
+	rateLimitBurst     = flag.Int("rate-limit-burst", 10, "number of requests a client IP address may send at once before -rate-limit applies")
+	rateLimitExempt    = flag.String("rate-limit-exempt", "", "comma-separated list of client IP addresses or CIDR ranges which are not rate limited")
+	trustedProxies     = flag.String("trusted-proxies", "", "comma-separated list of proxy IP addresses or CIDR ranges whose X-Forwarded-For header determines the client IP address for -rate-limit")
+	oidcIssuer         = flag.String("oidc-issuer", "", "require an OpenID Connect bearer token of the given issuer for all hooks")
+	oidcAudience       = flag.String("oidc-audience", "", "audience required in the OpenID Connect bearer token; must be used with -oidc-issuer")
+	oidcJWKSURL        = flag.String("oidc-jwks-url", "", "URL of the signing keys of the OpenID Connect issuer; default discovered from the issuer")
+	adminToken         = flag.String("admin-token", "", "enable the admin API under /admin, the activity feed under /events and the runtime stats under /debug/stats, authenticated with the given bearer token")
+	notFoundCode       = flag.Int("not-found-code", 0, "HTTP status code returned for requests not matching any hook; default 404, or 302 with -not-found-redirect")
+	notFoundMessage    = flag.String("not-found-message", "", `response body returned for requests not matching any hook; default "Hook not found." unless redirecting`)
+	notFoundRedirect   = flag.String("not-found-redirect", "", "redirect requests not matching any hook to the given URL")
+	pprofAddr          = flag.String("pprof", "", "serve the net/http/pprof profiling endpoints on the given loopback address, ie. localhost:6060")
+
+	responseHeaders         hook.ResponseHeaders
+	notFoundResponseHeaders hook.ResponseHeaders
+	hooksFiles              hook_manager.HooksFiles
 
 	pidFile *pidfile.PIDFile
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "trigger" {
+		os.Exit(runTriggerCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "convert" {
+		os.Exit(runConvertCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == sandbox.Command {
+		sandbox.Main(os.Args[2:])
+	}
+
 	flag.Var(&hooksFiles, "hooks", "path to the json file containing defined hooks the webhook should serve, use multiple times to load from different files")
 	flag.Var(&responseHeaders, "header", "response header to return, specified in format name=value, use multiple times to set multiple headers")
+	flag.Var(&notFoundResponseHeaders, "not-found-header", "response header to return for requests not matching any hook, specified in format name=value, use multiple times to set multiple headers")
 
 	flag.Parse()
 
@@ -85,6 +125,59 @@ func main() {
 		os.Exit(1)
 	}
 
+	if *debugDumpSample < 0 || *debugDumpSample > 1 {
+		fmt.Println("error: debug-dump-sample-rate must be between 0 and 1")
+		os.Exit(1)
+	}
+
+	if *setUser != "" && (*setUID != 0 || *setGID != 0) {
+		fmt.Println("error: setuser can't be used together with setuid and setgid")
+		os.Exit(1)
+	}
+	if *setGroup != "" && *setUser == "" {
+		fmt.Println("error: setgroup option must be used together with setuser")
+		os.Exit(1)
+	}
+
+	if *oidcIssuer != "" && *oidcAudience == "" {
+		fmt.Println("error: oidc-issuer option must be used together with oidc-audience")
+		os.Exit(1)
+	}
+	// the supplementary groups of root are dropped along with its IDs
+	uid, gid, groups := *setUID, *setGID, []int{*setGID}
+	if *setUser != "" {
+		var err error
+		uid, gid, groups, err = lookupIDs(*setUser, *setGroup)
+		if err != nil {
+			fmt.Println("error: resolving setuser and setgroup:", err)
+			os.Exit(1)
+		}
+	}
+
+	trustedProxyNets, err := middleware.ParseCIDRs(*trustedProxies)
+	if err != nil {
+		fmt.Println("error: invalid trusted-proxies:", err)
+		os.Exit(1)
+	}
+	rateLimitExemptNets, err := middleware.ParseCIDRs(*rateLimitExempt)
+	if err != nil {
+		fmt.Println("error: invalid rate-limit-exempt:", err)
+		os.Exit(1)
+	}
+
+	if *pprofAddr != "" {
+		if err := checkPprofAddress(*pprofAddr); err != nil {
+			fmt.Println("error: invalid pprof address:", err)
+			os.Exit(1)
+		}
+	}
+
+	generateRequestID, err := middleware.RequestIDGenerator(*requestIDFormat)
+	if err != nil {
+		fmt.Println("error:", err)
+		os.Exit(1)
+	}
+
 	logInit := setup.NewLogInit()
 
 	if *debug || *logPath != "" {
@@ -103,9 +196,17 @@ func main() {
 		logInit.PreInitLogf("error listening on port: %s", err)
 		// we'll bail out below
 	}
+	var pprofLn net.Listener
+	if *pprofAddr != "" {
+		pprofLn, err = net.Listen("tcp", *pprofAddr)
+		if err != nil {
+			logInit.PreInitLogf("error listening on pprof address: %s", err)
+			// we'll bail out below
+		}
+	}
 
-	if *setUID != 0 {
-		if err := dropPrivileges(*setUID, *setGID); err != nil {
+	if uid != 0 || *setUser != "" {
+		if err := dropPrivileges(uid, gid, groups); err != nil {
 			logInit.PreInitLogf("error dropping privileges: %s", err)
 			// we'll bail out below
 		}
@@ -128,6 +229,9 @@ func main() {
 			logger.Error("failed creating pidfile", "error", err, "path", *pidPath)
 			os.Exit(1)
 		}
+		if pid := pidFile.StalePID(); pid != 0 {
+			logger.Warn("replaced stale pidfile of exited process", "pid", pid, "path", *pidPath)
+		}
 
 		defer func() {
 			// NOTE: my testing shows that this doesn't work with
@@ -137,7 +241,12 @@ func main() {
 			}
 		}()
 	}
-	logger.Info("webhook server starting", "version", Version, "address", addr)
+	if pprofLn != nil {
+		go servePprof(pprofLn, logger.With("logger", "pprof"))
+	}
+
+	build := readBuildInfo()
+	logger.Info("webhook server starting", append(build.logAttrs(), "address", addr)...)
 
 	// global context
 	ctx, cancel := context.WithCancel(context.Background())
@@ -149,9 +258,6 @@ func main() {
 		logger.Error("error loading hooks", "error", err)
 		os.Exit(1)
 	}
-	// set os signal watcher
-	setupSignals(hooks.Notify)
-
 	if !*verbose && !*noPanic && hooks.Len() < 1 {
 		logger.Error("couldn't load any hooks from file!\n" +
 			"aborting webhook execution since the -verbose flag is set to false.\n" +
@@ -174,13 +280,79 @@ func main() {
 		os.Exit(1)
 	}
 
+	// executions of all requests and trigger sources are coordinated by a single scheduler
+	scheduler := handler.NewScheduler(*maxConcurrentExecs)
+	// activity of all hooks, streamed to operators under /events
+	activity := handler.NewActivityFeed()
+	// results of the previous executions and circuits of failing hooks, kept
+	// across reloads
+	lastRuns := handler.NewLastRuns()
+	circuits := handler.NewCircuitBreakers()
+	// running commands, terminated on shutdown
+	processes := handler.NewProcesses()
+
+	// start consumers for hooks bound to trigger sources
+	sourceLogger := logger.With("logger", "source")
+	sourcesCtx, stopSources := context.WithCancel(ctx)
+	sources := source.NewRunner(hooks, handler.NewDispatcher(hooks, scheduler, activity, lastRuns, circuits, processes, sourceLogger), sourceLogger)
+	if err := sources.Start(sourcesCtx); err != nil {
+		logger.Error("error starting trigger sources", "error", err)
+		os.Exit(1)
+	}
+
+	// set os signal watcher; on shutdown the consumers stop receiving
+	// messages before the running commands are terminated
+	setupSignals(hooks.Notify, logInit.ReopenLogFile, func() {
+		stopSources()
+		processes.Terminate()
+		sources.Wait()
+	})
+
+	// asynchronous executions can be awaited under /jobs
+	jobs := handler.NewJobRegistry()
+
+	// stored command outputs are removed according to the retention
+	// policies of their hooks
+	go handler.NewRetentionJanitor(hooks, logger.With("logger", "retention")).Run(ctx)
+
+	// requests are dumped for all hooks with -debug, otherwise only for the
+	// hooks being debugged
+	dumper := middleware.Dumper(log.Writer(),
+		middleware.DumpDirOption(*debugDumpDir),
+		middleware.DumpSampleRateOption(*debugDumpSample),
+		middleware.DumpMaxFilesOption(*debugDumpMaxFiles),
+	)
+	debugHooks := handler.NewDebugHooks(dumper)
+	if *debug {
+		debugHooks = handler.NewDebugHooks(nil)
+	}
+
+	// response to requests not matching any hook
+	notFound := handler.NotFoundResponse{
+		StatusCode:  *notFoundCode,
+		Message:     *notFoundMessage,
+		Headers:     append(slices.Clone(responseHeaders), notFoundResponseHeaders...),
+		RedirectURL: *notFoundRedirect,
+	}
+
 	// setup Request Handler
 	var reqHandler http.Handler = handler.NewRequestHandler(
 		hooks,
+		scheduler,
+		jobs,
+		activity,
+		lastRuns,
+		circuits,
+		processes,
+		debugHooks,
 		logger,
 		responseHeaders,
 		parseMethodList(*httpMethods),
 		*maxMultipartMem,
+		*maxStreams,
+		notFound,
+		*bodyReadTimeout,
+		*compressMinSize,
 	)
 
 	// setup tracing
@@ -199,12 +371,21 @@ func main() {
 	r.Use(middleware.RequestID(
 		middleware.UseXRequestIDHeaderOption(*useXRequestID),
 		middleware.XRequestIDLimitOption(*xRequestIDLimit),
+		middleware.RequestIDGeneratorOption(generateRequestID),
+		middleware.ResponseHeaderOption(*requestIDHeader),
 	))
 	r.Use(chimiddleware.RequestLogger(middleware.NewLogFormatter(logger.With("logger", "http"))))
 	r.Use(chimiddleware.Recoverer)
+	if *rateLimit > 0 {
+		r.Use(middleware.RateLimit(*rateLimit, *rateLimitBurst,
+			middleware.TrustedProxiesOption(trustedProxyNets),
+			middleware.ExemptOption(rateLimitExemptNets),
+		))
+	}
+	r.Use(middleware.MaxInFlight(*maxInFlight))
 
 	if *debug {
-		r.Use(middleware.Dumper(log.Writer()))
+		r.Use(dumper)
 	}
 	// healthcheck handler
 	r.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) {
@@ -213,11 +394,41 @@ func main() {
 		}
 		_, _ = fmt.Fprint(w, "OK")
 	})
+	// build info of the running binary
+	r.Method(http.MethodGet, "/version", build)
+	// admin API
+	if *adminToken != "" {
+		adminHandler := handler.NewAdminHandler(hooks, scheduler, activity, lastRuns, circuits, processes, debugHooks, logger.With("logger", "admin"))
+		r.With(middleware.BearerAuth(*adminToken)).Mount("/admin", adminHandler.Routes())
+		r.With(middleware.BearerAuth(*adminToken)).Get("/events", activity.ServeHTTP)
+		r.With(middleware.BearerAuth(*adminToken)).Method(http.MethodGet, "/debug/stats", handler.NewStatsHandler(hooks, scheduler, processes))
+	}
+	// job status of asynchronous executions, the job ID acts as the credential
+	r.Mount("/jobs", jobs.Routes())
 	// hooks handler
-	r.Handle(
+	hookRoutes := chi.Chain()
+	if *oidcIssuer != "" {
+		jwksURL := *oidcJWKSURL
+		if jwksURL == "" {
+			jwksURL, err = jwt.DiscoverKeySet(ctx, *oidcIssuer)
+			if err != nil {
+				logger.Error("error discovering OIDC signing keys", "error", err)
+				os.Exit(1)
+			}
+		}
+		hookRoutes = append(hookRoutes, middleware.OIDC(jwt.Remote(jwksURL), jwt.Validation{
+			Issuer:   *oidcIssuer,
+			Audience: *oidcAudience,
+		}, logger.With("logger", "oidc")))
+	}
+	r.With(hookRoutes...).Handle(
 		handler.MakeRoutePattern(hooksURLPrefix),
 		reqHandler,
 	)
+	// hooks with their own URL prefix are looked up by the path of requests
+	// matching no route, which are answered with the not found response
+	// otherwise
+	r.NotFound(hookRoutes.Handler(reqHandler).ServeHTTP)
 	// Create common HTTP server settings
 	server := &http.Server{
 		Addr:    addr,
@@ -147,6 +147,10 @@ func TestWebhook(t *testing.T) {
 					}
 				}
 
+				if res.Header.Get("X-Request-Id") == "" {
+					t.Errorf("failed %q (id: %s): response lacks the X-Request-Id header", tt.desc, tt.id)
+				}
+
 				if tt.logMatch == "" {
 					return
 				}
@@ -166,6 +170,110 @@ func TestWebhook(t *testing.T) {
 	}
 }
 
+func TestManualTrigger(t *testing.T) {
+	hookecho, cleanupHookecho := buildHookecho(t)
+	defer cleanupHookecho()
+
+	webhook, cleanupWebhookFn := buildWebhook(t)
+	defer cleanupWebhookFn()
+
+	configPath, cleanupConfigFn := genConfig(t, hookecho, "test/hooks.yaml.tmpl")
+	defer cleanupConfigFn()
+
+	ip, port := serverAddress(t)
+	cmd, b := startWebhook(t, webhook, fmt.Sprintf("-hooks=%s", configPath), fmt.Sprintf("-ip=%s", ip), fmt.Sprintf("-port=%s", port), "-admin-token=s3cret")
+	defer killAndWait(cmd)
+	waitForServerReady(t, ip, port)
+
+	url := fmt.Sprintf("http://%s:%s/admin/hooks/gitlab/trigger", ip, port)
+	body := `{"payload": {"user_name": "operator", "commits": [{"id": "abc"}]}}`
+
+	res, err := http.Post(url, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("unauthenticated trigger failed: %s", err)
+	}
+	_ = res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected status %d for unauthenticated trigger, got %d", http.StatusUnauthorized, res.StatusCode)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer s3cret")
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("trigger failed: %s", err)
+	}
+	out, _ := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	if res.StatusCode != http.StatusOK || !strings.Contains(string(out), "arg: abc operator") {
+		t.Errorf("unexpected trigger response %d: %s\nwebhook output:\n%s", res.StatusCode, out, b)
+	}
+
+	cli := exec.Command(webhook, "trigger", "-url", fmt.Sprintf("http://%s:%s", ip, port), "-token", "s3cret", "-payload", `{"user_name": "cli"}`, "gitlab")
+	out, err = cli.CombinedOutput()
+	if err != nil || !strings.Contains(string(out), "cli") {
+		t.Errorf("unexpected trigger CLI result (%v): %s", err, out)
+	}
+}
+
+func TestDeduplication(t *testing.T) {
+	hookecho, cleanupHookecho := buildHookecho(t)
+	defer cleanupHookecho()
+
+	webhook, cleanupWebhookFn := buildWebhook(t)
+	defer cleanupWebhookFn()
+
+	configPath, cleanupConfigFn := genConfig(t, hookecho, "test/hooks.yaml.tmpl")
+	defer cleanupConfigFn()
+
+	ip, port := serverAddress(t)
+	cmd, b := startWebhook(t, webhook, fmt.Sprintf("-hooks=%s", configPath), fmt.Sprintf("-ip=%s", ip), fmt.Sprintf("-port=%s", port), "-verbose")
+	defer killAndWait(cmd)
+	waitForServerReady(t, ip, port)
+
+	url := fmt.Sprintf("http://%s:%s/hooks/deduplicate", ip, port)
+	var wg sync.WaitGroup
+	outputs := make([]string, 2)
+	for i := range outputs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			res, err := http.Post(url, "application/json", strings.NewReader(`{"id": "delivery-1"}`))
+			if err != nil {
+				t.Errorf("request failed: %s", err)
+				return
+			}
+			body, _ := io.ReadAll(res.Body)
+			_ = res.Body.Close()
+			outputs[i] = string(body)
+		}(i)
+	}
+	wg.Wait()
+
+	if outputs[0] != "arg: delivery-1 sleep=1s\n" || outputs[0] != outputs[1] {
+		t.Errorf("expected identical responses, got %q and %q", outputs[0], outputs[1])
+	}
+	killAndWait(cmd)
+	if n := strings.Count(b.String(), "executing command"); n != 1 {
+		t.Errorf("expected a single execution, got %d:\n%s", n, b)
+	}
+}
+
+// startWebhook starts the webhook binary with the given arguments and
+// captures its output.
+func startWebhook(t *testing.T, webhook string, args ...string) (*exec.Cmd, *buffer) {
+	b := &buffer{}
+	cmd := exec.Command(webhook, args...)
+	cmd.Stdout = b
+	cmd.Stderr = b
+	cmd.Env = webhookEnv()
+	cmd.Args[0] = "webhook"
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start webhook: %s", err)
+	}
+	return cmd, b
+}
+
 func buildHookecho(t *testing.T) (binPath string, cleanupFn func()) {
 	tmp, err := os.MkdirTemp("", "hookecho-test-")
 	if err != nil {
@@ -1155,6 +1263,169 @@ env: HOOK_head_commit.timestamp=2013-03-12T08:14:29-07:00
 	{"static params should pass", "static-params-ok", nil, "POST", nil, "application/json", `{}`, false, http.StatusOK, "arg: passed\n", `(?s)exec.output="arg: passed`},
 	{"command with space logs warning", "warn-on-space", nil, "POST", nil, "application/json", `{}`, false, http.StatusInternalServerError, "Error occurred while executing the hook's command. Please check logs for more details.", `(?s)WARN.*use 'pass[-]arguments[-]to[-]command' to specify args`},
 	{"unsupported content type error", "github", nil, "POST", map[string]string{"Content-Type": "nonexistent/format"}, "application/json", `{}`, false, http.StatusBadRequest, `Hook rules were not satisfied.`, `(?s)unsupported content type, skip parsing body payload`},
+
+	{"chained hooks", "chain-build", nil, "POST", nil, "application/json", `{}`, false, http.StatusOK, `^arg: stage=build\narg: stage=deploy exit=1\narg: stage=notify\n$`, `(?s)skipping chained hook, it is already part of the chain`},
+	{
+		"multipart repeated fields",
+		"multipart-repeated",
+		nil,
+		"POST",
+		nil,
+		"multipart/form-data; boundary=xxx",
+		`--xxx
+Content-Disposition: form-data; name="tag"
+
+a
+--xxx
+Content-Disposition: form-data; name="tag"
+
+b
+--xxx
+Content-Disposition: form-data; name="single"
+
+c
+--xxx
+Content-Disposition: form-data; name="meta"; filename="first.json"
+Content-Type: application/json
+
+{"name": "first"}
+--xxx
+Content-Disposition: form-data; name="meta"; filename="second.json"
+Content-Type: application/json
+
+{"name": "second"}
+--xxx--`,
+		false,
+		http.StatusOK,
+		`^arg: a b c second\n$`,
+		``,
+	},
+	{
+		"multipart uploaded files",
+		"multipart-upload",
+		nil,
+		"POST",
+		nil,
+		"multipart/form-data; boundary=xxx",
+		`--xxx
+Content-Disposition: form-data; name="artifact"; filename="build.txt"
+Content-Type: text/plain
+
+build output
+--xxx--`,
+		false,
+		http.StatusOK,
+		`^env: HOOK_ARTIFACT=\S+webhook-upload-\d+\.txt HOOK_ARTIFACT_FILENAME=build.txt HOOK_ARTIFACT_CONTENT_TYPE=text/plain HOOK_ARTIFACT_0=\S+webhook-upload-\d+\.txt HOOK_ARTIFACT_0_FILENAME=build.txt HOOK_ARTIFACT_0_CONTENT_TYPE=text/plain HOOK_ARTIFACT_COUNT=1\n$`,
+		``,
+	},
+	{
+		"batch of NDJSON events",
+		"batch",
+		nil,
+		"POST",
+		nil,
+		"application/x-ndjson",
+		`{"name": "a"}
+{"name": "b"}
+`,
+		false,
+		http.StatusOK,
+		`^\{"events":2,"succeeded":2,"failed":0,"results":\[\{"index":0,"status":"success","output":"arg: a\\n"\},\{"index":1,"status":"success","output":"arg: b\\n"\}\]\}$`,
+		``,
+	},
+	{
+		"batch with failing event",
+		"batch-path",
+		nil,
+		"POST",
+		nil,
+		"application/json",
+		`{"events": [{"name": "a", "code": "exit=0"}, {"name": "b", "code": "exit=1"}]}`,
+		false,
+		http.StatusInternalServerError,
+		`^\{"events":2,"succeeded":1,"failed":1,"results":\[\{"index":0,"status":"success"\},\{"index":1,"status":"failure","error":"[^"]+","output":"arg: b exit=1\\n"\}\]\}$`,
+		``,
+	},
+	{
+		"stream body to stdin",
+		"stream-body",
+		nil,
+		"POST",
+		nil,
+		"application/octet-stream",
+		`artifact contents`,
+		false,
+		http.StatusOK,
+		`^arg: stdin\nstdin: artifact contents\n$`,
+		``,
+	},
+	{
+		"stream body exceeding size limit",
+		"stream-body",
+		nil,
+		"POST",
+		nil,
+		"application/octet-stream",
+		`artifact contents which exceed the limit`,
+		false,
+		http.StatusInternalServerError,
+		`^arg: stdin\nstdin: `,
+		``,
+	},
+	{
+		"payload transform",
+		"payload-transform",
+		nil,
+		"POST",
+		map[string]string{"X-Event": "merge"},
+		"application/json",
+		`{"object_attributes": {"ref": "main"}}`,
+		false,
+		http.StatusOK,
+		`^arg: main merge\n$`,
+		``,
+	},
+	{
+		"response file download",
+		"response-file",
+		nil,
+		"POST",
+		nil,
+		"application/json",
+		`{}`,
+		false,
+		http.StatusOK,
+		`^// Hook Echo is a simply utility`,
+		``,
+	},
+	{
+		"response file outside of the working directory",
+		"response-file-outside",
+		nil,
+		"POST",
+		nil,
+		"application/json",
+		`{}`,
+		false,
+		http.StatusInternalServerError,
+		`^Error occurred while sending the hook's file\.$`,
+		``,
+	},
+	{"trigger rule mismatch details", "mismatch-details", nil, "POST", map[string]string{"X-Event": "push", "X-Branch": "develop"}, "application/json", `{}`, false, http.StatusForbidden, `{"message":"Rejected mismatch-details request\.","class":"rules","mismatched_rules":\["regex"\]}`, ``},
+	{"response message template", "response-message-template", nil, "POST", nil, "application/json", `{"repo": "shop", "sha": "abc123"}`, false, http.StatusOK, `queued deploy of shop commit abc123 for response-message-template`, ``},
+	{"json envelope", "json-envelope", nil, "POST", nil, "application/json", `{}`, false, http.StatusOK, `^\{"hook":"json-envelope","request_id":"[^"]+","status":"success","exit_code":0,"output":"arg: \\n"\}$`, ``},
+	{"json envelope", "json-envelope?exit=exit=3", nil, "POST", nil, "application/json", `{}`, false, http.StatusInternalServerError, `^\{"hook":"json-envelope","request_id":"[^"]+","status":"error","exit_code":3,"output":"arg: exit=3\\n"\}$`, ``},
+	{"json envelope async", "json-envelope-async", nil, "POST", nil, "application/json", `{}`, false, http.StatusOK, `^\{"hook":"json-envelope-async","request_id":"[^"]+","status":"success","output":"","message":"queued"\}$`, ``},
+	{"mismatch class missing parameter", "mismatch-classes", nil, "POST", nil, "application/json", `{}`, false, http.StatusBadRequest, `Missing parameters for mismatch-classes.`, ``},
+	{"mismatch class signature", "mismatch-classes", nil, "POST", map[string]string{"X-Event": "push", "X-Signature": "sha256=00"}, "application/json", `{}`, false, http.StatusUnauthorized, `Invalid signature.`, ``},
+	{"mismatch class rules", "mismatch-classes", nil, "POST", map[string]string{"X-Event": "pull"}, "application/json", `{}`, false, http.StatusUnprocessableEntity, `Hook rules were not satisfied.`, ``},
+	{"auth failure invalid signature", "auth-failure", nil, "POST", map[string]string{"X-Signature": "sha256=00"}, "application/json", `{}`, false, http.StatusUnauthorized, `Hook rules were not satisfied.`, ``},
+	{"auth failure missing signature", "auth-failure", nil, "POST", nil, "application/json", `{}`, false, http.StatusUnauthorized, `Hook rules were not satisfied.`, ``},
+	{"head dry run", "json-envelope-async", nil, "HEAD", nil, "application/json", ``, false, http.StatusOK, `^$`, `(?s)skipping execution`},
+	{"head dry run mismatch", "github", nil, "HEAD", nil, "application/json", ``, false, http.StatusBadRequest, `^$`, ``},
+	{"options", "github", nil, "OPTIONS", nil, "application/json", ``, false, http.StatusNoContent, `^$`, ``},
+	{"sandboxed command", "sandboxed", nil, "POST", nil, "application/json", `{}`, false, http.StatusOK, `^arg: confined\n$`, ``},
+	{"pattern id", "repos/example/app/deploy", nil, "POST", nil, "application/json", `{}`, false, http.StatusOK, `^arg: example/app\n$`, ``},
 }
 
 // buffer provides a concurrency-safe bytes.Buffer to tests above.